@@ -4,8 +4,11 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"log"
+	"os"
 	"time"
 
 	"github.com/flusflas/connector-sdk/types"
@@ -14,11 +17,14 @@ import (
 
 func main() {
 
-	var username, password, gateway string
+	var username, password, gateway, selftestFunction string
+	var selftest bool
 
 	flag.StringVar(&username, "username", "admin", "username")
 	flag.StringVar(&password, "password", "", "password")
 	flag.StringVar(&gateway, "gateway", "http://127.0.0.1:8080", "gateway")
+	flag.BoolVar(&selftest, "self-test", false, "run the self-test, print its report and exit")
+	flag.StringVar(&selftestFunction, "self-test-function", "", "health-check function invoked by the self-test")
 
 	flag.Parse()
 
@@ -33,13 +39,39 @@ func main() {
 		PrintResponse:           true,
 		PrintResponseBody:       true,
 		AsyncFunctionInvocation: false,
+		SelftestFunction:        selftestFunction,
+	}
+
+	if err := config.Validate(); err != nil {
+		log.Fatalln(err)
 	}
 
 	controller := types.NewController(creds, config)
 
+	if selftest {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		report := controller.(types.HealthController).Selftest(ctx)
+		cancel()
+
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		_ = encoder.Encode(report)
+		if !report.OK {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	receiver := ResponseReceiver{}
 	controller.Subscribe(&receiver)
 
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	err := controller.(types.LifecycleController).WaitForGateway(ctx)
+	cancel()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
 	controller.BeginMapBuilder()
 
 	// Simulate events emitting from queue/pub-sub
@@ -0,0 +1,86 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// generate returns the formatted source of the constants for the topics and
+// function references of lookups.
+func generate(packageName string, lookups map[string][]string) ([]byte, error) {
+	topics := make([]string, 0, len(lookups))
+	functionSet := make(map[string]bool)
+	for topic, functions := range lookups {
+		topics = append(topics, topic)
+		for _, function := range functions {
+			functionSet[function] = true
+		}
+	}
+	functions := make([]string, 0, len(functionSet))
+	for function := range functionSet {
+		functions = append(functions, function)
+	}
+	sort.Strings(topics)
+	sort.Strings(functions)
+
+	buf := bytes.Buffer{}
+	fmt.Fprintf(&buf, "// Code generated by topicgen. DO NOT EDIT.\n\npackage %s\n\n", packageName)
+
+	buf.WriteString("// Topic is a topic advertised by the functions of the gateway.\ntype Topic string\n\n")
+	buf.WriteString("// FunctionRef is a reference to a function subscribed to a topic.\ntype FunctionRef string\n\n")
+
+	writeConstants(&buf, "Topic", topics)
+	writeConstants(&buf, "FunctionRef", functions)
+
+	return format.Source(buf.Bytes())
+}
+
+func writeConstants(buf *bytes.Buffer, typeName string, values []string) {
+	if len(values) == 0 {
+		return
+	}
+
+	// The values mapping to the same identifier, e.g. "a.b" and "a-b", are
+	// numbered in order.
+	used := make(map[string]bool)
+	buf.WriteString("const (\n")
+	for _, value := range values {
+		base := identifier(value)
+		if len(base) == 0 {
+			// The value has no letter or digit, e.g. "-", and the name
+			// would be the type name.
+			base = "Unnamed"
+		}
+		name := typeName + base
+		for i := 2; used[name]; i++ {
+			name = fmt.Sprintf("%s%s%d", typeName, base, i)
+		}
+		used[name] = true
+		fmt.Fprintf(buf, "\t%s %s = %s\n", name, typeName, strconv.Quote(value))
+	}
+	buf.WriteString(")\n\n")
+}
+
+// identifier turns a topic or function reference into an exported Go
+// identifier, e.g. "payment.received" into "PaymentReceived".
+func identifier(value string) string {
+	words := strings.FieldsFunc(value, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	b := strings.Builder{}
+	for _, word := range words {
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		b.WriteString(string(runes))
+	}
+	return b.String()
+}
@@ -0,0 +1,79 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func Test_generate_ConstantNames(t *testing.T) {
+	cases := []struct {
+		name    string
+		lookups map[string][]string
+		want    map[string]string
+	}{
+		{
+			name:    "words",
+			lookups: map[string][]string{"payment.received": {"billing/charge"}},
+			want: map[string]string{
+				"TopicPaymentReceived":     "payment.received",
+				"FunctionRefBillingCharge": "billing/charge",
+			},
+		},
+		{
+			name:    "no identifier characters",
+			lookups: map[string][]string{"-": {"fn"}, "..": nil},
+			want: map[string]string{
+				"TopicUnnamed":  "-",
+				"TopicUnnamed2": "..",
+				"FunctionRefFn": "fn",
+			},
+		},
+		{
+			name:    "same identifier",
+			lookups: map[string][]string{"a.b": {"a-b.ns", "a.b.ns"}, "a-b": nil, "a.b.2": nil},
+			want: map[string]string{
+				"TopicAB":          "a-b",
+				"TopicAB2":         "a.b",
+				"TopicAB22":        "a.b.2",
+				"FunctionRefABNs":  "a-b.ns",
+				"FunctionRefABNs2": "a.b.ns",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			source, err := generate("topics", c.lookups)
+			if err != nil {
+				t.Fatal(err)
+			}
+			file, err := parser.ParseFile(token.NewFileSet(), "topics_gen.go", source, 0)
+			if err != nil {
+				t.Fatalf("Generated source - want valid Go, got: %s\n%s", err, source)
+			}
+
+			got := map[string]string{}
+			for _, decl := range file.Decls {
+				gen, ok := decl.(*ast.GenDecl)
+				if !ok || gen.Tok != token.CONST {
+					continue
+				}
+				for _, spec := range gen.Specs {
+					value := spec.(*ast.ValueSpec)
+					literal, _ := strconv.Unquote(value.Values[0].(*ast.BasicLit).Value)
+					got[value.Names[0].Name] = literal
+				}
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("Constants - want: %v, got: %v", c.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+// Command topicgen queries an OpenFaaS gateway and writes a Go file with
+// typed constants for the topics advertised by the functions and for the
+// function references subscribed to them, so connector code gets
+// compile-time safety against typos. Use it with go:generate:
+//
+//	//go:generate go run github.com/flusflas/connector-sdk/cmd/topicgen -gateway http://127.0.0.1:8080 -package topics -output topics_gen.go
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/flusflas/connector-sdk/types"
+	"github.com/openfaas/faas-provider/auth"
+)
+
+func main() {
+
+	var username, password, token, gateway, namespace, delimiter, delimiterPattern, packageName, output string
+
+	flag.StringVar(&username, "username", "admin", "username")
+	flag.StringVar(&password, "password", "", "password")
+	flag.StringVar(&token, "token", "", "bearer token, e.g. an OpenFaaS IAM token, used in place of the password")
+	flag.StringVar(&gateway, "gateway", "http://127.0.0.1:8080", "gateway")
+	flag.StringVar(&namespace, "namespace", "", "namespace of the functions, all namespaces if empty")
+	flag.StringVar(&delimiter, "delimiter", ",", "delimiter of the topics in the topic annotation")
+	flag.StringVar(&delimiterPattern, "delimiter-pattern", "", "regular expression splitting the topic annotation, in place of -delimiter")
+	flag.StringVar(&packageName, "package", "topics", "package of the generated file")
+	flag.StringVar(&output, "output", "", "generated file, stdout if empty")
+
+	flag.Parse()
+
+	var clientAuth types.ClientAuth
+	if len(token) > 0 {
+		clientAuth = types.NewTokenAuth(token)
+	} else if len(password) > 0 {
+		clientAuth = types.BasicAuth(&auth.BasicAuthCredentials{
+			User:     username,
+			Password: password,
+		})
+	}
+
+	var pattern *regexp.Regexp
+	if len(delimiterPattern) > 0 {
+		var err error
+		if pattern, err = regexp.Compile(delimiterPattern); err != nil {
+			log.Fatalf("invalid delimiter pattern: %s", err)
+		}
+	}
+
+	builder := types.FunctionLookupBuilder{
+		GatewayURL:            gateway,
+		Client:                types.MakeClient(30 * time.Second),
+		Auth:                  clientAuth,
+		TopicDelimiter:        delimiter,
+		TopicDelimiterPattern: pattern,
+		Namespace:             namespace,
+	}
+
+	lookups, err := builder.Build()
+	if err != nil {
+		log.Fatalf("unable to query the gateway: %s", err)
+	}
+
+	source, err := generate(packageName, lookups)
+	if err != nil {
+		log.Fatalf("unable to generate the constants: %s", err)
+	}
+
+	if len(output) == 0 {
+		_, _ = os.Stdout.Write(source)
+		return
+	}
+
+	if err := ioutil.WriteFile(output, source, 0644); err != nil {
+		log.Fatalf("unable to write %s: %s", output, err)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package connectortest
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/flusflas/connector-sdk/types"
+)
+
+func Test_Gateway_WithController(t *testing.T) {
+	gateway := NewGateway()
+	defer gateway.Close()
+
+	gateway.AddFunction("", "echo", map[string]string{"topic": "orders"})
+	gateway.AddFunction("staging", "audit", map[string]string{"topic": "orders"})
+	gateway.Handle("echo", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("echoed"))
+	})
+
+	controller := types.NewController(nil, &types.ControllerConfig{
+		GatewayURL:      gateway.URL,
+		RebuildInterval: time.Hour,
+		Logger:          types.NewStdLogger(types.LevelError),
+	})
+	defer controller.(types.LifecycleController).Close()
+
+	recorder := &ResponseRecorder{}
+	controller.Subscribe(recorder)
+	topicMap := controller.(types.TopicMapController)
+	topicMap.StartMapBuilder()
+	if err := topicMap.RefreshTopicMap(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	controller.Invoke("orders", &[]byte{'1'})
+
+	invocations := gateway.WaitForInvocations(2, time.Second)
+	if len(invocations) != 2 {
+		t.Fatalf("Invocations - want: 2, got: %d", len(invocations))
+	}
+	for _, invocation := range invocations {
+		if string(invocation.Body) != "1" {
+			t.Errorf("Body - want: %q, got: %q", "1", invocation.Body)
+		}
+	}
+
+	responses := recorder.Wait(2, time.Second)
+	if len(responses) != 2 {
+		t.Fatalf("Responses - want: 2, got: %d", len(responses))
+	}
+	for _, res := range responses {
+		if res.Function == "echo.openfaas-fn" && string(*res.Body) != "echoed" {
+			t.Errorf("Body - want: %q, got: %q", "echoed", *res.Body)
+		}
+	}
+}
+
+func Test_Gateway_MissingFunction(t *testing.T) {
+	gateway := NewGateway()
+	defer gateway.Close()
+
+	res, err := http.Post(gateway.URL+"/function/missing.openfaas-fn", "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("Status - want: %d, got: %d", http.StatusNotFound, res.StatusCode)
+	}
+	if invocations := gateway.Invocations(); len(invocations) != 1 || invocations[0].Function != "missing" {
+		t.Errorf("Invocations - want the call captured, got: %v", invocations)
+	}
+}
+
+func Test_Controller_RecordsCalls(t *testing.T) {
+	controller := NewController(map[string][]string{"orders": {"echo", "audit"}})
+	recorder := &ResponseRecorder{}
+	controller.Subscribe(recorder)
+
+	responses := controller.InvokeWithResults(context.Background(), "orders", &types.Message{Body: []byte("1")})
+	if len(responses) != 2 || len(recorder.Responses()) != 2 {
+		t.Errorf("Responses - want 2 returned and delivered, got: %d %d", len(responses), len(recorder.Responses()))
+	}
+	if calls := controller.Calls(); len(calls) != 1 || calls[0].Topic != "orders" || string(calls[0].Message.Body) != "1" {
+		t.Errorf("Calls - want the message recorded, got: %v", calls)
+	}
+
+	controller.Pause()
+	responses = controller.InvokeWithResults(context.Background(), "orders", &types.Message{})
+	if len(responses) != 1 || responses[0].Error != types.ErrPaused {
+		t.Errorf("Responses - want ErrPaused, got: %v", responses)
+	}
+}
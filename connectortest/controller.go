@@ -0,0 +1,353 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package connectortest
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/flusflas/connector-sdk/types"
+)
+
+// Call is a message received by the fake Controller.
+type Call struct {
+	// Topic of the message, empty for InvokeFunction.
+	Topic string
+
+	// Tenant given to InvokeForTenant.
+	Tenant string
+
+	// Function given to InvokeFunction.
+	Function string
+
+	// Header given to InvokeFunction.
+	Header http.Header
+
+	// Message received, with the body of InvokeReader read into Body.
+	Message *types.Message
+}
+
+// Controller is a fake types.Controller for the unit tests of a connector.
+// It records the messages instead of invoking functions, and answers them
+// with the responses of Respond, delivered to the subscribers like a real
+// controller. It implements the optional MessageController,
+// TenantController, TopicMapController and LifecycleController interfaces
+// too. It is safe for concurrent use.
+type Controller struct {
+	// TopicMap maps the topics to the functions subscribed to them, reported
+	// by Topics and TopicMapSnapshot and answered by the default Respond.
+	TopicMap map[string][]string
+
+	// Respond answers a message on topic, or an InvokeFunction call when
+	// topic is empty. Defaults to a 200 response with an empty body for each
+	// function of the topic in TopicMap.
+	Respond func(ctx context.Context, topic string, call Call) []types.InvokerResponse
+
+	lock        sync.Mutex
+	calls       []Call
+	subscribers []types.ResponseSubscriber
+	filters     []types.MessageFilter
+	paused      bool
+	stopped     bool
+	rate        float64
+	burst       int
+}
+
+// NewController creates a fake controller with the topics of topicMap.
+func NewController(topicMap map[string][]string) *Controller {
+	return &Controller{TopicMap: topicMap}
+}
+
+// Calls returns the messages received so far, in order.
+func (c *Controller) Calls() []Call {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return append([]Call(nil), c.calls...)
+}
+
+// Subscribe adds a subscriber receiving the responses.
+func (c *Controller) Subscribe(subscriber types.ResponseSubscriber) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.subscribers = append(c.subscribers, subscriber)
+}
+
+// Unsubscribe removes a subscriber added with Subscribe.
+func (c *Controller) Unsubscribe(subscriber types.ResponseSubscriber) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for n, sub := range c.subscribers {
+		if sub == subscriber {
+			c.subscribers = append(c.subscribers[:n:n], c.subscribers[n+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// AddFilter adds a filter evaluated for each message before it is recorded.
+func (c *Controller) AddFilter(filter types.MessageFilter) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.filters = append(c.filters, filter)
+}
+
+func (c *Controller) Invoke(topic string, message *[]byte) {
+	c.InvokeMessage(context.Background(), topic, &types.Message{Body: *message})
+}
+
+func (c *Controller) InvokeWithContext(ctx context.Context, topic string, message *[]byte) {
+	c.InvokeMessage(ctx, topic, &types.Message{Body: *message})
+}
+
+func (c *Controller) InvokeMessage(ctx context.Context, topic string, message *types.Message) {
+	c.InvokeWithResults(ctx, topic, message)
+}
+
+func (c *Controller) InvokeReader(ctx context.Context, topic string, body io.Reader) {
+	message := &types.Message{}
+	message.Body, _ = ioutil.ReadAll(body)
+	c.InvokeMessage(ctx, topic, message)
+}
+
+func (c *Controller) InvokeWithResults(ctx context.Context, topic string, message *types.Message) []types.InvokerResponse {
+	return c.call(ctx, topic, Call{Topic: topic, Message: message})
+}
+
+func (c *Controller) InvokeAggregated(ctx context.Context, topic string, message *types.Message) types.AggregatedResponse {
+	return types.AggregateResponses(topic, c.InvokeWithResults(ctx, topic, message))
+}
+
+func (c *Controller) InvokeForTenant(ctx context.Context, tenant, topic string, message *types.Message) []types.InvokerResponse {
+	return c.call(ctx, topic, Call{Topic: topic, Tenant: tenant, Message: message})
+}
+
+// TenantErrors returns nil, the fake controller has no tenant topic maps.
+func (c *Controller) TenantErrors() map[string]error {
+	return nil
+}
+
+func (c *Controller) InvokeFunction(ctx context.Context, function string, message *types.Message, headers http.Header, opts ...types.InvokeOption) types.InvokerResponse {
+	responses := c.call(ctx, "", Call{Function: function, Header: headers, Message: message})
+	if len(responses) == 0 {
+		return types.InvokerResponse{Context: ctx, Function: function}
+	}
+	return responses[0]
+}
+
+// call records a message and delivers its responses to the subscribers,
+// unless the controller is stopped or paused or a filter rejects it.
+func (c *Controller) call(ctx context.Context, topic string, call Call) []types.InvokerResponse {
+	c.lock.Lock()
+	var err error
+	switch {
+	case c.stopped:
+		err = types.ErrControllerStopped
+	case c.paused:
+		err = types.ErrPaused
+	}
+	filters := c.filters
+	c.lock.Unlock()
+
+	if err != nil {
+		return c.publish([]types.InvokerResponse{{Context: ctx, Error: err, Topic: topic, Tenant: call.Tenant}})
+	}
+
+	if call.Message != nil {
+		for _, filter := range filters {
+			allow, err := filter(topic, call.Message)
+			if err != nil {
+				return c.publish([]types.InvokerResponse{{Context: ctx, Error: err, Topic: topic, Tenant: call.Tenant}})
+			}
+			if !allow {
+				return nil
+			}
+		}
+	}
+
+	c.lock.Lock()
+	c.calls = append(c.calls, call)
+	c.lock.Unlock()
+
+	var responses []types.InvokerResponse
+	if c.Respond != nil {
+		responses = c.Respond(ctx, topic, call)
+	} else {
+		responses = c.respond(ctx, topic, call)
+	}
+	return c.publish(responses)
+}
+
+// respond answers a call with a 200 response for each of its functions.
+func (c *Controller) respond(ctx context.Context, topic string, call Call) []types.InvokerResponse {
+	functions := []string{call.Function}
+	if len(topic) > 0 {
+		functions = c.TopicMapSnapshot()[topic]
+	}
+
+	responses := make([]types.InvokerResponse, 0, len(functions))
+	for _, function := range functions {
+		body := []byte{}
+		responses = append(responses, types.InvokerResponse{
+			Context:  ctx,
+			Body:     &body,
+			Header:   &http.Header{},
+			Status:   http.StatusOK,
+			Topic:    topic,
+			Function: function,
+			Tenant:   call.Tenant,
+		})
+	}
+	return responses
+}
+
+func (c *Controller) publish(responses []types.InvokerResponse) []types.InvokerResponse {
+	c.lock.Lock()
+	subscribers := append([]types.ResponseSubscriber(nil), c.subscribers...)
+	c.lock.Unlock()
+
+	for _, res := range responses {
+		for _, subscriber := range subscribers {
+			subscriber.Response(res)
+		}
+	}
+	return responses
+}
+
+// WaitForGateway returns immediately, there is no gateway.
+func (c *Controller) WaitForGateway(ctx context.Context) error {
+	return nil
+}
+
+// BeginMapBuilder does nothing, the topic map is TopicMap.
+func (c *Controller) BeginMapBuilder() {}
+
+// StartMapBuilder returns a MapBuilder reporting a successful sync.
+func (c *Controller) StartMapBuilder() types.MapBuilder {
+	return &mapBuilder{synced: time.Now(), done: make(chan struct{})}
+}
+
+func (c *Controller) Topics() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	topics := make([]string, 0, len(c.TopicMap))
+	for topic := range c.TopicMap {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+func (c *Controller) TopicMapSnapshot() map[string][]string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	snapshot := make(map[string][]string, len(c.TopicMap))
+	for topic, functions := range c.TopicMap {
+		snapshot[topic] = append([]string(nil), functions...)
+	}
+	return snapshot
+}
+
+func (c *Controller) RefreshTopicMap(ctx context.Context) error {
+	if c.Stopped() {
+		return types.ErrControllerStopped
+	}
+	return nil
+}
+
+func (c *Controller) Pause() {
+	c.lock.Lock()
+	c.paused = true
+	c.lock.Unlock()
+}
+
+func (c *Controller) Resume() {
+	c.lock.Lock()
+	c.paused = false
+	c.lock.Unlock()
+}
+
+func (c *Controller) Paused() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.paused
+}
+
+func (c *Controller) SetRateLimit(rate float64, burst int) {
+	c.lock.Lock()
+	c.rate, c.burst = rate, burst
+	c.lock.Unlock()
+}
+
+func (c *Controller) RateLimit() (float64, int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.rate, c.burst
+}
+
+// Stop rejects the next messages with ErrControllerStopped.
+func (c *Controller) Stop(ctx context.Context) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.stopped {
+		return types.ErrControllerStopped
+	}
+	c.stopped = true
+	return nil
+}
+
+func (c *Controller) Close() error {
+	return c.Stop(context.Background())
+}
+
+// Stopped returns true once Stop or Close has been called.
+func (c *Controller) Stopped() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.stopped
+}
+
+// mapBuilder is the MapBuilder of the fake Controller.
+type mapBuilder struct {
+	synced time.Time
+	once   sync.Once
+	done   chan struct{}
+}
+
+func (b *mapBuilder) Stop() {
+	b.once.Do(func() {
+		close(b.done)
+	})
+}
+
+func (b *mapBuilder) LastSync() (time.Time, error) {
+	return b.synced, nil
+}
+
+func (b *mapBuilder) Done() <-chan struct{} {
+	return b.done
+}
+
+var (
+	_ types.Controller          = &Controller{}
+	_ types.MessageController   = &Controller{}
+	_ types.TenantController    = &Controller{}
+	_ types.TopicMapController  = &Controller{}
+	_ types.LifecycleController = &Controller{}
+)
@@ -0,0 +1,21 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+// Package connectortest provides fakes to unit test connectors built with the
+// connector-sdk without an OpenFaaS gateway:
+//
+//   - Gateway is an HTTP server listing namespaces and functions annotated with
+//     topics, and capturing the invocations sent by a real controller.
+//   - Controller is a types.Controller recording the messages of a connector,
+//     which answers them with canned responses.
+//   - ResponseRecorder is a types.ResponseSubscriber recording the responses.
+//
+// A connector can then be tested against a real controller:
+//
+//	gateway := connectortest.NewGateway()
+//	defer gateway.Close()
+//	gateway.AddFunction("openfaas-fn", "echo", map[string]string{"topic": "orders"})
+//
+//	controller := types.NewController(nil, &types.ControllerConfig{GatewayURL: gateway.URL})
+//	controller.(types.TopicMapController).RefreshTopicMap(ctx)
+package connectortest
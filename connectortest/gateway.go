@@ -0,0 +1,263 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package connectortest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	ptypes "github.com/openfaas/faas-provider/types"
+)
+
+// DefaultNamespace is the namespace of the functions listed and invoked
+// without a namespace, like on a real gateway.
+const DefaultNamespace = "openfaas-fn"
+
+// Invocation is a function invocation received by the Gateway.
+type Invocation struct {
+	// Function and Namespace of the invoked function.
+	Function  string
+	Namespace string
+
+	// Async is true for the invocations made through /async-function.
+	Async bool
+
+	Method string
+	Header http.Header
+	Body   []byte
+	Time   time.Time
+}
+
+// Gateway is a fake OpenFaaS gateway serving the namespaces and functions
+// added to it, and capturing the invocations of the functions. It is safe
+// for concurrent use.
+type Gateway struct {
+	// URL of the gateway, to set as the GatewayURL of a controller.
+	URL string
+
+	server *httptest.Server
+
+	lock        sync.Mutex
+	functions   map[string][]ptypes.FunctionStatus
+	handlers    map[string]http.HandlerFunc
+	invocations []Invocation
+	invoked     chan struct{}
+}
+
+// NewGateway starts a fake gateway, which must be closed with Close.
+func NewGateway() *Gateway {
+	g := &Gateway{
+		functions: map[string][]ptypes.FunctionStatus{},
+		handlers:  map[string]http.HandlerFunc{},
+		invoked:   make(chan struct{}),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/system/info", g.info)
+	mux.HandleFunc("/system/namespaces", g.namespaces)
+	mux.HandleFunc("/system/functions", g.list)
+	mux.HandleFunc("/function/", g.invoke)
+	mux.HandleFunc("/async-function/", g.invoke)
+
+	g.server = httptest.NewServer(mux)
+	g.URL = g.server.URL
+	return g
+}
+
+// Close shuts the gateway down.
+func (g *Gateway) Close() {
+	g.server.Close()
+}
+
+// AddFunction deploys a function to namespace, DefaultNamespace if empty,
+// with its annotations, e.g. {"topic": "orders"}. The function answers its
+// invocations with 200 and an empty body, unless a handler is set with
+// Handle.
+func (g *Gateway) AddFunction(namespace, name string, annotations map[string]string) {
+	if len(namespace) == 0 {
+		namespace = DefaultNamespace
+	}
+
+	copied := make(map[string]string, len(annotations))
+	for key, value := range annotations {
+		copied[key] = value
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	functions := g.functions[namespace]
+	for n, function := range functions {
+		if function.Name == name {
+			functions = append(functions[:n], functions[n+1:]...)
+			break
+		}
+	}
+	g.functions[namespace] = append(functions, ptypes.FunctionStatus{
+		Name:        name,
+		Namespace:   namespace,
+		Annotations: &copied,
+	})
+}
+
+// RemoveFunction removes a function added with AddFunction.
+func (g *Gateway) RemoveFunction(namespace, name string) {
+	if len(namespace) == 0 {
+		namespace = DefaultNamespace
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	functions := g.functions[namespace]
+	for n, function := range functions {
+		if function.Name == name {
+			g.functions[namespace] = append(functions[:n], functions[n+1:]...)
+			return
+		}
+	}
+}
+
+// Handle sets the handler answering the invocations of function, given as
+// "name" or "name.namespace".
+func (g *Gateway) Handle(function string, handler http.HandlerFunc) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	g.handlers[qualify(function)] = handler
+}
+
+// Invocations returns the invocations received so far, in order.
+func (g *Gateway) Invocations() []Invocation {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	return append([]Invocation(nil), g.invocations...)
+}
+
+// WaitForInvocations waits until n invocations have been received or the
+// timeout has elapsed, and returns the invocations received.
+func (g *Gateway) WaitForInvocations(n int, timeout time.Duration) []Invocation {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		g.lock.Lock()
+		invocations := append([]Invocation(nil), g.invocations...)
+		invoked := g.invoked
+		g.lock.Unlock()
+
+		if len(invocations) >= n {
+			return invocations
+		}
+
+		select {
+		case <-invoked:
+		case <-deadline.C:
+			return invocations
+		}
+	}
+}
+
+// Reset forgets the invocations received so far.
+func (g *Gateway) Reset() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	g.invocations = nil
+}
+
+func (g *Gateway) info(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"provider":{"provider":"connectortest"},"version":{"release":"dev"}}`))
+}
+
+func (g *Gateway) namespaces(w http.ResponseWriter, r *http.Request) {
+	g.lock.Lock()
+	namespaces := []string{}
+	for namespace := range g.functions {
+		namespaces = append(namespaces, namespace)
+	}
+	g.lock.Unlock()
+
+	sort.Strings(namespaces)
+	writeJSON(w, namespaces)
+}
+
+func (g *Gateway) list(w http.ResponseWriter, r *http.Request) {
+	namespace := r.URL.Query().Get("namespace")
+	if len(namespace) == 0 {
+		namespace = DefaultNamespace
+	}
+
+	g.lock.Lock()
+	functions := append([]ptypes.FunctionStatus{}, g.functions[namespace]...)
+	g.lock.Unlock()
+
+	writeJSON(w, functions)
+}
+
+func (g *Gateway) invoke(w http.ResponseWriter, r *http.Request) {
+	async := strings.HasPrefix(r.URL.Path, "/async-function/")
+	function := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/async-function/"), "/function/")
+	function = qualify(strings.SplitN(function, "/", 2)[0])
+	name, namespace := splitRef(function)
+
+	body, _ := ioutil.ReadAll(r.Body)
+
+	g.lock.Lock()
+	deployed := false
+	for _, status := range g.functions[namespace] {
+		deployed = deployed || status.Name == name
+	}
+	handler := g.handlers[function]
+	g.invocations = append(g.invocations, Invocation{
+		Function:  name,
+		Namespace: namespace,
+		Async:     async,
+		Method:    r.Method,
+		Header:    r.Header.Clone(),
+		Body:      body,
+		Time:      time.Now(),
+	})
+	close(g.invoked)
+	g.invoked = make(chan struct{})
+	g.lock.Unlock()
+
+	switch {
+	case !deployed:
+		http.Error(w, "function not found: "+function, http.StatusNotFound)
+	case async:
+		w.WriteHeader(http.StatusAccepted)
+	case handler != nil:
+		r.Body = ioutil.NopCloser(strings.NewReader(string(body)))
+		handler(w, r)
+	}
+}
+
+// qualify adds DefaultNamespace to a function reference without namespace.
+func qualify(function string) string {
+	if !strings.Contains(function, ".") {
+		return function + "." + DefaultNamespace
+	}
+	return function
+}
+
+// splitRef splits a qualified function reference into its name and
+// namespace.
+func splitRef(function string) (string, string) {
+	n := strings.LastIndex(function, ".")
+	return function[:n], function[n+1:]
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
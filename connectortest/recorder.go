@@ -0,0 +1,79 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package connectortest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/flusflas/connector-sdk/types"
+)
+
+// ResponseRecorder is a types.ResponseSubscriber recording the responses it
+// receives. The zero value is ready to use, and it is safe for concurrent
+// use.
+type ResponseRecorder struct {
+	lock      sync.Mutex
+	responses []types.InvokerResponse
+
+	// received is closed by the next response
+	received chan struct{}
+}
+
+// Response records res.
+func (r *ResponseRecorder) Response(res types.InvokerResponse) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.responses = append(r.responses, res)
+	if r.received != nil {
+		close(r.received)
+	}
+	r.received = make(chan struct{})
+}
+
+// Responses returns the responses received so far, in order.
+func (r *ResponseRecorder) Responses() []types.InvokerResponse {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return append([]types.InvokerResponse(nil), r.responses...)
+}
+
+// Wait waits until n responses have been received or the timeout has
+// elapsed, and returns the responses received.
+func (r *ResponseRecorder) Wait(n int, timeout time.Duration) []types.InvokerResponse {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		r.lock.Lock()
+		responses := append([]types.InvokerResponse(nil), r.responses...)
+		if r.received == nil {
+			r.received = make(chan struct{})
+		}
+		received := r.received
+		r.lock.Unlock()
+
+		if len(responses) >= n {
+			return responses
+		}
+
+		select {
+		case <-received:
+		case <-deadline.C:
+			return responses
+		}
+	}
+}
+
+// Reset forgets the responses received so far.
+func (r *ResponseRecorder) Reset() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.responses = nil
+}
+
+var _ types.ResponseSubscriber = &ResponseRecorder{}
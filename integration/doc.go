@@ -0,0 +1,13 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+// Package integration validates the connector-sdk end-to-end against a real
+// OpenFaaS gateway, such as faasd or OpenFaaS on Kubernetes. Its helpers deploy
+// ephemeral functions, annotate them with topics, wait for the controller to
+// map them and invoke them through the controller.
+//
+// The package is built with the integration tag only, and the tests are
+// skipped unless OPENFAAS_URL is set:
+//
+//	OPENFAAS_URL=http://127.0.0.1:8080 OPENFAAS_PASSWORD=... make integration
+package integration
@@ -0,0 +1,327 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/flusflas/connector-sdk/types"
+	"github.com/openfaas/faas-provider/auth"
+	ptypes "github.com/openfaas/faas-provider/types"
+)
+
+const (
+	// defaultImage echoes the request body back with the cat fprocess.
+	defaultImage = "ghcr.io/openfaas/alpine:latest"
+
+	// functionPrefix names the ephemeral functions, so that the leftovers of
+	// an interrupted run can be found and removed.
+	functionPrefix = "connector-it-"
+
+	pollInterval = 500 * time.Millisecond
+)
+
+var functionCounter int64
+
+// deleteFunctionRequest is the body of DELETE /system/functions.
+type deleteFunctionRequest struct {
+	FunctionName string `json:"functionName"`
+	Namespace    string `json:"namespace,omitempty"`
+}
+
+// Harness deploys ephemeral functions on a real gateway and creates
+// controllers bound to it. Call Cleanup when done to remove the deployed
+// functions.
+type Harness struct {
+	// GatewayURL is the URL of the gateway, read from OPENFAAS_URL.
+	GatewayURL string
+
+	// Credentials authenticate against the gateway, read from
+	// OPENFAAS_USERNAME (defaults to admin) and OPENFAAS_PASSWORD.
+	Credentials *auth.BasicAuthCredentials
+
+	// Namespace the functions are deployed into, read from
+	// OPENFAAS_NAMESPACE. Empty means the default namespace of the gateway.
+	Namespace string
+
+	// Image of the deployed functions, read from INTEGRATION_FUNCTION_IMAGE.
+	// It must echo the request body with the fprocess set in EnvProcess.
+	Image string
+
+	// EnvProcess is the fprocess of the deployed functions. Defaults to cat.
+	EnvProcess string
+
+	// Client sends the requests to the gateway.
+	Client *http.Client
+
+	lock     sync.Mutex
+	deployed []string
+}
+
+// NewHarness creates a harness from the environment, and skips the test if
+// OPENFAAS_URL is not set.
+func NewHarness(t testing.TB) *Harness {
+	gatewayURL := os.Getenv("OPENFAAS_URL")
+	if len(gatewayURL) == 0 {
+		t.Skip("OPENFAAS_URL is not set")
+	}
+
+	username := os.Getenv("OPENFAAS_USERNAME")
+	if len(username) == 0 {
+		username = "admin"
+	}
+	image := os.Getenv("INTEGRATION_FUNCTION_IMAGE")
+	if len(image) == 0 {
+		image = defaultImage
+	}
+
+	return &Harness{
+		GatewayURL: gatewayURL,
+		Credentials: &auth.BasicAuthCredentials{
+			User:     username,
+			Password: os.Getenv("OPENFAAS_PASSWORD"),
+		},
+		Namespace:  os.Getenv("OPENFAAS_NAMESPACE"),
+		Image:      image,
+		EnvProcess: "cat",
+		Client:     &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// FunctionName returns a unique name for an ephemeral function.
+func FunctionName() string {
+	n := atomic.AddInt64(&functionCounter, 1)
+	return functionPrefix + strconv.FormatInt(time.Now().UnixNano(), 36) + "-" + strconv.FormatInt(n, 10)
+}
+
+// Deploy deploys the function name with annotations, such as the "topic"
+// annotation mapping it to its topics, and waits until it is ready. The
+// function is removed by Cleanup.
+func (h *Harness) Deploy(ctx context.Context, name string, annotations map[string]string) error {
+	h.lock.Lock()
+	h.deployed = append(h.deployed, name)
+	h.lock.Unlock()
+
+	if err := h.apply(ctx, http.MethodPost, name, annotations); err != nil {
+		return err
+	}
+	return h.WaitReady(ctx, name)
+}
+
+// DeployWithTopic deploys an ephemeral function mapped to topic and returns
+// its name.
+func (h *Harness) DeployWithTopic(ctx context.Context, topic string) (string, error) {
+	name := FunctionName()
+	return name, h.Deploy(ctx, name, map[string]string{"topic": topic})
+}
+
+// Annotate replaces the annotations of a deployed function and waits until
+// it is ready again.
+func (h *Harness) Annotate(ctx context.Context, name string, annotations map[string]string) error {
+	if err := h.apply(ctx, http.MethodPut, name, annotations); err != nil {
+		return err
+	}
+	return h.WaitReady(ctx, name)
+}
+
+// apply creates (POST) or updates (PUT) the function name.
+func (h *Harness) apply(ctx context.Context, method, name string, annotations map[string]string) error {
+	deployment := ptypes.FunctionDeployment{
+		Service:     name,
+		Image:       h.Image,
+		Namespace:   h.Namespace,
+		EnvProcess:  h.EnvProcess,
+		Annotations: &annotations,
+	}
+	body, err := json.Marshal(deployment)
+	if err != nil {
+		return err
+	}
+
+	if _, err := h.do(ctx, method, "/system/functions", bytes.NewReader(body)); err != nil {
+		return fmt.Errorf("unable to deploy %s: %s", name, err)
+	}
+	return nil
+}
+
+// WaitReady waits until the function name has an available replica.
+func (h *Harness) WaitReady(ctx context.Context, name string) error {
+	path := "/system/function/" + name
+	if len(h.Namespace) > 0 {
+		path += "?namespace=" + url.QueryEscape(h.Namespace)
+	}
+
+	return poll(ctx, func() (bool, error) {
+		res, err := h.do(ctx, http.MethodGet, path, nil)
+		if err != nil {
+			// The function may not be listed yet right after the deployment.
+			return false, nil
+		}
+
+		status := ptypes.FunctionStatus{}
+		if err := json.Unmarshal(res, &status); err != nil {
+			return false, err
+		}
+		return status.AvailableReplicas > 0, nil
+	})
+}
+
+// Remove deletes the function name.
+func (h *Harness) Remove(ctx context.Context, name string) error {
+	body, err := json.Marshal(deleteFunctionRequest{FunctionName: name, Namespace: h.Namespace})
+	if err != nil {
+		return err
+	}
+	if _, err := h.do(ctx, http.MethodDelete, "/system/functions", bytes.NewReader(body)); err != nil {
+		return fmt.Errorf("unable to remove %s: %s", name, err)
+	}
+	return nil
+}
+
+// Cleanup removes the functions deployed by the harness, reporting the
+// failures to t.
+func (h *Harness) Cleanup(t testing.TB) {
+	h.lock.Lock()
+	deployed := h.deployed
+	h.deployed = nil
+	h.lock.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	for _, name := range deployed {
+		if err := h.Remove(ctx, name); err != nil {
+			t.Errorf("%s", err)
+		}
+	}
+}
+
+// NewController creates a controller bound to the gateway of the harness,
+// with a short RebuildInterval, and starts its map builder. config may be nil
+// and is completed with the gateway and namespace of the harness. The
+// controller is stopped when ctx is done.
+func (h *Harness) NewController(ctx context.Context, config *types.ControllerConfig) types.Controller {
+	if config == nil {
+		config = &types.ControllerConfig{}
+	}
+	config.GatewayURL = h.GatewayURL
+	if len(config.Namespace) == 0 {
+		config.Namespace = h.Namespace
+	}
+	if config.RebuildInterval <= 0 {
+		config.RebuildInterval = time.Second
+	}
+	if config.UpstreamTimeout <= 0 {
+		config.UpstreamTimeout = 30 * time.Second
+	}
+
+	controller := types.NewControllerWithContext(ctx, h.Credentials, config)
+	controller.BeginMapBuilder()
+	return controller
+}
+
+// WaitForTopic waits until the topic map of controller contains topic, that
+// is until a function annotated with it has been synchronized.
+func WaitForTopic(ctx context.Context, controller types.Controller, topic string) error {
+	err := poll(ctx, func() (bool, error) {
+		for _, mapped := range controller.Topics() {
+			if mapped == topic {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return fmt.Errorf("topic %s not synchronized: %s", topic, err)
+	}
+	return nil
+}
+
+// Invoke invokes the functions of topic with body through controller and
+// fails t unless exactly want functions answered with 200 and echoed body.
+func Invoke(ctx context.Context, t testing.TB, controller types.Controller, topic string, body []byte, want int) []types.InvokerResponse {
+	messages, ok := controller.(types.MessageController)
+	if !ok {
+		t.Fatalf("the controller doesn't implement types.MessageController")
+	}
+
+	responses := messages.InvokeWithResults(ctx, topic, &types.Message{Body: body})
+	if len(responses) != want {
+		t.Fatalf("topic %s: want %d responses, got %d", topic, want, len(responses))
+	}
+
+	for _, res := range responses {
+		if res.Error != nil {
+			t.Fatalf("%s: %s", res.Function, res.Error)
+		}
+		if res.Status != http.StatusOK {
+			t.Fatalf("%s: want status %d, got %d", res.Function, http.StatusOK, res.Status)
+		}
+		if res.Body == nil || !bytes.Equal(*res.Body, body) {
+			t.Fatalf("%s: want body %q, got %v", res.Function, body, res.Body)
+		}
+	}
+	return responses
+}
+
+// do sends a request to the API of the gateway and returns the body of a
+// 2xx response.
+func (h *Harness) do(ctx context.Context, method, path string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequest(method, h.GatewayURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if h.Credentials != nil {
+		req.SetBasicAuth(h.Credentials.User, h.Credentials.Password)
+	}
+
+	res, err := h.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	resBody, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, fmt.Errorf("%s %s: unexpected status %d: %s", method, path, res.StatusCode, bytes.TrimSpace(resBody))
+	}
+	return resBody, nil
+}
+
+// poll calls done until it returns true or an error, or ctx is done.
+func poll(ctx context.Context, done func() (bool, error)) error {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		ok, err := done()
+		if err != nil || ok {
+			return err
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testTimeout = 3 * time.Minute
+
+func Test_Integration_InvokeTopic(t *testing.T) {
+	h := NewHarness(t)
+	defer h.Cleanup(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	topic := FunctionName() + ".invoke"
+	name, err := h.DeployWithTopic(ctx, topic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	controller := h.NewController(ctx, nil)
+	if err := WaitForTopic(ctx, controller, topic); err != nil {
+		t.Fatal(err)
+	}
+
+	responses := Invoke(ctx, t, controller, topic, []byte("hello"), 1)
+	if !strings.HasPrefix(responses[0].Function, name) {
+		t.Fatalf("want function %s, got %s", name, responses[0].Function)
+	}
+}
+
+func Test_Integration_FanOut(t *testing.T) {
+	h := NewHarness(t)
+	defer h.Cleanup(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	topic := FunctionName() + ".fan-out"
+	for i := 0; i < 2; i++ {
+		if _, err := h.DeployWithTopic(ctx, topic); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Both functions are ready before the controller is created, so the first
+	// synchronization maps them together.
+	controller := h.NewController(ctx, nil)
+	if err := WaitForTopic(ctx, controller, topic); err != nil {
+		t.Fatal(err)
+	}
+
+	Invoke(ctx, t, controller, topic, []byte("hello"), 2)
+}
+
+func Test_Integration_Reannotate(t *testing.T) {
+	h := NewHarness(t)
+	defer h.Cleanup(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	topic := FunctionName() + ".before"
+	name, err := h.DeployWithTopic(ctx, topic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	controller := h.NewController(ctx, nil)
+	if err := WaitForTopic(ctx, controller, topic); err != nil {
+		t.Fatal(err)
+	}
+
+	updated := name + ".after"
+	if err := h.Annotate(ctx, name, map[string]string{"topic": updated}); err != nil {
+		t.Fatal(err)
+	}
+	if err := WaitForTopic(ctx, controller, updated); err != nil {
+		t.Fatal(err)
+	}
+
+	Invoke(ctx, t, controller, updated, []byte("hello"), 1)
+}
@@ -0,0 +1,87 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Acknowledger is notified once per message of the outcome of its
+// invocations: Ack when every matched function succeeded, or when no
+// function matched or a filter dropped the message, and Nack otherwise, so
+// that broker-based connectors can commit offsets or ack messages only on
+// success for at-least-once delivery. A failed invocation delivered to the
+// DeadLetterSink counts as a success.
+type Acknowledger interface {
+	Ack()
+	Nack(err error)
+}
+
+// AckFunc adapts a function to the Acknowledger interface. It is called with
+// nil on Ack.
+type AckFunc func(err error)
+
+// Ack calls f with nil.
+func (f AckFunc) Ack() {
+	f(nil)
+}
+
+// Nack calls f with err.
+func (f AckFunc) Nack(err error) {
+	f(err)
+}
+
+type acknowledgerKey struct{}
+
+// WithAcknowledger returns a copy of ctx carrying ack, which is notified of
+// the outcome of the message invoked with it, e.g. with InvokeWithContext.
+func WithAcknowledger(ctx context.Context, ack Acknowledger) context.Context {
+	return context.WithValue(ctx, acknowledgerKey{}, ack)
+}
+
+func acknowledgerFrom(ctx context.Context) Acknowledger {
+	if ctx == nil {
+		return nil
+	}
+	ack, _ := ctx.Value(acknowledgerKey{}).(Acknowledger)
+	return ack
+}
+
+// acknowledge acks the message of ctx if all its responses succeeded, or
+// nacks it with the failures.
+func acknowledge(ctx context.Context, responses []InvokerResponse) {
+	ack := acknowledgerFrom(ctx)
+	if ack == nil {
+		return
+	}
+
+	failures := []string{}
+	for _, res := range responses {
+		if res.DeadLettered {
+			continue
+		}
+		switch {
+		case res.Error != nil:
+			failures = append(failures, fmt.Sprintf("%s: %s", res.Function, res.Error))
+		case res.Status >= http.StatusBadRequest:
+			failures = append(failures, fmt.Sprintf("%s: status %d", res.Function, res.Status))
+		}
+	}
+
+	if len(failures) == 0 {
+		ack.Ack()
+		return
+	}
+	ack.Nack(fmt.Errorf("%d of %d invocations failed: %s", len(failures), len(responses), strings.Join(failures, "; ")))
+}
+
+// nack nacks the message of ctx, which was not invoked.
+func nack(ctx context.Context, err error) {
+	if ack := acknowledgerFrom(ctx); ack != nil {
+		ack.Nack(err)
+	}
+}
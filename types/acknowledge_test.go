@@ -0,0 +1,104 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// recordingDeadLetterSink accepts every dead letter.
+type recordingDeadLetterSink struct{}
+
+func (recordingDeadLetterSink) DeadLetter(ctx context.Context, letter DeadLetter) error {
+	return nil
+}
+
+func Test_Controller_Acknowledges(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/function/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	cases := []struct {
+		name     string
+		topic    string
+		paused   bool
+		config   ControllerConfig
+		wantNack bool
+	}{
+		{name: "all succeeded", topic: "ok"},
+		{name: "one failed", topic: "mixed", wantNack: true},
+		{name: "no function", topic: "none"},
+		{name: "paused", topic: "ok", paused: true, wantNack: true},
+		{name: "failure dead-lettered", topic: "mixed", config: ControllerConfig{DeadLetterSink: recordingDeadLetterSink{}}},
+		{name: "queued", topic: "mixed", config: ControllerConfig{Queue: &QueueConfig{}}, wantNack: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := tc.config
+			config.GatewayURL = srv.URL
+			config.RebuildInterval = time.Hour
+			c := NewController(nil, &config).(*controller)
+			defer c.Close()
+			c.TopicMap.Sync(&map[string][]string{"ok": {"echo"}, "mixed": {"echo", "fail"}})
+			if tc.paused {
+				c.Pause()
+			}
+
+			acks := make(chan error, 2)
+			ctx := WithAcknowledger(context.Background(), AckFunc(func(err error) { acks <- err }))
+			data := []byte("hello")
+			c.InvokeWithContext(ctx, tc.topic, &data)
+
+			select {
+			case err := <-acks:
+				if (err != nil) != tc.wantNack {
+					t.Errorf("Nack - want: %v, got: %v", tc.wantNack, err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("want the message acknowledged")
+			}
+			select {
+			case err := <-acks:
+				t.Errorf("want a single acknowledgement, got another: %v", err)
+			case <-time.After(20 * time.Millisecond):
+			}
+		})
+	}
+}
+
+func Test_Controller_InvokeFunction_Acknowledges(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/function/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewController(nil, &ControllerConfig{GatewayURL: srv.URL, RebuildInterval: time.Hour}).(*controller)
+	defer c.Close()
+
+	for function, wantNack := range map[string]bool{"echo": false, "fail": true} {
+		var acked, nacked int
+		ctx := WithAcknowledger(context.Background(), AckFunc(func(err error) {
+			if err != nil {
+				nacked++
+			} else {
+				acked++
+			}
+		}))
+		c.InvokeFunction(ctx, function, &Message{Body: []byte("hello")}, nil)
+
+		if wantNack && (acked != 0 || nacked != 1) || !wantNack && (acked != 1 || nacked != 0) {
+			t.Errorf("%s: acks - want nack %v, got: %d acks and %d nacks", function, wantNack, acked, nacked)
+		}
+	}
+}
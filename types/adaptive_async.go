@@ -0,0 +1,141 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// latencyWeight is the weight of a new sample in the moving average
+	// latency.
+	latencyWeight = 0.2
+
+	// defaultAdaptiveAsyncCooldown is the minimum time a topic stays async
+	// when no Cooldown is given.
+	defaultAdaptiveAsyncCooldown = 30 * time.Second
+)
+
+// AdaptiveAsync switches a topic from synchronous to asynchronous invocations
+// when its in-flight invocations or its average synchronous latency exceed
+// the thresholds, and back to synchronous once the load subsides, smoothing
+// traffic spikes without changing the configuration.
+type AdaptiveAsync struct {
+	// MaxInFlight is the number of concurrent invocations of a topic above
+	// which it switches to async. Zero disables the check.
+	MaxInFlight int
+
+	// MaxLatency is the average latency of the synchronous invocations of a
+	// topic above which it switches to async. Zero disables the check.
+	MaxLatency time.Duration
+
+	// Cooldown is the minimum time a topic stays async before switching back,
+	// 30s by default, so that it doesn't flap between sync and async. When
+	// MaxInFlight is set, its in-flight invocations must also be below half
+	// of MaxInFlight.
+	Cooldown time.Duration
+
+	lock   sync.Mutex
+	topics map[string]*adaptiveTopic
+	now    func() time.Time
+}
+
+type adaptiveTopic struct {
+	inFlight int
+	latency  time.Duration
+	async    bool
+	since    time.Time
+}
+
+// acquire registers a new invocation of topic and returns true if it must be
+// asynchronous.
+func (a *AdaptiveAsync) acquire(topic string) bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	state := a.topic(topic)
+	state.inFlight++
+
+	now := a.clock()
+	if !state.async && a.MaxInFlight > 0 && state.inFlight > a.MaxInFlight {
+		state.async = true
+		state.since = now
+	} else if state.async && now.Sub(state.since) >= a.cooldown() && (a.MaxInFlight == 0 || state.inFlight <= a.MaxInFlight/2) {
+		state.async = false
+		state.latency = 0
+		state.since = now
+	}
+
+	return state.async
+}
+
+// release registers the end of an invocation of topic.
+func (a *AdaptiveAsync) release(topic string, async bool, latency time.Duration) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	state := a.topic(topic)
+	state.inFlight--
+
+	if async {
+		return
+	}
+
+	if state.latency == 0 {
+		state.latency = latency
+	} else {
+		state.latency = time.Duration(latencyWeight*float64(latency) + (1-latencyWeight)*float64(state.latency))
+	}
+
+	if !state.async && a.MaxLatency > 0 && state.latency > a.MaxLatency {
+		state.async = true
+		state.since = a.clock()
+	}
+}
+
+// cooldown returns the minimum time a topic stays async.
+func (a *AdaptiveAsync) cooldown() time.Duration {
+	if a.Cooldown <= 0 {
+		return defaultAdaptiveAsyncCooldown
+	}
+	return a.Cooldown
+}
+
+// clock returns the current time.
+func (a *AdaptiveAsync) clock() time.Time {
+	if a.now == nil {
+		return time.Now()
+	}
+	return a.now()
+}
+
+// AsyncTopics returns the topics currently invoked asynchronously.
+func (a *AdaptiveAsync) AsyncTopics() []string {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	topics := []string{}
+	for topic, state := range a.topics {
+		if state.async {
+			topics = append(topics, topic)
+		}
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// topic returns the state of a topic. The lock must be held.
+func (a *AdaptiveAsync) topic(topic string) *adaptiveTopic {
+	if a.topics == nil {
+		a.topics = make(map[string]*adaptiveTopic)
+	}
+	state, ok := a.topics[topic]
+	if !ok {
+		state = &adaptiveTopic{}
+		a.topics[topic] = state
+	}
+	return state
+}
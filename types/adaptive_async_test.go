@@ -0,0 +1,67 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_AdaptiveAsync_InFlight(t *testing.T) {
+	now := time.Now()
+	adaptive := AdaptiveAsync{MaxInFlight: 2, now: func() time.Time { return now }}
+
+	if adaptive.acquire("topic1") || adaptive.acquire("topic1") {
+		t.Fatalf("Invocations under the limit must be synchronous")
+	}
+	if !adaptive.acquire("topic1") {
+		t.Fatalf("Invocations over the limit must be asynchronous")
+	}
+	if adaptive.acquire("topic2") {
+		t.Errorf("Other topics must not be affected")
+	}
+
+	adaptive.release("topic1", false, time.Millisecond)
+	adaptive.release("topic1", false, time.Millisecond)
+	adaptive.release("topic1", true, time.Millisecond)
+
+	if !adaptive.acquire("topic1") {
+		t.Errorf("Topic must stay async during the cooldown")
+	}
+	adaptive.release("topic1", true, time.Millisecond)
+
+	now = now.Add(defaultAdaptiveAsyncCooldown)
+	if adaptive.acquire("topic1") {
+		t.Errorf("Topic must switch back once in-flight invocations are below half the limit")
+	}
+}
+
+func Test_AdaptiveAsync_Latency(t *testing.T) {
+	adaptive := AdaptiveAsync{MaxLatency: 100 * time.Millisecond, Cooldown: time.Hour}
+
+	async := adaptive.acquire("topic1")
+	adaptive.release("topic1", async, time.Second)
+
+	if !adaptive.acquire("topic1") {
+		t.Errorf("Slow topic must switch to async")
+	}
+	if topics := adaptive.AsyncTopics(); len(topics) != 1 || topics[0] != "topic1" {
+		t.Errorf("Async topics - want: [topic1], got: %v", topics)
+	}
+}
+
+func Test_AdaptiveAsync_DefaultCooldown(t *testing.T) {
+	adaptive := AdaptiveAsync{MaxLatency: 100 * time.Millisecond}
+
+	async := adaptive.acquire("topic1")
+	adaptive.release("topic1", async, time.Second)
+
+	for i := 0; i < 3; i++ {
+		async := adaptive.acquire("topic1")
+		if !async {
+			t.Fatalf("Slow topic must stay async without a Cooldown")
+		}
+		adaptive.release("topic1", async, time.Millisecond)
+	}
+}
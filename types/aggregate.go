@@ -0,0 +1,75 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"net/http"
+	"sort"
+)
+
+// FunctionResult is the response of one of the functions of an
+// AggregatedResponse.
+type FunctionResult struct {
+	Function string      `json:"function"`
+	Status   int         `json:"status,omitempty"`
+	Header   http.Header `json:"header,omitempty"`
+	Body     []byte      `json:"body,omitempty"`
+	Error    string      `json:"error,omitempty"`
+}
+
+// Succeeded returns true if the function answered with a status below 400.
+func (r FunctionResult) Succeeded() bool {
+	return len(r.Error) == 0 && r.Status > 0 && r.Status < http.StatusBadRequest
+}
+
+// AggregatedResponse combines the responses of the functions invoked for a
+// message, e.g. to compose the reply of a request/reply connector.
+type AggregatedResponse struct {
+	Topic string `json:"topic"`
+
+	// Success is true if at least one function was invoked and all of them
+	// succeeded.
+	Success bool `json:"success"`
+
+	// Results are sorted by function.
+	Results []FunctionResult `json:"results"`
+}
+
+// AggregateResponses combines the responses of the functions invoked on
+// topic.
+func AggregateResponses(topic string, responses []InvokerResponse) AggregatedResponse {
+	aggregated := AggregatedResponse{
+		Topic:   topic,
+		Success: len(responses) > 0,
+		Results: make([]FunctionResult, 0, len(responses)),
+	}
+
+	for _, res := range responses {
+		result := FunctionResult{Function: res.Function, Status: res.Status}
+		if res.Header != nil {
+			result.Header = *res.Header
+		}
+		if res.Body != nil {
+			result.Body = *res.Body
+		}
+		if res.Error != nil {
+			result.Error = res.Error.Error()
+		}
+
+		aggregated.Success = aggregated.Success && result.Succeeded()
+		aggregated.Results = append(aggregated.Results, result)
+	}
+
+	sort.SliceStable(aggregated.Results, func(i, j int) bool {
+		return aggregated.Results[i].Function < aggregated.Results[j].Function
+	})
+	return aggregated
+}
+
+// InvokeAggregated invokes the functions matching topic like
+// InvokeWithResults, and combines their responses.
+func (c *controller) InvokeAggregated(ctx context.Context, topic string, message *Message) AggregatedResponse {
+	return AggregateResponses(topic, c.InvokeWithResults(ctx, topic, message))
+}
@@ -0,0 +1,79 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_AggregateResponses(t *testing.T) {
+	body := []byte("ok")
+	cases := []struct {
+		name        string
+		responses   []InvokerResponse
+		wantSuccess bool
+	}{
+		{name: "no function"},
+		{
+			name: "all succeeded",
+			responses: []InvokerResponse{
+				{Function: "b", Status: http.StatusOK, Body: &body},
+				{Function: "a", Status: http.StatusAccepted},
+			},
+			wantSuccess: true,
+		},
+		{
+			name: "one failed",
+			responses: []InvokerResponse{
+				{Function: "a", Status: http.StatusOK},
+				{Function: "b", Status: http.StatusInternalServerError},
+			},
+		},
+		{
+			name:      "error",
+			responses: []InvokerResponse{{Function: "a", Error: fmt.Errorf("unreachable")}},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			aggregated := AggregateResponses("orders", tc.responses)
+			if aggregated.Success != tc.wantSuccess {
+				t.Errorf("Success - want: %v, got: %v", tc.wantSuccess, aggregated.Success)
+			}
+			if len(aggregated.Results) != len(tc.responses) {
+				t.Fatalf("Results - want: %d, got: %d", len(tc.responses), len(aggregated.Results))
+			}
+			for i := 1; i < len(aggregated.Results); i++ {
+				if aggregated.Results[i-1].Function > aggregated.Results[i].Function {
+					t.Errorf("Results - want sorted by function, got: %+v", aggregated.Results)
+				}
+			}
+		})
+	}
+}
+
+func Test_Controller_InvokeAggregated(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer srv.Close()
+
+	c := NewController(nil, &ControllerConfig{GatewayURL: srv.URL, RebuildInterval: time.Hour}).(*controller)
+	defer c.Close()
+	c.TopicMap.Sync(&map[string][]string{"orders": {"shipping", "billing"}})
+
+	aggregated := c.InvokeAggregated(context.Background(), "orders", &Message{Body: []byte("hello")})
+	if !aggregated.Success || len(aggregated.Results) != 2 {
+		t.Fatalf("Aggregated - want 2 successful results, got: %+v", aggregated)
+	}
+	if got := string(aggregated.Results[0].Body); got != "/function/billing" {
+		t.Errorf("Body of billing - want: %s, got: %s", "/function/billing", got)
+	}
+}
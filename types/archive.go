@@ -0,0 +1,257 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultArchiveWriters is the number of objects stored concurrently when
+// MaxWriters is not set.
+const defaultArchiveWriters = 16
+
+// ArchiveStore stores the objects written by an Archiver.
+type ArchiveStore interface {
+	Put(ctx context.Context, key string, data []byte) error
+}
+
+// Archiver writes the payloads sent to the functions, and optionally their
+// responses, to an ArchiveStore for audit and replay. The objects are
+// partitioned by topic and date:
+//
+//	<topic>/<yyyy>/<mm>/<dd>/<message id>.request
+//	<topic>/<yyyy>/<mm>/<dd>/<message id>.<function>.response
+type Archiver struct {
+	Store ArchiveStore
+
+	// SampleRate is the ratio of messages archived, between 0 and 1. Zero
+	// archives every message.
+	SampleRate float64
+
+	// ArchiveResponses enables archiving the responses of the functions.
+	ArchiveResponses bool
+
+	// EncryptionKey encrypts the objects with AES-GCM, if set. It must be
+	// 16, 24 or 32 bytes long.
+	EncryptionKey []byte
+
+	// Timeout limits the time taken to store each object. Defaults to 30s.
+	Timeout time.Duration
+
+	// MaxWriters is the number of objects stored concurrently. Defaults to
+	// 16. When they are all busy, the invocations wait for a writer.
+	MaxWriters int
+
+	Logger Logger
+
+	lock    sync.Mutex
+	slots   chan struct{}
+	writers sync.WaitGroup
+	stopped bool
+}
+
+// archivedResponse is the object written for each response.
+type archivedResponse struct {
+	Topic    string      `json:"topic"`
+	Function string      `json:"function"`
+	Tenant   string      `json:"tenant,omitempty"`
+	Status   int         `json:"status,omitempty"`
+	Header   interface{} `json:"header,omitempty"`
+	Body     []byte      `json:"body,omitempty"`
+	Error    string      `json:"error,omitempty"`
+}
+
+// sample decides whether a message must be archived.
+func (a *Archiver) sample() bool {
+	if a.SampleRate <= 0 || a.SampleRate >= 1 {
+		return true
+	}
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return false
+	}
+	return float64(n.Int64())/1000000 < a.SampleRate
+}
+
+// archiveRequest stores the payload of a message in the background, and
+// returns the key prefix of its objects.
+func (a *Archiver) archiveRequest(topic, messageID string, payload []byte) string {
+	prefix := archiveKey(topic, messageID, time.Now())
+	a.put(prefix+".request", payload)
+	return prefix
+}
+
+// archiveResponse stores the response of a function in the background.
+func (a *Archiver) archiveResponse(prefix string, res InvokerResponse) {
+	if !a.ArchiveResponses {
+		return
+	}
+
+	object := archivedResponse{
+		Topic:    res.Topic,
+		Function: res.Function,
+		Tenant:   res.Tenant,
+		Status:   res.Status,
+	}
+	if res.Header != nil {
+		object.Header = *res.Header
+	}
+	if res.Body != nil {
+		object.Body = *res.Body
+	}
+	if res.Error != nil {
+		object.Error = res.Error.Error()
+	}
+
+	data, err := json.Marshal(object)
+	if err != nil {
+		a.logger().Errorf("Unable to archive response of %s: %s", res.Function, err)
+		return
+	}
+
+	a.put(prefix+"."+url.PathEscape(res.Function)+".response", data)
+}
+
+func (a *Archiver) put(key string, data []byte) {
+	a.lock.Lock()
+	if a.stopped {
+		a.lock.Unlock()
+		a.logger().Errorf("Unable to archive object %s: archiver stopped", key)
+		return
+	}
+	if a.slots == nil {
+		writers := a.MaxWriters
+		if writers <= 0 {
+			writers = defaultArchiveWriters
+		}
+		a.slots = make(chan struct{}, writers)
+	}
+	slots := a.slots
+	a.writers.Add(1)
+	a.lock.Unlock()
+
+	slots <- struct{}{}
+	go func() {
+		defer func() {
+			<-slots
+			a.writers.Done()
+		}()
+
+		data, err := a.encrypt(data)
+		if err != nil {
+			a.logger().Errorf("Unable to encrypt archive object %s: %s", key, err)
+			return
+		}
+
+		timeout := a.Timeout
+		if timeout <= 0 {
+			timeout = 30 * time.Second
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		if err := a.Store.Put(ctx, key, data); err != nil {
+			a.logger().Errorf("Unable to archive object %s: %s", key, err)
+		}
+	}()
+}
+
+// Stop stops archiving the new objects and waits for the objects being
+// stored, or for ctx to be done.
+func (a *Archiver) Stop(ctx context.Context) error {
+	a.lock.Lock()
+	a.stopped = true
+	a.lock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		a.writers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// encrypt seals data with AES-GCM, prepending the nonce.
+func (a *Archiver) encrypt(data []byte) ([]byte, error) {
+	if len(a.EncryptionKey) == 0 {
+		return data, nil
+	}
+
+	block, err := aes.NewCipher(a.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, data, nil), nil
+}
+
+func (a *Archiver) logger() Logger {
+	if a.Logger == nil {
+		return defaultLogger
+	}
+	return a.Logger
+}
+
+func archiveKey(topic, messageID string, t time.Time) string {
+	return fmt.Sprintf("%s/%s/%s", archiveSegment(topic), t.UTC().Format("2006/01/02"), archiveSegment(messageID))
+}
+
+// archiveSegment escapes a segment of an archive key. The segments made of
+// dots only, such as "..", are encoded too, as they would be resolved as
+// paths by the stores.
+func archiveSegment(value string) string {
+	value = url.PathEscape(value)
+	if len(strings.Trim(value, ".")) == 0 {
+		return strings.Replace(value, ".", "%2E", -1)
+	}
+	return value
+}
+
+// FileArchiveStore is an ArchiveStore writing the objects as files under a
+// directory.
+type FileArchiveStore struct {
+	Dir string
+}
+
+// Put writes an object to a file. The keys resolving outside of Dir are
+// rejected.
+func (s *FileArchiveStore) Put(ctx context.Context, key string, data []byte) error {
+	dir := filepath.Clean(s.Dir)
+	path := filepath.Join(dir, filepath.FromSlash(key))
+	if rel, err := filepath.Rel(dir, path); err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("archive key %s is outside of %s", key, s.Dir)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
@@ -0,0 +1,211 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type memoryArchiveStore struct {
+	lock    sync.Mutex
+	objects map[string][]byte
+	put     chan string
+}
+
+func (s *memoryArchiveStore) Put(ctx context.Context, key string, data []byte) error {
+	s.lock.Lock()
+	s.objects[key] = data
+	s.lock.Unlock()
+	s.put <- key
+	return nil
+}
+
+func Test_InvokeMessage_ArchivesRequestAndResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("world"))
+	}))
+	defer srv.Close()
+
+	store := &memoryArchiveStore{objects: map[string][]byte{}, put: make(chan string, 2)}
+	invoker := NewInvoker(srv.URL+"/function", "", srv.Client(), false, false)
+	invoker.Archiver = &Archiver{Store: store, ArchiveResponses: true}
+	topicMap := newTestTopicMap(map[string][]string{"topic1": {"echo"}})
+
+	collectResponses(invoker, func() {
+		invoker.InvokeMessage(context.Background(), topicMap, "topic1", &Message{Body: []byte("hello"), ID: "msg1"})
+	})
+
+	prefix := "topic1/" + time.Now().UTC().Format("2006/01/02") + "/msg1"
+	for i := 0; i < 2; i++ {
+		select {
+		case <-store.put:
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for the archived objects")
+		}
+	}
+
+	if got := string(store.objects[prefix+".request"]); got != "hello" {
+		t.Errorf("Request - want: %q, got: %q", "hello", got)
+	}
+	if got := string(store.objects[prefix+".echo.response"]); !strings.Contains(got, `"function":"echo"`) {
+		t.Errorf("Response - want the function name, got: %q", got)
+	}
+}
+
+func Test_Archiver_Encrypts(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	archiver := &Archiver{EncryptionKey: key}
+
+	sealed, err := archiver.encrypt([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, _ := aes.NewCipher(key)
+	gcm, _ := cipher.NewGCM(block)
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plain) != "secret" {
+		t.Errorf("Decrypted - want: %q, got: %q", "secret", string(plain))
+	}
+}
+
+func Test_S3ArchiveStore_Put(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests <- r
+		bodies <- body
+	}))
+	defer srv.Close()
+
+	store := &S3ArchiveStore{
+		Endpoint:  srv.URL,
+		Bucket:    "archive",
+		Region:    "us-east-1",
+		AccessKey: "AKID",
+		SecretKey: "secret",
+		Client:    srv.Client(),
+	}
+
+	if err := store.Put(context.Background(), "topic 1/2020/01/01/msg1.request", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	r := <-requests
+	if r.Method != http.MethodPut || r.URL.EscapedPath() != "/archive/topic%201/2020/01/01/msg1.request" {
+		t.Errorf("Request - want: PUT /archive/topic%%201/2020/01/01/msg1.request, got: %s %s", r.Method, r.URL.EscapedPath())
+	}
+	if auth := r.Header.Get("Authorization"); !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") {
+		t.Errorf("Authorization - got: %q", auth)
+	}
+	if body := <-bodies; string(body) != "hello" {
+		t.Errorf("Body - want: %q, got: %q", "hello", string(body))
+	}
+}
+
+func Test_FileArchiveStore_StaysInDir(t *testing.T) {
+	root, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	dir := filepath.Join(root, "archive")
+
+	store := &FileArchiveStore{Dir: dir}
+	if err := store.Put(context.Background(), "../escaped", []byte("x")); err == nil {
+		t.Errorf("want an error for a key outside of the directory")
+	}
+
+	archiver := &Archiver{Store: store}
+	archiver.archiveRequest("..", "..", []byte("hello"))
+	archiver.archiveRequest(".", "msg1", []byte("hello"))
+	if err := archiver.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if files, _ := ioutil.ReadDir(root); len(files) != 1 || files[0].Name() != "archive" {
+		t.Errorf("Root - want only the archive directory, got: %v", files)
+	}
+	day := time.Now().UTC().Format("2006/01/02")
+	for _, key := range []string{"%2E%2E/" + day + "/%2E%2E.request", "%2E/" + day + "/msg1.request"} {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(key))); err != nil {
+			t.Errorf("Object %s - want stored, got: %s", key, err)
+		}
+	}
+}
+
+type blockingArchiveStore struct {
+	release  chan struct{}
+	inFlight int32
+	max      int32
+	stored   int32
+}
+
+func (s *blockingArchiveStore) Put(ctx context.Context, key string, data []byte) error {
+	n := atomic.AddInt32(&s.inFlight, 1)
+	if n > atomic.LoadInt32(&s.max) {
+		atomic.StoreInt32(&s.max, n)
+	}
+	<-s.release
+	atomic.AddInt32(&s.inFlight, -1)
+	atomic.AddInt32(&s.stored, 1)
+	return nil
+}
+
+func Test_Archiver_StopWaitsForBoundedWriters(t *testing.T) {
+	store := &blockingArchiveStore{release: make(chan struct{})}
+	archiver := &Archiver{Store: store, MaxWriters: 1, Logger: NewStdLogger(LevelError)}
+
+	archiver.archiveRequest("topic1", "msg1", []byte("hello"))
+	returned := make(chan struct{})
+	go func() {
+		archiver.archiveRequest("topic1", "msg2", []byte("hello"))
+		close(returned)
+	}()
+	select {
+	case <-returned:
+		t.Fatal("want the invocation waiting for a writer")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := archiver.Stop(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Stop - want: %v, got: %v", context.DeadlineExceeded, err)
+	}
+
+	close(store.release)
+	<-returned
+	if err := archiver.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(&store.stored); got != 2 {
+		t.Errorf("Stored - want: %d, got: %d", 2, got)
+	}
+	if got := atomic.LoadInt32(&store.max); got != 1 {
+		t.Errorf("Concurrent writers - want: %d, got: %d", 1, got)
+	}
+
+	archiver.archiveRequest("topic1", "msg3", []byte("hello"))
+	if got := atomic.LoadInt32(&store.stored); got != 2 {
+		t.Errorf("Stored after Stop - want: %d, got: %d", 2, got)
+	}
+}
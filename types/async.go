@@ -0,0 +1,230 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	callIDHeader         = "X-Call-Id"
+	functionStatusHeader = "X-Function-Status"
+)
+
+// AsyncCall is an asynchronous invocation accepted by the gateway.
+type AsyncCall struct {
+	CallID    string
+	Topic     string
+	Function  string
+	Message   *[]byte
+	InvokedAt time.Time
+}
+
+// AsyncResult is the result of an asynchronous invocation, as received on
+// the callback URL.
+type AsyncResult struct {
+	AsyncCall
+
+	Status      int
+	Body        []byte
+	Header      http.Header
+	CompletedAt time.Time
+}
+
+type asyncEntry struct {
+	call   AsyncCall
+	result *AsyncResult
+	done   chan struct{}
+
+	// waiters is the number of Await calls waiting for the result, which
+	// keep the entry from being pruned
+	waiters int
+}
+
+// AsyncTracker records the call IDs returned by the gateway for asynchronous
+// invocations and correlates them with the results posted to the callback
+// URL, so they can be awaited. It must be mounted as the handler of the
+// callback URL to receive the results.
+type AsyncTracker struct {
+	ttl time.Duration
+
+	lock  sync.Mutex
+	calls map[string]*asyncEntry
+
+	// pruning is true while a timer is set to prune the calls
+	pruning bool
+}
+
+// NewAsyncTracker creates an AsyncTracker that forgets the calls older than
+// ttl, whether completed or not, unless they are being awaited. The calls
+// are pruned on a timer, every ttl, while some are tracked.
+func NewAsyncTracker(ttl time.Duration) *AsyncTracker {
+	return &AsyncTracker{
+		ttl:   ttl,
+		calls: make(map[string]*asyncEntry),
+	}
+}
+
+// Track records an asynchronous call.
+func (t *AsyncTracker) Track(call AsyncCall) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	entry := t.entry(call.CallID)
+	entry.call = call
+	if entry.result != nil {
+		entry.result.AsyncCall = call
+	}
+}
+
+// Pending returns the tracked calls that haven't completed yet.
+func (t *AsyncTracker) Pending() []AsyncCall {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	calls := []AsyncCall{}
+	for _, entry := range t.calls {
+		if entry.result == nil && len(entry.call.CallID) > 0 {
+			calls = append(calls, entry.call)
+		}
+	}
+	return calls
+}
+
+// Result returns the result of a call if it has already completed.
+func (t *AsyncTracker) Result(callID string) (AsyncResult, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	entry, ok := t.calls[callID]
+	if !ok || entry.result == nil {
+		return AsyncResult{}, false
+	}
+	return *entry.result, true
+}
+
+// Await blocks until the result of a call is received or ctx is done.
+func (t *AsyncTracker) Await(ctx context.Context, callID string) (AsyncResult, error) {
+	t.lock.Lock()
+	entry := t.entry(callID)
+	entry.waiters++
+	t.lock.Unlock()
+
+	defer func() {
+		t.lock.Lock()
+		entry.waiters--
+		t.lock.Unlock()
+	}()
+
+	select {
+	case <-entry.done:
+		t.lock.Lock()
+		defer t.lock.Unlock()
+		return *entry.result, nil
+	case <-ctx.Done():
+		return AsyncResult{}, ctx.Err()
+	}
+}
+
+// Complete records the result of a call and releases its waiters.
+func (t *AsyncTracker) Complete(callID string, status int, body []byte, header http.Header) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	entry := t.entry(callID)
+	if entry.result != nil {
+		return
+	}
+
+	entry.result = &AsyncResult{
+		AsyncCall:   entry.call,
+		Status:      status,
+		Body:        body,
+		Header:      header,
+		CompletedAt: time.Now(),
+	}
+	close(entry.done)
+}
+
+// ServeHTTP receives the results of the asynchronous invocations posted by the
+// gateway to the callback URL.
+func (t *AsyncTracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	callID := r.Header.Get(callIDHeader)
+	if len(callID) == 0 {
+		http.Error(w, fmt.Sprintf("missing %s header", callIDHeader), http.StatusBadRequest)
+		return
+	}
+
+	var body []byte
+	if r.Body != nil {
+		defer r.Body.Close()
+
+		var err error
+		body, err = ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	status := http.StatusOK
+	if v := r.Header.Get(functionStatusHeader); len(v) > 0 {
+		if s, err := strconv.Atoi(v); err == nil {
+			status = s
+		}
+	}
+
+	t.Complete(callID, status, body, r.Header)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// entry returns the entry of a call, creating it if needed. The tracker lock
+// must be held.
+func (t *AsyncTracker) entry(callID string) *asyncEntry {
+	entry, ok := t.calls[callID]
+	if !ok {
+		entry = &asyncEntry{
+			call: AsyncCall{CallID: callID, InvokedAt: time.Now()},
+			done: make(chan struct{}),
+		}
+		t.calls[callID] = entry
+		t.schedulePrune()
+	}
+	return entry
+}
+
+// schedulePrune sets a timer to prune the calls after the ttl, unless one
+// is already set. The tracker lock must be held.
+func (t *AsyncTracker) schedulePrune() {
+	if t.ttl <= 0 || t.pruning {
+		return
+	}
+	t.pruning = true
+	time.AfterFunc(t.ttl, func() {
+		t.lock.Lock()
+		defer t.lock.Unlock()
+
+		t.pruning = false
+		t.prune(time.Now())
+		if len(t.calls) > 0 {
+			t.schedulePrune()
+		}
+	})
+}
+
+// prune forgets the calls older than the ttl, except the ones being
+// awaited. The tracker lock must be held.
+func (t *AsyncTracker) prune(now time.Time) {
+	for callID, entry := range t.calls {
+		if entry.waiters == 0 && now.Sub(entry.call.InvokedAt) > t.ttl {
+			delete(t.calls, callID)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_AsyncTracker_AwaitCallback(t *testing.T) {
+	tracker := NewAsyncTracker(time.Minute)
+	message := []byte("hello")
+	tracker.Track(AsyncCall{
+		CallID:    "call-1",
+		Topic:     "topic1",
+		Function:  "echo.openfaas-fn",
+		Message:   &message,
+		InvokedAt: time.Now(),
+	})
+
+	if pending := tracker.Pending(); len(pending) != 1 {
+		t.Fatalf("Pending - want: %d, got: %d", 1, len(pending))
+	}
+
+	go func() {
+		req := httptest.NewRequest(http.MethodPost, "/callback", strings.NewReader("result"))
+		req.Header.Set("X-Call-Id", "call-1")
+		req.Header.Set("X-Function-Status", "500")
+		tracker.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := tracker.Await(ctx, "call-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != http.StatusInternalServerError {
+		t.Errorf("Status - want: %d, got: %d", http.StatusInternalServerError, result.Status)
+	}
+	if result.Topic != "topic1" || string(*result.Message) != "hello" {
+		t.Errorf("Result not correlated with the call: %+v", result.AsyncCall)
+	}
+	if string(result.Body) != "result" {
+		t.Errorf("Body - want: %s, got: %s", "result", string(result.Body))
+	}
+	if pending := tracker.Pending(); len(pending) != 0 {
+		t.Errorf("Pending - want: %d, got: %d", 0, len(pending))
+	}
+}
+
+func Test_AsyncTracker_PrunesOnTimerExceptAwaited(t *testing.T) {
+	tracker := NewAsyncTracker(10 * time.Millisecond)
+	tracker.Track(AsyncCall{CallID: "forgotten", InvokedAt: time.Now()})
+	tracker.Track(AsyncCall{CallID: "awaited", InvokedAt: time.Now()})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	awaited := make(chan error, 1)
+	go func() {
+		_, err := tracker.Await(ctx, "awaited")
+		awaited <- err
+	}()
+
+	count := func() int {
+		tracker.lock.Lock()
+		defer tracker.lock.Unlock()
+		return len(tracker.calls)
+	}
+	waitFor(t, func() bool { return count() == 1 })
+
+	time.Sleep(50 * time.Millisecond)
+	tracker.Complete("awaited", http.StatusOK, []byte("done"), nil)
+	if err := <-awaited; err != nil {
+		t.Fatalf("want the awaited call kept until its result, got: %s", err)
+	}
+	cancel()
+
+	waitFor(t, func() bool { return count() == 0 })
+}
@@ -0,0 +1,60 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import "context"
+
+// inFlightLimiter caps the messages invoked concurrently by the controller.
+type inFlightLimiter struct {
+	slots  chan struct{}
+	reject bool
+}
+
+// newInFlightLimiter creates a limiter allowing max concurrent invocations,
+// or nil if max is not positive.
+func newInFlightLimiter(max int, reject bool) *inFlightLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &inFlightLimiter{slots: make(chan struct{}, max), reject: reject}
+}
+
+// acquire takes a slot, waiting for one until ctx is done, or failing with
+// ErrBusy at once if the limiter rejects the invocations over the limit.
+func (l *inFlightLimiter) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	default:
+	}
+	if l.reject {
+		return ErrBusy
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release frees a slot taken by acquire.
+func (l *inFlightLimiter) release() {
+	if l != nil {
+		<-l.slots
+	}
+}
+
+// inFlight returns the number of slots taken.
+func (l *inFlightLimiter) inFlight() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.slots)
+}
@@ -0,0 +1,58 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_Controller_MaxInFlight(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+	defer srv.Close()
+
+	for _, reject := range []bool{false, true} {
+		c := NewController(nil, &ControllerConfig{
+			GatewayURL:      srv.URL,
+			RebuildInterval: time.Hour,
+			MaxInFlight:     1,
+			RejectWhenBusy:  reject,
+		}).(*controller)
+		c.TopicMap.Sync(&map[string][]string{"orders": {"echo"}})
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			c.InvokeWithResults(context.Background(), "orders", &Message{Body: []byte("first")})
+		}()
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		responses := c.InvokeWithResults(ctx, "orders", &Message{Body: []byte("second")})
+		cancel()
+
+		want := context.DeadlineExceeded
+		if reject {
+			want = ErrBusy
+		}
+		if len(responses) != 1 || responses[0].Error != want {
+			t.Errorf("Reject %v: want %s, got: %+v", reject, want, responses)
+		}
+
+		release <- struct{}{}
+		<-done
+		if got := c.inFlight.inFlight(); got != 0 {
+			t.Errorf("Reject %v: in flight - want: %d, got: %d", reject, 0, got)
+		}
+		c.Close()
+	}
+}
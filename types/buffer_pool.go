@@ -0,0 +1,69 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+const (
+	// maxPooledBuffer is the capacity above which a buffer is not returned to
+	// the pool, so a few large responses don't keep memory allocated.
+	maxPooledBuffer = 1 << 20
+
+	// maxPresizedBody is the largest Content-Length trusted to allocate the
+	// body upfront.
+	maxPresizedBody = 64 << 20
+)
+
+// bufferPool holds the buffers used to read the response bodies. Reading
+// into a pooled buffer and copying the result out allocates the body once,
+// instead of once per growth of ioutil.ReadAll.
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// readBody reads r until EOF. When the length of the content is known, the
+// body is allocated upfront; otherwise it is read into a pooled buffer.
+func readBody(r io.Reader, contentLength int64) ([]byte, error) {
+	if contentLength == 0 {
+		return []byte{}, nil
+	}
+
+	if contentLength > 0 && contentLength <= maxPresizedBody {
+		body := make([]byte, contentLength)
+		n, err := io.ReadFull(r, body)
+		if err != nil {
+			return body[:n], err
+		}
+		// The content may be longer than announced.
+		var probe [1]byte
+		if m, _ := r.Read(probe[:]); m == 0 {
+			return body, nil
+		}
+		return readPooled(io.MultiReader(bytes.NewReader(body), bytes.NewReader(probe[:1]), r))
+	}
+
+	return readPooled(r)
+}
+
+// readPooled reads r into a pooled buffer and returns a copy of its content.
+func readPooled(r io.Reader) ([]byte, error) {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer func() {
+		if buf.Cap() <= maxPooledBuffer {
+			bufferPool.Put(buf)
+		}
+	}()
+
+	_, err := buf.ReadFrom(r)
+	body := make([]byte, buf.Len())
+	copy(body, buf.Bytes())
+	return body, err
+}
@@ -0,0 +1,50 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func Test_readBody(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		contentLength int64
+		wantErr       bool
+	}{
+		{name: "known length", body: "hello world", contentLength: 11},
+		{name: "unknown length", body: "hello world", contentLength: -1},
+		{name: "empty", body: "", contentLength: 0},
+		{name: "longer than announced", body: "hello world", contentLength: 5},
+		{name: "shorter than announced", body: "hello", contentLength: 11, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// MultiReader hides the length of the content from readBody.
+			body, err := readBody(io.MultiReader(strings.NewReader(test.body)), test.contentLength)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Error - want: %v, got: %v", test.wantErr, err)
+			}
+			if string(body) != test.body {
+				t.Errorf("Body - want: %q, got: %q", test.body, body)
+			}
+		})
+	}
+}
+
+func Benchmark_readBody(b *testing.B) {
+	payload := bytes.Repeat([]byte("x"), 32<<10)
+
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		if _, err := readBody(io.MultiReader(bytes.NewReader(payload)), -1); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
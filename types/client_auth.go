@@ -0,0 +1,122 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openfaas/faas-provider/auth"
+)
+
+// ClientAuth authenticates the requests to the gateway. It has the method
+// set of the ClientAuth of the OpenFaaS go-sdk, so its implementations can
+// be used as is.
+type ClientAuth interface {
+	Set(req *http.Request) error
+}
+
+// BasicAuth authenticates the requests with basic authentication, or returns
+// nil if credentials is nil.
+func BasicAuth(credentials *auth.BasicAuthCredentials) ClientAuth {
+	if credentials == nil {
+		return nil
+	}
+	return &basicAuth{credentials: credentials}
+}
+
+type basicAuth struct {
+	credentials *auth.BasicAuthCredentials
+}
+
+func (a *basicAuth) Set(req *http.Request) error {
+	req.SetBasicAuth(a.credentials.User, a.credentials.Password)
+	return nil
+}
+
+// TokenSource returns the current token of a TokenAuth, e.g. an OpenFaaS IAM
+// token exchanged and refreshed by the go-sdk.
+type TokenSource interface {
+	Token() (string, error)
+}
+
+// TokenAuth authenticates the requests with a bearer token.
+type TokenAuth struct {
+	TokenSource TokenSource
+}
+
+// NewTokenAuth authenticates the requests with a static bearer token.
+func NewTokenAuth(token string) *TokenAuth {
+	return &TokenAuth{TokenSource: staticToken(token)}
+}
+
+// Set adds the token of the TokenSource as the Authorization header of req.
+func (a *TokenAuth) Set(req *http.Request) error {
+	token, err := a.TokenSource.Token()
+	if err != nil {
+		return fmt.Errorf("unable to get a token: %s", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+type staticToken string
+
+func (t staticToken) Token() (string, error) {
+	return string(t), nil
+}
+
+// FileTokenSource reads the token from a file, e.g. a projected service
+// account token, reading it again when the file is modified so that rotated
+// tokens are picked up.
+type FileTokenSource struct {
+	Path string
+
+	lock    sync.Mutex
+	token   string
+	modTime time.Time
+}
+
+// Token returns the token of the file, trimmed of surrounding whitespace.
+func (s *FileTokenSource) Token() (string, error) {
+	info, err := os.Stat(s.Path)
+	if err != nil {
+		return "", err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if len(s.token) > 0 && info.ModTime().Equal(s.modTime) {
+		return s.token, nil
+	}
+
+	data, err := ioutil.ReadFile(s.Path)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(data))
+	if len(token) == 0 {
+		return "", fmt.Errorf("empty token in %s", s.Path)
+	}
+	s.token, s.modTime = token, info.ModTime()
+	return token, nil
+}
+
+// setAuth authenticates req with clientAuth, or with credentials when
+// clientAuth is nil.
+func setAuth(req *http.Request, clientAuth ClientAuth, credentials *auth.BasicAuthCredentials) error {
+	if clientAuth != nil {
+		return clientAuth.Set(req)
+	}
+	if credentials != nil {
+		req.SetBasicAuth(credentials.User, credentials.Password)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/openfaas/faas-provider/auth"
+)
+
+func Test_TokenAuth_DiscoveryAndInvocation(t *testing.T) {
+	var lock sync.Mutex
+	authorizations := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		authorizations[r.URL.Path] = r.Header.Get("Authorization")
+		lock.Unlock()
+
+		switch r.URL.Path {
+		case "/system/namespaces":
+			w.Write([]byte(`["openfaas-fn"]`))
+		case "/system/functions":
+			w.Write([]byte(`[{"name":"echo","annotations":{"topic":"topic1"}}]`))
+		}
+	}))
+	defer srv.Close()
+
+	builder := FunctionLookupBuilder{
+		GatewayURL:  srv.URL,
+		Client:      srv.Client(),
+		Auth:        NewTokenAuth("iam-token"),
+		Credentials: &auth.BasicAuthCredentials{User: "admin", Password: "secret"},
+	}
+	lookups, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invoker := NewInvoker(srv.URL+"/function", "", srv.Client(), false, false)
+	invoker.Auth = NewTokenAuth("iam-token")
+	topicMap := newTestTopicMap(lookups)
+	collectResponses(invoker, func() {
+		invoker.InvokeMessage(context.Background(), topicMap, "topic1", &Message{Body: []byte("hello")})
+	})
+
+	lock.Lock()
+	defer lock.Unlock()
+	for _, path := range []string{"/system/namespaces", "/system/functions", "/function/echo.openfaas-fn"} {
+		if got := authorizations[path]; got != "Bearer iam-token" {
+			t.Errorf("%s - want the bearer token, got %q", path, got)
+		}
+	}
+}
+
+func Test_FileTokenSource_ReadsRotatedToken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(path, []byte("first\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	source := &FileTokenSource{Path: path}
+	if token, err := source.Token(); err != nil || token != "first" {
+		t.Fatalf("want token first, got %q, %v", token, err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("second"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	later := source.modTime.Add(1e9)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if token, err := source.Token(); err != nil || token != "second" {
+		t.Errorf("want the rotated token second, got %q, %v", token, err)
+	}
+}
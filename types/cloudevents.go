@@ -0,0 +1,117 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// CloudEventsMode defines whether and how the messages are wrapped as
+// CloudEvents 1.0 before being sent to the functions.
+type CloudEventsMode string
+
+const (
+	// CloudEventsDisabled sends the messages unchanged. This is the default.
+	CloudEventsDisabled CloudEventsMode = ""
+
+	// CloudEventsBinary sends the message as the body and the event
+	// attributes as ce-* headers.
+	CloudEventsBinary CloudEventsMode = "binary"
+
+	// CloudEventsStructured sends the whole event as a JSON document.
+	CloudEventsStructured CloudEventsMode = "structured"
+)
+
+const (
+	cloudEventsSpecVersion   = "1.0"
+	cloudEventsContentType   = "application/cloudevents+json; charset=UTF-8"
+	defaultCloudEventsSource = "connector-sdk"
+)
+
+// cloudEvent is the JSON representation of a CloudEvent in structured mode.
+type cloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            string          `json:"time"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+	DataBase64      []byte          `json:"data_base64,omitempty"`
+}
+
+// cloudEvent wraps a message published on topic as a CloudEvent according to
+// the CloudEventsMode of the Invoker. The topic is used as the type and the
+// subject of the event. It returns the body to send and the headers to add.
+func (i *Invoker) cloudEvent(topic string, message []byte) ([]byte, http.Header, error) {
+	header := http.Header{}
+	if i.CloudEventsMode == CloudEventsDisabled {
+		return message, header, nil
+	}
+
+	source := i.CloudEventsSource
+	if len(source) == 0 {
+		source = defaultCloudEventsSource
+	}
+
+	id, err := i.newID()
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+
+	if i.CloudEventsMode == CloudEventsBinary {
+		header.Set("Ce-Specversion", cloudEventsSpecVersion)
+		header.Set("Ce-Id", id)
+		header.Set("Ce-Source", source)
+		header.Set("Ce-Type", topic)
+		header.Set("Ce-Subject", topic)
+		header.Set("Ce-Time", now)
+		return message, header, nil
+	}
+
+	event := cloudEvent{
+		SpecVersion: cloudEventsSpecVersion,
+		ID:          id,
+		Source:      source,
+		Type:        topic,
+		Subject:     topic,
+		Time:        now,
+	}
+	if json.Valid(message) {
+		event.DataContentType = "application/json"
+		event.Data = message
+	} else {
+		event.DataBase64 = message
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	header.Set("Content-Type", cloudEventsContentType)
+	return body, header, nil
+}
+
+// cloudEventData returns the data of a structured CloudEvent, or payload if
+// it isn't one. The id and the time of the events differ on every
+// invocation, so the responses are cached by the data.
+func (i *Invoker) cloudEventData(payload []byte) []byte {
+	if i.CloudEventsMode != CloudEventsStructured {
+		return payload
+	}
+
+	var event cloudEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return payload
+	}
+	if len(event.DataBase64) > 0 {
+		return event.DataBase64
+	}
+	return event.Data
+}
@@ -0,0 +1,75 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func Test_cloudEvent_Binary(t *testing.T) {
+	invoker := Invoker{CloudEventsMode: CloudEventsBinary, CloudEventsSource: "kafka"}
+
+	body, header, err := invoker.cloudEvent("orders", []byte("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "payload" {
+		t.Errorf("Body - want: %s, got: %s", "payload", string(body))
+	}
+
+	want := map[string]string{
+		"Ce-Specversion": "1.0",
+		"Ce-Source":      "kafka",
+		"Ce-Type":        "orders",
+		"Ce-Subject":     "orders",
+	}
+	for name, value := range want {
+		if got := header.Get(name); got != value {
+			t.Errorf("Header %s - want: %s, got: %s", name, value, got)
+		}
+	}
+	if len(header.Get("Ce-Id")) == 0 || len(header.Get("Ce-Time")) == 0 {
+		t.Errorf("Headers Ce-Id and Ce-Time must be set: %v", header)
+	}
+}
+
+func Test_cloudEvent_Structured(t *testing.T) {
+	invoker := Invoker{CloudEventsMode: CloudEventsStructured}
+
+	tests := []struct {
+		name     string
+		message  string
+		wantJSON bool
+	}{
+		{name: "JSON data", message: `{"id":1}`, wantJSON: true},
+		{name: "binary data", message: "plain text", wantJSON: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body, header, err := invoker.cloudEvent("orders", []byte(test.message))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if header.Get("Content-Type") != cloudEventsContentType {
+				t.Errorf("Content-Type - want: %s, got: %s", cloudEventsContentType, header.Get("Content-Type"))
+			}
+
+			var event cloudEvent
+			if err := json.Unmarshal(body, &event); err != nil {
+				t.Fatal(err)
+			}
+			if event.Type != "orders" || event.Source != defaultCloudEventsSource || event.SpecVersion != "1.0" {
+				t.Errorf("Unexpected event attributes: %+v", event)
+			}
+			if test.wantJSON && string(event.Data) != test.message {
+				t.Errorf("Data - want: %s, got: %s", test.message, string(event.Data))
+			}
+			if !test.wantJSON && string(event.DataBase64) != test.message {
+				t.Errorf("DataBase64 - want: %s, got: %s", test.message, string(event.DataBase64))
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ConfigErrors collects every invalid value of a configuration, so that they
+// can be fixed at once.
+type ConfigErrors []*ConfigError
+
+func (e ConfigErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return fmt.Sprintf("%d configuration errors: %s", len(e), strings.Join(messages, "; "))
+}
+
+// configValidator accumulates the ConfigErrors of a configuration.
+type configValidator struct {
+	errors ConfigErrors
+}
+
+func (v *configValidator) fail(field, format string, args ...interface{}) {
+	v.errors = append(v.errors, &ConfigError{Field: field, Reason: fmt.Sprintf(format, args...)})
+}
+
+// url checks that value is an absolute http(s) URL, unless it is empty and
+// not required.
+func (v *configValidator) url(field, value string, required bool) {
+	if len(value) == 0 {
+		if required {
+			v.fail(field, "is required")
+		}
+		return
+	}
+
+	u, err := url.Parse(value)
+	if err != nil {
+		v.fail(field, "malformed URL %q", value)
+		return
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		v.fail(field, "%q must be an absolute http or https URL", value)
+	}
+}
+
+func (v *configValidator) duration(field string, value time.Duration) {
+	if value < 0 {
+		v.fail(field, "must not be negative, got %s", value)
+	}
+}
+
+func (v *configValidator) number(field string, value float64) {
+	if value < 0 {
+		v.fail(field, "must not be negative, got %v", value)
+	}
+}
+
+func (v *configValidator) err() error {
+	if len(v.errors) == 0 {
+		return nil
+	}
+	return v.errors
+}
+
+// Validate checks the configuration and returns a ConfigErrors listing every
+// invalid value, or nil. NewController logs these errors, call Validate
+// before it to fail fast at startup.
+func (c *ControllerConfig) Validate() error {
+	v := &configValidator{}
+
+	v.url("GatewayURL", c.GatewayURL, true)
+	v.url("AsyncFunctionCallbackURL", c.AsyncFunctionCallbackURL, false)
+	for n, url := range c.GatewayURLs {
+		v.url(fmt.Sprintf("GatewayURLs[%d]", n), url, true)
+	}
+	for n, gateway := range c.Gateways {
+		v.url(fmt.Sprintf("Gateways[%d].URL", n), gateway.URL, true)
+	}
+
+	v.duration("UpstreamTimeout", c.UpstreamTimeout)
+	v.duration("RebuildInterval", c.RebuildInterval)
+	v.duration("StatsReportInterval", c.StatsReportInterval)
+	v.duration("RetryAfterMaxWait", c.RetryAfterMaxWait)
+	v.duration("GatewayProbeInterval", c.GatewayProbeInterval)
+	v.duration("MissingFunctionTTL", c.MissingFunctionTTL)
+	v.duration("ShutdownTimeout", c.ShutdownTimeout)
+	v.duration("SyncRetryBackoff", c.SyncRetryBackoff)
+	v.duration("StatsMaxAge", c.StatsMaxAge)
+	v.duration("NamespaceRetryBackoff", c.NamespaceRetryBackoff)
+	v.duration("NamespaceCacheTTL", c.NamespaceCacheTTL)
+	v.duration("ClientOptions.IdleConnTimeout", c.ClientOptions.IdleConnTimeout)
+	v.duration("ClientOptions.DialTimeout", c.ClientOptions.DialTimeout)
+	v.duration("ClientOptions.TLSHandshakeTimeout", c.ClientOptions.TLSHandshakeTimeout)
+	v.duration("ClientOptions.ResponseHeaderTimeout", c.ClientOptions.ResponseHeaderTimeout)
+
+	v.number("RateLimit", c.RateLimit)
+	v.number("RateLimitBurst", float64(c.RateLimitBurst))
+	v.number("ResponseBufferSize", float64(c.ResponseBufferSize))
+	v.number("StatsSamples", float64(c.StatsSamples))
+	v.number("PrintMaxBodyLength", float64(c.PrintMaxBodyLength))
+	v.number("DeadLetterQueueSize", float64(c.DeadLetterQueueSize))
+	if c.PrintSampleRate < 0 || c.PrintSampleRate > 1 {
+		v.fail("PrintSampleRate", "must be between 0 and 1, got %v", c.PrintSampleRate)
+	}
+	v.number("MaxInFlight", float64(c.MaxInFlight))
+	v.number("FunctionPageSize", float64(c.FunctionPageSize))
+	v.number("MaxFunctionPages", float64(c.MaxFunctionPages))
+	v.number("DiscoveryRateLimit", c.DiscoveryRateLimit)
+	v.number("DiscoveryRateLimitBurst", float64(c.DiscoveryRateLimitBurst))
+	if c.RebuildJitter < 0 || c.RebuildJitter > 1 {
+		v.fail("RebuildJitter", "must be between 0 and 1, got %v", c.RebuildJitter)
+	}
+	v.number("NamespaceRetries", float64(c.NamespaceRetries))
+	v.number("ClientOptions.MaxIdleConns", float64(c.ClientOptions.MaxIdleConns))
+	v.number("ClientOptions.MaxIdleConnsPerHost", float64(c.ClientOptions.MaxIdleConnsPerHost))
+	v.number("ClientOptions.MaxConnsPerHost", float64(c.ClientOptions.MaxConnsPerHost))
+
+	if len(c.DefaultNamespace) > 0 {
+		if err := validateLabel(c.DefaultNamespace); err != nil {
+			v.fail("DefaultNamespace", "namespace %s", err)
+		}
+	}
+	for n, namespace := range c.Namespaces {
+		if err := validateLabel(namespace); err != nil {
+			v.fail(fmt.Sprintf("Namespaces[%d]", n), "namespace %s", err)
+		}
+	}
+	for n, namespace := range c.ExcludeNamespaces {
+		if err := validateLabel(namespace); err != nil {
+			v.fail(fmt.Sprintf("ExcludeNamespaces[%d]", n), "namespace %s", err)
+		}
+	}
+	if len(c.TopicAnnotationDelimiterPattern) > 0 {
+		if _, err := regexp.Compile(c.TopicAnnotationDelimiterPattern); err != nil {
+			v.fail("TopicAnnotationDelimiterPattern", "%s", err)
+		}
+	}
+	if len(c.SelftestFunction) > 0 {
+		if err := ValidateFunctionRef(c.SelftestFunction); err != nil {
+			v.fail("SelftestFunction", "%s", err)
+		}
+	}
+
+	for topic, functions := range c.StaticTopics {
+		for _, function := range functions {
+			if err := ValidateFunctionRef(function); err != nil {
+				v.fail(fmt.Sprintf("StaticTopics[%q]", topic), "%s", err)
+			}
+		}
+	}
+
+	for tenant, namespaces := range c.Tenants {
+		if len(namespaces) == 0 {
+			v.fail(fmt.Sprintf("Tenants[%q]", tenant), "requires at least one namespace")
+		}
+		for _, namespace := range namespaces {
+			if err := validateLabel(namespace); err != nil {
+				v.fail(fmt.Sprintf("Tenants[%q]", tenant), "namespace %s", err)
+			}
+		}
+	}
+
+	switch c.GatewayBalancing {
+	case GatewayPreferred, GatewayRoundRobin, GatewayLeastPending:
+	default:
+		v.fail("GatewayBalancing", "unknown balancing %q", c.GatewayBalancing)
+	}
+
+	switch c.PausePolicy {
+	case PauseReject, PauseHold:
+	default:
+		v.fail("PausePolicy", "unknown policy %q", c.PausePolicy)
+	}
+
+	switch c.CloudEventsMode {
+	case CloudEventsDisabled, CloudEventsBinary, CloudEventsStructured:
+	default:
+		v.fail("CloudEventsMode", "unknown mode %q", c.CloudEventsMode)
+	}
+
+	if c.DuplicateFunctionPolicy < DuplicateInvokeAll || c.DuplicateFunctionPolicy > DuplicatePreferNamespace {
+		v.fail("DuplicateFunctionPolicy", "unknown policy %d", c.DuplicateFunctionPolicy)
+	}
+	if c.DuplicateFunctionPolicy == DuplicatePreferNamespace && len(c.NamespacePreference) == 0 {
+		v.fail("NamespacePreference", "is required by DuplicatePreferNamespace")
+	}
+
+	if c.Queue != nil {
+		v.number("Queue.Workers", float64(c.Queue.Workers))
+		v.number("Queue.MemoryBudget", float64(c.Queue.MemoryBudget))
+		switch c.Queue.OverflowPolicy {
+		case QueueOverflowBlock:
+		case QueueOverflowSpill:
+			if len(c.Queue.SpillDir) == 0 {
+				v.fail("Queue.SpillDir", "required to spill messages")
+			}
+		default:
+			v.fail("Queue.OverflowPolicy", "unknown policy %q", c.Queue.OverflowPolicy)
+		}
+	}
+
+	if c.RetryBudget != nil {
+		v.number("RetryBudget.Ratio", c.RetryBudget.Ratio)
+		v.duration("RetryBudget.Window", c.RetryBudget.Window)
+		v.number("RetryBudget.MinRetries", float64(c.RetryBudget.MinRetries))
+	}
+
+	return v.err()
+}
+
+// validateController validates config, and the invoker injected in place of
+// the one built from config, if any.
+func validateController(config *ControllerConfig, invoker *Invoker) error {
+	var errs ConfigErrors
+	if err := config.Validate(); err != nil {
+		errs = append(errs, err.(ConfigErrors)...)
+	}
+	if invoker != nil {
+		if err := invoker.Validate(); err != nil {
+			for _, invalid := range err.(ConfigErrors) {
+				errs = append(errs, &ConfigError{Field: "Invoker." + invalid.Field, Reason: invalid.Reason})
+			}
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// Validate checks the URLs and limits of the Invoker and returns a
+// ConfigErrors listing every invalid value, or nil.
+func (i *Invoker) Validate() error {
+	v := &configValidator{}
+
+	v.url("GatewayURL", i.GatewayURL, true)
+	v.url("CallbackURL", i.CallbackURL, false)
+	v.duration("RetryAfterMaxWait", i.RetryAfterMaxWait)
+	v.duration("MissingFunctionTTL", i.MissingFunctionTTL)
+	if i.Client == nil {
+		v.fail("Client", "is required")
+	}
+	if len(i.DefaultNamespace) > 0 {
+		if err := validateLabel(i.DefaultNamespace); err != nil {
+			v.fail("DefaultNamespace", "namespace %s", err)
+		}
+	}
+
+	return v.err()
+}
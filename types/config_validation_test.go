@@ -0,0 +1,106 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func Test_ControllerConfig_Validate(t *testing.T) {
+	valid := &ControllerConfig{
+		GatewayURL:      "http://gateway:8080",
+		RebuildInterval: time.Second,
+		UpstreamTimeout: time.Minute,
+	}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("want a valid config, got: %s", err)
+	}
+
+	invalid := &ControllerConfig{
+		GatewayURL:               "gateway:8080",
+		AsyncFunctionCallbackURL: "http://%zz",
+		UpstreamTimeout:          -time.Second,
+		RateLimit:                -1,
+		DefaultNamespace:         "Openfaas-fn",
+		CloudEventsMode:          "json",
+		Queue:                    &QueueConfig{OverflowPolicy: QueueOverflowSpill},
+	}
+	err := invalid.Validate()
+	errs, ok := err.(ConfigErrors)
+	if !ok {
+		t.Fatalf("want ConfigErrors, got: %v", err)
+	}
+
+	want := []string{"GatewayURL", "AsyncFunctionCallbackURL", "UpstreamTimeout", "RateLimit", "DefaultNamespace", "CloudEventsMode", "Queue.SpillDir"}
+	if len(errs) != len(want) {
+		t.Fatalf("Errors - want: %d, got: %d (%s)", len(want), len(errs), errs)
+	}
+	for n, field := range want {
+		if errs[n].Field != field {
+			t.Errorf("Error %d - want field: %s, got: %s", n, field, errs[n])
+		}
+	}
+}
+
+func Test_Invoker_Validate(t *testing.T) {
+	invoker := NewInvoker("http://gateway:8080/function", "", http.DefaultClient, false, false)
+	if err := invoker.Validate(); err != nil {
+		t.Fatalf("want a valid invoker, got: %s", err)
+	}
+
+	invoker = NewInvoker("", "callback", nil, false, false)
+	errs, ok := invoker.Validate().(ConfigErrors)
+	if !ok || len(errs) != 3 {
+		t.Errorf("want 3 ConfigErrors, got: %v", errs)
+	}
+}
+
+func Test_NewValidatedController(t *testing.T) {
+	config := &ControllerConfig{
+		GatewayURL:                      "http://gateway:8080",
+		RebuildInterval:                 time.Second,
+		TopicAnnotationDelimiterPattern: "[",
+		Logger:                          NewStdLogger(LevelError),
+	}
+	controller, err := NewValidatedController(nil, config)
+	errs, ok := err.(ConfigErrors)
+	if !ok || len(errs) != 1 || errs[0].Field != "TopicAnnotationDelimiterPattern" {
+		t.Fatalf("want a TopicAnnotationDelimiterPattern error, got: %v", err)
+	}
+	if controller != nil {
+		t.Errorf("want no controller, got: %v", controller)
+	}
+
+	config.TopicAnnotationDelimiterPattern = "[,;]"
+	controller, err = NewValidatedController(nil, config)
+	if err != nil || controller == nil {
+		t.Fatalf("want a controller, got: %v", err)
+	}
+}
+
+func Test_NewValidatedController_InjectedInvoker(t *testing.T) {
+	config := &ControllerConfig{
+		GatewayURL:      "http://gateway:8080",
+		RebuildInterval: time.Second,
+		Logger:          NewStdLogger(LevelError),
+	}
+	options := &controllerOptions{invoker: NewInvoker("", "", nil, false, false)}
+	_, err := newController(nil, config, options, true)
+	errs, ok := err.(ConfigErrors)
+	if !ok || len(errs) == 0 || errs[0].Field != "Invoker.GatewayURL" {
+		t.Fatalf("want an Invoker.GatewayURL error, got: %v", err)
+	}
+}
+
+func Test_NewValidatedInvoker(t *testing.T) {
+	if _, err := NewValidatedInvoker("http://gateway:8080/function", "", http.DefaultClient, false, false); err != nil {
+		t.Fatalf("want a valid invoker, got: %s", err)
+	}
+	invoker, err := NewValidatedInvoker("gateway", "", http.DefaultClient, false, false)
+	if err == nil || invoker != nil {
+		t.Errorf("want an error and no invoker, got: %v, %v", invoker, err)
+	}
+}
@@ -0,0 +1,305 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/openfaas/faas-provider/auth"
+)
+
+// ControlOptions configures the authentication of the control API. At least
+// one of the methods must be set, otherwise every request is rejected.
+type ControlOptions struct {
+	// Token is accepted as a bearer token in the Authorization header.
+	Token string
+
+	// Credentials are accepted as basic authentication.
+	Credentials *auth.BasicAuthCredentials
+
+	// Journal is queried by GET /journal, if set.
+	Journal *Journal
+}
+
+// ControlStatus is the state of the controller reported by the control API.
+type ControlStatus struct {
+	Paused    bool     `json:"paused"`
+	RateLimit float64  `json:"rateLimit"`
+	Burst     int      `json:"burst"`
+	Topics    []string `json:"topics"`
+}
+
+type rateLimitRequest struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+type logLevelRequest struct {
+	Level       string `json:"level"`
+	PrintBodies bool   `json:"printBodies"`
+	RevertAfter string `json:"revertAfter"`
+}
+
+type drainRequest struct {
+	Function string `json:"function"`
+	Timeout  string `json:"timeout"`
+}
+
+// defaultDrainTimeout is the drain timeout of the control API when the
+// request doesn't set one.
+const defaultDrainTimeout = 30 * time.Second
+
+type controlHandler struct {
+	controller Controller
+	options    ControlOptions
+	mux        *http.ServeMux
+
+	// the optional interfaces of the controller, nil if not implemented
+	runtime  RuntimeController
+	health   HealthController
+	topicMap TopicMapController
+}
+
+// NewControlHandler returns an authenticated http.Handler to operate a
+// controller at runtime:
+//
+//	GET  /status     returns a ControlStatus
+//	POST /pause      pauses the invocations
+//	POST /resume     resumes the invocations
+//	POST /rate-limit changes the rate limit: {"rate": 10, "burst": 20}
+//	POST /log-level  changes the log level: {"level": "debug"}, optionally
+//	                 printing the response bodies and reverting after a
+//	                 while: {"level": "debug", "printBodies": true,
+//	                 "revertAfter": "10m"}
+//	POST /resync     rebuilds the topic map immediately
+//	GET  /health     returns the FunctionHealth of the functions
+//	GET  /stats      returns the Stats of the recent invocations
+//	POST /drain      drains a function: {"function": "echo", "timeout": "30s"}
+//	POST /undrain    resumes a drained function: {"function": "echo"}
+//	GET  /journal    returns the entries of the Journal of the options
+//	                 matching the "topic", "function", "tenant", "since",
+//	                 "until" and "limit" query parameters
+//
+// The endpoints need the controller to implement RuntimeController,
+// TopicMapController (/resync) or HealthController (/health and /stats),
+// and the Journal to be set (/journal), and answer 501 otherwise.
+func NewControlHandler(controller Controller, options ControlOptions) http.Handler {
+	h := &controlHandler{
+		controller: controller,
+		options:    options,
+		mux:        http.NewServeMux(),
+	}
+	h.runtime, _ = controller.(RuntimeController)
+	h.health, _ = controller.(HealthController)
+	h.topicMap, _ = controller.(TopicMapController)
+
+	h.mux.HandleFunc("/status", h.get(h.status))
+	h.mux.HandleFunc("/pause", h.post(h.implements(h.runtime != nil, h.pause)))
+	h.mux.HandleFunc("/resume", h.post(h.implements(h.runtime != nil, h.resume)))
+	h.mux.HandleFunc("/rate-limit", h.post(h.implements(h.runtime != nil, h.rateLimit)))
+	h.mux.HandleFunc("/log-level", h.post(h.implements(h.runtime != nil, h.logLevel)))
+	h.mux.HandleFunc("/resync", h.post(h.implements(h.topicMap != nil, h.resync)))
+	h.mux.HandleFunc("/health", h.get(h.implements(h.health != nil, h.functionHealth)))
+	h.mux.HandleFunc("/stats", h.get(h.implements(h.health != nil, h.stats)))
+	h.mux.HandleFunc("/drain", h.post(h.implements(h.runtime != nil, h.drain)))
+	h.mux.HandleFunc("/undrain", h.post(h.implements(h.runtime != nil, h.undrain)))
+	h.mux.HandleFunc("/journal", h.get(h.implements(options.Journal != nil, h.journal)))
+
+	return h
+}
+
+func (h *controlHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.authenticated(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="connector"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *controlHandler) authenticated(r *http.Request) bool {
+	if len(h.options.Token) > 0 {
+		header := r.Header.Get("Authorization")
+		if strings.HasPrefix(header, "Bearer ") &&
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(header, "Bearer ")), []byte(h.options.Token)) == 1 {
+			return true
+		}
+	}
+
+	if h.options.Credentials != nil {
+		user, password, ok := r.BasicAuth()
+		if ok &&
+			subtle.ConstantTimeCompare([]byte(user), []byte(h.options.Credentials.User)) == 1 &&
+			subtle.ConstantTimeCompare([]byte(password), []byte(h.options.Credentials.Password)) == 1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (h *controlHandler) get(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (h *controlHandler) post(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost && r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// implements answers 501 unless the controller implements the optional
+// interface needed by next.
+func (h *controlHandler) implements(implemented bool, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !implemented {
+			http.Error(w, "not supported by the controller", http.StatusNotImplemented)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (h *controlHandler) status(w http.ResponseWriter, r *http.Request) {
+	status := ControlStatus{Topics: h.controller.Topics()}
+	if h.runtime != nil {
+		status.Paused = h.runtime.Paused()
+		status.RateLimit, status.Burst = h.runtime.RateLimit()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(status)
+}
+
+func (h *controlHandler) functionHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(h.health.FunctionHealth())
+}
+
+func (h *controlHandler) stats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(h.health.Stats())
+}
+
+func (h *controlHandler) journal(w http.ResponseWriter, r *http.Request) {
+	h.options.Journal.ServeHTTP(w, r)
+}
+
+func (h *controlHandler) pause(w http.ResponseWriter, r *http.Request) {
+	h.runtime.Pause()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *controlHandler) resume(w http.ResponseWriter, r *http.Request) {
+	h.runtime.Resume()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *controlHandler) rateLimit(w http.ResponseWriter, r *http.Request) {
+	var req rateLimitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %s", err), http.StatusBadRequest)
+		return
+	}
+	if req.Rate < 0 || req.Burst < 0 {
+		http.Error(w, "rate and burst must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	h.runtime.SetRateLimit(req.Rate, req.Burst)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *controlHandler) logLevel(w http.ResponseWriter, r *http.Request) {
+	var req logLevelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	level, err := ParseLogLevel(req.Level)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var revertAfter time.Duration
+	if len(req.RevertAfter) > 0 {
+		if revertAfter, err = time.ParseDuration(req.RevertAfter); err != nil || revertAfter <= 0 {
+			http.Error(w, fmt.Sprintf("invalid revertAfter: %q", req.RevertAfter), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := h.runtime.SetVerbosity(level, req.PrintBodies, revertAfter); err != nil {
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *controlHandler) resync(w http.ResponseWriter, r *http.Request) {
+	if err := h.topicMap.RefreshTopicMap(r.Context()); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *controlHandler) drain(w http.ResponseWriter, r *http.Request) {
+	var req drainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	timeout := defaultDrainTimeout
+	if len(req.Timeout) > 0 {
+		var err error
+		if timeout, err = time.ParseDuration(req.Timeout); err != nil || timeout <= 0 {
+			http.Error(w, fmt.Sprintf("invalid timeout: %q", req.Timeout), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := ValidateFunctionRef(req.Function); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.runtime.DrainFunction(req.Function, timeout); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *controlHandler) undrain(w http.ResponseWriter, r *http.Request) {
+	var req drainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.runtime.ResumeFunction(req.Function); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
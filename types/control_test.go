@@ -0,0 +1,107 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_ControlHandler(t *testing.T) {
+	controller := NewController(nil, &ControllerConfig{
+		GatewayURL:      "http://127.0.0.1:8080",
+		RebuildInterval: time.Second,
+	}).(*controller)
+	handler := NewControlHandler(controller, ControlOptions{Token: "secret"})
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		body       string
+		wantStatus int
+	}{
+		{name: "missing token", method: http.MethodPost, path: "/pause", wantStatus: http.StatusUnauthorized},
+		{name: "wrong token", method: http.MethodPost, path: "/pause", token: "wrong", wantStatus: http.StatusUnauthorized},
+		{name: "pause", method: http.MethodPost, path: "/pause", token: "secret", wantStatus: http.StatusNoContent},
+		{name: "rate limit", method: http.MethodPost, path: "/rate-limit", token: "secret", body: `{"rate": 5, "burst": 10}`, wantStatus: http.StatusNoContent},
+		{name: "invalid rate limit", method: http.MethodPost, path: "/rate-limit", token: "secret", body: `{"rate": -1}`, wantStatus: http.StatusBadRequest},
+		{name: "log level", method: http.MethodPost, path: "/log-level", token: "secret", body: `{"level": "warn"}`, wantStatus: http.StatusNoContent},
+		{name: "unknown log level", method: http.MethodPost, path: "/log-level", token: "secret", body: `{"level": "verbose"}`, wantStatus: http.StatusBadRequest},
+		{name: "resync before map builder", method: http.MethodPost, path: "/resync", token: "secret", wantStatus: http.StatusServiceUnavailable},
+		{name: "status", method: http.MethodGet, path: "/status", token: "secret", wantStatus: http.StatusOK},
+		{name: "health", method: http.MethodGet, path: "/health", token: "secret", wantStatus: http.StatusOK},
+		{name: "stats", method: http.MethodGet, path: "/stats", token: "secret", wantStatus: http.StatusOK},
+		{name: "drain", method: http.MethodPost, path: "/drain", token: "secret", body: `{"function": "echo", "timeout": "1s"}`, wantStatus: http.StatusNoContent},
+		{name: "drain invalid function", method: http.MethodPost, path: "/drain", token: "secret", body: `{"function": "Echo"}`, wantStatus: http.StatusBadRequest},
+		{name: "undrain", method: http.MethodPost, path: "/undrain", token: "secret", body: `{"function": "echo"}`, wantStatus: http.StatusNoContent},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+			if len(test.token) > 0 {
+				req.Header.Set("Authorization", "Bearer "+test.token)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != test.wantStatus {
+				t.Errorf("Status - want: %d, got: %d (%s)", test.wantStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+
+	if !controller.Paused() {
+		t.Errorf("Controller - want paused")
+	}
+	if rate, burst := controller.RateLimit(); rate != 5 || burst != 10 {
+		t.Errorf("Rate limit - want: %v/%d, got: %v/%d", 5, 10, rate, burst)
+	}
+}
+
+// topicsController implements Controller only.
+type topicsController struct{}
+
+func (topicsController) Subscribe(subscriber ResponseSubscriber)                              {}
+func (topicsController) Invoke(topic string, message *[]byte)                                 {}
+func (topicsController) InvokeWithContext(ctx context.Context, topic string, message *[]byte) {}
+func (topicsController) BeginMapBuilder()                                                     {}
+func (topicsController) Topics() []string                                                     { return []string{"orders"} }
+
+func Test_ControlHandler_OptionalInterfaces(t *testing.T) {
+	handler := NewControlHandler(topicsController{}, ControlOptions{Token: "secret"})
+
+	tests := []struct {
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{method: http.MethodGet, path: "/status", wantStatus: http.StatusOK},
+		{method: http.MethodPost, path: "/pause", wantStatus: http.StatusNotImplemented},
+		{method: http.MethodPost, path: "/resync", wantStatus: http.StatusNotImplemented},
+		{method: http.MethodGet, path: "/stats", wantStatus: http.StatusNotImplemented},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, test.path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != test.wantStatus {
+			t.Errorf("%s - want: %d, got: %d", test.path, test.wantStatus, rr.Code)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	NewProbeHandler(topicsController{}).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rr.Code != http.StatusNotImplemented {
+		t.Errorf("Probe - want: %d, got: %d", http.StatusNotImplemented, rr.Code)
+	}
+}
@@ -6,11 +6,17 @@ package types
 import (
 	"context"
 	"fmt"
-	"log"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"regexp"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/openfaas/faas-provider/auth"
+	"github.com/pkg/errors"
 )
 
 // ControllerConfig configures a connector SDK controller
@@ -27,12 +33,29 @@ type ControllerConfig struct {
 	// PrintResponseBody if true prints the function response body to stdout
 	PrintResponseBody bool
 
+	// PrintSampleRate is the fraction of the successful responses printed, e.g. 0.01 for 1%, so that PrintResponse
+	// can stay enabled at high volume. Errors are always printed. Zero prints every response.
+	PrintSampleRate float64
+
+	// PrintMaxBodyLength truncates the printed response bodies to this number of bytes. Zero prints the whole body.
+	PrintMaxBodyLength int
+
 	// RebuildInterval the interval at which the topic map is rebuilt
 	RebuildInterval time.Duration
 
 	// TopicAnnotationDelimiter defines the character upon which to split the Topic annotation value
 	TopicAnnotationDelimiter string
 
+	// TopicAnnotationDelimiterPattern is a regular expression splitting the Topic annotation value on each match, in
+	// place of TopicAnnotationDelimiter, e.g. `[,;\s]+` to accept topics separated by commas, semicolons or spaces.
+	TopicAnnotationDelimiterPattern string
+
+	// TopicNormalization rewrites the topics declared by the functions before they are added to the topic map, e.g.
+	// to lowercase them or strip a prefix, so that typos and case differences in the annotations don't break routing.
+	// It applies to the topics of the TopicSource and the StaticTopics too, and to the topic of each message before
+	// it is matched.
+	TopicNormalization TopicNormalization
+
 	// AsyncFunctionInvocation if true points to the asynchronous function route
 	AsyncFunctionInvocation bool
 
@@ -45,14 +68,339 @@ type ControllerConfig struct {
 	// Namespace defines the namespace of the functions to be mapped and invoked. If empty, all namespaces will be used.
 	Namespace string
 
+	// Namespaces maps the functions of these namespaces only, in place of Namespace, without discovering the others.
+	Namespaces []string
+
+	// ExcludeNamespaces are never mapped, e.g. the namespaces of the system functions when all of them are discovered.
+	ExcludeNamespaces []string
+
+	// NamespaceSelector maps the functions of the namespaces whose labels or annotations, served by the gateway,
+	// match every key and value, an empty value matching any value. New namespaces matching it are picked up by the
+	// next rebuild of the topic map.
+	NamespaceSelector map[string]string
+
+	// SkipNamespaceDiscovery maps the functions of DefaultNamespace (or of the default namespace of the gateway) only,
+	// without listing the namespaces. Discovery also falls back to it, with a warning, when the gateway answers the
+	// namespaces listing with 401 or 403, e.g. under restricted RBAC.
+	SkipNamespaceDiscovery bool
+
+	// DisableFunctionListCache lists the functions with full requests on every rebuild of the topic map. By default
+	// the lists are requested with If-None-Match, and the previous list of a namespace is reused when the gateway
+	// answers 304 Not Modified.
+	DisableFunctionListCache bool
+
+	// NamespaceCacheTTL keeps the discovered namespaces, and the metadata read for the NamespaceSelector, for this
+	// duration instead of getting them on every rebuild of the topic map, as they change far less often than the
+	// functions. RefreshTopicMap gets them again.
+	NamespaceCacheTTL time.Duration
+
+	// FunctionPageSize lists the functions by pages of FunctionPageSize, for providers paginating /system/functions
+	// with the limit parameter and a Link header to the next page. MaxFunctionPages caps the pages listed per
+	// namespace, defaults to 1000.
+	FunctionPageSize int
+	MaxFunctionPages int
+
+	// DiscoveryRateLimit limits the calls listing the namespaces and the functions of the gateway per second, with
+	// bursts of up to DiscoveryRateLimitBurst calls, so that many replicas or a short RebuildInterval don't overload
+	// it. With a SharedState, the limit applies across the replicas. A rate of zero disables the limit.
+	DiscoveryRateLimit      float64
+	DiscoveryRateLimitBurst int
+
+	// RebuildJitter shifts each rebuild of the topic map by a random duration of up to RebuildJitter times the
+	// RebuildInterval, earlier or later, so that the replicas started together don't rebuild at the same time.
+	// Between 0 and 1, defaults to 0.
+	RebuildJitter float64
+
+	// FunctionSource lists the functions mapped from their annotations in place of the gateway, e.g. from a file with
+	// FileFunctionSource. A FunctionWatcher, such as KubernetesFunctionSource, also rebuilds the topic map as soon as
+	// the functions change. It is ignored when TopicSource is set.
+	FunctionSource FunctionSource
+
+	// NamespaceRetries is the number of retries of a failed listing of the functions of a namespace during a rebuild
+	// of the topic map, with a backoff starting at NamespaceRetryBackoff, 100ms if unset, and doubling on each retry.
+	NamespaceRetries      int
+	NamespaceRetryBackoff time.Duration
+
+	// PartialSync rebuilds the topic map from the namespaces listed successfully when others fail, keeping the
+	// functions of the failed namespaces as they were. The failure is still reported to OnSyncError, and the rebuild
+	// retried. By default a failed namespace fails the whole rebuild. A gateway that can't be reached always fails it.
+	PartialSync bool
+
+	// SkipNotReadyFunctions leaves out of the topic map the functions with replicas requested but none available, to
+	// avoid the errors of the invocations made right after a deploy. They are mapped again by the first rebuild once
+	// a replica is available. Functions scaled to zero are kept, the gateway scales them up when they are invoked.
+	SkipNotReadyFunctions bool
+
 	// SendTopic defines whether the topic will be sent in the invocation request using the header 'X-Topic'.
 	SendTopic bool
 
+	// TopicHeader overrides the name of the header used to send the topic when SendTopic is enabled.
+	TopicHeader string
+
 	// TopicMatcher overrides how the topic received is matched against the mapped functions. Defaults to an equality check.
 	TopicMatcher MatchTopicFunc
+
+	// DuplicateFunctionPolicy defines what to do when a function with the same name is subscribed to the same topic
+	// in several namespaces. Defaults to invoking all of them.
+	DuplicateFunctionPolicy DuplicateFunctionPolicy
+
+	// NamespacePreference defines the namespace priority used by the DuplicatePreferNamespace policy.
+	NamespacePreference []string
+
+	// DefaultNamespace is applied at invocation time to the mapped functions without a namespace, which is the case
+	// for providers that don't support namespaces. If empty, the gateway's default namespace is used.
+	DefaultNamespace string
+
+	// Logger is used by the controller and the invoker. Defaults to the standard log package, including the
+	// per-invocation messages logged at debug level.
+	Logger Logger
+
+	// ClientOptions tunes the transport of the HTTP clients used to invoke functions and to query the gateway.
+	ClientOptions ClientOptions
+
+	// AsyncTracker records the call IDs of the asynchronous invocations so their results can be awaited. It must be
+	// mounted as the handler of AsyncFunctionCallbackURL.
+	AsyncTracker *AsyncTracker
+
+	// RateLimit defines the maximum number of invocations per second. Zero means no limit. It can be changed at
+	// runtime with the control API.
+	RateLimit float64
+
+	// RateLimitBurst defines the number of invocations allowed to exceed RateLimit in a burst.
+	RateLimitBurst int
+
+	// CloudEventsMode wraps the messages as CloudEvents 1.0 in binary or structured mode, using the topic as the
+	// type and subject of the events. Disabled by default.
+	CloudEventsMode CloudEventsMode
+
+	// CloudEventsSource defines the source of the CloudEvents. Defaults to "connector-sdk".
+	CloudEventsSource string
+
+	// SharedState is used to enforce the RateLimit and the DiscoveryRateLimit collectively when several replicas of
+	// the connector are running. The circuit breakers and the duplicate windows are still kept per replica.
+	SharedState SharedState
+
+	// AttributeHeaders maps the attributes of the invoked messages to the headers used to send them.
+	AttributeHeaders map[string]string
+
+	// AttributeHeaderPrefix is prepended to the message attributes not found in AttributeHeaders to build the header
+	// name. If empty, those attributes are not sent.
+	AttributeHeaderPrefix string
+
+	// StatsReportInterval defines how often the error rate and p95 latency observed for each function are written
+	// back to the gateway as function annotations, merged into the deployment and only when they changed. Zero, the
+	// default, disables the report: the stats are available through Stats, the control API and the Metrics without
+	// writing to the functions.
+	StatsReportInterval time.Duration
+
+	// AdaptiveAsync switches a topic to asynchronous invocations when its in-flight invocations or synchronous
+	// latency exceed the configured thresholds, and back when the load subsides. Only used when
+	// AsyncFunctionInvocation is false.
+	AdaptiveAsync *AdaptiveAsync
+
+	// TracerProvider enables tracing with a span per invocation and per topic map sync.
+	TracerProvider TracerProvider
+
+	// RetryAfterMaxWait enables retrying the invocations rejected with 429 after the delay given by their
+	// Retry-After header (one second if missing), up to this maximum total wait. Zero disables the retries.
+	RetryAfterMaxWait time.Duration
+
+	// ShouldRetry decides which invocations are retried when RetryAfterMaxWait is set, given their response or
+	// transport error, e.g. to retry a function's 503 but not its 409. Defaults to retrying 429 only.
+	ShouldRetry func(res InvokerResponse) bool
+
+	// RetryBudget caps the retries (429 retries and gateway failovers) to a ratio of the invocations over a sliding
+	// window, so that retry storms during a gateway outage don't amplify the load. Retries are unbounded if nil.
+	RetryBudget *RetryBudget
+
+	// Archiver archives the payloads sent to the functions, and optionally their responses, to a file system or an
+	// S3 compatible object storage.
+	Archiver *Archiver
+
+	// Metrics exports the invocations by topic, function and status class with their durations, the topic map,
+	// its syncs and the discovery of the functions as Prometheus metrics.
+	Metrics *Metrics
+
+	// ResponseBufferSize is the capacity of the channel delivering the responses to the subscribers. Defaults to 0
+	// (unbuffered).
+	ResponseBufferSize int
+
+	// DropResponsesOnOverflow drops the responses when the response buffer is full, instead of blocking the
+	// invocations until the subscribers catch up.
+	DropResponsesOnOverflow bool
+
+	// OnResponseOverflow is called with each dropped response, if set.
+	OnResponseOverflow func(InvokerResponse)
+
+	// ResponseCache caches the successful responses by function and payload, or by event data in the structured
+	// CloudEvents mode, so identical invocations within its TTL do not invoke the functions again. Only use it with
+	// idempotent functions.
+	ResponseCache *ResponseCache
+
+	// TopicContentTypes maps topics to the Content-Type header sent to the functions, e.g. "application/avro" for
+	// Avro topics. Other topics use DefaultContentType, if set. Ignored in the structured CloudEvents mode.
+	TopicContentTypes  map[string]string
+	DefaultContentType string
+
+	// OrderedDelivery delivers the responses of each topic to the subscribers in the order the messages were
+	// invoked, at the cost of holding back the responses of slower invocations.
+	OrderedDelivery bool
+
+	// OrderedByKey invokes the messages of a topic sharing a Message.Key one at a time, in the order they were
+	// received, while the messages with different keys are invoked in parallel, e.g. to preserve the order of the
+	// events of an entity. With a Queue, the order is the order in which the messages were queued.
+	OrderedByKey bool
+
+	// SelftestFunction is the health-check function invoked by Selftest, if set. SelftestPayload is the synthetic
+	// payload sent to it. Defaults to {"selftest":true}.
+	SelftestFunction string
+	SelftestPayload  []byte
+
+	// IDGenerator generates the IDs of the events and invocations, e.g. ULIDGenerator or UUIDv7Generator for
+	// sortable IDs, or SequentialIDGenerator in tests. Defaults to random IDs.
+	IDGenerator IDGenerator
+
+	// Queue places a queue with a memory budget between the controller and the invoker, if set. InvokeMessage
+	// then returns once the message is queued, and the messages are invoked by a pool of workers.
+	Queue *QueueConfig
+
+	// ResponseTransformer normalizes or validates each response before it is delivered to the subscribers, if set.
+	ResponseTransformer ResponseTransformer
+
+	// CircuitBreaker stops invoking a function after consecutive failures, if set.
+	CircuitBreaker *CircuitBreaker
+
+	// ExpiringHeaders are forwarded to every function with a TTL, e.g. short-lived tokens. Expired headers are
+	// refreshed with their HeaderRefresher, or stripped.
+	ExpiringHeaders *ExpiringHeaders
+
+	// Gateways are additional gateways the invocations can be sent to, with their zones. The gateways of the local
+	// Zone are preferred, by latency measured every GatewayProbeInterval (default 10s), and the invocations fail
+	// over to other zones only when the local gateways are unreachable. GatewayURL is part of the pool even if it
+	// isn't listed.
+	Gateways             []Gateway
+	Zone                 string
+	GatewayProbeInterval time.Duration
+
+	// GatewayURLs are fallback gateways for HA deployments: the invocations are sent to GatewayURL, and fail over to
+	// the next healthy gateway in this order on connection errors. The gateways are probed every
+	// GatewayProbeInterval, so the invocations return to GatewayURL once it is reachable again. When set, the
+	// Gateways are tried after them, regardless of their Zone.
+	GatewayURLs []string
+
+	// GatewayBalancing spreads the invocations and the topic map builds over the healthy gateways of the local Zone,
+	// or over all the healthy GatewayURLs, round-robin or to the gateway with the fewest requests in flight. By
+	// default, the most preferred gateway is used.
+	GatewayBalancing GatewayBalancing
+
+	// MissingFunctionTTL is how long a function answered with 404 is considered missing: its invocations fail
+	// with ErrFunctionNotFound without calling the gateway, and the topic map is rebuilt. Zero disables it. Do not
+	// enable it if the functions themselves respond with 404.
+	MissingFunctionTTL time.Duration
+
+	// PropagateHeaders lists the request headers (e.g. a tenant, correlation or partition header, including the ones
+	// built from the message attributes) copied into the Metadata of each InvokerResponse, so that subscribers can
+	// attribute the responses without the original message.
+	PropagateHeaders []string
+
+	// DebugSignals enables debug logging and response body printing on SIGUSR1 for DebugSignalTimeout (15 minutes
+	// by default), and reverts them on SIGUSR2. Not supported on Windows.
+	DebugSignals       bool
+	DebugSignalTimeout time.Duration
+
+	// DiscardResponseBodies drains the responses of the functions without buffering their bodies, for connectors
+	// that only use the status codes. The responses are delivered with an empty body and are not cached.
+	DiscardResponseBodies bool
+
+	// TenantResolver labels each invocation with its tenant, from its topic, function and namespace, or message
+	// metadata. The tenant is reported in InvokerResponse.Tenant, the logs of the ResponsePrinter, the traces, the
+	// journal and archive records, and accounted per tenant by the Metrics.
+	TenantResolver TenantResolver
+
+	// Tenants maps each tenant to the namespaces of its functions. Every tenant has its own topic map, rebuilt with
+	// the main one like it (from the TopicSource, or the functions of its namespaces, and the StaticTopics) but only
+	// keeping the functions of its namespaces, and its messages are invoked with InvokeForTenant, so that one
+	// connector can serve several tenants without mixing their subscriptions. A tenant that fails to build keeps its
+	// last map without failing the sync; its error is logged and reported by TenantErrors.
+	Tenants map[string][]string
+
+	// OnSyncError is called with each failed rebuild of the topic map and the number of consecutive failures, e.g. to
+	// alert or to exit after too many. The topic map built last keeps being used. Defaults to logging the error.
+	OnSyncError func(err error, failures int)
+
+	// TopicSource builds the topics of the functions instead of discovering them from their "topic" annotation, e.g.
+	// from Kubernetes resources or a database. If it implements MetadataTopicSource, the metadata of the functions
+	// is used too.
+	TopicSource TopicSource
+
+	// StaticTopics maps topics to functions in addition to the functions discovered from their "topic" annotation,
+	// e.g. on gateways where the annotations can't be edited. StaticTopicsFile is a JSON file with the same mapping,
+	// read on each rebuild of the topic map (see LoadTopicMapFile). SkipTopicDiscovery uses the static topics only,
+	// without listing the functions of the gateway, e.g. for local testing.
+	StaticTopics       map[string][]string
+	StaticTopicsFile   string
+	SkipTopicDiscovery bool
+
+	// OnTopicMapChange is called after each rebuild that changed the topic map, with the topics and functions added
+	// and removed, e.g. to subscribe to or unsubscribe from the topics of a broker. The first rebuild reports every
+	// topic as added. It is called by the map builder, so it must return quickly and must not call RefreshTopicMap.
+	OnTopicMapChange func(change TopicMapChange)
+
+	// Auth authenticates the requests to the gateway, the discovery and the invocations, e.g. with a TokenAuth for
+	// OpenFaaS IAM. It takes precedence over the basic auth credentials, which don't authenticate the invocations.
+	Auth ClientAuth
+
+	// OnDiscovery is called after each discovery of the functions of the topic map, with the time spent, the
+	// namespaces scanned, the functions and topics found and the errors per namespace, which the Metrics export too.
+	// It is called by the map builder, so it must return quickly.
+	OnDiscovery func(stats DiscoveryStats)
+
+	// SyncRetryBackoff is the delay before retrying a failed rebuild of the topic map, doubled after each consecutive
+	// failure up to RebuildInterval. Defaults to one second.
+	SyncRetryBackoff time.Duration
+
+	// DeadLetterSink receives the failed invocations once their retries are exhausted, with the original message and
+	// the failure, e.g. a NewFunctionDeadLetterSink, an HTTPDeadLetterSink or a FileDeadLetterSink. DeadLetterPolicy
+	// decides which invocations failed, by default the ones with an error or a 4xx or 5xx status, except the cached
+	// responses and the invocations rejected by the connector itself. The dead letters are delivered in the background,
+	// with up to DeadLetterQueueSize waiting at once, 1000 by default.
+	DeadLetterSink      DeadLetterSink
+	DeadLetterPolicy    func(res InvokerResponse) bool
+	DeadLetterQueueSize int
+
+	// MaxInFlight caps the messages invoked concurrently, so that connectors apply backpressure to their sources:
+	// once reached, the Invoke methods block until an invocation returns or their context is done, or fail at once
+	// with ErrBusy if RejectWhenBusy is set. Zero means no limit. Messages pushed to the Queue are not counted, the
+	// Queue Workers bound them.
+	MaxInFlight    int
+	RejectWhenBusy bool
+
+	// PausePolicy decides what happens to the messages received while the controller is paused: rejected with
+	// ErrPaused by default, or held until Resume with PauseHold, e.g. during a maintenance window of the gateway.
+	PausePolicy PausePolicy
+
+	// Filters are evaluated in order for each message before its topic is matched, to drop messages such as
+	// heartbeats, or to reject them, e.g. with MaxBodySizeFilter. More filters can be added with AddFilter. The
+	// messages invoked with InvokeFunction are not filtered.
+	Filters []MessageFilter
+
+	// StatsSamples is the number of recent invocations of each topic and function summarized by Stats and reported
+	// every StatsReportInterval. Defaults to 1000.
+	StatsSamples int
+
+	// StatsMaxAge excludes the invocations older than this duration from Stats and InvocationStats. Zero summarizes
+	// the last StatsSamples invocations whatever their age.
+	StatsMaxAge time.Duration
+
+	// ShutdownTimeout bounds the wait for the in-flight invocations when the context of a controller created with
+	// NewControllerWithContext is done. Defaults to 30 seconds.
+	ShutdownTimeout time.Duration
 }
 
 // Controller is used to invoke functions on a per-topic basis and to subscribe to responses returned by said functions.
+// The controllers of NewController implement the optional MessageController, TenantController, TopicMapController,
+// LifecycleController, RuntimeController and HealthController interfaces too, which can be checked with type
+// assertions.
 type Controller interface {
 	Subscribe(subscriber ResponseSubscriber)
 	Invoke(topic string, message *[]byte)
@@ -82,39 +430,231 @@ type controller struct {
 
 	// Lock used for synchronizing subscribers
 	Lock *sync.RWMutex
+
+	// Logger used by the controller
+	Logger Logger
+
+	// Tracer used to trace the topic map syncs, if set
+	Tracer Tracer
+
+	// topicSource is set once the map builder has started
+	topicSource TopicSource
+
+	// pause holds or rejects the messages while the controller is paused
+	pause pauseGate
+
+	// syncGroup coalesces the concurrent rebuilds of the topic map
+	syncGroup flightGroup
+
+	// queue holds the messages waiting to be invoked, if enabled
+	queue *invocationQueue
+
+	// verbosity is the log level and body printing changed at runtime
+	verbosity verbosity
+
+	// stop is closed by Stop to end the map builder
+	stop    chan struct{}
+	stopped int32
+
+	// fanOutDone is closed once every response has been delivered to the
+	// subscribers, after the invoker is closed
+	fanOutDone chan struct{}
+
+	reporter     *StatsReporter
+	debugSignals chan os.Signal
+
+	// filters are evaluated for each message, guarded by Lock
+	filters []MessageFilter
+
+	// inFlight caps the concurrent invocations, if MaxInFlight is set
+	inFlight *inFlightLimiter
+
+	// stats keeps the outcome and latency of the recent invocations
+	stats *StatsCollector
+
+	// lastSync is the time of the last successful topic map sync in Unix
+	// nanoseconds, and syncFailures the number of failed syncs since then
+	lastSync     int64
+	syncFailures int32
+
+	// syncErr holds the syncError of the last sync
+	syncErr atomic.Value
+
+	// builder discovers the topics of the functions in place of the one
+	// built from the config, if set
+	builder *FunctionLookupBuilder
+
+	// now is the clock of the controller
+	now func() time.Time
+
+	// tenants are the topic maps of the Tenants, rebuilt with TopicMap
+	tenants map[string]*tenantTopics
+
+	// discoveryLimiter limits the discovery calls of every lookup builder,
+	// if DiscoveryRateLimit is set
+	discoveryLimiter *RateLimiter
+
+	// namespaceCache keeps the namespaces discovered by the lookup builders,
+	// if NamespaceCacheTTL is set
+	namespaceCache *NamespaceCache
+
+	// topicDelimiterPattern is the compiled TopicAnnotationDelimiterPattern
+	topicDelimiterPattern *regexp.Regexp
 }
 
-// NewController create a new connector SDK controller
+// NewController create a new connector SDK controller. An invalid config is
+// logged and the controller is created anyway, use NewValidatedController to
+// fail fast instead. If the Queue can't be created, e.g. because its
+// PersistDir can't be recovered, the error is logged and the messages are
+// invoked without the queue.
 func NewController(credentials *auth.BasicAuthCredentials, config *ControllerConfig) Controller {
+	c, _ := newController(credentials, config, &controllerOptions{}, false)
+	return c
+}
 
-	gatewayFunctionPath := gatewayRoute(config)
+// NewValidatedController creates a controller like NewController, or returns
+// the ConfigErrors of config, or the error creating its Queue, without
+// creating it.
+func NewValidatedController(credentials *auth.BasicAuthCredentials, config *ControllerConfig) (Controller, error) {
+	c, err := newController(credentials, config, &controllerOptions{}, true)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
 
-	invoker := NewInvoker(gatewayFunctionPath,
-		config.AsyncFunctionCallbackURL,
-		MakeClient(config.UpstreamTimeout),
-		config.PrintResponse, config.SendTopic)
+// newController wires a controller from config, with the components injected
+// through options in place of the ones built from config. When strict is
+// true, an invalid config or injected invoker is returned as an error before
+// anything is started, otherwise it is logged and the invalid options, or the
+// queue that can't be created, are ignored.
+func newController(credentials *auth.BasicAuthCredentials, config *ControllerConfig, options *controllerOptions, strict bool) (*controller, error) {
+	logger := config.Logger
+	if logger == nil {
+		logger = NewStdLogger(LevelDebug)
+	}
+
+	if err := validateController(config, options.invoker); err != nil {
+		if strict {
+			return nil, err
+		}
+		logger.Errorf("%s", err)
+	}
+
+	var queue *invocationQueue
+	if config.Queue != nil {
+		var err error
+		if queue, err = newInvocationQueue(*config.Queue, config.Metrics, logger); err != nil {
+			err = errors.Wrap(err, "unable to create the queue")
+			if strict {
+				return nil, err
+			}
+			logger.Errorf("%s, invoking the messages without the queue", err)
+		}
+	}
+
+	var tracer Tracer
+	if config.TracerProvider != nil {
+		tracer = config.TracerProvider.Tracer(tracerName)
+	}
+
+	invoker := options.invoker
+	if invoker == nil {
+		invoker = newConfigInvoker(credentials, config, logger, tracer)
+	} else if invoker.Logger == nil {
+		invoker.Logger = logger
+	}
+
+	now := time.Now
+	if options.now != nil {
+		now = options.now
+		invoker.health.now = now
+	}
 
 	subs := []ResponseSubscriber{}
 
-	topicMap := NewTopicMap(config.TopicMatcher)
+	topicMap := options.topicMap
+	if topicMap == nil {
+		defaultTopicMap := NewTopicMap(config.TopicMatcher)
+		topicMap = &defaultTopicMap
+	}
 
 	c := controller{
 		Config:      config,
 		Invoker:     invoker,
-		TopicMap:    &topicMap,
+		TopicMap:    topicMap,
 		Credentials: credentials,
 		Subscribers: subs,
 		Lock:        &sync.RWMutex{},
+		Logger:      logger,
+		Tracer:      tracer,
+		stop:        make(chan struct{}),
+		fanOutDone:  make(chan struct{}),
+		stats:       newControllerStats(config),
+		filters:     append([]MessageFilter(nil), config.Filters...),
+		inFlight:    newInFlightLimiter(config.MaxInFlight, config.RejectWhenBusy),
+		builder:     options.lookupBuilder,
+		now:         now,
+
+		discoveryLimiter: newDiscoveryLimiter(config),
+		namespaceCache:   NewNamespaceCache(config.NamespaceCacheTTL),
+	}
+	if len(config.TopicAnnotationDelimiterPattern) > 0 {
+		// an invalid pattern is reported by Validate, and falls back to the
+		// TopicAnnotationDelimiter
+		c.topicDelimiterPattern, _ = regexp.Compile(config.TopicAnnotationDelimiterPattern)
+	}
+	c.tenants = c.newTenantTopics()
+
+	if invoker.MissingFunctionTTL > 0 {
+		invoker.OnMissingFunction = func(function string) {
+			go func() {
+				if err := c.resync(); err != nil {
+					logger.Debugf("Unable to rebuild the topic map after %s was not found: %s", function, err)
+				}
+			}()
+		}
+	}
+
+	if queue != nil {
+		c.queue = queue
+		invoker.keys.notify = queue.wake
+		c.queue.start(func(ctx context.Context, topic string, message *Message) (bool, []string) {
+			if c.Config.PausePolicy == PauseHold {
+				if err := c.admit(ctx); err != nil {
+					finishKeyTurn(ctx)
+					nack(ctx, err)
+					c.Invoker.publish(InvokerResponse{Context: ctx, Error: err, Topic: topic})
+					return true, nil
+				}
+			}
+			return settlement(c.Invoker.InvokeMessageWithResults(ctx, c.TopicMap, topic, message))
+		})
 	}
 
 	if config.PrintResponse {
 		// printer := &{}
-		c.Subscribe(&ResponsePrinter{config.PrintResponseBody})
+		c.Subscribe(&ResponsePrinter{
+			PrintResponseBody: config.PrintResponseBody,
+			SampleRate:        config.PrintSampleRate,
+			MaxBodyLength:     config.PrintMaxBodyLength,
+			Logger:            logger,
+		})
 	}
 
 	go func(ch *chan InvokerResponse, controller *controller) {
+		defer close(controller.fanOutDone)
 		for {
-			res := <-*ch
+			res, ok := <-*ch
+			if !ok {
+				return
+			}
+
+			controller.printBody(res)
+			controller.stats.Response(res)
+			if controller.Config.Metrics != nil {
+				controller.Config.Metrics.observeInvocation(res)
+			}
 
 			controller.Lock.RLock()
 			for _, sub := range controller.Subscribers {
@@ -124,19 +664,151 @@ func NewController(credentials *auth.BasicAuthCredentials, config *ControllerCon
 		}
 	}(&invoker.Responses, &c)
 
-	return &c
+	if config.StatsReportInterval > 0 {
+		reporter := &StatsReporter{
+			GatewayURL:  config.GatewayURL,
+			Client:      MakeClientWithOptions(config.UpstreamTimeout, config.ClientOptions),
+			Credentials: credentials,
+			Auth:        config.Auth,
+			Stats:       c.stats,
+			Logger:      logger,
+		}
+		reporter.Start(config.StatsReportInterval)
+		c.reporter = reporter
+	}
+
+	if config.DebugSignals {
+		c.notifyDebugSignals()
+	}
+
+	return &c, nil
+}
+
+// newConfigInvoker creates the invoker of a controller from config.
+func newConfigInvoker(credentials *auth.BasicAuthCredentials, config *ControllerConfig, logger Logger, tracer Tracer) *Invoker {
+	gatewayFunctionPath := gatewayRoute(config)
+
+	invoker := NewInvoker(gatewayFunctionPath,
+		config.AsyncFunctionCallbackURL,
+		MakeClientWithOptions(config.UpstreamTimeout, config.ClientOptions),
+		config.PrintResponse, config.SendTopic)
+	invoker.DuplicatePolicy = config.DuplicateFunctionPolicy
+	invoker.NamespacePreference = config.NamespacePreference
+	invoker.DefaultNamespace = config.DefaultNamespace
+	invoker.TopicNormalization = config.TopicNormalization
+	invoker.AsyncTracker = config.AsyncTracker
+	invoker.RateLimiter = NewRateLimiter(config.RateLimit, config.RateLimitBurst)
+	invoker.RateLimiter.SharedState = config.SharedState
+	invoker.CloudEventsMode = config.CloudEventsMode
+	invoker.CloudEventsSource = config.CloudEventsSource
+	invoker.AttributeHeaders = config.AttributeHeaders
+	invoker.AttributeHeaderPrefix = config.AttributeHeaderPrefix
+	invoker.TopicHeader = config.TopicHeader
+	invoker.RetryAfterMaxWait = config.RetryAfterMaxWait
+	invoker.ShouldRetry = config.ShouldRetry
+	if config.RetryBudget != nil && config.RetryBudget.Metrics == nil {
+		config.RetryBudget.Metrics = config.Metrics
+	}
+	invoker.RetryBudget = config.RetryBudget
+	invoker.Archiver = config.Archiver
+	if config.ResponseBufferSize > 0 {
+		invoker.Responses = make(chan InvokerResponse, config.ResponseBufferSize)
+	}
+	invoker.ResponseCache = config.ResponseCache
+	invoker.TopicContentTypes = config.TopicContentTypes
+	invoker.DefaultContentType = config.DefaultContentType
+	invoker.OrderedDelivery = config.OrderedDelivery
+	invoker.OrderedByKey = config.OrderedByKey
+	invoker.IDGenerator = config.IDGenerator
+	invoker.ResponseTransformer = config.ResponseTransformer
+	invoker.health.breaker = config.CircuitBreaker
+	invoker.ExpiringHeaders = config.ExpiringHeaders
+	invoker.PropagateHeaders = config.PropagateHeaders
+	invoker.DiscardResponseBodies = config.DiscardResponseBodies
+	invoker.TenantResolver = config.TenantResolver
+	invoker.DeadLetterSink = config.DeadLetterSink
+	invoker.DeadLetterPolicy = config.DeadLetterPolicy
+	invoker.DeadLetterQueueSize = config.DeadLetterQueueSize
+	var pool *GatewayPool
+	if len(config.GatewayURLs) > 0 {
+		pool = NewGatewayPool(config.Zone, Gateway{URL: config.GatewayURL, Zone: config.Zone})
+		for _, url := range config.GatewayURLs {
+			pool.add(Gateway{URL: url, Zone: config.Zone})
+		}
+		for _, gateway := range config.Gateways {
+			pool.add(gateway)
+		}
+		pool.Ordered = true
+	} else if len(config.Gateways) > 0 {
+		pool = NewGatewayPool(config.Zone, config.Gateways...)
+		pool.add(Gateway{URL: config.GatewayURL, Zone: config.Zone})
+	}
+	if pool != nil {
+		pool.Balancing = config.GatewayBalancing
+		pool.ProbeInterval = config.GatewayProbeInterval
+		pool.Client = MakeClientWithOptions(config.UpstreamTimeout, config.ClientOptions)
+		pool.Credentials = credentials
+		pool.Auth = config.Auth
+		pool.Metrics = config.Metrics
+		pool.Start()
+		invoker.GatewayPool = pool
+	}
+	invoker.DropOnOverflow = config.DropResponsesOnOverflow
+	invoker.OnOverflow = func(res InvokerResponse) {
+		if config.Metrics != nil {
+			config.Metrics.responseDropped()
+		}
+		if config.OnResponseOverflow != nil {
+			config.OnResponseOverflow(res)
+		}
+	}
+	invoker.Tracer = tracer
+
+	invoker.AsyncGatewayURL = fmt.Sprintf("%s/%s", config.GatewayURL, "async-function")
+	invoker.SyncGatewayURL = fmt.Sprintf("%s/%s", config.GatewayURL, "function")
+	if !config.AsyncFunctionInvocation && config.AdaptiveAsync != nil {
+		invoker.AdaptiveAsync = config.AdaptiveAsync
+	}
+
+	invoker.Auth = config.Auth
+	invoker.Logger = logger
+	invoker.MissingFunctionTTL = config.MissingFunctionTTL
+	return invoker
 }
 
 // Subscribe adds a ResponseSubscriber to the list of subscribers
 // which receive messages upon function invocation or error
-// Note: it is not possible to Unsubscribe at this point using
-// the API of the controller
 func (c *controller) Subscribe(subscriber ResponseSubscriber) {
+	if journal, ok := subscriber.(*Journal); ok {
+		journal.setDefaultLogger(c.Logger)
+	}
+
 	c.Lock.Lock()
 	defer c.Lock.Unlock()
 	c.Subscribers = append(c.Subscribers, subscriber)
 }
 
+// Unsubscribe removes a subscriber from the list of subscribers, so that it
+// receives no more responses once Unsubscribe returns.
+func (c *controller) Unsubscribe(subscriber ResponseSubscriber) bool {
+	if subscriber == nil || !reflect.TypeOf(subscriber).Comparable() {
+		return false
+	}
+
+	c.Lock.Lock()
+	defer c.Lock.Unlock()
+
+	for n, sub := range c.Subscribers {
+		if reflect.TypeOf(sub).Comparable() && sub == subscriber {
+			subscribers := make([]ResponseSubscriber, 0, len(c.Subscribers)-1)
+			subscribers = append(subscribers, c.Subscribers[:n]...)
+			c.Subscribers = append(subscribers, c.Subscribers[n+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
 // Invoke attempts to invoke any functions which match the
 // topic the incoming message was published on.
 func (c *controller) Invoke(topic string, message *[]byte) {
@@ -146,46 +818,418 @@ func (c *controller) Invoke(topic string, message *[]byte) {
 // InvokeWithContext attempts to invoke any functions which match the topic
 // the incoming message was published on while propagating context.
 func (c *controller) InvokeWithContext(ctx context.Context, topic string, message *[]byte) {
-	c.Invoker.InvokeWithContext(ctx, c.TopicMap, topic, message)
+	c.InvokeMessage(ctx, topic, &Message{Body: *message})
+}
+
+// InvokeMessage attempts to invoke any functions which match the topic the
+// incoming message was published on, sending the message metadata as headers.
+func (c *controller) InvokeMessage(ctx context.Context, topic string, message *Message) {
+	if err := c.admit(ctx); err != nil {
+		nack(ctx, err)
+		c.Invoker.publish(InvokerResponse{
+			Context: ctx,
+			Error:   err,
+			Topic:   topic,
+		})
+		return
+	}
+
+	if allow, res := c.filter(ctx, topic, message); !allow {
+		if res != nil {
+			nack(ctx, res.Error)
+		} else {
+			acknowledge(ctx, nil)
+		}
+		return
+	}
+
+	if c.queue != nil {
+		// the turn of the message is taken before it is queued, so that the
+		// workers invoke the messages sharing a key in the queue order
+		ctx = withKeyTurn(ctx, c.Invoker.takeKeyTurn(topic, message))
+		if err := c.queue.push(ctx, topic, message); err != nil {
+			err = errors.Wrap(err, "unable to queue message")
+			finishKeyTurn(ctx)
+			nack(ctx, err)
+			c.Invoker.publish(InvokerResponse{
+				Context: ctx,
+				Error:   err,
+				Topic:   topic,
+			})
+		}
+		return
+	}
+
+	if err := c.inFlight.acquire(ctx); err != nil {
+		nack(ctx, err)
+		c.Invoker.publish(InvokerResponse{
+			Context: ctx,
+			Error:   err,
+			Topic:   topic,
+		})
+		return
+	}
+	defer c.inFlight.release()
+
+	c.Invoker.InvokeMessage(ctx, c.TopicMap, topic, message)
+}
+
+// InvokeReader attempts to invoke any functions which match the topic with
+// a payload streamed from body.
+func (c *controller) InvokeReader(ctx context.Context, topic string, body io.Reader) {
+	c.InvokeMessage(ctx, topic, &Message{BodyReader: body})
+}
+
+// InvokeWithResults attempts to invoke any functions which match the topic
+// like InvokeMessage, and returns their responses.
+func (c *controller) InvokeWithResults(ctx context.Context, topic string, message *Message) []InvokerResponse {
+	return c.invokeWithResults(ctx, c.TopicMap, topic, message)
+}
+
+// invokeWithResults invokes the functions of topicMap matching topic, once
+// the message is admitted, filtered and given an in-flight slot.
+func (c *controller) invokeWithResults(ctx context.Context, topicMap *TopicMap, topic string, message *Message) []InvokerResponse {
+	if err := c.admit(ctx); err != nil {
+		nack(ctx, err)
+		res := InvokerResponse{
+			Context: ctx,
+			Error:   err,
+			Topic:   topic,
+		}
+		c.Invoker.publish(res)
+		return []InvokerResponse{res}
+	}
+
+	if allow, res := c.filter(ctx, topic, message); !allow {
+		if res != nil {
+			nack(ctx, res.Error)
+			return []InvokerResponse{*res}
+		}
+		acknowledge(ctx, nil)
+		return nil
+	}
+
+	if err := c.inFlight.acquire(ctx); err != nil {
+		nack(ctx, err)
+		res := InvokerResponse{
+			Context: ctx,
+			Error:   err,
+			Topic:   topic,
+		}
+		c.Invoker.publish(res)
+		return []InvokerResponse{res}
+	}
+	defer c.inFlight.release()
+
+	return c.Invoker.InvokeMessageWithResults(ctx, topicMap, topic, message)
+}
+
+// InvokeFunction invokes a function directly, bypassing the topic map, and
+// returns its response after delivering it to the subscribers.
+func (c *controller) InvokeFunction(ctx context.Context, function string, message *Message, headers http.Header, opts ...InvokeOption) InvokerResponse {
+	if err := c.admit(ctx); err != nil {
+		res := InvokerResponse{
+			Context:  ctx,
+			Error:    err,
+			Function: function,
+			Topic:    newInvokeOptions(opts).topic,
+		}
+		c.Invoker.publish(res)
+		nack(ctx, err)
+		return res
+	}
+
+	if err := c.inFlight.acquire(ctx); err != nil {
+		res := InvokerResponse{
+			Context:  ctx,
+			Error:    err,
+			Function: function,
+			Topic:    newInvokeOptions(opts).topic,
+		}
+		c.Invoker.publish(res)
+		nack(ctx, err)
+		return res
+	}
+	defer c.inFlight.release()
+
+	return c.Invoker.InvokeFunction(ctx, function, message, headers, opts...)
 }
 
 // BeginMapBuilder begins to build a map of function->topic by
 // querying the API gateway.
 func (c *controller) BeginMapBuilder() {
+	c.StartMapBuilder()
+}
+
+// Stats summarizes the recent invocations of each topic and function.
+func (c *controller) Stats() Stats {
+	return Stats{
+		Topics:    c.stats.Topics(),
+		Functions: c.stats.Functions(),
+	}
+}
+
+// InvocationStats summarizes the recent invocations of function for topic.
+func (c *controller) InvocationStats(topic, function string) InvocationStats {
+	return c.stats.Invocations(topic, function)
+}
+
+func newControllerStats(config *ControllerConfig) *StatsCollector {
+	stats := NewStatsCollector(config.StatsSamples)
+	stats.MaxAge = config.StatsMaxAge
+	return stats
+}
 
-	lookupBuilder := FunctionLookupBuilder{
+// FunctionHealth returns the health observed for each function invoked so
+// far.
+func (c *controller) FunctionHealth() []FunctionHealth {
+	return c.Invoker.FunctionHealth()
+}
+
+// DrainFunction holds the new invocations of a function and waits for the in-flight ones to return.
+func (c *controller) DrainFunction(ref string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return c.Invoker.DrainFunction(ctx, ref)
+}
+
+// ResumeFunction releases the invocations of a drained function.
+func (c *controller) ResumeFunction(ref string) error {
+	return c.Invoker.ResumeFunction(ref)
+}
+
+// clientAuth returns the Auth of the config, or the basic auth of the
+// credentials.
+func (c *controller) clientAuth() ClientAuth {
+	if c.Config.Auth != nil {
+		return c.Config.Auth
+	}
+	return BasicAuth(c.Credentials)
+}
+
+// newLookupBuilder creates the builder of the topic map from the config.
+func (c *controller) newLookupBuilder() *FunctionLookupBuilder {
+	if c.builder != nil {
+		return c.builder
+	}
+	return c.configLookupBuilder()
+}
+
+// configLookupBuilder creates a builder of the topic map from the config
+// only, ignoring the builder injected with WithLookupBuilder.
+func (c *controller) configLookupBuilder() *FunctionLookupBuilder {
+	return &FunctionLookupBuilder{
 		GatewayURL:     c.Config.GatewayURL,
-		Client:         MakeClient(c.Config.UpstreamTimeout),
+		Client:         MakeClientWithOptions(c.Config.UpstreamTimeout, c.Config.ClientOptions),
 		Credentials:    c.Credentials,
+		Auth:           c.Config.Auth,
 		TopicDelimiter: c.Config.TopicAnnotationDelimiter,
 		Namespace:      c.Config.Namespace,
+
+		TopicDelimiterPattern:  c.topicDelimiterPattern,
+		TopicNormalization:     c.Config.TopicNormalization,
+		DefaultNamespace:       c.Config.DefaultNamespace,
+		SkipNamespaceDiscovery: c.Config.SkipNamespaceDiscovery,
+		DisableListCache:       c.Config.DisableFunctionListCache,
+		Namespaces:             c.Config.Namespaces,
+		ExcludeNamespaces:      c.Config.ExcludeNamespaces,
+		NamespaceSelector:      c.Config.NamespaceSelector,
+		SkipNotReady:           c.Config.SkipNotReadyFunctions,
+		NamespaceRetries:       c.Config.NamespaceRetries,
+		NamespaceRetryBackoff:  c.Config.NamespaceRetryBackoff,
+		PartialResults:         c.Config.PartialSync,
+		FunctionSource:         c.Config.FunctionSource,
+		PageSize:               c.Config.FunctionPageSize,
+		MaxPages:               c.Config.MaxFunctionPages,
+		DiscoveryLimiter:       c.discoveryLimiter,
+		NamespaceCache:         c.namespaceCache,
+		OnDiscovery:            c.observeDiscovery,
+		Logger:                 c.Logger,
+		GatewayPool:            c.Invoker.GatewayPool,
 	}
+}
 
-	ticker := time.NewTicker(c.Config.RebuildInterval)
-	go c.synchronizeLookups(ticker, &lookupBuilder, c.TopicMap)
+// newTopicSource returns the TopicSource of the config, or discovers the
+// functions from their annotations.
+func (c *controller) newTopicSource() TopicSource {
+	if c.Config.TopicSource != nil {
+		return c.Config.TopicSource
+	}
+	return NewAnnotationTopicSource(c.newLookupBuilder())
 }
 
-func (c *controller) synchronizeLookups(ticker *time.Ticker,
-	lookupBuilder *FunctionLookupBuilder,
-	topicMap *TopicMap) {
+func (c *controller) synchronizeLookups(ticker *rebuildTicker,
+	source TopicSource,
+	topicMap *TopicMap,
+	changes <-chan struct{},
+	stop <-chan struct{}) {
+
+	ctx, cancel := c.stopContext(stop)
+	defer cancel()
+
+	// retry is a timer rebuilding the topic map sooner than the ticker after
+	// a failure, with a backoff.
+	var retry *time.Timer
+	var retryC <-chan time.Time
+	failures := 0
 
 	fn := func() {
-		lookups, err := lookupBuilder.Build()
-		if err != nil {
-			log.Fatalln(err)
+		if retry != nil {
+			retry.Stop()
+			retry, retryC = nil, nil
 		}
 
-		if c.Config.PrintSync {
-			log.Println("Syncing topic map")
+		if err := c.syncTopicMap(ctx, source, topicMap); err != nil {
+			failures++
+			c.syncFailed(err, failures)
+			if delay := c.syncRetryDelay(failures); delay < c.Config.RebuildInterval {
+				retry = time.NewTimer(delay)
+				retryC = retry.C
+			}
+			return
 		}
-
-		topicMap.Sync(&lookups)
+		failures = 0
 	}
 
+	defer ticker.Stop()
+	defer func() {
+		if retry != nil {
+			retry.Stop()
+		}
+	}()
+
 	fn()
 	for {
-		<-ticker.C
-		fn()
+		select {
+		case <-ticker.C:
+			fn()
+		case <-retryC:
+			retry, retryC = nil, nil
+			fn()
+		case <-changes:
+			fn()
+		case <-stop:
+			return
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// syncTopicMap rebuilds the topic map, giving up when ctx is done.
+// Concurrent rebuilds are coalesced, so the gateway is queried once and the
+// callers share the result.
+func (c *controller) syncTopicMap(ctx context.Context, source TopicSource, topicMap *TopicMap) error {
+	return c.syncGroup.do(c.syncFunc(ctx, source, topicMap))
+}
+
+// syncTopicMapFresh rebuilds the topic map like syncTopicMap, but only shares
+// a rebuild started after the call.
+func (c *controller) syncTopicMapFresh(ctx context.Context, source TopicSource, topicMap *TopicMap) error {
+	return c.syncGroup.doFresh(c.syncFunc(ctx, source, topicMap))
+}
+
+func (c *controller) syncFunc(ctx context.Context, source TopicSource, topicMap *TopicMap) func() error {
+	return func() error {
+		err := c.buildTopicMap(ctx, source, topicMap)
+		c.buildTenantTopicMaps(ctx)
+		c.recordSync(err)
+		return err
+	}
+}
+
+func (c *controller) buildTopicMap(ctx context.Context, source TopicSource, topicMap *TopicMap) error {
+	var span Span
+	if c.Tracer != nil {
+		ctx, span = c.Tracer.Start(ctx, "sync topic map")
+		defer span.End()
+	}
+
+	start := c.now()
+	lookups, metadata, err := c.buildLookups(ctx, source)
+	if c.Config.Metrics != nil {
+		c.Config.Metrics.observeSync(c.now().Sub(start), len(lookups), err)
+	}
+	partial, _ := err.(*PartialBuildError)
+	if err != nil {
+		if span != nil {
+			span.RecordError(err)
+		}
+		if partial == nil {
+			return err
+		}
+		if metadata == nil {
+			metadata = map[string]FunctionMetadata{}
+		}
+		keepFailedNamespaces(lookups, metadata, topicMap.lookups(), topicMap.functionMetadata(), partial.Failed)
+	}
+
+	if span != nil {
+		span.SetAttributes(map[string]interface{}{"connector.topics": len(lookups)})
+	}
+
+	if c.Config.PrintSync {
+		c.Logger.Infof("Syncing topic map")
+	}
+
+	change := syncChange(topicMap, lookups, metadata)
+	if c.Config.OnTopicMapChange != nil && !change.Empty() {
+		c.Config.OnTopicMapChange(change)
+	}
+	if c.Config.Metrics != nil {
+		c.Config.Metrics.syncTopicMap(lookups)
+	}
+	if partial != nil {
+		return partial
+	}
+	return nil
+}
+
+// resync rebuilds the topic map immediately, sharing a rebuild in progress.
+func (c *controller) resync() error {
+	c.Lock.RLock()
+	source := c.topicSource
+	c.Lock.RUnlock()
+
+	if source == nil {
+		return fmt.Errorf("the map builder has not been started")
+	}
+
+	ctx, cancel := c.stopContext(nil)
+	defer cancel()
+	return c.syncTopicMap(ctx, source, c.TopicMap)
+}
+
+// RefreshTopicMap rebuilds the topic map immediately and waits for it until
+// ctx is done. A rebuild already in progress may have missed the changes the
+// caller wants to see, so it is waited for and the topic map is rebuilt
+// again; the concurrent refreshes share that rebuild.
+func (c *controller) RefreshTopicMap(ctx context.Context) error {
+	if c.Stopped() {
+		return ErrControllerStopped
+	}
+
+	c.namespaceCache.Refresh()
+
+	c.Lock.RLock()
+	source := c.topicSource
+	c.Lock.RUnlock()
+	if source == nil {
+		return fmt.Errorf("the map builder has not been started")
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		syncCtx, cancel := c.stopContext(nil)
+		defer cancel()
+		done <- c.syncTopicMapFresh(syncCtx, source, c.TopicMap)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
@@ -195,6 +1239,32 @@ func (c *controller) Topics() []string {
 	return c.TopicMap.Topics()
 }
 
+// TopicMapSnapshot returns a copy of the functions bound to each topic.
+func (c *controller) TopicMapSnapshot() map[string][]string {
+	return c.TopicMap.Snapshot()
+}
+
+// SetRateLimit changes the maximum number of invocations per second.
+func (c *controller) SetRateLimit(rate float64, burst int) {
+	c.Invoker.RateLimiter.SetLimit(rate, burst)
+}
+
+// RateLimit returns the maximum number of invocations per second and the burst.
+func (c *controller) RateLimit() (float64, int) {
+	return c.Invoker.RateLimiter.Limit()
+}
+
+// SetLogLevel changes the level of the configured Logger. It returns an error
+// if the Logger doesn't support levels.
+func (c *controller) SetLogLevel(level LogLevel) error {
+	logger, ok := c.Logger.(interface{ SetLevel(LogLevel) })
+	if !ok {
+		return fmt.Errorf("the logger does not support changing the level")
+	}
+	logger.SetLevel(level)
+	return nil
+}
+
 func gatewayRoute(config *ControllerConfig) string {
 	if config.AsyncFunctionInvocation {
 		return fmt.Sprintf("%s/%s", config.GatewayURL, "async-function")
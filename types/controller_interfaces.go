@@ -0,0 +1,150 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+// MessageController is implemented by the controllers invoking Messages,
+// with their headers and metadata, and returning the responses:
+//
+//	if messages, ok := controller.(types.MessageController); ok {
+//		responses := messages.InvokeWithResults(ctx, topic, message)
+//	}
+type MessageController interface {
+	// AddFilter appends a filter to the chain evaluated for each message before its topic is matched.
+	AddFilter(filter MessageFilter)
+
+	// Unsubscribe removes a subscriber added with Subscribe, compared by identity, and returns false if it was not
+	// subscribed. The subscriber must be of a comparable type, such as a pointer.
+	Unsubscribe(subscriber ResponseSubscriber) bool
+
+	InvokeMessage(ctx context.Context, topic string, message *Message)
+
+	// InvokeReader invokes the functions matching topic with a payload streamed from body, see Message.BodyReader.
+	InvokeReader(ctx context.Context, topic string, body io.Reader)
+
+	// InvokeWithResults invokes the functions matching topic like InvokeMessage, and returns their responses, one
+	// per matched function, once delivered to the subscribers.
+	InvokeWithResults(ctx context.Context, topic string, message *Message) []InvokerResponse
+
+	// InvokeAggregated invokes the functions matching topic like InvokeWithResults, and combines their bodies and
+	// statuses into a single response, for request/reply connectors.
+	InvokeAggregated(ctx context.Context, topic string, message *Message) AggregatedResponse
+
+	// InvokeFunction invokes a function directly, bypassing the topic map. The response is delivered to the
+	// subscribers and returned.
+	InvokeFunction(ctx context.Context, function string, message *Message, headers http.Header, opts ...InvokeOption) InvokerResponse
+}
+
+// TenantController is implemented by the controllers serving the Tenants
+// of their config with a topic map each.
+type TenantController interface {
+	// InvokeForTenant invokes the functions of tenant matching topic like InvokeWithResults, using the topic map
+	// of the tenant declared in Tenants. The responses of the functions are labelled with the tenant, and an
+	// ErrUnknownTenant response is returned for a tenant not declared.
+	InvokeForTenant(ctx context.Context, tenant, topic string, message *Message) []InvokerResponse
+
+	// TenantErrors returns the error of the last build of each tenant whose topic map failed to build, or was
+	// built partially.
+	TenantErrors() map[string]error
+}
+
+// TopicMapController is implemented by the controllers whose topic map can
+// be monitored and rebuilt on demand.
+type TopicMapController interface {
+	// StartMapBuilder begins to build the topic map like BeginMapBuilder, and returns a handle to stop the loop and
+	// to monitor its syncs.
+	StartMapBuilder() MapBuilder
+
+	// TopicMapSnapshot returns a copy of the functions bound to each topic, e.g. to display or log them.
+	TopicMapSnapshot() map[string][]string
+
+	// RefreshTopicMap rebuilds the topic map immediately, outside of the RebuildInterval, e.g. right after a deploy
+	// event, and returns once it is rebuilt or ctx is done. A rebuild already in progress is not shared, as it may
+	// predate the deploy. The namespaces cached for NamespaceCacheTTL are listed again. It fails if BeginMapBuilder
+	// has not been called.
+	RefreshTopicMap(ctx context.Context) error
+}
+
+// LifecycleController is implemented by the controllers which can wait for
+// their gateway at startup and be shut down gracefully.
+type LifecycleController interface {
+	// WaitForGateway checks that the gateway is reachable and accepts the credentials, retrying with a backoff until
+	// ctx is done, so that a connector can fail with a clear error at startup, before BeginMapBuilder.
+	WaitForGateway(ctx context.Context) error
+
+	// Stop shuts the controller down gracefully: it stops the map builder, invokes the queued messages, waits for the
+	// in-flight invocations and the delivery of their responses until ctx is done, then closes the subscribers
+	// implementing Close. The messages received afterwards fail with ErrControllerStopped.
+	Stop(ctx context.Context) error
+
+	// Close stops the controller like Stop, without a deadline.
+	Close() error
+}
+
+// RuntimeController is implemented by the controllers which can be
+// operated at runtime, e.g. through NewControlHandler.
+type RuntimeController interface {
+	// Pause makes the controller reject the received messages, or hold them with PauseHold, until Resume is called.
+	Pause()
+	Resume()
+	Paused() bool
+
+	// SetRateLimit changes the maximum number of invocations per second. Zero means no limit.
+	SetRateLimit(rate float64, burst int)
+	RateLimit() (float64, int)
+
+	// SetLogLevel changes the level of the configured Logger, if it supports levels.
+	SetLogLevel(level LogLevel) error
+
+	// SetVerbosity changes the log level and the printing of the response bodies, reverting both after revertAfter
+	// if it is positive.
+	SetVerbosity(level LogLevel, printBodies bool, revertAfter time.Duration) error
+
+	// DrainFunction pauses the new invocations of a function, holding them until ResumeFunction is called, and waits
+	// up to timeout for its in-flight invocations to return, so that it can be redeployed safely. It returns nil once
+	// the function is drained. A held invocation whose context is done fails with ErrFunctionDraining.
+	DrainFunction(ref string, timeout time.Duration) error
+	ResumeFunction(ref string) error
+}
+
+// HealthController is implemented by the controllers reporting their health
+// and the statistics of their invocations.
+type HealthController interface {
+	// Healthy returns true while the responses are dispatched to the subscribers, i.e. until the controller is
+	// stopped. Ready returns true once the topic map has been synchronized, as long as the gateway is reachable.
+	Healthy() bool
+	Ready() bool
+
+	// Selftest checks the discovery of the functions and the invocation of the SelftestFunction, for use as a
+	// startup probe.
+	Selftest(ctx context.Context) SelftestReport
+
+	// FunctionHealth returns the health observed for each function invoked so far: last status and error,
+	// consecutive failures, circuit state and last success time.
+	FunctionHealth() []FunctionHealth
+
+	// Stats summarizes the outcome and latency of the recent invocations of each topic and function.
+	Stats() Stats
+
+	// InvocationStats summarizes the success and failure counts and the latency percentiles of the recent
+	// invocations of function for topic, e.g. for adaptive throttling. An empty topic or function matches all, and
+	// both empty summarize the most recent invocations of all the functions.
+	InvocationStats(topic, function string) InvocationStats
+}
+
+var (
+	_ Controller          = &controller{}
+	_ MessageController   = &controller{}
+	_ TenantController    = &controller{}
+	_ TopicMapController  = &controller{}
+	_ LifecycleController = &controller{}
+	_ RuntimeController   = &controller{}
+	_ HealthController    = &controller{}
+)
@@ -0,0 +1,114 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"time"
+
+	"github.com/openfaas/faas-provider/auth"
+)
+
+// defaultRebuildInterval is the RebuildInterval of a controller created with
+// NewControllerWithOptions when the config doesn't set one.
+const defaultRebuildInterval = 30 * time.Second
+
+// ControllerOption customises a controller created with
+// NewControllerWithOptions.
+type ControllerOption func(*controllerOptions)
+
+type controllerOptions struct {
+	config        *ControllerConfig
+	credentials   *auth.BasicAuthCredentials
+	invoker       *Invoker
+	topicMap      *TopicMap
+	lookupBuilder *FunctionLookupBuilder
+	logger        Logger
+	now           func() time.Time
+}
+
+// NewControllerWithOptions creates a controller for the gateway at
+// gatewayURL like NewValidatedController, with its components replaced by
+// opts, e.g. to inject fakes in tests. It returns the ConfigErrors of the
+// config and of an injected invoker, or the error creating the Queue.
+func NewControllerWithOptions(gatewayURL string, opts ...ControllerOption) (Controller, error) {
+	options := &controllerOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	// the options apply to a copy, the config of the caller is left as is
+	config := &ControllerConfig{}
+	if options.config != nil {
+		*config = *options.config
+	}
+	config.GatewayURL = gatewayURL
+	if config.RebuildInterval <= 0 {
+		config.RebuildInterval = defaultRebuildInterval
+	}
+	if options.logger != nil {
+		config.Logger = options.logger
+	}
+
+	c, err := newController(options.credentials, config, options, true)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// WithControllerConfig configures the controller with a copy of config,
+// whose GatewayURL is replaced by the URL given to NewControllerWithOptions.
+func WithControllerConfig(config *ControllerConfig) ControllerOption {
+	return func(options *controllerOptions) {
+		options.config = config
+	}
+}
+
+// WithCredentials authenticates the requests to the gateway.
+func WithCredentials(credentials *auth.BasicAuthCredentials) ControllerOption {
+	return func(options *controllerOptions) {
+		options.credentials = credentials
+	}
+}
+
+// WithInvoker invokes the functions with invoker, created with NewInvoker,
+// instead of an invoker built from the config. The invoker is used as is:
+// the settings of the config applying to the invoker are ignored.
+func WithInvoker(invoker *Invoker) ControllerOption {
+	return func(options *controllerOptions) {
+		options.invoker = invoker
+	}
+}
+
+// WithTopicMap matches the messages against topicMap, which the map builder
+// keeps rebuilding.
+func WithTopicMap(topicMap *TopicMap) ControllerOption {
+	return func(options *controllerOptions) {
+		options.topicMap = topicMap
+	}
+}
+
+// WithLookupBuilder discovers the functions with builder instead of a
+// builder created from the config. It is ignored when the config sets a
+// TopicSource.
+func WithLookupBuilder(builder *FunctionLookupBuilder) ControllerOption {
+	return func(options *controllerOptions) {
+		options.lookupBuilder = builder
+	}
+}
+
+// WithLogger logs with logger, overriding the Logger of the config.
+func WithLogger(logger Logger) ControllerOption {
+	return func(options *controllerOptions) {
+		options.logger = logger
+	}
+}
+
+// WithClock reads the time from now instead of time.Now for the syncs of the
+// topic map and the circuit breaker of the functions.
+func WithClock(now func() time.Time) ControllerOption {
+	return func(options *controllerOptions) {
+		options.now = now
+	}
+}
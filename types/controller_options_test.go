@@ -0,0 +1,82 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_NewControllerWithOptions(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/system/functions":
+			w.Write([]byte(`[{"name":"echo","annotations":{"topic":"orders"}}]`))
+		case "/function/echo.openfaas-fn":
+			w.Write([]byte("ok"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	invoker := NewInvoker(srv.URL+"/function", "", srv.Client(), false, false)
+	topicMap := NewTopicMap(nil)
+	clock := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	config := &ControllerConfig{Namespace: "openfaas-fn"}
+	created, err := NewControllerWithOptions(srv.URL,
+		WithControllerConfig(config),
+		WithInvoker(invoker),
+		WithTopicMap(&topicMap),
+		WithLookupBuilder(&FunctionLookupBuilder{GatewayURL: srv.URL, Client: srv.Client(), Namespace: "openfaas-fn"}),
+		WithLogger(NewStdLogger(LevelError)),
+		WithClock(func() time.Time { return clock }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := created.(*controller)
+	defer c.Close()
+
+	if c.Invoker != invoker || c.TopicMap != &topicMap {
+		t.Fatal("want the injected invoker and topic map")
+	}
+	if c.Config.GatewayURL != srv.URL || c.Config.RebuildInterval != defaultRebuildInterval {
+		t.Errorf("Config - want gateway %s every %s, got: %s every %s",
+			srv.URL, defaultRebuildInterval, c.Config.GatewayURL, c.Config.RebuildInterval)
+	}
+	if config.GatewayURL != "" || config.RebuildInterval != 0 || config.Logger != nil {
+		t.Errorf("Config - want the config of the caller unchanged, got: %+v", config)
+	}
+
+	c.BeginMapBuilder()
+	if err := c.RefreshTopicMap(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := time.Unix(0, c.lastSync); !got.Equal(clock) {
+		t.Errorf("Last sync - want: %s, got: %s", clock, got)
+	}
+
+	responses := c.InvokeWithResults(context.Background(), "orders", &Message{Body: []byte("hello")})
+	if len(responses) != 1 || responses[0].Status != http.StatusOK {
+		t.Errorf("Responses - want a single %d, got: %+v", http.StatusOK, responses)
+	}
+}
+
+func Test_NewControllerWithOptions_Invalid(t *testing.T) {
+	_, err := NewControllerWithOptions("gateway:8080", WithLogger(NewStdLogger(LevelError)))
+	errs, ok := err.(ConfigErrors)
+	if !ok || len(errs) != 1 || errs[0].Field != "GatewayURL" {
+		t.Errorf("want a GatewayURL error, got: %v", err)
+	}
+
+	_, err = NewControllerWithOptions("http://gateway:8080", WithInvoker(NewInvoker("", "", nil, false, false)))
+	if errs, ok := err.(ConfigErrors); !ok || errs[0].Field != "Invoker.GatewayURL" {
+		t.Errorf("want an Invoker.GatewayURL error, got: %v", err)
+	}
+}
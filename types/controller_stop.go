@@ -0,0 +1,140 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/openfaas/faas-provider/auth"
+)
+
+// defaultShutdownTimeout bounds the shutdown of a controller created with
+// NewControllerWithContext when ShutdownTimeout is not set.
+const defaultShutdownTimeout = 30 * time.Second
+
+// NewControllerWithContext creates a controller like NewController, which is
+// stopped when ctx is done: the map builder, the queue and the dispatch of
+// the responses are torn down, waiting up to ShutdownTimeout for the
+// in-flight invocations.
+func NewControllerWithContext(ctx context.Context, credentials *auth.BasicAuthCredentials, config *ControllerConfig) Controller {
+	c := NewController(credentials, config).(*controller)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-c.stop:
+			return
+		}
+
+		timeout := config.ShutdownTimeout
+		if timeout <= 0 {
+			timeout = defaultShutdownTimeout
+		}
+		stopCtx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		if err := c.Stop(stopCtx); err != nil && err != ErrControllerStopped {
+			c.Logger.Errorf("%s", err)
+		}
+	}()
+
+	return c
+}
+
+// stopContext returns a context cancelled when the controller is stopped or
+// stop is closed, so that the rebuilds of the topic map don't hold up the
+// shutdown waiting for the gateway or the DiscoveryLimiter.
+func (c *controller) stopContext(stop <-chan struct{}) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-stop:
+		case <-c.stop:
+		case <-ctx.Done():
+		}
+		cancel()
+	}()
+	return ctx, cancel
+}
+
+// Stop shuts the controller down gracefully: it stops rebuilding the topic
+// map, rejects the new messages with ErrControllerStopped, invokes the
+// queued messages, waits for the in-flight invocations, for their responses
+// to be delivered and archived, and finally closes the subscribers
+// implementing Close() or Close() error. If ctx is done first, the remaining invocations
+// are abandoned and the error of ctx is returned.
+func (c *controller) Stop(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&c.stopped, 0, 1) {
+		return ErrControllerStopped
+	}
+
+	close(c.stop)
+	if c.Invoker.GatewayPool != nil {
+		c.Invoker.GatewayPool.Stop()
+	}
+	if c.reporter != nil {
+		c.reporter.Stop()
+	}
+	c.stopDebugSignals()
+	c.verbosity.stop()
+
+	errs := []string{}
+
+	if c.queue != nil {
+		if err := c.queue.close(ctx); err != nil {
+			errs = append(errs, fmt.Sprintf("queued messages not invoked: %s", err))
+		}
+	}
+
+	if abandoned, err := c.Invoker.Close(ctx); err != nil {
+		errs = append(errs, fmt.Sprintf("%d invocations abandoned: %s", abandoned, err))
+	}
+
+	select {
+	case <-c.fanOutDone:
+	case <-ctx.Done():
+		errs = append(errs, fmt.Sprintf("responses not delivered: %s", ctx.Err()))
+	}
+
+	if c.Invoker.Archiver != nil {
+		if err := c.Invoker.Archiver.Stop(ctx); err != nil {
+			errs = append(errs, fmt.Sprintf("objects not archived: %s", err))
+		}
+	}
+
+	c.Lock.RLock()
+	subscribers := append([]ResponseSubscriber(nil), c.Subscribers...)
+	c.Lock.RUnlock()
+
+	for _, subscriber := range subscribers {
+		switch closer := subscriber.(type) {
+		case interface{ Close() error }:
+			if err := closer.Close(); err != nil {
+				errs = append(errs, fmt.Sprintf("unable to close subscriber: %s", err))
+			}
+		case interface{ Close() }:
+			closer.Close()
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("controller stopped uncleanly: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Close stops the controller like Stop, waiting for the in-flight
+// invocations without a deadline.
+func (c *controller) Close() error {
+	return c.Stop(context.Background())
+}
+
+// Stopped returns true once Stop or Close has been called.
+func (c *controller) Stopped() bool {
+	return atomic.LoadInt32(&c.stopped) == 1
+}
@@ -0,0 +1,334 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// subscriberFunc is a ResponseSubscriber calling a function.
+type subscriberFunc func(InvokerResponse)
+
+func (f subscriberFunc) Response(res InvokerResponse) {
+	f(res)
+}
+
+func Test_Controller_InvokeFunction(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/function/echo" {
+			t.Errorf("Path - want: %s, got: %s", "/function/echo", r.URL.Path)
+		}
+		w.Write([]byte(r.Header.Get("X-Mode")))
+	}))
+	defer srv.Close()
+
+	controller := NewController(nil, &ControllerConfig{
+		GatewayURL:      srv.URL,
+		RebuildInterval: time.Second,
+	}).(*controller)
+
+	received := make(chan InvokerResponse, 1)
+	controller.Subscribe(subscriberFunc(func(res InvokerResponse) {
+		received <- res
+	}))
+
+	res := controller.InvokeFunction(context.Background(), "echo", &Message{Body: []byte("hello")},
+		http.Header{"X-Mode": []string{"direct"}}, WithInvokeTopic("manual"))
+
+	if res.Error != nil {
+		t.Fatal(res.Error)
+	}
+	if string(*res.Body) != "direct" || res.Topic != "manual" {
+		t.Errorf("Response - want: body %q and topic %q, got: %q and %q", "direct", "manual", string(*res.Body), res.Topic)
+	}
+
+	select {
+	case sub := <-received:
+		if sub.Function != "echo" {
+			t.Errorf("Subscriber - want: %s, got: %s", "echo", sub.Function)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Subscriber - want the response delivered")
+	}
+}
+
+func Test_Controller_CoalescesConcurrentSyncs(t *testing.T) {
+	var scans int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/system/functions" {
+			atomic.AddInt32(&scans, 1)
+			time.Sleep(100 * time.Millisecond)
+		}
+		w.Write([]byte("[]"))
+	}))
+	defer srv.Close()
+
+	c := NewController(nil, &ControllerConfig{
+		GatewayURL:      srv.URL,
+		RebuildInterval: time.Second,
+		Namespace:       "openfaas-fn",
+	}).(*controller)
+	c.topicSource = c.newTopicSource()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.resync(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&scans); got != 1 {
+		t.Errorf("Scans - want: %d, got: %d", 1, got)
+	}
+}
+
+func Test_Controller_Unsubscribe(t *testing.T) {
+	c := NewController(nil, &ControllerConfig{GatewayURL: "http://127.0.0.1:8080"}).(*controller)
+
+	received := make(chan InvokerResponse, 1)
+	waiter := &ResponsePrinter{}
+	other := subscriberFunc(func(res InvokerResponse) { received <- res })
+	c.Subscribe(waiter)
+	c.Subscribe(other)
+
+	if !c.Unsubscribe(waiter) {
+		t.Fatal("want the subscriber removed")
+	}
+	if c.Unsubscribe(waiter) {
+		t.Error("want false for a subscriber already removed")
+	}
+	if c.Unsubscribe(other) {
+		t.Error("want false for a subscriber that can't be compared")
+	}
+	if len(c.Subscribers) != 1 {
+		t.Errorf("Subscribers - want: %d, got: %d", 1, len(c.Subscribers))
+	}
+
+	c.Invoker.Responses <- InvokerResponse{Error: ErrPaused}
+	if res := <-received; res.Error != ErrPaused {
+		t.Errorf("Response - want: %s, got: %v", ErrPaused, res.Error)
+	}
+}
+
+// closingSubscriber records the responses it receives and whether it was
+// closed.
+type closingSubscriber struct {
+	responses int32
+	closed    int32
+}
+
+func (s *closingSubscriber) Response(res InvokerResponse) {
+	atomic.AddInt32(&s.responses, 1)
+}
+
+func (s *closingSubscriber) Close() error {
+	atomic.StoreInt32(&s.closed, 1)
+	return nil
+}
+
+func Test_Controller_Stop(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/system/functions" {
+			_, _ = w.Write([]byte(`[{"name": "echo", "annotations": {"topic": "topic1"}}]`))
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	c := NewController(nil, &ControllerConfig{
+		GatewayURL:      srv.URL,
+		RebuildInterval: time.Hour,
+		Namespace:       "openfaas-fn",
+		Queue:           &QueueConfig{Workers: 2},
+	}).(*controller)
+	subscriber := &closingSubscriber{}
+	c.Subscribe(subscriber)
+	if err := c.resync(); err == nil {
+		t.Fatal("want an error before the map builder starts")
+	}
+	c.BeginMapBuilder()
+	if err := c.resync(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		c.InvokeMessage(context.Background(), "topic1", &Message{Body: []byte("hello")})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := atomic.LoadInt32(&subscriber.responses); got != 5 {
+		t.Errorf("Responses - want: %d, got: %d", 5, got)
+	}
+	if atomic.LoadInt32(&subscriber.closed) != 1 {
+		t.Error("want the subscriber closed")
+	}
+	if err := c.Close(); err != ErrControllerStopped {
+		t.Errorf("Second stop - want: %s, got: %v", ErrControllerStopped, err)
+	}
+}
+
+func Test_NewControllerWithContext_StopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := NewControllerWithContext(ctx, nil, &ControllerConfig{
+		GatewayURL:      "http://127.0.0.1:8080",
+		RebuildInterval: time.Hour,
+	}).(*controller)
+	subscriber := &closingSubscriber{}
+	c.Subscribe(subscriber)
+
+	cancel()
+
+	select {
+	case <-c.fanOutDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("want the response dispatcher stopped")
+	}
+	if !c.Stopped() {
+		t.Error("want the controller stopped")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&subscriber.closed) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if atomic.LoadInt32(&subscriber.closed) != 1 {
+		t.Error("want the subscriber closed")
+	}
+}
+
+func Test_Controller_RefreshTopicMap(t *testing.T) {
+	var delay int64
+	var topic atomic.Value
+	topic.Store("orders")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Duration(atomic.LoadInt64(&delay)))
+		w.Write([]byte(`[{"name":"echo","annotations":{"topic":"` + topic.Load().(string) + `"}}]`))
+	}))
+	defer srv.Close()
+
+	c := NewController(nil, &ControllerConfig{
+		GatewayURL:      srv.URL,
+		RebuildInterval: time.Hour,
+		Namespace:       "openfaas-fn",
+	}).(*controller)
+	defer c.Close()
+
+	if err := c.RefreshTopicMap(context.Background()); err == nil {
+		t.Fatal("want an error before the map builder starts")
+	}
+	c.BeginMapBuilder()
+
+	topic.Store("invoices")
+	if err := c.RefreshTopicMap(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if topics := c.Topics(); len(topics) != 1 || topics[0] != "invoices" {
+		t.Errorf("Topics - want: %v, got: %v", []string{"invoices"}, topics)
+	}
+
+	atomic.StoreInt64(&delay, int64(200*time.Millisecond))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := c.RefreshTopicMap(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Error - want: %s, got: %v", context.DeadlineExceeded, err)
+	}
+}
+
+func Test_flightGroup_DoFresh(t *testing.T) {
+	group := &flightGroup{}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var calls int32
+
+	first := make(chan error, 1)
+	go func() {
+		first <- group.do(func() error {
+			atomic.AddInt32(&calls, 1)
+			close(started)
+			<-release
+			return fmt.Errorf("stale")
+		})
+	}()
+	<-started
+
+	// A refresh called while a build is in flight waits for a new one,
+	// shared by the concurrent refreshes.
+	fresh := make(chan error, 2)
+	for n := 0; n < 2; n++ {
+		go func() {
+			fresh <- group.doFresh(func() error {
+				atomic.AddInt32(&calls, 1)
+				return nil
+			})
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	if err := <-first; err == nil || err.Error() != "stale" {
+		t.Errorf("Do - want the stale error, got: %v", err)
+	}
+	for n := 0; n < 2; n++ {
+		if err := <-fresh; err != nil {
+			t.Errorf("DoFresh - want the result of a new call, got: %s", err)
+		}
+	}
+	if got := atomic.LoadInt32(&calls); got < 2 || got > 3 {
+		t.Errorf("Calls - want the refreshes to run again, got: %d", got)
+	}
+}
+
+func Test_Controller_Stats(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/function/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewController(nil, &ControllerConfig{
+		GatewayURL:      srv.URL,
+		RebuildInterval: time.Hour,
+		StatsSamples:    2,
+	}).(*controller)
+	c.TopicMap.Sync(&map[string][]string{"orders": {"echo", "fail"}})
+
+	received := make(chan InvokerResponse, 10)
+	c.Subscribe(subscriberFunc(func(res InvokerResponse) { received <- res }))
+
+	for i := 0; i < 3; i++ {
+		c.InvokeMessage(context.Background(), "orders", &Message{Body: []byte("hello")})
+		<-received
+		<-received
+	}
+
+	stats := c.Stats()
+	if got := stats.Topics["orders"]; got.Invocations != 2 || got.Failures != 1 || got.Successes() != 1 {
+		t.Errorf("Topic stats - want 2 invocations with 1 failure, got: %+v", got)
+	}
+	if got := stats.Functions["echo"]; got.Invocations != 2 || got.Failures != 0 {
+		t.Errorf("Function stats - want 2 successful invocations, got: %+v", got)
+	}
+	if got := stats.Functions["fail"]; got.Invocations != 2 || got.Failures != 2 {
+		t.Errorf("Function stats - want 2 failed invocations, got: %+v", got)
+	}
+}
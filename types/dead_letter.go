@@ -0,0 +1,247 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openfaas/faas-provider/auth"
+)
+
+// defaultDeadLetterTimeout limits the time taken to deliver a dead letter.
+const defaultDeadLetterTimeout = 30 * time.Second
+
+// defaultDeadLetterQueueSize is the number of dead letters waiting to be
+// delivered when no DeadLetterQueueSize is given.
+const defaultDeadLetterQueueSize = 1000
+
+// DeadLetter is an invocation that failed once its retries were exhausted,
+// with the original message.
+type DeadLetter struct {
+	Topic      string            `json:"topic"`
+	Function   string            `json:"function"`
+	MessageID  string            `json:"messageId,omitempty"`
+	Tenant     string            `json:"tenant,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+
+	// Body is the body of the message, or empty if it was streamed.
+	Body []byte `json:"body,omitempty"`
+
+	// Status and Error describe the failure.
+	Status int    `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+
+	// ResponseBody is the body of the failed response, if any.
+	ResponseBody []byte `json:"responseBody,omitempty"`
+
+	Time time.Time `json:"time"`
+}
+
+// DeadLetterSink receives the invocations that failed, so that undeliverable
+// messages are not lost.
+type DeadLetterSink interface {
+	DeadLetter(ctx context.Context, letter DeadLetter) error
+}
+
+// DefaultDeadLetterPolicy routes the invocations that failed with an error or
+// a 4xx or 5xx status to the DeadLetterSink. The cached responses and the
+// invocations rejected by the connector itself, e.g. with ErrCircuitOpen,
+// ErrFunctionDraining, ErrRateLimited or ErrPaused, are not dead-lettered:
+// the message never reached the function.
+func DefaultDeadLetterPolicy(res InvokerResponse) bool {
+	if res.Cached || localRejection(res.Error) {
+		return false
+	}
+	return res.Error != nil || res.Status >= http.StatusBadRequest
+}
+
+// deadLetterQueue delivers the dead letters in the background, so that a slow
+// DeadLetterSink doesn't hold the invocations. Its worker runs while there
+// are dead letters to deliver.
+type deadLetterQueue struct {
+	lock    sync.Mutex
+	pending []DeadLetter
+	running bool
+}
+
+// deadLetter queues a failed invocation for the DeadLetterSink, if set, and
+// returns true once it is accepted. It is not accepted when the queue is
+// full.
+func (i *Invoker) deadLetter(message *Message, res InvokerResponse) bool {
+	if i.DeadLetterSink == nil {
+		return false
+	}
+	policy := i.DeadLetterPolicy
+	if policy == nil {
+		policy = DefaultDeadLetterPolicy
+	}
+	if !policy(res) {
+		return false
+	}
+
+	letter := DeadLetter{
+		Topic:      res.Topic,
+		Function:   res.Function,
+		MessageID:  res.MessageID,
+		Tenant:     res.Tenant,
+		Attributes: message.Attributes,
+		Body:       message.Body,
+		Status:     res.Status,
+		Time:       time.Now().UTC(),
+	}
+	if res.Error != nil {
+		letter.Error = res.Error.Error()
+	}
+	if res.Body != nil {
+		letter.ResponseBody = *res.Body
+	}
+
+	size := i.DeadLetterQueueSize
+	if size <= 0 {
+		size = defaultDeadLetterQueueSize
+	}
+
+	queue := &i.deadLetters
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+
+	if len(queue.pending) >= size {
+		i.logger().Errorf("Unable to dead-letter the message %s of %s: %d dead letters are waiting", res.MessageID, res.Function, len(queue.pending))
+		return false
+	}
+	// The delivery is in flight, so that Close waits for it.
+	if _, ok := i.beginPublish(); !ok {
+		return false
+	}
+	queue.pending = append(queue.pending, letter)
+	if !queue.running {
+		queue.running = true
+		go i.deliverDeadLetters()
+	}
+	return true
+}
+
+// deliverDeadLetters delivers the queued dead letters in order, until there
+// are none left.
+func (i *Invoker) deliverDeadLetters() {
+	queue := &i.deadLetters
+	for {
+		queue.lock.Lock()
+		if len(queue.pending) == 0 {
+			queue.running = false
+			queue.lock.Unlock()
+			return
+		}
+		letter := queue.pending[0]
+		queue.pending[0] = DeadLetter{}
+		queue.pending = queue.pending[1:]
+		queue.lock.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), defaultDeadLetterTimeout)
+		if err := i.DeadLetterSink.DeadLetter(ctx, letter); err != nil {
+			i.logger().Errorf("Unable to dead-letter the message %s of %s: %s", letter.MessageID, letter.Function, err)
+		}
+		cancel()
+		i.end()
+	}
+}
+
+// HTTPDeadLetterSink posts each dead letter as JSON to an HTTP endpoint.
+type HTTPDeadLetterSink struct {
+	URL string
+
+	// Header is sent with each request, e.g. for authentication.
+	Header http.Header
+
+	Credentials *auth.BasicAuthCredentials
+	Client      *http.Client
+
+	// Auth authenticates the requests, taking precedence over Credentials.
+	Auth ClientAuth
+}
+
+// DeadLetter posts a dead letter, failing unless a 2xx status is returned.
+func (s *HTTPDeadLetterSink) DeadLetter(ctx context.Context, letter DeadLetter) error {
+	data, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	for name, values := range s.Header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err := setAuth(req, s.Auth, s.Credentials); err != nil {
+		return err
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d from %s", res.StatusCode, s.URL)
+	}
+	return nil
+}
+
+// NewFunctionDeadLetterSink creates a sink invoking function through the
+// gateway with each dead letter as its JSON body.
+func NewFunctionDeadLetterSink(gatewayURL, function string, credentials *auth.BasicAuthCredentials, client *http.Client) *HTTPDeadLetterSink {
+	return &HTTPDeadLetterSink{
+		URL:         strings.TrimSuffix(gatewayURL, "/") + "/function/" + function,
+		Credentials: credentials,
+		Client:      client,
+	}
+}
+
+// FileDeadLetterSink appends each dead letter as a line of JSON to a file.
+type FileDeadLetterSink struct {
+	Path string
+
+	lock sync.Mutex
+}
+
+// DeadLetter appends a dead letter to the file, creating it if needed.
+func (s *FileDeadLetterSink) DeadLetter(ctx context.Context, letter DeadLetter) error {
+	data, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	f, err := os.OpenFile(s.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,167 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_Invoker_DeadLetter(t *testing.T) {
+	letters := make(chan DeadLetter, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/function/dlq":
+			letter := DeadLetter{}
+			if err := json.NewDecoder(r.Body).Decode(&letter); err != nil {
+				t.Error(err)
+			}
+			letters <- letter
+		case "/function/fail":
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("boom"))
+		}
+	}))
+	defer srv.Close()
+
+	invoker := NewInvoker(srv.URL+"/function", "", srv.Client(), false, false)
+	invoker.DeadLetterSink = NewFunctionDeadLetterSink(srv.URL, "dlq", nil, srv.Client())
+	topicMap := newTestTopicMap(map[string][]string{"orders": {"echo", "fail"}})
+
+	responses := collectResponses(invoker, func() {
+		invoker.InvokeMessage(context.Background(), topicMap, "orders", &Message{
+			Body:       []byte("hello"),
+			Attributes: map[string]string{"key": "1"},
+		})
+	})
+
+	for _, res := range responses {
+		if want := res.Function == "fail"; res.DeadLettered != want {
+			t.Errorf("%s: DeadLettered - want: %v, got: %v", res.Function, want, res.DeadLettered)
+		}
+	}
+
+	select {
+	case letter := <-letters:
+		if letter.Topic != "orders" || letter.Function != "fail" || letter.Status != http.StatusInternalServerError ||
+			string(letter.Body) != "hello" || string(letter.ResponseBody) != "boom" || letter.Attributes["key"] != "1" {
+			t.Errorf("Dead letter - got: %+v", letter)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("want a dead letter")
+	}
+	if len(letters) != 0 {
+		t.Errorf("Dead letters - want only the failed invocation, got %d more", len(letters))
+	}
+}
+
+func Test_FileDeadLetterSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dead-letters")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sink := &FileDeadLetterSink{Path: filepath.Join(dir, "dead-letters.jsonl")}
+	for _, function := range []string{"a", "b"} {
+		if err := sink.DeadLetter(context.Background(), DeadLetter{Topic: "orders", Function: function}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := os.Open(sink.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	functions := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		letter := DeadLetter{}
+		if err := json.Unmarshal(scanner.Bytes(), &letter); err != nil {
+			t.Fatal(err)
+		}
+		functions = append(functions, letter.Function)
+	}
+	if len(functions) != 2 || functions[0] != "a" || functions[1] != "b" {
+		t.Errorf("Dead letters - want: [a b], got: %v", functions)
+	}
+}
+
+func Test_DefaultDeadLetterPolicy(t *testing.T) {
+	cases := []struct {
+		name string
+		res  InvokerResponse
+		want bool
+	}{
+		{name: "ok", res: InvokerResponse{Status: http.StatusOK}},
+		{name: "failed", res: InvokerResponse{Status: http.StatusInternalServerError}, want: true},
+		{name: "cached", res: InvokerResponse{Status: http.StatusInternalServerError, Cached: true}},
+		{name: "circuit open", res: InvokerResponse{Error: ErrCircuitOpen}},
+		{name: "draining", res: InvokerResponse{Error: ErrFunctionDraining}},
+		{name: "paused", res: InvokerResponse{Error: ErrPaused}},
+	}
+	for _, tc := range cases {
+		if got := DefaultDeadLetterPolicy(tc.res); got != tc.want {
+			t.Errorf("%s: want: %v, got: %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func Test_Invoker_DeadLetterDoesNotBlock(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/function/dlq":
+			<-release
+		case "/function/fail":
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	invoker := NewInvoker(srv.URL+"/function", "", srv.Client(), false, false)
+	invoker.DeadLetterSink = NewFunctionDeadLetterSink(srv.URL, "dlq", nil, srv.Client())
+	invoker.DeadLetterQueueSize = 1
+	topicMap := newTestTopicMap(map[string][]string{"orders": {"fail"}})
+
+	var responses []InvokerResponse
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		responses = collectResponses(invoker, func() {
+			for n := 0; n < 3; n++ {
+				invoker.InvokeMessage(context.Background(), topicMap, "orders", &Message{Body: []byte("hello")})
+			}
+		})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("want the invocations not to wait for the DeadLetterSink")
+	}
+	close(release)
+
+	// The letters beyond the one being delivered and the one waiting
+	// overflow the queue.
+	dead := 0
+	for _, res := range responses {
+		if res.DeadLettered {
+			dead++
+		}
+	}
+	if dead == 0 || dead == len(responses) {
+		t.Errorf("DeadLettered - want the queue to overflow, got: %d of %d", dead, len(responses))
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+//go:build !windows
+// +build !windows
+
+package types
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyDebugSignals raises the verbosity on SIGUSR1 and reverts it on
+// SIGUSR2.
+func (c *controller) notifyDebugSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	c.debugSignals = signals
+
+	timeout := c.Config.DebugSignalTimeout
+	if timeout <= 0 {
+		timeout = defaultDebugSignalTimeout
+	}
+
+	go func() {
+		for sig := range signals {
+			switch sig {
+			case syscall.SIGUSR1:
+				if err := c.SetVerbosity(LevelDebug, true, timeout); err != nil {
+					c.Logger.Warnf("Unable to enable debug logging: %s", err)
+					continue
+				}
+				c.Logger.Infof("Debug logging and response bodies enabled for %s", timeout)
+			case syscall.SIGUSR2:
+				c.revertVerbosity()
+			}
+		}
+	}()
+}
+
+// stopDebugSignals stops handling the signals enabled by notifyDebugSignals.
+func (c *controller) stopDebugSignals() {
+	if c.debugSignals != nil {
+		signal.Stop(c.debugSignals)
+		close(c.debugSignals)
+	}
+}
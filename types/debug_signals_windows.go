@@ -0,0 +1,13 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+// notifyDebugSignals is not supported on Windows, which has no SIGUSR1 and
+// SIGUSR2: use the control API instead.
+func (c *controller) notifyDebugSignals() {
+	c.Logger.Warnf("DebugSignals is not supported on Windows, use the control API to change the log level")
+}
+
+// stopDebugSignals does nothing on Windows.
+func (c *controller) stopDebugSignals() {}
@@ -0,0 +1,101 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"crypto/rand"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// discoveryLimiterKey identifies the limit of the discovery calls in the
+// SharedState, apart from the limit of the invocations.
+const discoveryLimiterKey = "connector-discovery"
+
+// waitDiscovery waits for the DiscoveryLimiter to allow a call listing the
+// namespaces or the functions, or for ctx to be done.
+func (s *FunctionLookupBuilder) waitDiscovery(ctx context.Context) error {
+	if s.DiscoveryLimiter != nil {
+		return s.DiscoveryLimiter.Wait(ctx)
+	}
+	return ctx.Err()
+}
+
+// newDiscoveryLimiter creates the limiter of the discovery calls of the
+// config, or nil if DiscoveryRateLimit is not set.
+func newDiscoveryLimiter(config *ControllerConfig) *RateLimiter {
+	if config.DiscoveryRateLimit <= 0 {
+		return nil
+	}
+	limiter := NewRateLimiter(config.DiscoveryRateLimit, config.DiscoveryRateLimitBurst)
+	limiter.SharedState = config.SharedState
+	limiter.Key = discoveryLimiterKey
+	return limiter
+}
+
+// rebuildTicker ticks every interval, each tick shifted by a random jitter
+// of up to jitter times the interval, so that the replicas of a connector
+// started together don't rebuild their topic maps at the same time.
+type rebuildTicker struct {
+	C <-chan time.Time
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func newRebuildTicker(interval time.Duration, jitter float64) *rebuildTicker {
+	c := make(chan time.Time, 1)
+	t := &rebuildTicker{C: c, stop: make(chan struct{})}
+
+	go func() {
+		for {
+			timer := time.NewTimer(jittered(interval, jitter))
+			select {
+			case now := <-timer.C:
+				select {
+				case c <- now:
+				default:
+				}
+			case <-t.stop:
+				timer.Stop()
+				return
+			}
+		}
+	}()
+	return t
+}
+
+// Stop stops the ticker.
+func (t *rebuildTicker) Stop() {
+	t.stopOnce.Do(func() {
+		close(t.stop)
+	})
+}
+
+// jittered returns interval shifted by a random duration between -jitter
+// and +jitter times the interval. The random numbers come from crypto/rand,
+// which needs no seed to differ across replicas.
+func jittered(interval time.Duration, jitter float64) time.Duration {
+	if jitter <= 0 || interval <= 0 {
+		return interval
+	}
+	if jitter > 1 {
+		jitter = 1
+	}
+
+	spread := int64(float64(interval) * jitter)
+	if spread <= 0 {
+		return interval
+	}
+	n, err := rand.Int(rand.Reader, big.NewInt(2*spread+1))
+	if err != nil {
+		return interval
+	}
+	if delay := interval + time.Duration(n.Int64()-spread); delay > 0 {
+		return delay
+	}
+	return interval
+}
@@ -0,0 +1,145 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ptypes "github.com/openfaas/faas-provider/types"
+)
+
+func Test_Jittered_WithinBounds(t *testing.T) {
+	interval := time.Second
+	for n := 0; n < 100; n++ {
+		delay := jittered(interval, 0.2)
+		if delay < 800*time.Millisecond || delay > 1200*time.Millisecond {
+			t.Fatalf("want a delay within 20%% of %s, got %s", interval, delay)
+		}
+	}
+
+	if delay := jittered(interval, 0); delay != interval {
+		t.Errorf("want %s without jitter, got %s", interval, delay)
+	}
+}
+
+func Test_RebuildTicker_TicksAndStops(t *testing.T) {
+	ticker := newRebuildTicker(10*time.Millisecond, 0.5)
+
+	select {
+	case <-ticker.C:
+	case <-time.After(time.Second):
+		t.Fatal("want a tick")
+	}
+
+	ticker.Stop()
+	ticker.Stop()
+}
+
+func Test_BuildWithMetadata_DiscoveryLimiter(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if r.URL.Path == "/system/namespaces" {
+			json.NewEncoder(w).Encode([]string{"openfaas-fn"})
+			return
+		}
+		json.NewEncoder(w).Encode([]ptypes.FunctionStatus{})
+	}))
+	defer srv.Close()
+
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	limiter := &RateLimiter{now: clock.Now, after: clock.After}
+	limiter.SetLimit(10, 1)
+
+	builder := FunctionLookupBuilder{
+		GatewayURL:       srv.URL,
+		Client:           srv.Client(),
+		DisableListCache: true,
+		DiscoveryLimiter: limiter,
+	}
+
+	for n := 0; n < 2; n++ {
+		if _, _, err := builder.BuildWithMetadata(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := atomic.LoadInt32(&calls); got != 4 {
+		t.Fatalf("want 4 calls, got %d", got)
+	}
+	if waited := clock.Waited(); waited < 300*time.Millisecond {
+		t.Errorf("want the calls limited to 10 per second, waited %s", waited)
+	}
+}
+
+func Test_AnnotationTopicSource_DiscoveryLimiterStopsWithContext(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/system/namespaces" {
+			json.NewEncoder(w).Encode([]string{"openfaas-fn"})
+			return
+		}
+		json.NewEncoder(w).Encode([]ptypes.FunctionStatus{})
+	}))
+	defer srv.Close()
+
+	source := NewAnnotationTopicSource(&FunctionLookupBuilder{
+		GatewayURL:       srv.URL,
+		Client:           srv.Client(),
+		DisableListCache: true,
+		DiscoveryLimiter: NewRateLimiter(0.001, 1),
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := source.BuildWithMetadata(ctx)
+		done <- err
+	}()
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Fatalf("want %s, got %v", context.Canceled, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("want the build to give up waiting for the limiter")
+	}
+}
+
+// fakeClock is a clock advanced by the waits of a RateLimiter.
+type fakeClock struct {
+	lock   sync.Mutex
+	now    time.Time
+	waited time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+	c.waited += d
+	fired := make(chan time.Time, 1)
+	fired <- c.now
+	return fired
+}
+
+func (c *fakeClock) Waited() time.Duration {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.waited
+}
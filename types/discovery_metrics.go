@@ -0,0 +1,134 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DiscoveryStats describes a build of the lookups by a FunctionLookupBuilder.
+type DiscoveryStats struct {
+	// Gateway is the URL of the gateway queried.
+	Gateway string
+
+	// Duration is the time spent listing the namespaces and the functions.
+	Duration time.Duration
+
+	// Namespaces is the number of namespaces whose functions were listed.
+	Namespaces int
+
+	// Functions is the number of functions discovered, before SkipNotReady
+	// leaves some out.
+	Functions int
+
+	// Topics is the number of topics of the lookups.
+	Topics int
+
+	// NamespaceErrors maps the namespaces whose functions could not be
+	// listed to their error.
+	NamespaceErrors map[string]error
+
+	// Err is the error of the build, if any.
+	Err error
+}
+
+// build compiles the map of topic names and functions from gatewayURL,
+// reporting the DiscoveryStats of the build to OnDiscovery.
+func (s *FunctionLookupBuilder) build(ctx context.Context, gatewayURL string) (map[string][]string, map[string]FunctionMetadata, error) {
+	stats := &DiscoveryStats{Gateway: gatewayURL, NamespaceErrors: map[string]error{}}
+	start := time.Now()
+
+	serviceMap, metadata, err := s.discover(ctx, gatewayURL, stats)
+
+	if s.OnDiscovery != nil {
+		stats.Duration = time.Since(start)
+		stats.Topics = len(serviceMap)
+		stats.Err = err
+		s.OnDiscovery(*stats)
+	}
+	return serviceMap, metadata, err
+}
+
+// discoveryMetrics accounts the builds of the lookups.
+type discoveryMetrics struct {
+	lock            sync.Mutex
+	observed        bool
+	duration        time.Duration
+	namespaces      int
+	functions       int
+	topics          int
+	namespaceErrors map[string]uint64
+}
+
+// observeDiscovery accounts a build of the lookups.
+func (m *Metrics) observeDiscovery(stats DiscoveryStats) {
+	d := &m.discovery
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.observed = true
+	d.duration = stats.Duration
+	d.namespaces = stats.Namespaces
+	d.functions = stats.Functions
+	d.topics = stats.Topics
+	for namespace := range stats.NamespaceErrors {
+		if d.namespaceErrors == nil {
+			d.namespaceErrors = map[string]uint64{}
+		}
+		d.namespaceErrors[namespace]++
+	}
+}
+
+// writeDiscovery writes the metrics of the last build of the lookups and
+// the listing errors per namespace.
+func (m *Metrics) writeDiscovery(w io.Writer) {
+	d := &m.discovery
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if !d.observed {
+		return
+	}
+
+	writeMetricHeader(w, "connector_discovery_duration_seconds", "gauge", "Duration of the last discovery of the functions.")
+	writeMetric(w, "connector_discovery_duration_seconds", nil, d.duration.Seconds())
+
+	writeMetricHeader(w, "connector_discovery_namespaces", "gauge", "Namespaces scanned by the last discovery.")
+	writeMetric(w, "connector_discovery_namespaces", nil, float64(d.namespaces))
+
+	writeMetricHeader(w, "connector_discovery_functions", "gauge", "Functions found by the last discovery.")
+	writeMetric(w, "connector_discovery_functions", nil, float64(d.functions))
+
+	writeMetricHeader(w, "connector_discovery_topics", "gauge", "Topics produced by the last discovery.")
+	writeMetric(w, "connector_discovery_topics", nil, float64(d.topics))
+
+	if len(d.namespaceErrors) == 0 {
+		return
+	}
+	namespaces := make([]string, 0, len(d.namespaceErrors))
+	for namespace := range d.namespaceErrors {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	writeMetricHeader(w, "connector_discovery_namespace_errors_total", "counter", "Failed listings of the functions of each namespace.")
+	for _, namespace := range namespaces {
+		writeMetric(w, "connector_discovery_namespace_errors_total", []string{"namespace", namespace}, float64(d.namespaceErrors[namespace]))
+	}
+}
+
+// observeDiscovery reports a build of the main topic map to the Metrics and
+// to OnDiscovery.
+func (c *controller) observeDiscovery(stats DiscoveryStats) {
+	if c.Config.Metrics != nil {
+		c.Config.Metrics.observeDiscovery(stats)
+	}
+	if c.Config.OnDiscovery != nil {
+		c.Config.OnDiscovery(stats)
+	}
+}
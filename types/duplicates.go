@@ -0,0 +1,95 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"strings"
+)
+
+// DuplicateFunctionPolicy defines what the Invoker does when a function with
+// the same name is deployed in several namespaces and all of them subscribe to
+// the same topic.
+type DuplicateFunctionPolicy int
+
+const (
+	// DuplicateInvokeAll invokes every matched function. This is the default.
+	DuplicateInvokeAll DuplicateFunctionPolicy = iota
+
+	// DuplicateWarn invokes every matched function, but logs a warning the
+	// first time a duplicate is detected for a topic.
+	DuplicateWarn
+
+	// DuplicatePreferNamespace invokes only the duplicate whose namespace comes
+	// first in the configured namespace preference list. If none of the
+	// namespaces is listed, all of them are invoked and a warning is logged.
+	DuplicatePreferNamespace
+)
+
+// resolveDuplicates applies the duplicate policy of the Invoker to the list
+// of functions matched for a topic.
+func (i *Invoker) resolveDuplicates(topic string, functions []string) []string {
+	if i.DuplicatePolicy == DuplicateInvokeAll || len(functions) < 2 {
+		return functions
+	}
+
+	byName := make(map[string][]string)
+	for _, function := range functions {
+		name, _ := splitFunctionRef(function)
+		byName[name] = append(byName[name], function)
+	}
+
+	if len(byName) == len(functions) {
+		return functions
+	}
+
+	resolved := make([]string, 0, len(byName))
+	for _, function := range functions {
+		name, _ := splitFunctionRef(function)
+		duplicates, ok := byName[name]
+		if !ok {
+			// already resolved
+			continue
+		}
+		delete(byName, name)
+
+		if len(duplicates) == 1 {
+			resolved = append(resolved, function)
+			continue
+		}
+
+		if i.DuplicatePolicy == DuplicatePreferNamespace {
+			if preferred, found := preferredFunction(duplicates, i.NamespacePreference); found {
+				resolved = append(resolved, preferred)
+				continue
+			}
+		}
+
+		i.warnDuplicate(topic, name, duplicates)
+		resolved = append(resolved, duplicates...)
+	}
+
+	return resolved
+}
+
+// warnDuplicate logs a warning only once per topic and function name.
+func (i *Invoker) warnDuplicate(topic, name string, duplicates []string) {
+	if _, warned := i.duplicatesWarned.LoadOrStore(topic+"/"+name, true); warned {
+		return
+	}
+	i.logger().Warnf("Function %s is subscribed to topic %s in several namespaces: %s",
+		name, topic, strings.Join(duplicates, ", "))
+}
+
+// preferredFunction returns the function whose namespace has the highest
+// priority in the namespace preference list.
+func preferredFunction(functions, preference []string) (string, bool) {
+	for _, namespace := range preference {
+		for _, function := range functions {
+			if _, ns := splitFunctionRef(function); ns == namespace {
+				return function, true
+			}
+		}
+	}
+	return "", false
+}
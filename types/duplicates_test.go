@@ -0,0 +1,56 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_resolveDuplicates(t *testing.T) {
+	functions := []string{"echo.openfaas-fn", "figlet.openfaas-fn", "echo.team-a"}
+
+	tests := []struct {
+		name       string
+		policy     DuplicateFunctionPolicy
+		preference []string
+		want       []string
+	}{
+		{
+			name:   "invoke all",
+			policy: DuplicateInvokeAll,
+			want:   functions,
+		},
+		{
+			name:   "warn invokes all",
+			policy: DuplicateWarn,
+			want:   []string{"echo.openfaas-fn", "echo.team-a", "figlet.openfaas-fn"},
+		},
+		{
+			name:       "prefer namespace",
+			policy:     DuplicatePreferNamespace,
+			preference: []string{"team-a", "openfaas-fn"},
+			want:       []string{"echo.team-a", "figlet.openfaas-fn"},
+		},
+		{
+			name:       "prefer namespace not listed",
+			policy:     DuplicatePreferNamespace,
+			preference: []string{"team-b"},
+			want:       []string{"echo.openfaas-fn", "echo.team-a", "figlet.openfaas-fn"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			invoker := Invoker{
+				DuplicatePolicy:     test.policy,
+				NamespacePreference: test.preference,
+			}
+			got := invoker.resolveDuplicates("topic1", functions)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Functions - want: %v, got: %v", test.want, got)
+			}
+		})
+	}
+}
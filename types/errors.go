@@ -0,0 +1,64 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"errors"
+	"fmt"
+
+	pkgerrors "github.com/pkg/errors"
+)
+
+// ErrPaused is returned for the messages received while the controller is paused.
+var ErrPaused = errors.New("controller is paused")
+
+// ErrCircuitOpen is returned for the invocations of a function whose circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// ErrFunctionDraining is returned for the invocations of a function drained with DrainFunction whose context is done
+// before the function is resumed.
+var ErrFunctionDraining = errors.New("function is draining")
+
+// ErrInvokerClosed is returned for the invocations made after the Invoker is closed.
+var ErrInvokerClosed = errors.New("invoker is closed")
+
+// ErrControllerStopped is returned for the messages received after the controller is stopped.
+var ErrControllerStopped = errors.New("controller is stopped")
+
+// ErrBusy is returned for the messages received while MaxInFlight invocations are in flight, when RejectWhenBusy is
+// set.
+var ErrBusy = errors.New("too many invocations in flight")
+
+// ErrGatewayUnauthorized is returned by CheckGateway and WaitForGateway when the gateway rejects the credentials.
+var ErrGatewayUnauthorized = errors.New("gateway rejected the credentials")
+
+// ErrUnknownTenant is returned by InvokeForTenant for a tenant not declared in Tenants.
+var ErrUnknownTenant = errors.New("unknown tenant")
+
+// ErrFunctionNotFound is returned for the invocations of a function recently answered with 404 by the gateway.
+var ErrFunctionNotFound = errors.New("function not found")
+
+// ErrRateLimited is returned for the invocations whose context is done while they wait for the rate limiter.
+var ErrRateLimited = errors.New("rate limited")
+
+// localRejection returns true if err rejected an invocation before it was sent to the gateway, which says nothing
+// about the health of the function.
+func localRejection(err error) bool {
+	switch pkgerrors.Cause(err) {
+	case ErrPaused, ErrCircuitOpen, ErrFunctionDraining, ErrInvokerClosed, ErrControllerStopped, ErrBusy, ErrRateLimited:
+		return true
+	}
+	return false
+}
+
+// ConfigError is returned when a configuration value of the controller or
+// the invoker is not valid.
+type ConfigError struct {
+	Field  string
+	Reason string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("invalid configuration for %s: %s", e.Field, e.Reason)
+}
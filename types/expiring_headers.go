@@ -0,0 +1,138 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ExpiringHeader is a header forwarded to the functions until it expires,
+// e.g. a short-lived token.
+type ExpiringHeader struct {
+	Name      string
+	Value     string
+	ExpiresAt time.Time
+}
+
+// HeaderRefresher returns a fresh value for an expired header.
+type HeaderRefresher func(ctx context.Context, name string) (ExpiringHeader, error)
+
+// ExpiringHeaders holds the headers forwarded to every function with a TTL.
+// When a header has expired, the Refresher is called to renew it; if there
+// is no Refresher or it fails, the header is stripped instead of being
+// forwarded stale. The zero value is an empty set without a Refresher.
+type ExpiringHeaders struct {
+	Refresher HeaderRefresher
+
+	lock      sync.Mutex
+	headers   map[string]ExpiringHeader
+	refreshes map[string]*flightGroup
+
+	now func() time.Time
+}
+
+// NewExpiringHeaders creates an empty set of expiring headers.
+func NewExpiringHeaders(refresher HeaderRefresher) *ExpiringHeaders {
+	return &ExpiringHeaders{
+		Refresher: refresher,
+		headers:   make(map[string]ExpiringHeader),
+	}
+}
+
+// Set adds or replaces a header valid for ttl.
+func (h *ExpiringHeaders) Set(name, value string, ttl time.Duration) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.headers == nil {
+		h.headers = make(map[string]ExpiringHeader)
+	}
+	name = http.CanonicalHeaderKey(name)
+	h.headers[name] = ExpiringHeader{Name: name, Value: value, ExpiresAt: h.clock().Add(ttl)}
+}
+
+// apply sets the valid headers on header, refreshing the expired ones, and
+// strips those that could not be refreshed. The Refresher is called without
+// the lock held, once per header for concurrent invocations.
+func (h *ExpiringHeaders) apply(ctx context.Context, header http.Header, logger Logger) {
+	h.lock.Lock()
+	now := h.clock()
+	expired := []string{}
+	for name, expiring := range h.headers {
+		if now.Before(expiring.ExpiresAt) {
+			header.Set(name, expiring.Value)
+		} else {
+			expired = append(expired, name)
+		}
+	}
+	h.lock.Unlock()
+
+	for _, name := range expired {
+		if h.Refresher != nil {
+			if err := h.refresh(ctx, name); err != nil {
+				logger.Warnf("Unable to refresh header %s: %s", name, err)
+			}
+		}
+
+		h.lock.Lock()
+		refreshed, ok := h.headers[name]
+		h.lock.Unlock()
+		if ok && h.clock().Before(refreshed.ExpiresAt) {
+			header.Set(name, refreshed.Value)
+			continue
+		}
+
+		logger.Debugf("Stripping expired header %s", name)
+		header.Del(name)
+	}
+}
+
+// refresh renews an expired header with the Refresher, sharing the call with
+// the concurrent invocations refreshing the same header.
+func (h *ExpiringHeaders) refresh(ctx context.Context, name string) error {
+	h.lock.Lock()
+	if h.refreshes == nil {
+		h.refreshes = make(map[string]*flightGroup)
+	}
+	group, ok := h.refreshes[name]
+	if !ok {
+		group = &flightGroup{}
+		h.refreshes[name] = group
+	}
+	h.lock.Unlock()
+
+	return group.do(func() error {
+		h.lock.Lock()
+		expiring, ok := h.headers[name]
+		h.lock.Unlock()
+		if !ok || h.clock().Before(expiring.ExpiresAt) {
+			// Refreshed or replaced meanwhile.
+			return nil
+		}
+
+		refreshed, err := h.Refresher(ctx, name)
+		if err != nil {
+			return err
+		}
+
+		h.lock.Lock()
+		defer h.lock.Unlock()
+		if current, ok := h.headers[name]; ok && current == expiring && h.clock().Before(refreshed.ExpiresAt) {
+			refreshed.Name = name
+			h.headers[name] = refreshed
+		}
+		return nil
+	})
+}
+
+// clock returns the current time.
+func (h *ExpiringHeaders) clock() time.Time {
+	if h.now == nil {
+		return time.Now()
+	}
+	return h.now()
+}
@@ -0,0 +1,107 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_ExpiringHeaders_RefreshesAndStrips(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	refreshes := 0
+	headers := NewExpiringHeaders(func(ctx context.Context, name string) (ExpiringHeader, error) {
+		refreshes++
+		if name == "X-Broken" {
+			return ExpiringHeader{}, fmt.Errorf("token service unavailable")
+		}
+		return ExpiringHeader{Value: "fresh", ExpiresAt: now.Add(time.Minute)}, nil
+	})
+	headers.now = func() time.Time { return now }
+
+	headers.Set("Authorization", "stale", time.Second)
+	headers.Set("X-Broken", "stale", time.Second)
+
+	header := http.Header{}
+	headers.apply(context.Background(), header, defaultLogger)
+	if header.Get("Authorization") != "stale" || header.Get("X-Broken") != "stale" || refreshes != 0 {
+		t.Fatalf("Headers - want valid headers forwarded, got: %v (%d refreshes)", header, refreshes)
+	}
+
+	now = now.Add(time.Second)
+	header = http.Header{"X-Broken": []string{"from message"}}
+	headers.apply(context.Background(), header, defaultLogger)
+
+	if got := header.Get("Authorization"); got != "fresh" {
+		t.Errorf("Authorization - want: %q, got: %q", "fresh", got)
+	}
+	if _, ok := header["X-Broken"]; ok {
+		t.Errorf("X-Broken - want stripped, got: %v", header["X-Broken"])
+	}
+
+	headers.apply(context.Background(), http.Header{}, defaultLogger)
+	if refreshes != 3 {
+		t.Errorf("Refreshes - want: %d, got: %d", 3, refreshes)
+	}
+}
+
+func Test_ExpiringHeaders_ZeroValue(t *testing.T) {
+	var headers ExpiringHeaders
+
+	header := http.Header{}
+	headers.apply(context.Background(), header, defaultLogger)
+	headers.Set("Authorization", "token", time.Minute)
+	headers.apply(context.Background(), header, defaultLogger)
+
+	if got := header.Get("Authorization"); got != "token" {
+		t.Errorf("Authorization - want: %q, got: %q", "token", got)
+	}
+}
+
+func Test_ExpiringHeaders_RefreshesOnceWithoutLock(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	var refreshes int32
+	release := make(chan struct{})
+	var headers *ExpiringHeaders
+	headers = NewExpiringHeaders(func(ctx context.Context, name string) (ExpiringHeader, error) {
+		atomic.AddInt32(&refreshes, 1)
+		// The lock must not be held while refreshing.
+		headers.Set("X-Other", "other", time.Minute)
+		<-release
+		return ExpiringHeader{Value: "fresh", ExpiresAt: now.Add(time.Minute)}, nil
+	})
+	headers.now = func() time.Time { return now }
+	headers.Set("Authorization", "stale", 0)
+
+	var wg sync.WaitGroup
+	results := make(chan string, 5)
+	for i := 0; i < cap(results); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			header := http.Header{}
+			headers.apply(context.Background(), header, defaultLogger)
+			results <- header.Get("Authorization")
+		}()
+	}
+
+	waitFor(t, func() bool { return atomic.LoadInt32(&refreshes) == 1 })
+	close(release)
+	wg.Wait()
+	close(results)
+
+	for got := range results {
+		if got != "fresh" {
+			t.Errorf("Authorization - want: %q, got: %q", "fresh", got)
+		}
+	}
+	if got := atomic.LoadInt32(&refreshes); got != 1 {
+		t.Errorf("Refreshes - want: %d, got: %d", 1, got)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"fmt"
+)
+
+// MessageFilter is evaluated for each message received by the controller,
+// before its topic is matched. Returning false drops the message silently,
+// e.g. a heartbeat, while returning an error rejects it: the error is
+// delivered to the subscribers and the message is not invoked.
+type MessageFilter func(topic string, message *Message) (allow bool, err error)
+
+// MaxBodySizeFilter returns a MessageFilter rejecting the messages whose body
+// is larger than size bytes. The size of a streamed body is not known, so
+// those messages are allowed.
+func MaxBodySizeFilter(size int) MessageFilter {
+	return func(topic string, message *Message) (bool, error) {
+		if message != nil && len(message.Body) > size {
+			return false, fmt.Errorf("message of %d bytes exceeds the limit of %d bytes", len(message.Body), size)
+		}
+		return true, nil
+	}
+}
+
+// AddFilter appends a filter to the chain evaluated for each message.
+func (c *controller) AddFilter(filter MessageFilter) {
+	c.Lock.Lock()
+	c.filters = append(c.filters, filter)
+	c.Lock.Unlock()
+}
+
+// filter evaluates the filter chain for a message, and returns false if it
+// must not be invoked, with the response reporting the error of the filter
+// that rejected it, if any, already delivered to the subscribers.
+func (c *controller) filter(ctx context.Context, topic string, message *Message) (bool, *InvokerResponse) {
+	c.Lock.RLock()
+	filters := c.filters
+	c.Lock.RUnlock()
+
+	for _, filter := range filters {
+		allow, err := filter(topic, message)
+		if err != nil {
+			res := InvokerResponse{
+				Context: ctx,
+				Error:   err,
+				Topic:   topic,
+			}
+			c.Invoker.publish(res)
+			return false, &res
+		}
+		if !allow {
+			c.Logger.Debugf("Message on %s dropped by a filter", topic)
+			return false, nil
+		}
+	}
+	return true, nil
+}
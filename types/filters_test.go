@@ -0,0 +1,49 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_Controller_Filters(t *testing.T) {
+	var invocations int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&invocations, 1)
+	}))
+	defer srv.Close()
+
+	c := NewController(nil, &ControllerConfig{
+		GatewayURL:      srv.URL,
+		RebuildInterval: time.Hour,
+		Filters:         []MessageFilter{MaxBodySizeFilter(5)},
+	}).(*controller)
+	c.TopicMap.Sync(&map[string][]string{"orders": {"echo"}, "heartbeat": {"echo"}})
+	c.AddFilter(func(topic string, message *Message) (bool, error) {
+		return topic != "heartbeat", nil
+	})
+
+	if responses := c.InvokeWithResults(context.Background(), "heartbeat", &Message{Body: []byte("ping")}); len(responses) != 0 {
+		t.Errorf("Heartbeat - want dropped, got: %+v", responses)
+	}
+
+	responses := c.InvokeWithResults(context.Background(), "orders", &Message{Body: []byte("too large")})
+	if len(responses) != 1 || responses[0].Error == nil {
+		t.Errorf("Large message - want rejected with an error, got: %+v", responses)
+	}
+
+	responses = c.InvokeWithResults(context.Background(), "orders", &Message{Body: []byte("ok")})
+	if len(responses) != 1 || responses[0].Error != nil {
+		t.Errorf("Message - want invoked, got: %+v", responses)
+	}
+
+	if got := atomic.LoadInt32(&invocations); got != 1 {
+		t.Errorf("Invocations - want: %d, got: %d", 1, got)
+	}
+}
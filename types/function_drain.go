@@ -0,0 +1,137 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// functionDrains tracks the in-flight invocations of each function and the
+// functions being drained, whose new invocations are held until they are
+// resumed.
+type functionDrains struct {
+	lock     sync.Mutex
+	inFlight map[string]int
+	draining map[string]chan struct{}
+	idle     map[string][]chan struct{}
+}
+
+// begin registers an invocation of function. While the function is being
+// drained, the invocation is held until it is resumed, or ctx is done in
+// which case ErrFunctionDraining is returned.
+func (d *functionDrains) begin(ctx context.Context, function string) error {
+	for {
+		d.lock.Lock()
+		resumed, draining := d.draining[function]
+		if !draining {
+			if d.inFlight == nil {
+				d.inFlight = map[string]int{}
+			}
+			d.inFlight[function]++
+			d.lock.Unlock()
+			return nil
+		}
+		d.lock.Unlock()
+
+		select {
+		case <-resumed:
+		case <-ctx.Done():
+			return ErrFunctionDraining
+		}
+	}
+}
+
+// end unregisters an invocation of function, waking up the drains waiting
+// for the last one.
+func (d *functionDrains) end(function string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.inFlight[function]--
+	if d.inFlight[function] > 0 {
+		return
+	}
+	delete(d.inFlight, function)
+	for _, idle := range d.idle[function] {
+		close(idle)
+	}
+	delete(d.idle, function)
+}
+
+// drain holds the new invocations of function and waits until its in-flight
+// invocations have returned or ctx is done, in which case it returns the
+// number of invocations still in flight.
+func (d *functionDrains) drain(ctx context.Context, function string) (int, error) {
+	d.lock.Lock()
+	if d.draining == nil {
+		d.draining = map[string]chan struct{}{}
+	}
+	if _, ok := d.draining[function]; !ok {
+		d.draining[function] = make(chan struct{})
+	}
+
+	if d.inFlight[function] == 0 {
+		d.lock.Unlock()
+		return 0, nil
+	}
+
+	if d.idle == nil {
+		d.idle = map[string][]chan struct{}{}
+	}
+	idle := make(chan struct{})
+	d.idle[function] = append(d.idle[function], idle)
+	d.lock.Unlock()
+
+	select {
+	case <-idle:
+		return 0, nil
+	case <-ctx.Done():
+		d.lock.Lock()
+		defer d.lock.Unlock()
+		return d.inFlight[function], ctx.Err()
+	}
+}
+
+// resume releases the invocations held while function was drained.
+func (d *functionDrains) resume(function string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if resumed, ok := d.draining[function]; ok {
+		close(resumed)
+		delete(d.draining, function)
+	}
+}
+
+// DrainFunction pauses the new invocations of function, holding them until
+// ResumeFunction is called, and waits for its in-flight invocations to
+// return, so that the function can be redeployed safely. If ctx is done
+// first, the returned error reports the invocations still in flight. A held
+// invocation whose context is done fails with ErrFunctionDraining.
+func (i *Invoker) DrainFunction(ctx context.Context, function string) error {
+	functionRef, err := i.resolveFunctionRef(function)
+	if err != nil {
+		return err
+	}
+
+	pending, err := i.drains.drain(ctx, functionRef)
+	if err != nil {
+		return fmt.Errorf("%d invocations of %s still in flight: %s", pending, functionRef, err)
+	}
+	return nil
+}
+
+// ResumeFunction releases the invocations of a function drained with
+// DrainFunction.
+func (i *Invoker) ResumeFunction(function string) error {
+	functionRef, err := i.resolveFunctionRef(function)
+	if err != nil {
+		return err
+	}
+
+	i.drains.resume(functionRef)
+	return nil
+}
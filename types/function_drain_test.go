@@ -0,0 +1,104 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_DrainFunction_WaitsForInFlightInvocations(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+	}))
+	defer srv.Close()
+
+	invoker := NewInvoker(srv.URL+"/function", "", srv.Client(), false, false)
+	invoke := func() InvokerResponse {
+		return invoker.invoke(context.Background(), "topic1", "echo", &Message{Body: []byte("hello")}, []byte("hello"), http.Header{}, invokeOptions{})
+	}
+
+	inFlight := make(chan InvokerResponse, 1)
+	go func() { inFlight <- invoke() }()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := invoker.DrainFunction(ctx, "echo"); err == nil {
+		t.Fatal("want a timeout while the invocation is in flight")
+	}
+
+	heldCtx, cancelHeld := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancelHeld()
+	held := invoker.invoke(heldCtx, "topic1", "echo", &Message{Body: []byte("hello")}, []byte("hello"), http.Header{}, invokeOptions{})
+	if held.Error != ErrFunctionDraining {
+		t.Errorf("Error - want: %s, got: %v", ErrFunctionDraining, held.Error)
+	}
+
+	resumed := make(chan InvokerResponse, 1)
+	go func() { resumed <- invoke() }()
+
+	drained := make(chan error, 1)
+	go func() { drained <- invoker.DrainFunction(context.Background(), "echo") }()
+	close(release)
+
+	if err := <-drained; err != nil {
+		t.Errorf("Drain - want: nil, got: %s", err)
+	}
+	if res := <-inFlight; res.Error != nil {
+		t.Errorf("In-flight invocation - want no error, got: %s", res.Error)
+	}
+
+	select {
+	case res := <-resumed:
+		t.Fatalf("want the invocation held until resumed, got: %+v", res)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	if err := invoker.ResumeFunction("echo"); err != nil {
+		t.Fatal(err)
+	}
+	if res := <-resumed; res.Error != nil {
+		t.Errorf("Held invocation - want no error once resumed, got: %s", res.Error)
+	}
+	if res := invoke(); res.Error != nil {
+		t.Errorf("Error after resume - want: nil, got: %s", res.Error)
+	}
+}
+
+func Test_DrainFunction_KeepsCircuitClosed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	invoker := NewInvoker(srv.URL+"/function", "", srv.Client(), false, false)
+	invoker.health.breaker = &CircuitBreaker{FailureThreshold: 1, OpenDuration: time.Hour}
+	if err := invoker.DrainFunction(context.Background(), "echo"); err != nil {
+		t.Fatal(err)
+	}
+
+	for n := 0; n < 3; n++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		res := invoker.invoke(ctx, "topic1", "echo", &Message{Body: []byte("hello")}, []byte("hello"), http.Header{}, invokeOptions{})
+		cancel()
+		if res.Error != ErrFunctionDraining {
+			t.Fatalf("Error - want: %s, got: %v", ErrFunctionDraining, res.Error)
+		}
+	}
+
+	if err := invoker.ResumeFunction("echo"); err != nil {
+		t.Fatal(err)
+	}
+	if res := invoker.invoke(context.Background(), "topic1", "echo", &Message{Body: []byte("hello")}, []byte("hello"), http.Header{}, invokeOptions{}); res.Error != nil {
+		t.Errorf("Error after resume - want the circuit closed, got: %s", res.Error)
+	}
+}
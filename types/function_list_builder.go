@@ -4,12 +4,17 @@
 package types
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/openfaas/faas-provider/auth"
 	"github.com/openfaas/faas-provider/types"
@@ -18,26 +23,141 @@ import (
 
 // FunctionLookupBuilder builds a list of OpenFaaS functions
 type FunctionLookupBuilder struct {
-	GatewayURL     string
-	Client         *http.Client
-	Credentials    *auth.BasicAuthCredentials
+	GatewayURL string
+	Client     *http.Client
+
+	// Auth authenticates the requests to the gateway, e.g. with a TokenAuth.
+	// It takes precedence over Credentials.
+	Auth ClientAuth
+
+	// Credentials authenticate the requests with basic authentication.
+	//
+	// Deprecated: set Auth with BasicAuth(credentials) instead.
+	Credentials *auth.BasicAuthCredentials
+
 	TopicDelimiter string
 	Namespace      string
+
+	// TopicDelimiterPattern splits the topic annotation on each match, e.g.
+	// [,;\s]+, in place of TopicDelimiter.
+	TopicDelimiterPattern *regexp.Regexp
+
+	// Namespaces lists the functions of these namespaces only, in place of
+	// Namespace, e.g. for the topic map of a tenant.
+	Namespaces []string
+
+	// ExcludeNamespaces are never listed, whichever namespaces are
+	// discovered or configured.
+	ExcludeNamespaces []string
+
+	// NamespaceSelector lists the functions of the namespaces whose labels
+	// or annotations match every key and value, an empty value matching any
+	// value, e.g. {"openfaas": "1", "team": ""}.
+	NamespaceSelector map[string]string
+
+	// TopicNormalization rewrites the topics of the annotations, e.g. to
+	// lowercase them. The surrounding whitespace is always trimmed.
+	TopicNormalization TopicNormalization
+
+	// DefaultNamespace is used when the namespaces can't be listed because
+	// discovery is skipped or forbidden. If empty, the functions of the
+	// default namespace of the gateway are listed.
+	DefaultNamespace string
+
+	// SkipNamespaceDiscovery lists the functions of DefaultNamespace only,
+	// without listing the namespaces first.
+	SkipNamespaceDiscovery bool
+
+	// Logger is used to warn about the fallback to DefaultNamespace.
+	// Defaults to the standard log package.
+	Logger Logger
+
+	// GatewayPool spreads the builds over several gateways, if set, failing
+	// over to the next gateway when one is unreachable.
+	GatewayPool *GatewayPool
+
+	// DisableListCache lists the functions with full requests on every
+	// build. By default the lists are requested with If-None-Match, and the
+	// previous list is reused when the gateway answers 304 Not Modified.
+	DisableListCache bool
+
+	// SkipNotReady leaves out of the lookups the functions with replicas
+	// requested but none available yet, e.g. right after a deploy. Functions
+	// scaled to zero are kept, the gateway scales them up when invoked.
+	SkipNotReady bool
+
+	// FunctionSource lists the functions in place of the gateway, if set.
+	// NamespaceSelector still reads the namespaces from the gateway.
+	FunctionSource FunctionSource
+
+	// PageSize requests the functions by pages of PageSize, for providers
+	// paginating /system/functions with the limit parameter and a Link
+	// header to the next page. The pages of a provider which paginates by
+	// default are followed even without PageSize.
+	PageSize int
+
+	// MaxPages caps the pages of functions listed per namespace, so that a
+	// provider linking the pages in a loop fails the listing instead of
+	// hanging it. Defaults to 1000.
+	MaxPages int
+
+	// NamespaceCache keeps the discovered namespaces and the metadata of the
+	// selected ones for its TTL, if set, instead of getting them on every
+	// build.
+	NamespaceCache *NamespaceCache
+
+	// DiscoveryLimiter limits the calls listing the namespaces and the
+	// functions, if set.
+	DiscoveryLimiter *RateLimiter
+
+	// NamespaceRetries is the number of retries of a failed namespace
+	// listing, with a backoff starting at NamespaceRetryBackoff, 100ms if
+	// unset, and doubling on each retry.
+	NamespaceRetries      int
+	NamespaceRetryBackoff time.Duration
+
+	// PartialResults keeps the functions of the namespaces listed
+	// successfully when others fail, returning them with a
+	// *PartialBuildError instead of failing the whole build. A gateway that
+	// can't be reached still fails the build, so that the GatewayPool fails
+	// over.
+	PartialResults bool
+
+	// OnDiscovery is called after each build with its DiscoveryStats, if set.
+	OnDiscovery func(stats DiscoveryStats)
+
+	forbiddenWarned int32
+	selectorWarned  int32
+	listCache       functionListCache
+}
+
+// errNamespacesForbidden is returned by getNamespaces when the gateway
+// rejects the listing of the namespaces.
+type errNamespacesForbidden struct {
+	status int
+}
+
+func (e *errNamespacesForbidden) Error() string {
+	return fmt.Sprintf("listing the namespaces is forbidden (%d)", e.status)
 }
 
 //getNamespaces get openfaas namespaces
-func (s *FunctionLookupBuilder) getNamespaces() ([]string, error) {
+func (s *FunctionLookupBuilder) getNamespaces(ctx context.Context, gatewayURL string) ([]string, error) {
 	var (
 		err        error
 		namespaces []string
 	)
-	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/system/namespaces", s.GatewayURL), nil)
+	if err := s.waitDiscovery(ctx); err != nil {
+		return namespaces, err
+	}
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/system/namespaces", gatewayURL), nil)
 	if err != nil {
 		return namespaces, err
 	}
+	req = req.WithContext(ctx)
 
-	if s.Credentials != nil {
-		req.SetBasicAuth(s.Credentials.User, s.Credentials.Password)
+	if err := setAuth(req, s.Auth, s.Credentials); err != nil {
+		return namespaces, err
 	}
 
 	res, err := s.Client.Do(req)
@@ -49,6 +169,10 @@ func (s *FunctionLookupBuilder) getNamespaces() ([]string, error) {
 		defer res.Body.Close()
 	}
 
+	if res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden {
+		return namespaces, &errNamespacesForbidden{status: res.StatusCode}
+	}
+
 	if res.StatusCode != http.StatusNotFound {
 		bytesOut, err := ioutil.ReadAll(res.Body)
 		if err != nil {
@@ -68,60 +192,180 @@ func (s *FunctionLookupBuilder) getNamespaces() ([]string, error) {
 	return namespaces, err
 }
 
-func (s *FunctionLookupBuilder) getFunctions(namespace string) ([]types.FunctionStatus, error) {
-	gateway := fmt.Sprintf("%s/system/functions", s.GatewayURL)
+func (s *FunctionLookupBuilder) getFunctions(ctx context.Context, gatewayBaseURL, namespace string) ([]types.FunctionStatus, error) {
+	gateway := fmt.Sprintf("%s/system/functions", gatewayBaseURL)
 	gatewayURL, err := url.Parse(gateway)
 	if err != nil {
 		return []types.FunctionStatus{}, fmt.Errorf("invalid gateway URL: %s", err.Error())
 	}
+	query := gatewayURL.Query()
 	if len(namespace) > 0 {
-		query := gatewayURL.Query()
 		query.Set("namespace", namespace)
-		gatewayURL.RawQuery = query.Encode()
 	}
+	if s.PageSize > 0 {
+		query.Set("limit", strconv.Itoa(s.PageSize))
+	}
+	gatewayURL.RawQuery = query.Encode()
+
+	maxPages := s.MaxPages
+	if maxPages <= 0 {
+		maxPages = defaultMaxFunctionPages
+	}
+
+	functions := []types.FunctionStatus{}
+	for page := 0; gatewayURL != nil; page++ {
+		if page == maxPages {
+			return []types.FunctionStatus{}, fmt.Errorf("more than %d pages of functions in namespace %q", maxPages, namespace)
+		}
 
-	req, _ := http.NewRequest(http.MethodGet, gatewayURL.String(), nil)
-	if s.Credentials != nil {
-		req.SetBasicAuth(s.Credentials.User, s.Credentials.Password)
+		listing, err := s.getFunctionPage(ctx, gatewayURL)
+		if err != nil {
+			return []types.FunctionStatus{}, err
+		}
+		functions = append(functions, listing.functions...)
+		gatewayURL = listing.next
+	}
+
+	return functions, nil
+}
+
+// getFunctionPage gets a page of the function list, with the URL of the next
+// page if the gateway paginates the list.
+func (s *FunctionLookupBuilder) getFunctionPage(ctx context.Context, pageURL *url.URL) (functionListing, error) {
+	if err := s.waitDiscovery(ctx); err != nil {
+		return functionListing{}, err
+	}
+	req, _ := http.NewRequest(http.MethodGet, pageURL.String(), nil)
+	req = req.WithContext(ctx)
+	if err := setAuth(req, s.Auth, s.Credentials); err != nil {
+		return functionListing{}, err
+	}
+
+	cached, isCached := s.listCache.get(req.URL.String())
+	if isCached && !s.DisableListCache {
+		req.Header.Set("If-None-Match", cached.etag)
 	}
 
 	res, reqErr := s.Client.Do(req)
 
 	if reqErr != nil {
-		return []types.FunctionStatus{}, reqErr
+		return functionListing{}, reqErr
 	}
 
 	if res.Body != nil {
 		defer res.Body.Close()
 	}
 
+	if res.StatusCode == http.StatusNotModified && isCached && !s.DisableListCache {
+		return cached, nil
+	}
+
 	bytesOut, _ := ioutil.ReadAll(res.Body)
 
 	functions := []types.FunctionStatus{}
 	marshalErr := json.Unmarshal(bytesOut, &functions)
 
 	if marshalErr != nil {
-		return []types.FunctionStatus{}, errors.Wrap(marshalErr, fmt.Sprintf("unable to unmarshal value: %q", string(bytesOut)))
+		return functionListing{}, errors.Wrap(marshalErr, fmt.Sprintf("unable to unmarshal value: %q", string(bytesOut)))
 	}
 
-	return functions, nil
+	next, err := nextPage(pageURL, res.Header)
+	if err != nil {
+		return functionListing{}, err
+	}
+
+	listing := functionListing{etag: res.Header.Get("ETag"), functions: functions, next: next}
+	if !s.DisableListCache {
+		s.listCache.put(req.URL.String(), listing)
+	}
+
+	return listing, nil
 }
 
 // Build compiles a map of topic names and functions that have
 // advertised to receive messages on said topic
 func (s *FunctionLookupBuilder) Build() (map[string][]string, error) {
+	serviceMap, _, err := s.BuildWithMetadata()
+	return serviceMap, err
+}
+
+// BuildWithMetadata compiles the map of topic names and functions like Build,
+// along with the metadata declared by the functions in their annotations.
+func (s *FunctionLookupBuilder) BuildWithMetadata() (map[string][]string, map[string]FunctionMetadata, error) {
+	return s.buildWithMetadata(context.Background())
+}
+
+// buildWithMetadata compiles the map like BuildWithMetadata, giving up when
+// ctx is done.
+func (s *FunctionLookupBuilder) buildWithMetadata(ctx context.Context) (map[string][]string, map[string]FunctionMetadata, error) {
+	if s.FunctionSource != nil {
+		return s.build(ctx, s.GatewayURL)
+	}
+
+	var candidates []GatewayStatus
+	if s.GatewayPool != nil {
+		candidates = s.GatewayPool.candidates()
+	}
+	if len(candidates) == 0 {
+		return s.build(ctx, s.GatewayURL)
+	}
+
+	var (
+		serviceMap map[string][]string
+		metadata   map[string]FunctionMetadata
+		err        error
+	)
+	for _, gateway := range candidates {
+		end := s.GatewayPool.begin(gateway.URL)
+		serviceMap, metadata, err = s.build(ctx, gateway.URL)
+		end()
+
+		if _, unreachable := err.(*url.Error); !unreachable || ctx.Err() != nil {
+			return serviceMap, metadata, err
+		}
+		s.logger().Warnf("Gateway %s unreachable, failing over: %s", gateway.URL, err)
+		s.GatewayPool.setHealth(gateway.URL, false, 0)
+	}
+	return serviceMap, metadata, err
+}
+
+// discover compiles the map of topic names and functions from gatewayURL,
+// counting the namespaces and functions listed in stats.
+func (s *FunctionLookupBuilder) discover(ctx context.Context, gatewayURL string, stats *DiscoveryStats) (map[string][]string, map[string]FunctionMetadata, error) {
 	var (
 		err        error
 		namespaces []string
 	)
 
-	if s.Namespace == "" {
-		namespaces, err = s.getNamespaces()
+	source := s.functionSource(ctx, gatewayURL)
+	if len(s.Namespaces) > 0 {
+		namespaces = s.Namespaces
+	} else if s.Namespace != "" {
+		namespaces = []string{s.Namespace}
+	} else if s.SkipNamespaceDiscovery {
+		namespaces = []string{s.DefaultNamespace}
+	} else {
+		namespaces, err = s.NamespaceCache.namespaces(gatewayURL, source.Namespaces)
+		if forbidden, ok := err.(*errNamespacesForbidden); ok {
+			if atomic.CompareAndSwapInt32(&s.forbiddenWarned, 0, 1) {
+				s.logger().Warnf("Unable to discover the namespaces, %s: using namespace %q only", forbidden, s.DefaultNamespace)
+			}
+			namespaces, err = []string{s.DefaultNamespace}, nil
+		}
 		if err != nil {
-			return map[string][]string{}, err
+			return map[string][]string{}, map[string]FunctionMetadata{}, err
 		}
-	} else {
-		namespaces = []string{s.Namespace}
+	}
+
+	namespaces = s.excludeNamespaces(namespaces)
+	if len(s.NamespaceSelector) > 0 {
+		namespaces, err = s.selectNamespaces(ctx, gatewayURL, namespaces)
+		if err != nil {
+			return map[string][]string{}, map[string]FunctionMetadata{}, err
+		}
+	}
+	if len(namespaces) == 0 && (len(s.ExcludeNamespaces) > 0 || len(s.NamespaceSelector) > 0) {
+		return map[string][]string{}, map[string]FunctionMetadata{}, nil
 	}
 
 	if len(namespaces) == 0 {
@@ -129,19 +373,109 @@ func (s *FunctionLookupBuilder) Build() (map[string][]string, error) {
 	}
 
 	serviceMap := make(map[string][]string)
+	metadata := make(map[string]FunctionMetadata)
 
+	failed := map[string]error{}
 	for _, namespace := range namespaces {
-		functions, err := s.getFunctions(namespace)
+		functions, err := s.listFunctions(ctx, source, namespace)
 		if err != nil {
-			return map[string][]string{}, err
+			stats.NamespaceErrors[namespace] = err
 		}
-		serviceMap = buildServiceMap(&functions, s.TopicDelimiter, namespace, serviceMap)
+		if err != nil && s.PartialResults && !failsBuild(ctx, err) {
+			failed[namespace] = err
+			continue
+		}
+		if err != nil {
+			return map[string][]string{}, map[string]FunctionMetadata{}, err
+		}
+		stats.Namespaces++
+		stats.Functions += len(functions)
+		if s.SkipNotReady {
+			functions = s.readyFunctions(functions, namespace)
+		}
+		splitter := topicSplitter{delimiter: s.TopicDelimiter, pattern: s.TopicDelimiterPattern, normalization: s.TopicNormalization}
+		serviceMap = buildSplitServiceMap(&functions, splitter, namespace, serviceMap)
+		buildNormalizedMetadataMap(&functions, namespace, s.TopicNormalization, metadata)
 	}
 
-	return serviceMap, err
+	if len(failed) > 0 {
+		return serviceMap, metadata, &PartialBuildError{Failed: failed}
+	}
+	return serviceMap, metadata, err
+}
+
+// excludeNamespaces removes the ExcludeNamespaces from namespaces.
+func (s *FunctionLookupBuilder) excludeNamespaces(namespaces []string) []string {
+	if len(s.ExcludeNamespaces) == 0 {
+		return namespaces
+	}
+
+	included := make([]string, 0, len(namespaces))
+	for _, namespace := range namespaces {
+		if !contains(s.ExcludeNamespaces, namespace) {
+			included = append(included, namespace)
+		}
+	}
+	return included
+}
+
+// readyFunctions returns the functions which are not waiting for their
+// replicas.
+func (s *FunctionLookupBuilder) readyFunctions(functions []types.FunctionStatus, namespace string) []types.FunctionStatus {
+	ready := make([]types.FunctionStatus, 0, len(functions))
+	for _, function := range functions {
+		if notReady(function) {
+			s.logger().Debugf("Skipping %s, none of its %d replicas is available", functionPath(function.Name, namespace), function.Replicas)
+			continue
+		}
+		ready = append(ready, function)
+	}
+	return ready
+}
+
+// notReady returns true if replicas of function are requested but none is
+// available. A function scaled to zero is ready, the gateway scales it up.
+func notReady(function types.FunctionStatus) bool {
+	return function.Replicas > 0 && function.AvailableReplicas == 0
+}
+
+func buildMetadataMap(functions *[]types.FunctionStatus, namespace string, metadata map[string]FunctionMetadata) {
+	buildNormalizedMetadataMap(functions, namespace, TopicNormalization{}, metadata)
+}
+
+// buildNormalizedMetadataMap adds the metadata of functions to metadata,
+// with the topics of their bindings normalized by normalization.
+func buildNormalizedMetadataMap(functions *[]types.FunctionStatus, namespace string, normalization TopicNormalization, metadata map[string]FunctionMetadata) {
+	for _, function := range *functions {
+		if function.Annotations == nil {
+			continue
+		}
+		functionMetadata, ok := parseFunctionMetadata(*function.Annotations)
+		functionMetadata.Bindings = normalization.bindings(functionMetadata.Bindings)
+		if function.Labels != nil && len(*function.Labels) > 0 {
+			functionMetadata.Labels = make(map[string]string, len(*function.Labels))
+			for key, value := range *function.Labels {
+				functionMetadata.Labels[key] = value
+			}
+			ok = true
+		}
+		if notReady(function) {
+			functionMetadata.NotReady = true
+			ok = true
+		}
+		if ok {
+			metadata[functionPath(function.Name, namespace)] = functionMetadata
+		}
+	}
 }
 
 func buildServiceMap(functions *[]types.FunctionStatus, topicDelimiter, namespace string, serviceMap map[string][]string) map[string][]string {
+	return buildSplitServiceMap(functions, topicSplitter{delimiter: topicDelimiter}, namespace, serviceMap)
+}
+
+// buildSplitServiceMap adds the topics of functions to serviceMap, splitting
+// and normalizing their topic annotations with splitter.
+func buildSplitServiceMap(functions *[]types.FunctionStatus, splitter topicSplitter, namespace string, serviceMap map[string][]string) map[string][]string {
 	for _, function := range *functions {
 
 		if function.Annotations != nil {
@@ -150,15 +484,18 @@ func buildServiceMap(functions *[]types.FunctionStatus, topicDelimiter, namespac
 
 			if topicNames, exist := annotations["topic"]; exist {
 
-				if len(topicDelimiter) > 0 && strings.Count(topicNames, topicDelimiter) > 0 {
-
-					topicSlice := strings.Split(topicNames, topicDelimiter)
-
-					for _, topic := range topicSlice {
+				for _, topic := range splitter.split(topicNames) {
+					topic = splitter.normalization.apply(topic)
+					if !contains(serviceMap[topic], functionPath(function.Name, namespace)) {
 						serviceMap = appendServiceMap(topic, function.Name, namespace, serviceMap)
 					}
-				} else {
-					serviceMap = appendServiceMap(topicNames, function.Name, namespace, serviceMap)
+				}
+			}
+
+			for _, binding := range parseTopicBindings(annotations) {
+				topic := splitter.normalization.apply(binding.Topic)
+				if !contains(serviceMap[topic], functionPath(function.Name, namespace)) {
+					serviceMap = appendServiceMap(topic, function.Name, namespace, serviceMap)
 				}
 			}
 		}
@@ -166,6 +503,24 @@ func buildServiceMap(functions *[]types.FunctionStatus, topicDelimiter, namespac
 	return serviceMap
 }
 
+// topicSplitter splits the topic annotation of a function on a literal
+// delimiter, or on each match of a pattern if set, and normalizes the topics.
+type topicSplitter struct {
+	delimiter     string
+	pattern       *regexp.Regexp
+	normalization TopicNormalization
+}
+
+func (t topicSplitter) split(topicNames string) []string {
+	if t.pattern != nil {
+		return t.pattern.Split(topicNames, -1)
+	}
+	if len(t.delimiter) > 0 && strings.Count(topicNames, t.delimiter) > 0 {
+		return strings.Split(topicNames, t.delimiter)
+	}
+	return []string{topicNames}
+}
+
 func appendServiceMap(key, function, namespace string, sm map[string][]string) map[string][]string {
 
 	key = strings.TrimSpace(key)
@@ -175,14 +530,25 @@ func appendServiceMap(key, function, namespace string, sm map[string][]string) m
 		if sm[key] == nil {
 			sm[key] = []string{}
 		}
-		sep := ""
-		if len(namespace) > 0 {
-			sep = "."
-		}
-
-		functionPath := fmt.Sprintf("%s%s%s", function, sep, namespace)
-		sm[key] = append(sm[key], functionPath)
+		sm[key] = append(sm[key], functionPath(function, namespace))
 	}
 
 	return sm
 }
+
+func (s *FunctionLookupBuilder) logger() Logger {
+	if s.Logger == nil {
+		return defaultLogger
+	}
+	return s.Logger
+}
+
+// functionPath is the reference of a function in the lookups.
+func functionPath(function, namespace string) string {
+	sep := ""
+	if len(namespace) > 0 {
+		sep = "."
+	}
+
+	return fmt.Sprintf("%s%s%s", function, sep, namespace)
+}
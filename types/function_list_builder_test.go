@@ -4,11 +4,17 @@
 package types
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/openfaas/faas-provider/auth"
 	"github.com/openfaas/faas-provider/types"
 )
 
@@ -384,7 +390,7 @@ func Test_GetNamespaces(t *testing.T) {
 		GatewayURL: srv.URL,
 	}
 
-	namespaces, err := builder.getNamespaces()
+	namespaces, err := builder.getNamespaces(context.Background(), builder.GatewayURL)
 	if err != nil {
 		t.Errorf("%s", err.Error())
 	}
@@ -405,7 +411,7 @@ func Test_GetNamespaces_ProviderGives404(t *testing.T) {
 		GatewayURL: srv.URL,
 	}
 
-	namespaces, err := builder.getNamespaces()
+	namespaces, err := builder.getNamespaces(context.Background(), builder.GatewayURL)
 	if err != nil {
 		t.Errorf("%s", err.Error())
 	}
@@ -447,7 +453,7 @@ func Test_GetFunctions(t *testing.T) {
 		TopicDelimiter: ",",
 	}
 
-	functions, err := builder.getFunctions("openfaas-fn")
+	functions, err := builder.getFunctions(context.Background(), builder.GatewayURL, "openfaas-fn")
 	if err != nil {
 		t.Errorf("%s", err)
 	}
@@ -488,7 +494,7 @@ func Test_GetEmptyFunctions(t *testing.T) {
 		TopicDelimiter: ",",
 	}
 
-	functions, err := builder.getFunctions("fn")
+	functions, err := builder.getFunctions(context.Background(), builder.GatewayURL, "fn")
 	if err != nil {
 		t.Errorf("%s", err)
 	}
@@ -573,3 +579,415 @@ func TestBuildWithNamespace(t *testing.T) {
 		})
 	}
 }
+
+func Test_BuildWithMetadata_HeadersAnnotation(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/system/namespaces" {
+			bytesOut, _ := json.Marshal([]string{"openfaas-fn"})
+			_, _ = w.Write(bytesOut)
+			return
+		}
+
+		functions := []types.FunctionStatus{
+			{
+				Name:        "echo",
+				Namespace:   "openfaas-fn",
+				Annotations: &map[string]string{"topic": "topic1", "topic-headers": "X-Mode=compat, X-Version=2,invalid"},
+			},
+			{
+				Name:        "plain",
+				Namespace:   "openfaas-fn",
+				Annotations: &map[string]string{"topic": "topic1"},
+			},
+		}
+		bytesOut, _ := json.Marshal(functions)
+		_, _ = w.Write(bytesOut)
+	}))
+	defer srv.Close()
+
+	builder := FunctionLookupBuilder{
+		Client:     srv.Client(),
+		GatewayURL: srv.URL,
+	}
+
+	_, metadata, err := builder.BuildWithMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(metadata) != 1 {
+		t.Fatalf("Metadata - want: %d items, got: %d", 1, len(metadata))
+	}
+	headers := metadata["echo.openfaas-fn"].Headers
+	if headers.Get("X-Mode") != "compat" || headers.Get("X-Version") != "2" || len(headers) != 2 {
+		t.Errorf("Headers - want: X-Mode=compat and X-Version=2, got: %v", headers)
+	}
+}
+
+func Test_parseFunctionMetadata_AsyncAnnotation(t *testing.T) {
+	for value, want := range map[string]string{"true": "true", " false ": "false", "maybe": "<nil>"} {
+		metadata, _ := parseFunctionMetadata(map[string]string{"topic-async": value})
+		got := "<nil>"
+		if metadata.Async != nil {
+			got = fmt.Sprint(*metadata.Async)
+		}
+		if got != want {
+			t.Errorf("Async of %q - want: %s, got: %s", value, want, got)
+		}
+	}
+}
+
+func Test_buildServiceMap_TopicConfigAnnotation(t *testing.T) {
+	annotations := map[string]string{
+		"topic":        "orders",
+		"topic-config": `[{"topic":"orders","contentType":"application/json","async":true},{"topic":"payments"},{"topic":" "}]`,
+	}
+	functions := []types.FunctionStatus{{Name: "echo", Annotations: &annotations}}
+
+	serviceMap := buildServiceMap(&functions, ",", "openfaas-fn", map[string][]string{})
+	if len(serviceMap) != 2 || len(serviceMap["orders"]) != 1 || len(serviceMap["payments"]) != 1 {
+		t.Errorf("Service map - want orders and payments once, got: %v", serviceMap)
+	}
+
+	metadata, ok := parseFunctionMetadata(annotations)
+	if !ok || len(metadata.Bindings) != 2 {
+		t.Fatalf("Bindings - want: 2, got: %v", metadata.Bindings)
+	}
+	orders := metadata.Bindings["orders"]
+	if orders.ContentType != "application/json" || orders.Async == nil || !*orders.Async {
+		t.Errorf("Binding of orders - want application/json and async, got: %+v", orders)
+	}
+
+	if _, ok := parseFunctionMetadata(map[string]string{"topic-config": "orders"}); ok {
+		t.Errorf("Metadata - want a malformed topic-config ignored")
+	}
+}
+
+func Test_Build_ReusesFunctionListWhenNotModified(t *testing.T) {
+	for _, disabled := range []bool{false, true} {
+		var full, notModified int
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				notModified++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			full++
+			w.Header().Set("ETag", `"v1"`)
+			w.Write([]byte(`[{"name":"echo","annotations":{"topic":"topic1"}}]`))
+		}))
+
+		builder := FunctionLookupBuilder{
+			Client:           srv.Client(),
+			GatewayURL:       srv.URL,
+			Namespace:        "openfaas-fn",
+			DisableListCache: disabled,
+		}
+		for n := 0; n < 3; n++ {
+			lookups, err := builder.Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(lookups["topic1"]) != 1 {
+				t.Errorf("Lookups of build %d - want topic1, got: %v", n, lookups)
+			}
+		}
+		srv.Close()
+
+		wantFull, wantNotModified := 1, 2
+		if disabled {
+			wantFull, wantNotModified = 3, 0
+		}
+		if full != wantFull || notModified != wantNotModified {
+			t.Errorf("Requests with cache disabled=%v - want: %d full and %d not modified, got: %d and %d",
+				disabled, wantFull, wantNotModified, full, notModified)
+		}
+	}
+}
+
+func Test_Build_NamespaceAllowAndDenyLists(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/system/namespaces" {
+			w.Write([]byte(`["openfaas-fn","team-a","team-b"]`))
+			return
+		}
+		fmt.Fprintf(w, `[{"name":"echo","annotations":{"topic":"topic1"}}]`)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name       string
+		namespaces []string
+		exclude    []string
+		want       []string
+	}{
+		{name: "all", want: []string{"echo.openfaas-fn", "echo.team-a", "echo.team-b"}},
+		{name: "allowed", namespaces: []string{"team-a", "team-b"}, want: []string{"echo.team-a", "echo.team-b"}},
+		{name: "denied", exclude: []string{"openfaas-fn"}, want: []string{"echo.team-a", "echo.team-b"}},
+		{name: "allowed and denied", namespaces: []string{"team-a", "team-b"}, exclude: []string{"team-b"}, want: []string{"echo.team-a"}},
+		{name: "all denied", namespaces: []string{"team-a"}, exclude: []string{"team-a"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			builder := FunctionLookupBuilder{
+				Client:            srv.Client(),
+				GatewayURL:        srv.URL,
+				Namespaces:        test.namespaces,
+				ExcludeNamespaces: test.exclude,
+			}
+			lookups, err := builder.Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := lookups["topic1"]; fmt.Sprint(got) != fmt.Sprint(test.want) && len(got)+len(test.want) > 0 {
+				t.Errorf("Functions - want: %v, got: %v", test.want, got)
+			}
+		})
+	}
+}
+
+func Test_Build_SkipsNotReadyFunctions(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[
+			{"name":"ready","annotations":{"topic":"topic1"},"replicas":1,"availableReplicas":1},
+			{"name":"deploying","annotations":{"topic":"topic1"},"replicas":2,"availableReplicas":0},
+			{"name":"idle","annotations":{"topic":"topic1"},"replicas":0,"availableReplicas":0}
+		]`))
+	}))
+	defer srv.Close()
+
+	for _, skip := range []bool{false, true} {
+		builder := FunctionLookupBuilder{
+			Client:       srv.Client(),
+			GatewayURL:   srv.URL,
+			Namespace:    "openfaas-fn",
+			SkipNotReady: skip,
+			Logger:       NewStdLogger(LevelError),
+		}
+		lookups, metadata, err := builder.BuildWithMetadata()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := "[ready.openfaas-fn deploying.openfaas-fn idle.openfaas-fn]"
+		if skip {
+			want = "[ready.openfaas-fn idle.openfaas-fn]"
+		}
+		if got := fmt.Sprint(lookups["topic1"]); got != want {
+			t.Errorf("Functions with skip=%v - want: %s, got: %s", skip, want, got)
+		}
+		if !skip && !metadata["deploying.openfaas-fn"].NotReady {
+			t.Errorf("Metadata - want deploying flagged as not ready, got: %+v", metadata)
+		}
+		if metadata["ready.openfaas-fn"].NotReady || metadata["idle.openfaas-fn"].NotReady {
+			t.Errorf("Metadata - want ready and idle not flagged, got: %+v", metadata)
+		}
+	}
+}
+
+func Test_BuildWithMetadata_ContentTypeTimeoutAndLabels(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"name":"echo","labels":{"team":"a"},"annotations":{
+			"topic":"topic1","topic-content-type":"application/json","topic-timeout":"2s"}}]`))
+	}))
+	defer srv.Close()
+
+	builder := FunctionLookupBuilder{
+		Client:     srv.Client(),
+		GatewayURL: srv.URL,
+		Namespace:  "openfaas-fn",
+	}
+	_, metadata, err := builder.BuildWithMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	echo := metadata["echo.openfaas-fn"]
+	if echo.ContentType != "application/json" || echo.Timeout != 2*time.Second || echo.Labels["team"] != "a" {
+		t.Errorf("Metadata - want application/json, 2s and team=a, got: %+v", echo)
+	}
+
+	if _, ok := parseFunctionMetadata(map[string]string{"topic-timeout": "soon"}); ok {
+		t.Errorf("Metadata - want a malformed topic-timeout ignored")
+	}
+}
+
+func Test_Build_FallsBackWhenNamespacesForbidden(t *testing.T) {
+	tests := []struct {
+		name          string
+		skipDiscovery bool
+	}{
+		{name: "forbidden"},
+		{name: "skipped", skipDiscovery: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/system/namespaces" {
+					if test.skipDiscovery {
+						t.Errorf("Namespaces listed while discovery is skipped")
+					}
+					http.Error(w, "forbidden", http.StatusForbidden)
+					return
+				}
+				if got := r.URL.Query().Get("namespace"); got != "team-a" {
+					t.Errorf("Namespace - want: %s, got: %s", "team-a", got)
+				}
+				annotations := map[string]string{"topic": "topic1"}
+				bytesOut, _ := json.Marshal([]types.FunctionStatus{{Name: "echo", Annotations: &annotations}})
+				_, _ = w.Write(bytesOut)
+			}))
+			defer srv.Close()
+
+			builder := FunctionLookupBuilder{
+				Client:                 srv.Client(),
+				GatewayURL:             srv.URL,
+				DefaultNamespace:       "team-a",
+				SkipNamespaceDiscovery: test.skipDiscovery,
+			}
+
+			lookup, err := builder.Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if functions := lookup["topic1"]; len(functions) != 1 || functions[0] != "echo.team-a" {
+				t.Errorf("Lookup - want: [echo.team-a], got: %v", functions)
+			}
+		})
+	}
+}
+
+func Test_GetFunctions_FollowsPages(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("limit") != "2" {
+			t.Errorf("want limit 2, got %q", r.URL.Query().Get("limit"))
+		}
+
+		page := r.URL.Query().Get("continue")
+		functions := []types.FunctionStatus{}
+		switch page {
+		case "":
+			functions = append(functions, types.FunctionStatus{Name: "f1"}, types.FunctionStatus{Name: "f2"})
+			w.Header().Set("Link", `</system/functions?namespace=openfaas-fn&limit=2&continue=2>; rel="next"`)
+		case "2":
+			functions = append(functions, types.FunctionStatus{Name: "f3"})
+		}
+		bytesOut, _ := json.Marshal(functions)
+		_, _ = w.Write(bytesOut)
+	}))
+	defer srv.Close()
+
+	builder := FunctionLookupBuilder{
+		Client:     srv.Client(),
+		GatewayURL: srv.URL,
+		PageSize:   2,
+	}
+
+	functions, err := builder.getFunctions(context.Background(), builder.GatewayURL, "openfaas-fn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(functions) != 3 || functions[2].Name != "f3" {
+		t.Errorf("Functions - want: 3 items across the pages, got: %v", functions)
+	}
+}
+
+func Test_GetFunctions_CapsPages(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", `<?namespace=openfaas-fn>; rel="next"`)
+		_, _ = w.Write([]byte(`[{"name":"loop"}]`))
+	}))
+	defer srv.Close()
+
+	builder := FunctionLookupBuilder{
+		Client:     srv.Client(),
+		GatewayURL: srv.URL,
+		MaxPages:   3,
+	}
+
+	if _, err := builder.getFunctions(context.Background(), builder.GatewayURL, "openfaas-fn"); err == nil {
+		t.Error("want an error when the pages exceed MaxPages")
+	}
+}
+
+func Test_GetFunctions_RejectsPagesOnOtherHosts(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("want no request to another host, got: %s with %q", r.URL, r.Header.Get("Authorization"))
+	}))
+	defer other.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", "<"+other.URL+"/system/functions?continue=2>; rel=\"next\"")
+		_, _ = w.Write([]byte(`[{"name":"f1"}]`))
+	}))
+	defer srv.Close()
+
+	builder := FunctionLookupBuilder{
+		Client:      srv.Client(),
+		GatewayURL:  srv.URL,
+		Credentials: &auth.BasicAuthCredentials{User: "admin", Password: "secret"},
+	}
+
+	if _, err := builder.getFunctions(context.Background(), builder.GatewayURL, "openfaas-fn"); err == nil {
+		t.Error("want an error when the next page is on another host")
+	}
+}
+
+func Test_Build_TopicDelimiterPattern(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/system/namespaces" {
+			_, _ = w.Write([]byte(`["openfaas-fn"]`))
+			return
+		}
+		_, _ = w.Write([]byte(`[{"name":"echo","annotations":{"topic":"orders, payments;refunds  audit,"}}]`))
+	}))
+	defer srv.Close()
+
+	builder := FunctionLookupBuilder{
+		Client:                srv.Client(),
+		GatewayURL:            srv.URL,
+		TopicDelimiter:        ",",
+		TopicDelimiterPattern: regexp.MustCompile(`[,;\s]+`),
+	}
+
+	lookups, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lookups) != 4 {
+		t.Errorf("Topics - want: 4, got: %v", lookups)
+	}
+	for _, topic := range []string{"orders", "payments", "refunds", "audit"} {
+		if len(lookups[topic]) != 1 {
+			t.Errorf("Topic %q - want echo, got: %v", topic, lookups)
+		}
+	}
+}
+
+func Test_buildSplitServiceMap_TopicNormalization(t *testing.T) {
+	annotations := map[string]string{
+		"topic":        " Team.Orders ,team.orders,PAYMENTS",
+		"topic-config": `[{"topic":"Team.Refunds","async":true}]`,
+	}
+	functions := []types.FunctionStatus{{Name: "echo", Annotations: &annotations}}
+	normalization := TopicNormalization{
+		Lowercase:   true,
+		StripPrefix: "Team.",
+		Normalize: func(topic string) string {
+			return strings.Replace(topic, "payments", "billing", 1)
+		},
+	}
+
+	serviceMap := buildSplitServiceMap(&functions, topicSplitter{delimiter: ",", normalization: normalization}, "openfaas-fn", map[string][]string{})
+	if len(serviceMap) != 3 || len(serviceMap["orders"]) != 1 || len(serviceMap["billing"]) != 1 || len(serviceMap["refunds"]) != 1 {
+		t.Errorf("Service map - want orders, billing and refunds once, got: %v", serviceMap)
+	}
+
+	metadata := map[string]FunctionMetadata{}
+	buildNormalizedMetadataMap(&functions, "openfaas-fn", normalization, metadata)
+	if binding, ok := metadata["echo.openfaas-fn"].Bindings["refunds"]; !ok || binding.Async == nil || !*binding.Async {
+		t.Errorf("Bindings - want the binding of refunds, got: %v", metadata["echo.openfaas-fn"].Bindings)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/openfaas/faas-provider/types"
+	"github.com/pkg/errors"
+)
+
+// functionListCache keeps the last function list of each namespace with its
+// ETag, so that the builder sends conditional requests and reuses the list
+// when the gateway answers 304 Not Modified.
+type functionListCache struct {
+	lock     sync.Mutex
+	listings map[string]functionListing
+}
+
+// functionListing is a page of a function list, the ETag it was served with
+// and the URL of the next page, if any.
+type functionListing struct {
+	etag      string
+	functions []types.FunctionStatus
+	next      *url.URL
+}
+
+// get returns the cached listing of url.
+func (c *functionListCache) get(url string) (functionListing, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	listing, ok := c.listings[url]
+	return listing, ok
+}
+
+// put caches the listing of url, or forgets it when the gateway sent no
+// ETag.
+func (c *functionListCache) put(url string, listing functionListing) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if len(listing.etag) == 0 {
+		delete(c.listings, url)
+		return
+	}
+	if c.listings == nil {
+		c.listings = map[string]functionListing{}
+	}
+	c.listings[url] = listing
+}
+
+// defaultMaxFunctionPages caps the pages of functions listed per namespace
+// when MaxPages is not set.
+const defaultMaxFunctionPages = 1000
+
+// nextPage returns the URL of the next page of a function list, from the
+// rel="next" link of header, resolved against the URL of the current page.
+// A link to another scheme or host is rejected, so that the credentials of
+// the gateway are not sent elsewhere.
+func nextPage(page *url.URL, header http.Header) (*url.URL, error) {
+	for _, links := range header["Link"] {
+		for _, link := range strings.Split(links, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+
+			for _, param := range parts[1:] {
+				param = strings.Replace(strings.TrimSpace(param), " ", "", -1)
+				if !strings.EqualFold(param, `rel="next"`) && !strings.EqualFold(param, "rel=next") {
+					continue
+				}
+				next, err := page.Parse(strings.Trim(target, "<>"))
+				if err != nil {
+					return nil, errors.Wrap(err, "invalid next page")
+				}
+				if !strings.EqualFold(next.Scheme, page.Scheme) || !strings.EqualFold(next.Host, page.Host) {
+					return nil, fmt.Errorf("the next page on %s://%s is not on the gateway %s://%s", next.Scheme, next.Host, page.Scheme, page.Host)
+				}
+				return next, nil
+			}
+		}
+	}
+	return nil, nil
+}
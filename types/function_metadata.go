@@ -0,0 +1,204 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// topicHeadersAnnotation declares extra headers sent to a function, as a
+// comma-separated list of Name=Value pairs, e.g. "X-Mode=compat,X-Version=2".
+const topicHeadersAnnotation = "topic-headers"
+
+// topicAsyncAnnotation invokes a function asynchronously when "true", or
+// synchronously when "false", whatever the AsyncFunctionInvocation of the
+// connector.
+const topicAsyncAnnotation = "topic-async"
+
+// topicContentTypeAnnotation sets the Content-Type sent to a function, in
+// place of the Content-Type of the topic or of the message.
+const topicContentTypeAnnotation = "topic-content-type"
+
+// topicTimeoutAnnotation bounds the invocations of a function, as a
+// duration, e.g. "30s". It can only shorten the UpstreamTimeout.
+const topicTimeoutAnnotation = "topic-timeout"
+
+// topicConfigAnnotation subscribes a function to topics with per-topic
+// settings, as a JSON list of TopicBinding, e.g.
+// [{"topic":"orders","contentType":"application/json","async":true}].
+const topicConfigAnnotation = "topic-config"
+
+// TopicBinding is the subscription of a function to a topic declared in its
+// topic-config annotation, with the settings of its invocations for that
+// topic.
+type TopicBinding struct {
+	Topic string `json:"topic"`
+
+	// ContentType is sent to the function for the messages of the topic,
+	// in place of the Content-Type of the topic or of the message.
+	ContentType string `json:"contentType,omitempty"`
+
+	// Async overrides the invocation mode of the function for the topic
+	// when set.
+	Async *bool `json:"async,omitempty"`
+}
+
+// FunctionMetadata holds the per-function settings declared through
+// annotations, keyed in the topic map by the same function reference used
+// in the lookups.
+type FunctionMetadata struct {
+	// Headers are added to the invocations of the function, overriding the
+	// headers of the message.
+	Headers http.Header
+
+	// Async overrides the invocation mode of the connector for the function
+	// when set: true invokes it asynchronously, false synchronously.
+	Async *bool
+
+	// ContentType is sent to the function in place of the Content-Type of
+	// the topic or of the message, if set.
+	ContentType string
+
+	// Timeout bounds the invocations of the function, if positive.
+	Timeout time.Duration
+
+	// Labels of the function, e.g. to route or account its invocations.
+	Labels map[string]string
+
+	// Bindings are the settings of the topics declared in the topic-config
+	// annotation, keyed by topic.
+	Bindings map[string]TopicBinding
+
+	// NotReady is true when none of the replicas of the function was
+	// available when the topic map was built, e.g. while it is deployed.
+	NotReady bool
+}
+
+// parseFunctionMetadata reads the metadata of a function from its
+// annotations. ok is false when the function declares none.
+func parseFunctionMetadata(annotations map[string]string) (metadata FunctionMetadata, ok bool) {
+	if value, exist := annotations[topicHeadersAnnotation]; exist {
+		metadata.Headers = parseHeadersAnnotation(value)
+		ok = len(metadata.Headers) > 0
+	}
+	if value, exist := annotations[topicAsyncAnnotation]; exist {
+		if async, err := strconv.ParseBool(strings.TrimSpace(value)); err == nil {
+			metadata.Async = &async
+			ok = true
+		}
+	}
+	if value := strings.TrimSpace(annotations[topicContentTypeAnnotation]); len(value) > 0 {
+		metadata.ContentType = value
+		ok = true
+	}
+	if value, exist := annotations[topicTimeoutAnnotation]; exist {
+		if timeout, err := time.ParseDuration(strings.TrimSpace(value)); err == nil && timeout > 0 {
+			metadata.Timeout = timeout
+			ok = true
+		}
+	}
+	if bindings := parseTopicBindings(annotations); len(bindings) > 0 {
+		metadata.Bindings = make(map[string]TopicBinding, len(bindings))
+		for _, binding := range bindings {
+			metadata.Bindings[binding.Topic] = binding
+		}
+		ok = true
+	}
+	return metadata, ok
+}
+
+// parseTopicBindings reads the topic-config annotation, skipping the
+// bindings without a topic. A malformed annotation declares no binding.
+func parseTopicBindings(annotations map[string]string) []TopicBinding {
+	value, exist := annotations[topicConfigAnnotation]
+	if !exist {
+		return nil
+	}
+
+	var bindings []TopicBinding
+	if err := json.Unmarshal([]byte(value), &bindings); err != nil {
+		return nil
+	}
+
+	valid := bindings[:0]
+	for _, binding := range bindings {
+		binding.Topic = strings.TrimSpace(binding.Topic)
+		if len(binding.Topic) > 0 {
+			valid = append(valid, binding)
+		}
+	}
+	return valid
+}
+
+// parseHeadersAnnotation parses a list of Name=Value pairs, skipping the
+// malformed ones.
+func parseHeadersAnnotation(value string) http.Header {
+	header := http.Header{}
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		name := strings.TrimSpace(parts[0])
+		if len(name) == 0 {
+			continue
+		}
+		header.Add(name, strings.TrimSpace(parts[1]))
+	}
+	return header
+}
+
+// functionHeader returns the header of an invocation of function, with the
+// headers declared in its metadata.
+func functionHeader(topicMap *TopicMap, function string, header http.Header) http.Header {
+	metadata, ok := topicMap.Metadata(function)
+	if !ok || len(metadata.Headers) == 0 {
+		return header
+	}
+
+	return mergeHeader(header, metadata.Headers)
+}
+
+// functionAsync returns the invocation mode declared by function for topic,
+// or nil.
+func functionAsync(topicMap *TopicMap, topic, function string) *bool {
+	if binding, ok := topicMap.Binding(topic, function); ok && binding.Async != nil {
+		return binding.Async
+	}
+	metadata, _ := topicMap.Metadata(function)
+	return metadata.Async
+}
+
+// contentTypeHeader returns the header of an invocation of function for
+// topic, with the Content-Type declared by its binding to the topic or else
+// by the function.
+func (i *Invoker) contentTypeHeader(topicMap *TopicMap, topic, function string, header http.Header) http.Header {
+	if i.CloudEventsMode == CloudEventsStructured {
+		return header
+	}
+
+	contentType := ""
+	if binding, ok := topicMap.Binding(topic, function); ok {
+		contentType = binding.ContentType
+	}
+	if len(contentType) == 0 {
+		metadata, _ := topicMap.Metadata(function)
+		contentType = metadata.ContentType
+	}
+	if len(contentType) == 0 {
+		return header
+	}
+
+	return mergeHeader(header, http.Header{"Content-Type": {contentType}})
+}
+
+// functionTimeout returns the timeout declared by function, or zero.
+func functionTimeout(topicMap *TopicMap, function string) time.Duration {
+	metadata, _ := topicMap.Metadata(function)
+	return metadata.Timeout
+}
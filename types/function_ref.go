@@ -0,0 +1,83 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// maxNameLength is the maximum length of a function name or namespace, as
+// both need to be valid DNS-1123 labels.
+const maxNameLength = 63
+
+var dnsLabel = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// InvalidFunctionError is returned when a function reference can't be used to
+// build an invocation URL.
+type InvalidFunctionError struct {
+	Function string
+	Reason   string
+}
+
+func (e *InvalidFunctionError) Error() string {
+	return fmt.Sprintf("invalid function %q: %s", e.Function, e.Reason)
+}
+
+// ValidateFunctionRef checks that a function reference in the format
+// "name" or "name.namespace" is made of valid DNS-1123 labels.
+func ValidateFunctionRef(ref string) error {
+	name, namespace := splitFunctionRef(ref)
+
+	if err := validateLabel(name); err != nil {
+		return &InvalidFunctionError{Function: ref, Reason: "name " + err.Error()}
+	}
+
+	if strings.Contains(ref, ".") {
+		if err := validateLabel(namespace); err != nil {
+			return &InvalidFunctionError{Function: ref, Reason: "namespace " + err.Error()}
+		}
+	}
+
+	return nil
+}
+
+// resolveFunctionRef applies the default namespace of the Invoker to function
+// references without a namespace and validates the result.
+func (i *Invoker) resolveFunctionRef(ref string) (string, error) {
+	if !strings.Contains(ref, ".") && len(i.DefaultNamespace) > 0 {
+		if err := validateLabel(i.DefaultNamespace); err != nil {
+			return "", &ConfigError{Field: "DefaultNamespace", Reason: "namespace " + err.Error()}
+		}
+		ref = ref + "." + i.DefaultNamespace
+	}
+
+	if err := ValidateFunctionRef(ref); err != nil {
+		return "", err
+	}
+	return ref, nil
+}
+
+func validateLabel(label string) error {
+	if len(label) == 0 {
+		return fmt.Errorf("is empty")
+	}
+	if len(label) > maxNameLength {
+		return fmt.Errorf("is longer than %d characters", maxNameLength)
+	}
+	if !dnsLabel.MatchString(label) {
+		return fmt.Errorf("must consist of lower case alphanumeric characters or '-', and start and end with an alphanumeric character")
+	}
+	return nil
+}
+
+// splitFunctionRef splits a function reference as stored in the TopicMap
+// ("name.namespace" or just "name") into its name and namespace.
+func splitFunctionRef(ref string) (name, namespace string) {
+	if i := strings.Index(ref, "."); i >= 0 {
+		return ref[:i], ref[i+1:]
+	}
+	return ref, ""
+}
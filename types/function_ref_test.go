@@ -0,0 +1,74 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_ValidateFunctionRef(t *testing.T) {
+	tests := []struct {
+		ref   string
+		valid bool
+	}{
+		{ref: "echo", valid: true},
+		{ref: "echo.openfaas-fn", valid: true},
+		{ref: "nodeinfo-2", valid: true},
+		{ref: "", valid: false},
+		{ref: "Echo", valid: false},
+		{ref: "echo.", valid: false},
+		{ref: ".openfaas-fn", valid: false},
+		{ref: "echo.openfaas-fn.extra", valid: false},
+		{ref: "echo/../system", valid: false},
+		{ref: "-echo", valid: false},
+		{ref: strings.Repeat("a", 64), valid: false},
+	}
+
+	for _, test := range tests {
+		err := ValidateFunctionRef(test.ref)
+		if test.valid && err != nil {
+			t.Errorf("Function %q - want valid, got: %s", test.ref, err)
+		}
+		if !test.valid {
+			if _, ok := err.(*InvalidFunctionError); !ok {
+				t.Errorf("Function %q - want *InvalidFunctionError, got: %v", test.ref, err)
+			}
+		}
+	}
+}
+
+func Test_resolveFunctionRef(t *testing.T) {
+	tests := []struct {
+		name             string
+		ref              string
+		defaultNamespace string
+		want             string
+		wantConfigError  bool
+	}{
+		{name: "no default namespace", ref: "echo", want: "echo"},
+		{name: "default namespace applied", ref: "echo", defaultNamespace: "openfaas-fn", want: "echo.openfaas-fn"},
+		{name: "namespace kept", ref: "echo.team-a", defaultNamespace: "openfaas-fn", want: "echo.team-a"},
+		{name: "invalid default namespace", ref: "echo", defaultNamespace: "Team_A", wantConfigError: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			invoker := Invoker{DefaultNamespace: test.defaultNamespace}
+			got, err := invoker.resolveFunctionRef(test.ref)
+			if test.wantConfigError {
+				if _, ok := err.(*ConfigError); !ok {
+					t.Errorf("want *ConfigError, got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("%s", err)
+			}
+			if got != test.want {
+				t.Errorf("Function - want: %s, got: %s", test.want, got)
+			}
+		})
+	}
+}
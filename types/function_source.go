@@ -0,0 +1,94 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/openfaas/faas-provider/types"
+)
+
+// FunctionSource lists the functions whose annotations are mapped by the
+// FunctionLookupBuilder. The gateway is the default source, others can list
+// the functions from Kubernetes, a file or a key-value store and feed the
+// same topic map.
+type FunctionSource interface {
+	// Namespaces lists the namespaces of the functions.
+	Namespaces() ([]string, error)
+
+	// Functions lists the functions of namespace, with their annotations.
+	Functions(namespace string) ([]types.FunctionStatus, error)
+}
+
+// gatewayFunctionSource lists the functions of a gateway with the settings
+// of a FunctionLookupBuilder.
+type gatewayFunctionSource struct {
+	ctx        context.Context
+	builder    *FunctionLookupBuilder
+	gatewayURL string
+}
+
+func (s *gatewayFunctionSource) Namespaces() ([]string, error) {
+	return s.builder.getNamespaces(s.ctx, s.gatewayURL)
+}
+
+func (s *gatewayFunctionSource) Functions(namespace string) ([]types.FunctionStatus, error) {
+	return s.builder.getFunctions(s.ctx, s.gatewayURL, namespace)
+}
+
+// functionSource returns the FunctionSource of the builder, or the gateway
+// at gatewayURL, queried until ctx is done.
+func (s *FunctionLookupBuilder) functionSource(ctx context.Context, gatewayURL string) FunctionSource {
+	if s.FunctionSource != nil {
+		return s.FunctionSource
+	}
+	return &gatewayFunctionSource{ctx: ctx, builder: s, gatewayURL: gatewayURL}
+}
+
+// FileFunctionSource lists the functions of a JSON file mapping each
+// namespace to its functions, read again on each build:
+//
+//	{"openfaas-fn": [{"name": "echo", "annotations": {"topic": "orders"}}]}
+type FileFunctionSource struct {
+	Path string
+}
+
+func (s *FileFunctionSource) Namespaces() ([]string, error) {
+	functions, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	namespaces := make([]string, 0, len(functions))
+	for namespace := range functions {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
+
+func (s *FileFunctionSource) Functions(namespace string) ([]types.FunctionStatus, error) {
+	functions, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return functions[namespace], nil
+}
+
+func (s *FileFunctionSource) load() (map[string][]types.FunctionStatus, error) {
+	data, err := ioutil.ReadFile(s.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	functions := map[string][]types.FunctionStatus{}
+	if err := json.Unmarshal(data, &functions); err != nil {
+		return nil, fmt.Errorf("invalid function file %s: %s", s.Path, err)
+	}
+	return functions, nil
+}
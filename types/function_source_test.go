@@ -0,0 +1,47 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_Build_FileFunctionSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "function-source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "functions.json")
+	data := `{
+		"openfaas-fn": [{"name": "echo", "annotations": {"topic": "orders", "topic-headers": "X-Mode=file"}}],
+		"team-a": [{"name": "billing", "annotations": {"topic": "orders"}}, {"name": "plain"}]
+	}`
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	builder := FunctionLookupBuilder{FunctionSource: &FileFunctionSource{Path: path}}
+	lookups, metadata, err := builder.BuildWithMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := map[string][]string{"orders": {"echo.openfaas-fn", "billing.team-a"}}; !reflect.DeepEqual(lookups, want) {
+		t.Errorf("Lookups - want: %v, got: %v", want, lookups)
+	}
+	if got := metadata["echo.openfaas-fn"].Headers.Get("X-Mode"); got != "file" {
+		t.Errorf("Metadata - want X-Mode=file, got: %q", got)
+	}
+
+	builder = FunctionLookupBuilder{FunctionSource: &FileFunctionSource{Path: filepath.Join(dir, "missing.json")}}
+	if _, err := builder.Build(); err == nil {
+		t.Errorf("Error - want the missing file reported")
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/openfaas/faas-provider/auth"
+)
+
+// CheckGateway checks once that the gateway at gatewayURL is reachable and
+// accepts credentials, with GET /system/info. It returns
+// ErrGatewayUnauthorized if the credentials are rejected. A gateway without
+// /system/info is considered reachable.
+func CheckGateway(ctx context.Context, client *http.Client, gatewayURL string, credentials *auth.BasicAuthCredentials) error {
+	return CheckGatewayWithAuth(ctx, client, gatewayURL, BasicAuth(credentials))
+}
+
+// CheckGatewayWithAuth checks the gateway like CheckGateway, authenticating
+// with clientAuth if set.
+func CheckGatewayWithAuth(ctx context.Context, client *http.Client, gatewayURL string, clientAuth ClientAuth) error {
+	req, err := http.NewRequest(http.MethodGet, gatewayURL+"/system/info", nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	if err := setAuth(req, clientAuth, nil); err != nil {
+		return err
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("gateway %s unreachable: %s", gatewayURL, err)
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+
+	switch {
+	case res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden:
+		return ErrGatewayUnauthorized
+	case res.StatusCode == http.StatusNotFound || res.StatusCode < http.StatusBadRequest:
+		return nil
+	default:
+		return fmt.Errorf("gateway %s not ready: status %d", gatewayURL, res.StatusCode)
+	}
+}
+
+// WaitForGateway checks the gateway like CheckGateway until it is ready,
+// retrying with the backoff of the topic map syncs, typically before
+// BeginMapBuilder. It gives up at once if the credentials are rejected, and
+// returns the last failure once ctx is done.
+func (c *controller) WaitForGateway(ctx context.Context) error {
+	client := MakeClientWithOptions(c.Config.UpstreamTimeout, c.Config.ClientOptions)
+
+	for failures := 1; ; failures++ {
+		err := CheckGatewayWithAuth(ctx, client, c.Config.GatewayURL, c.clientAuth())
+		if err == nil || err == ErrGatewayUnauthorized {
+			return err
+		}
+
+		delay := c.syncRetryDelay(failures)
+		if delay <= 0 {
+			delay = defaultSyncRetryBackoff
+		}
+		c.Logger.Warnf("%s, retrying in %s", err, delay)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%s: %s", ctx.Err(), err)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas-provider/auth"
+)
+
+func Test_CheckGateway(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, _ := r.BasicAuth(); user != "admin" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"provider":{"provider":"faas-netes"}}`))
+	}))
+	defer srv.Close()
+
+	if err := CheckGateway(context.Background(), srv.Client(), srv.URL, &auth.BasicAuthCredentials{User: "admin", Password: "secret"}); err != nil {
+		t.Errorf("Check - want: nil, got: %v", err)
+	}
+	if err := CheckGateway(context.Background(), srv.Client(), srv.URL, &auth.BasicAuthCredentials{User: "admin", Password: "wrong"}); err != ErrGatewayUnauthorized {
+		t.Errorf("Check - want: %v, got: %v", ErrGatewayUnauthorized, err)
+	}
+}
+
+func Test_Controller_WaitForGateway(t *testing.T) {
+	var checks int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&checks, 1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewController(nil, &ControllerConfig{
+		GatewayURL:       srv.URL,
+		RebuildInterval:  time.Hour,
+		SyncRetryBackoff: 10 * time.Millisecond,
+		Logger:           NewStdLogger(LevelError),
+	}).(*controller)
+	defer c.Close()
+
+	if err := c.WaitForGateway(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(&checks); got != 3 {
+		t.Errorf("Checks - want: %d, got: %d", 3, got)
+	}
+
+	srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.WaitForGateway(ctx); err == nil {
+		t.Error("want an error once the deadline is exceeded")
+	}
+}
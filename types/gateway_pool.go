@@ -0,0 +1,382 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/openfaas/faas-provider/auth"
+)
+
+const (
+	defaultGatewayProbeInterval = 10 * time.Second
+	defaultGatewayProbePath     = "/healthz"
+
+	// gatewayLatencyWeight is the weight of the last probe in the moving
+	// average of the latency of a gateway.
+	gatewayLatencyWeight = 0.3
+)
+
+// Gateway is an OpenFaaS gateway of a GatewayPool.
+type Gateway struct {
+	URL  string `json:"url"`
+	Zone string `json:"zone,omitempty"`
+}
+
+// GatewayStatus is the state of a gateway of a GatewayPool.
+type GatewayStatus struct {
+	Gateway
+
+	Healthy bool          `json:"healthy"`
+	Latency time.Duration `json:"latency"`
+
+	// Pending is the number of requests in flight to the gateway.
+	Pending int `json:"pending"`
+}
+
+// GatewayBalancing defines how a GatewayPool spreads the requests over its
+// most preferred gateways.
+type GatewayBalancing string
+
+const (
+	// GatewayPreferred sends the requests to the most preferred gateway,
+	// failing over to the others. This is the default.
+	GatewayPreferred GatewayBalancing = ""
+
+	// GatewayRoundRobin spreads the requests evenly over the healthy gateways
+	// of the most preferred rank.
+	GatewayRoundRobin GatewayBalancing = "round-robin"
+
+	// GatewayLeastPending sends each request to the healthy gateway of the
+	// most preferred rank with the fewest requests in flight.
+	GatewayLeastPending GatewayBalancing = "least-pending"
+)
+
+// GatewayPool selects the gateway used for each invocation among several
+// gateways. Healthy gateways of the local Zone are preferred, by measured
+// latency, and the invocations fail over to other zones only when the local
+// gateways are unhealthy or unreachable. The gateways are probed
+// periodically once the pool is started.
+type GatewayPool struct {
+	// Zone is the zone of the connector.
+	Zone string
+
+	// ProbeInterval is the time between probes. Defaults to 10s.
+	ProbeInterval time.Duration
+
+	// ProbePath is requested on each gateway to probe it. Defaults to /healthz.
+	ProbePath string
+
+	// Ordered prefers the healthy gateways in the order they were added rather
+	// than by zone and latency: the first gateway is the primary, and the
+	// others are fallbacks until a probe finds the primary healthy again.
+	Ordered bool
+
+	// Balancing spreads the requests over the healthy gateways of the local
+	// zone, or over all the healthy gateways of an Ordered pool. Defaults to
+	// GatewayPreferred.
+	Balancing GatewayBalancing
+
+	Client      *http.Client
+	Credentials *auth.BasicAuthCredentials
+
+	// Auth authenticates the probes, taking precedence over Credentials.
+	Auth ClientAuth
+
+	// Metrics counts the cross-zone invocations, if set.
+	Metrics *Metrics
+
+	lock     sync.RWMutex
+	gateways []*GatewayStatus
+	stop     chan struct{}
+	next     uint64
+}
+
+// NewGatewayPool creates a pool of gateways for a connector running in zone.
+// All the gateways are considered healthy until probed.
+func NewGatewayPool(zone string, gateways ...Gateway) *GatewayPool {
+	p := &GatewayPool{Zone: zone}
+	for _, gateway := range gateways {
+		p.add(gateway)
+	}
+	return p
+}
+
+// add adds a gateway to the pool, unless it already has the same URL.
+func (p *GatewayPool) add(gateway Gateway) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	gateway.URL = strings.TrimSuffix(gateway.URL, "/")
+	for _, existing := range p.gateways {
+		if existing.URL == gateway.URL {
+			return
+		}
+	}
+	p.gateways = append(p.gateways, &GatewayStatus{Gateway: gateway, Healthy: true})
+}
+
+// Gateways returns the state of the gateways of the pool.
+func (p *GatewayPool) Gateways() []GatewayStatus {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	gateways := make([]GatewayStatus, 0, len(p.gateways))
+	for _, gateway := range p.gateways {
+		gateways = append(gateways, *gateway)
+	}
+	return gateways
+}
+
+// candidates returns the gateways in order of preference: healthy local
+// gateways, healthy gateways of other zones, then unhealthy gateways, each
+// by latency. Ordered pools return the healthy gateways, then the unhealthy
+// ones, each in the order they were added.
+func (p *GatewayPool) candidates() []GatewayStatus {
+	gateways := p.Gateways()
+
+	rank := func(g GatewayStatus) int {
+		r := 0
+		if !g.Healthy {
+			r += 2
+		}
+		if g.Zone != p.Zone && !p.Ordered {
+			r++
+		}
+		return r
+	}
+	sort.SliceStable(gateways, func(i, j int) bool {
+		ri, rj := rank(gateways[i]), rank(gateways[j])
+		if ri != rj || p.Ordered {
+			return ri < rj
+		}
+		return gateways[i].Latency < gateways[j].Latency
+	})
+
+	// Balance the requests over the healthy gateways of the first rank, the
+	// others are only used to fail over.
+	if p.Balancing == GatewayPreferred || len(gateways) < 2 || !gateways[0].Healthy {
+		return gateways
+	}
+	group := 1
+	for group < len(gateways) && rank(gateways[group]) == rank(gateways[0]) {
+		group++
+	}
+
+	switch p.Balancing {
+	case GatewayRoundRobin:
+		offset := int((atomic.AddUint64(&p.next, 1) - 1) % uint64(group))
+		rotated := append(append([]GatewayStatus{}, gateways[offset:group]...), gateways[:offset]...)
+		copy(gateways, rotated)
+	case GatewayLeastPending:
+		sort.SliceStable(gateways[:group], func(i, j int) bool {
+			return gateways[i].Pending < gateways[j].Pending
+		})
+	}
+	return gateways
+}
+
+// begin counts a request in flight to the gateway url, until the returned
+// function is called.
+func (p *GatewayPool) begin(url string) func() {
+	p.pending(url, 1)
+	return func() {
+		p.pending(url, -1)
+	}
+}
+
+func (p *GatewayPool) pending(url string, delta int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, g := range p.gateways {
+		if g.URL == url {
+			g.Pending += delta
+		}
+	}
+}
+
+// route returns the URL of target on another gateway, target being a URL of
+// one of the gateways of the pool.
+func (p *GatewayPool) route(target string, gateway GatewayStatus) string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return target
+	}
+
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	for _, g := range p.gateways {
+		base, err := url.Parse(g.URL)
+		if err != nil || !strings.EqualFold(base.Scheme, u.Scheme) || !strings.EqualFold(base.Host, u.Host) {
+			continue
+		}
+		// The path of the gateway, if any, must match whole segments.
+		if u.Path != base.Path && !strings.HasPrefix(u.Path, strings.TrimSuffix(base.Path, "/")+"/") {
+			continue
+		}
+		rest := url.URL{
+			Path:     strings.TrimPrefix(u.Path, base.Path),
+			RawQuery: u.RawQuery,
+			Fragment: u.Fragment,
+		}
+		return gateway.URL + rest.String()
+	}
+	return target
+}
+
+// setHealth records the health and, if measured, the latency of a gateway.
+func (p *GatewayPool) setHealth(url string, healthy bool, latency time.Duration) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, g := range p.gateways {
+		if g.URL != url {
+			continue
+		}
+		g.Healthy = healthy
+		if latency > 0 {
+			if g.Latency == 0 {
+				g.Latency = latency
+			} else {
+				g.Latency = time.Duration(gatewayLatencyWeight*float64(latency) + (1-gatewayLatencyWeight)*float64(g.Latency))
+			}
+		}
+	}
+}
+
+// Start probes the gateways periodically until Stop is called.
+func (p *GatewayPool) Start() {
+	interval := p.ProbeInterval
+	if interval <= 0 {
+		interval = defaultGatewayProbeInterval
+	}
+
+	p.lock.Lock()
+	if p.stop != nil {
+		p.lock.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	p.stop = stop
+	p.lock.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		p.probe()
+		for {
+			select {
+			case <-ticker.C:
+				p.probe()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops probing the gateways.
+func (p *GatewayPool) Stop() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.stop != nil {
+		close(p.stop)
+		p.stop = nil
+	}
+}
+
+// probe requests the ProbePath of every gateway, measuring its latency.
+func (p *GatewayPool) probe() {
+	path := p.ProbePath
+	if len(path) == 0 {
+		path = defaultGatewayProbePath
+	}
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	for _, gateway := range p.Gateways() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		req, err := http.NewRequest(http.MethodGet, gateway.URL+path, nil)
+		if err != nil {
+			cancel()
+			p.setHealth(gateway.URL, false, 0)
+			continue
+		}
+		req = req.WithContext(ctx)
+		if err := setAuth(req, p.Auth, p.Credentials); err != nil {
+			cancel()
+			p.setHealth(gateway.URL, false, 0)
+			continue
+		}
+
+		start := time.Now()
+		res, err := client.Do(req)
+		latency := time.Since(start)
+		if err != nil {
+			cancel()
+			p.setHealth(gateway.URL, false, 0)
+			continue
+		}
+		res.Body.Close()
+		cancel()
+
+		p.setHealth(gateway.URL, res.StatusCode < http.StatusInternalServerError, latency)
+	}
+}
+
+// postGateway posts the payload to gwURL, or through the GatewayPool if set:
+// the gateways are tried in order of preference until one is reachable.
+func (i *Invoker) postGateway(ctx context.Context, function, gwURL string, header http.Header, payload []byte, discard bool) (*[]byte, int, *http.Header, error) {
+	i.RetryBudget.deposit()
+
+	candidates := []GatewayStatus{}
+	if i.GatewayPool != nil {
+		candidates = i.GatewayPool.candidates()
+	}
+	if len(candidates) == 0 {
+		return i.post(ctx, function, gwURL, header, payload, discard)
+	}
+
+	var (
+		body       *[]byte
+		statusCode int
+		resHeader  *http.Header
+		err        error
+	)
+	for n, gateway := range candidates {
+		if n > 0 && !i.RetryBudget.withdraw() {
+			i.logger().Warnf("Retry budget exhausted, not failing over to %s", gateway.URL)
+			break
+		}
+
+		target := i.GatewayPool.route(gwURL, gateway)
+		if gateway.Zone != i.GatewayPool.Zone && i.GatewayPool.Metrics != nil {
+			i.GatewayPool.Metrics.crossZoneRequest()
+		}
+
+		end := i.GatewayPool.begin(gateway.URL)
+		body, statusCode, resHeader, err = i.post(ctx, function, target, header, payload, discard)
+		end()
+		if err == nil || ctx.Err() != nil {
+			return body, statusCode, resHeader, err
+		}
+
+		i.logger().Warnf("Gateway %s unreachable, failing over: %s", gateway.URL, err)
+		i.GatewayPool.setHealth(gateway.URL, false, 0)
+	}
+	return body, statusCode, resHeader, err
+}
@@ -0,0 +1,223 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_GatewayPool_PrefersLocalZoneAndFailsOver(t *testing.T) {
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("local"))
+	}))
+	defer local.Close()
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("remote"))
+	}))
+	defer remote.Close()
+
+	metrics := NewMetrics()
+	pool := NewGatewayPool("zone-a",
+		Gateway{URL: remote.URL, Zone: "zone-b"},
+		Gateway{URL: local.URL, Zone: "zone-a"},
+	)
+	pool.Metrics = metrics
+
+	invoker := NewInvoker(remote.URL+"/function", "", http.DefaultClient, false, false)
+	invoker.GatewayPool = pool
+
+	invoke := func() string {
+		res := invoker.invoke(context.Background(), "topic1", "echo", &Message{Body: []byte("hello")}, []byte("hello"), http.Header{}, invokeOptions{})
+		if res.Error != nil {
+			t.Fatal(res.Error)
+		}
+		return string(*res.Body)
+	}
+
+	if got := invoke(); got != "local" {
+		t.Errorf("Gateway - want: %s, got: %s", "local", got)
+	}
+	if metrics.crossZone != 0 {
+		t.Errorf("Cross-zone - want: %d, got: %d", 0, metrics.crossZone)
+	}
+
+	local.Close()
+	if got := invoke(); got != "remote" {
+		t.Errorf("Gateway - want failover to %s, got: %s", "remote", got)
+	}
+	if metrics.crossZone != 1 {
+		t.Errorf("Cross-zone - want: %d, got: %d", 1, metrics.crossZone)
+	}
+
+	for _, gateway := range pool.Gateways() {
+		if gateway.URL == local.URL && gateway.Healthy {
+			t.Errorf("Gateway %s - want unhealthy", gateway.URL)
+		}
+	}
+}
+
+func Test_GatewayPool_OrderedFailsOverAndReturnsToPrimary(t *testing.T) {
+	var primaryDown int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&primaryDown) == 1 {
+			panic(http.ErrAbortHandler)
+		}
+		w.Write([]byte("primary"))
+	}))
+	defer primary.Close()
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secondary"))
+	}))
+	defer secondary.Close()
+	tertiary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("tertiary"))
+	}))
+	defer tertiary.Close()
+
+	pool := NewGatewayPool("", Gateway{URL: primary.URL}, Gateway{URL: secondary.URL}, Gateway{URL: tertiary.URL})
+	pool.Ordered = true
+	// Measured latencies don't change the order of an ordered pool.
+	pool.setHealth(tertiary.URL, true, time.Microsecond)
+	pool.setHealth(primary.URL, true, time.Second)
+
+	invoker := NewInvoker(primary.URL+"/function", "", http.DefaultClient, false, false)
+	invoker.GatewayPool = pool
+
+	invoke := func() string {
+		res := invoker.invoke(context.Background(), "topic1", "echo", &Message{Body: []byte("hello")}, []byte("hello"), http.Header{}, invokeOptions{})
+		if res.Error != nil {
+			t.Fatal(res.Error)
+		}
+		return string(*res.Body)
+	}
+
+	if got := invoke(); got != "primary" {
+		t.Errorf("Gateway - want: %s, got: %s", "primary", got)
+	}
+
+	atomic.StoreInt32(&primaryDown, 1)
+	if got := invoke(); got != "secondary" {
+		t.Errorf("Gateway - want failover to %s, got: %s", "secondary", got)
+	}
+	if got := invoke(); got != "secondary" {
+		t.Errorf("Gateway - want %s until the primary is probed, got: %s", "secondary", got)
+	}
+
+	atomic.StoreInt32(&primaryDown, 0)
+	pool.probe()
+	if got := invoke(); got != "primary" {
+		t.Errorf("Gateway - want %s once probed healthy, got: %s", "primary", got)
+	}
+}
+
+func Test_GatewayPool_Balancing(t *testing.T) {
+	pool := NewGatewayPool("zone-a",
+		Gateway{URL: "http://a1", Zone: "zone-a"},
+		Gateway{URL: "http://a2", Zone: "zone-a"},
+		Gateway{URL: "http://b1", Zone: "zone-b"},
+	)
+
+	pool.Balancing = GatewayRoundRobin
+	got := []string{}
+	for i := 0; i < 4; i++ {
+		got = append(got, pool.candidates()[0].URL)
+	}
+	if want := "http://a1 http://a2 http://a1 http://a2"; strings.Join(got, " ") != want {
+		t.Errorf("Round-robin - want: %s, got: %s", want, strings.Join(got, " "))
+	}
+	if candidates := pool.candidates(); candidates[2].URL != "http://b1" {
+		t.Errorf("Round-robin - want the other zones last, got: %v", candidates)
+	}
+
+	pool.Balancing = GatewayLeastPending
+	end := pool.begin("http://a1")
+	if candidates := pool.candidates(); candidates[0].URL != "http://a2" {
+		t.Errorf("Least pending - want: %s, got: %s", "http://a2", candidates[0].URL)
+	}
+	end()
+	pool.begin("http://a2")
+	if candidates := pool.candidates(); candidates[0].URL != "http://a1" {
+		t.Errorf("Least pending - want: %s, got: %s", "http://a1", candidates[0].URL)
+	}
+}
+
+func Test_FunctionLookupBuilder_FailsOverGateways(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	down.Close()
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"name":"echo","annotations":{"topic":"orders"}}]`))
+	}))
+	defer up.Close()
+
+	pool := NewGatewayPool("", Gateway{URL: down.URL}, Gateway{URL: up.URL})
+	pool.Ordered = true
+	builder := &FunctionLookupBuilder{
+		GatewayURL:  down.URL,
+		Client:      http.DefaultClient,
+		Namespace:   "openfaas-fn",
+		Logger:      NewStdLogger(LevelError),
+		GatewayPool: pool,
+	}
+
+	lookups, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lookups["orders"]) != 1 {
+		t.Errorf("Lookups - want the functions of %s, got: %v", up.URL, lookups)
+	}
+	for _, gateway := range pool.Gateways() {
+		if gateway.URL == down.URL && gateway.Healthy {
+			t.Errorf("Gateway %s - want unhealthy", gateway.URL)
+		}
+		if gateway.Pending != 0 {
+			t.Errorf("Gateway %s - want no pending request, got: %d", gateway.URL, gateway.Pending)
+		}
+	}
+}
+
+func Test_GatewayPool_Route(t *testing.T) {
+	pool := NewGatewayPool("", Gateway{URL: "http://gw1"}, Gateway{URL: "http://gw10/"}, Gateway{URL: "http://gw2/prefix"})
+	gateway := GatewayStatus{Gateway: Gateway{URL: "http://backup"}}
+
+	cases := []struct {
+		target string
+		want   string
+	}{
+		{"http://gw1/function/echo", "http://backup/function/echo"},
+		{"http://gw10/function/echo?x=1", "http://backup/function/echo?x=1"},
+		{"http://GW1/function/echo", "http://backup/function/echo"},
+		{"http://gw2/prefix/function/echo", "http://backup/function/echo"},
+		{"http://gw2/prefixed/function/echo", "http://gw2/prefixed/function/echo"},
+		{"https://gw1/function/echo", "https://gw1/function/echo"},
+		{"http://gw100/function/echo", "http://gw100/function/echo"},
+	}
+	for _, c := range cases {
+		if got := pool.route(c.target, gateway); got != c.want {
+			t.Errorf("Route %s - want: %s, got: %s", c.target, c.want, got)
+		}
+	}
+}
+
+func Test_NewController_PrimaryGatewayInLocalZone(t *testing.T) {
+	c := NewController(nil, &ControllerConfig{
+		GatewayURL:      "http://primary",
+		Gateways:        []Gateway{{URL: "http://remote", Zone: "zone-b"}},
+		Zone:            "zone-a",
+		RebuildInterval: time.Hour,
+	}).(*controller)
+	defer c.Close()
+
+	for _, gateway := range c.Invoker.GatewayPool.Gateways() {
+		if gateway.URL == "http://primary" && gateway.Zone != "zone-a" {
+			t.Errorf("Primary gateway zone - want: %s, got: %q", "zone-a", gateway.Zone)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"net/http"
+)
+
+// invokerHeader is the set of headers sent with every invocation of an
+// Invoker, with the settings it was built from. It is never modified once
+// built.
+type invokerHeader struct {
+	callbackURL string
+	header      http.Header
+}
+
+// baseHeader returns the headers sent with every invocation, built once and
+// shared by all of them: it must not be modified. It is rebuilt if the
+// CallbackURL changes.
+func (i *Invoker) baseHeader() http.Header {
+	if base, ok := i.base.Load().(*invokerHeader); ok && base.callbackURL == i.CallbackURL {
+		return base.header
+	}
+
+	header := http.Header{}
+	if len(i.CallbackURL) > 0 {
+		header.Set("X-Callback-Url", i.CallbackURL)
+	}
+	i.base.Store(&invokerHeader{callbackURL: i.CallbackURL, header: header})
+	return header
+}
+
+// mergeHeader returns a new header with the values of each layer, the
+// values of a layer replacing the ones of the previous layers for the same
+// name. The layers are not modified, and don't share any value slice with
+// the result.
+func mergeHeader(layers ...http.Header) http.Header {
+	size := 0
+	for _, layer := range layers {
+		size += len(layer)
+	}
+
+	merged := make(http.Header, size)
+	for _, layer := range layers {
+		for name, values := range layer {
+			merged[name] = append([]string(nil), values...)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,51 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func Test_InvokeFunction_DoesNotMutateHeaders(t *testing.T) {
+	received := make(chan http.Header, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header
+	}))
+	defer srv.Close()
+
+	invoker := NewInvoker(srv.URL+"/function", "http://callback", srv.Client(), false, false)
+	headers := http.Header{"X-Tenant": {"acme"}, "X-Callback-Url": {"http://override"}}
+	want := http.Header{"X-Tenant": {"acme"}, "X-Callback-Url": {"http://override"}}
+
+	collectResponses(invoker, func() {
+		invoker.InvokeFunction(context.Background(), "echo", &Message{Body: []byte("hello")}, headers)
+	})
+
+	header := <-received
+	if header.Get("X-Tenant") != "acme" || header.Get("X-Callback-Url") != "http://override" {
+		t.Errorf("Headers - want the per-call headers, got: %v", header)
+	}
+	if !reflect.DeepEqual(headers, want) {
+		t.Errorf("Per-call headers modified - want: %v, got: %v", want, headers)
+	}
+	if got := invoker.baseHeader().Get("X-Callback-Url"); got != "http://callback" {
+		t.Errorf("Base header modified - want: %s, got: %s", "http://callback", got)
+	}
+}
+
+func Test_baseHeader_RebuiltOnCallbackURLChange(t *testing.T) {
+	invoker := NewInvoker("http://gateway/function", "http://callback1", http.DefaultClient, false, false)
+	if got := invoker.baseHeader().Get("X-Callback-Url"); got != "http://callback1" {
+		t.Errorf("X-Callback-Url - want: %s, got: %s", "http://callback1", got)
+	}
+
+	invoker.CallbackURL = "http://callback2"
+	if got := invoker.baseHeader().Get("X-Callback-Url"); got != "http://callback2" {
+		t.Errorf("X-Callback-Url - want: %s, got: %s", "http://callback2", got)
+	}
+}
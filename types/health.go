@@ -0,0 +1,167 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// CircuitState is the state of the circuit breaker of a function.
+type CircuitState string
+
+const (
+	// CircuitClosed lets the invocations through.
+	CircuitClosed CircuitState = "closed"
+	// CircuitOpen rejects the invocations with ErrCircuitOpen.
+	CircuitOpen CircuitState = "open"
+	// CircuitHalfOpen lets a single trial invocation through.
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+// CircuitBreaker stops invoking a function after FailureThreshold
+// consecutive failures. After OpenDuration, a trial invocation is let
+// through: the circuit closes again if it succeeds. Failures are transport
+// errors and 5xx responses.
+type CircuitBreaker struct {
+	FailureThreshold int
+	OpenDuration     time.Duration
+}
+
+// FunctionHealth is the health of a function as observed by the invoker.
+type FunctionHealth struct {
+	Function            string       `json:"function"`
+	LastStatus          int          `json:"lastStatus,omitempty"`
+	LastError           string       `json:"lastError,omitempty"`
+	LastErrorAt         time.Time    `json:"lastErrorAt,omitempty"`
+	LastSuccessAt       time.Time    `json:"lastSuccessAt,omitempty"`
+	ConsecutiveFailures int          `json:"consecutiveFailures"`
+	Circuit             CircuitState `json:"circuit"`
+}
+
+type functionHealthState struct {
+	health   FunctionHealth
+	openedAt time.Time
+	trial    bool
+}
+
+// healthTracker records the health of the functions and applies the
+// CircuitBreaker, if set.
+type healthTracker struct {
+	breaker *CircuitBreaker
+
+	lock      sync.Mutex
+	functions map[string]*functionHealthState
+
+	now func() time.Time
+}
+
+func newHealthTracker() *healthTracker {
+	return &healthTracker{
+		functions: make(map[string]*functionHealthState),
+		now:       time.Now,
+	}
+}
+
+func (h *healthTracker) state(function string) *functionHealthState {
+	state, ok := h.functions[function]
+	if !ok {
+		state = &functionHealthState{health: FunctionHealth{Function: function, Circuit: CircuitClosed}}
+		h.functions[function] = state
+	}
+	return state
+}
+
+// allow returns ErrCircuitOpen if the circuit of function is open.
+func (h *healthTracker) allow(function string) error {
+	if h == nil || h.breaker == nil || h.breaker.FailureThreshold <= 0 {
+		return nil
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	state := h.state(function)
+	switch state.health.Circuit {
+	case CircuitOpen:
+		if h.now().Sub(state.openedAt) < h.breaker.OpenDuration {
+			return ErrCircuitOpen
+		}
+		state.health.Circuit = CircuitHalfOpen
+		state.trial = true
+		return nil
+	case CircuitHalfOpen:
+		if state.trial {
+			return ErrCircuitOpen
+		}
+		state.trial = true
+	}
+	return nil
+}
+
+// record updates the health of a function with a response. The responses
+// served from a cache and the invocations rejected before being sent, e.g.
+// while the function is drained, are ignored.
+func (h *healthTracker) record(res InvokerResponse) {
+	if h == nil || len(res.Function) == 0 || res.Cached || localRejection(res.Error) {
+		return
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	now := h.now()
+	state := h.state(res.Function)
+	state.trial = false
+	state.health.LastStatus = res.Status
+
+	if res.Error == nil && res.Status < http.StatusInternalServerError {
+		state.health.LastSuccessAt = now
+		state.health.ConsecutiveFailures = 0
+		state.health.Circuit = CircuitClosed
+		return
+	}
+
+	state.health.LastErrorAt = now
+	if res.Error != nil {
+		state.health.LastError = res.Error.Error()
+	} else {
+		state.health.LastError = http.StatusText(res.Status)
+	}
+	state.health.ConsecutiveFailures++
+
+	if h.breaker == nil || h.breaker.FailureThreshold <= 0 {
+		return
+	}
+	if state.health.Circuit == CircuitHalfOpen || state.health.ConsecutiveFailures >= h.breaker.FailureThreshold {
+		state.health.Circuit = CircuitOpen
+		state.openedAt = now
+	}
+}
+
+// snapshot returns the health of the functions, sorted by function.
+func (h *healthTracker) snapshot() []FunctionHealth {
+	if h == nil {
+		return []FunctionHealth{}
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	functions := make([]FunctionHealth, 0, len(h.functions))
+	for _, state := range h.functions {
+		functions = append(functions, state.health)
+	}
+	sort.Slice(functions, func(i, j int) bool {
+		return functions[i].Function < functions[j].Function
+	})
+	return functions
+}
+
+// FunctionHealth returns the health of the functions invoked so far.
+func (i *Invoker) FunctionHealth() []FunctionHealth {
+	return i.health.snapshot()
+}
@@ -0,0 +1,96 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func Test_healthTracker_CircuitBreaker(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	h := newHealthTracker()
+	h.breaker = &CircuitBreaker{FailureThreshold: 2, OpenDuration: time.Minute}
+	h.now = func() time.Time { return now }
+
+	failure := InvokerResponse{Function: "fn", Error: fmt.Errorf("connection refused")}
+	success := InvokerResponse{Function: "fn", Status: http.StatusOK}
+
+	h.record(failure)
+	if err := h.allow("fn"); err != nil {
+		t.Fatalf("Allow - want closed after 1 failure, got: %v", err)
+	}
+
+	h.record(InvokerResponse{Function: "fn", Status: http.StatusBadGateway})
+	if err := h.allow("fn"); err != ErrCircuitOpen {
+		t.Fatalf("Allow - want: %v, got: %v", ErrCircuitOpen, err)
+	}
+
+	now = now.Add(time.Minute)
+	if err := h.allow("fn"); err != nil {
+		t.Fatalf("Allow - want a trial after OpenDuration, got: %v", err)
+	}
+	if err := h.allow("fn"); err != ErrCircuitOpen {
+		t.Fatalf("Allow - want a single trial, got: %v", err)
+	}
+
+	h.record(success)
+	health := h.snapshot()
+	if len(health) != 1 {
+		t.Fatalf("Snapshot - want: %d functions, got: %d", 1, len(health))
+	}
+	got := health[0]
+	if got.Circuit != CircuitClosed || got.ConsecutiveFailures != 0 || got.LastStatus != http.StatusOK ||
+		got.LastError != http.StatusText(http.StatusBadGateway) || !got.LastSuccessAt.Equal(now) {
+		t.Errorf("Health - got: %+v", got)
+	}
+}
+
+func Test_Invoker_RateLimitedTrialKeepsCircuitUsable(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	invoker := NewInvoker(srv.URL+"/function", "", srv.Client(), false, false)
+	invoker.health.breaker = &CircuitBreaker{FailureThreshold: 1, OpenDuration: time.Minute}
+	invoker.health.now = func() time.Time { return now }
+
+	invoke := func(ctx context.Context) InvokerResponse {
+		return invoker.invoke(ctx, "topic1", "fn", &Message{Body: []byte("hello")}, []byte("hello"), http.Header{}, invokeOptions{})
+	}
+
+	if res := invoke(context.Background()); res.Status != http.StatusBadGateway {
+		t.Fatalf("Status - want: %d, got: %d (%v)", http.StatusBadGateway, res.Status, res.Error)
+	}
+	now = now.Add(time.Minute)
+
+	// The trial is rejected by the rate limiter before being sent.
+	invoker.RateLimiter = NewRateLimiter(0.001, 1)
+	invoker.RateLimiter.Wait(context.Background())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if res := invoke(ctx); errors.Cause(res.Error) != ErrRateLimited {
+		t.Fatalf("Error - want: %v, got: %v", ErrRateLimited, res.Error)
+	}
+
+	invoker.RateLimiter = nil
+	if res := invoke(context.Background()); res.Error != nil || res.Status != http.StatusOK {
+		t.Fatalf("Trial - want sent, got: %d (%v)", res.Status, res.Error)
+	}
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("Calls - want: %d, got: %d", 2, got)
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// IDGenerator generates the IDs of the events and invocations.
+type IDGenerator interface {
+	NewID() (string, error)
+}
+
+// RandomIDGenerator generates random 128-bit IDs encoded as hex. It is the
+// default IDGenerator.
+type RandomIDGenerator struct{}
+
+// NewID returns a random ID.
+func (RandomIDGenerator) NewID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// ULIDGenerator generates ULIDs, sortable by creation time to the
+// millisecond.
+type ULIDGenerator struct{}
+
+const crockfordBase32 = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewID returns a ULID.
+func (ULIDGenerator) NewID() (string, error) {
+	var b [16]byte
+	putTimestamp(b[:6], time.Now())
+	if _, err := rand.Read(b[6:]); err != nil {
+		return "", err
+	}
+
+	// 128 bits encoded in 26 characters of 5 bits, the first one holding
+	// only the 3 highest bits.
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+	id := make([]byte, 26)
+	for i := 25; i >= 0; i-- {
+		id[i] = crockfordBase32[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(id), nil
+}
+
+// UUIDv7Generator generates version 7 UUIDs, sortable by creation time to
+// the millisecond.
+type UUIDv7Generator struct{}
+
+// NewID returns a UUIDv7.
+func (UUIDv7Generator) NewID() (string, error) {
+	var b [16]byte
+	putTimestamp(b[:6], time.Now())
+	if _, err := rand.Read(b[6:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x70
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+// SequentialIDGenerator generates sequential IDs prefixed with Prefix
+// ("<prefix>1", "<prefix>2"...), for deterministic tests.
+type SequentialIDGenerator struct {
+	Prefix string
+
+	next uint64
+}
+
+// NewID returns the next ID of the sequence.
+func (g *SequentialIDGenerator) NewID() (string, error) {
+	return fmt.Sprintf("%s%d", g.Prefix, atomic.AddUint64(&g.next, 1)), nil
+}
+
+// putTimestamp writes the Unix time in milliseconds of t as a 48-bit big
+// endian integer.
+func putTimestamp(b []byte, t time.Time) {
+	ms := uint64(t.UnixNano() / int64(time.Millisecond))
+	for i := 5; i >= 0; i-- {
+		b[i] = byte(ms)
+		ms >>= 8
+	}
+}
+
+// newID generates an ID with the IDGenerator of the Invoker.
+func (i *Invoker) newID() (string, error) {
+	if i.IDGenerator == nil {
+		return RandomIDGenerator{}.NewID()
+	}
+	return i.IDGenerator.NewID()
+}
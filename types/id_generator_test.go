@@ -0,0 +1,46 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func Test_IDGenerators(t *testing.T) {
+	tests := []struct {
+		name      string
+		generator IDGenerator
+		pattern   string
+	}{
+		{name: "random", generator: RandomIDGenerator{}, pattern: `^[0-9a-f]{32}$`},
+		{name: "ulid", generator: ULIDGenerator{}, pattern: `^[0-7][0-9A-HJKMNP-TV-Z]{25}$`},
+		{name: "uuidv7", generator: UUIDv7Generator{}, pattern: `^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`},
+		{name: "sequential", generator: &SequentialIDGenerator{Prefix: "id-"}, pattern: `^id-1$`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			id, err := test.generator.NewID()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !regexp.MustCompile(test.pattern).MatchString(id) {
+				t.Errorf("ID - want: %s, got: %s", test.pattern, id)
+			}
+		})
+	}
+}
+
+func Test_SortableIDGenerators(t *testing.T) {
+	for _, generator := range []IDGenerator{ULIDGenerator{}, UUIDv7Generator{}} {
+		first, _ := generator.NewID()
+		time.Sleep(2 * time.Millisecond)
+		second, _ := generator.NewID()
+		if first >= second {
+			t.Errorf("%T - want %s < %s", generator, first, second)
+		}
+	}
+}
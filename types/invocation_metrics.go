@@ -0,0 +1,192 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultDurationBuckets are the upper bounds, in seconds, of the buckets of
+// connector_invocation_duration_seconds when Metrics.DurationBuckets is not
+// set.
+var DefaultDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// invocationTarget labels the invocations of a function for a topic.
+type invocationTarget struct {
+	topic     string
+	function  string
+	namespace string
+}
+
+// invocationStats accounts the invocations of an invocationTarget.
+type invocationStats struct {
+	statusClasses map[string]uint64
+	buckets       []uint64
+	count         uint64
+	sum           float64
+}
+
+// invocationMetrics accounts the invocations and the topic map syncs.
+type invocationMetrics struct {
+	lock        sync.Mutex
+	invocations map[invocationTarget]*invocationStats
+
+	topics         int64
+	syncs          uint64
+	syncFailures   uint64
+	syncDurationNs int64
+}
+
+// statusClass returns the class of the status of res: "2xx" to "5xx", or
+// "error" if the function could not be invoked.
+func statusClass(res InvokerResponse) string {
+	if res.Status < 100 || res.Status > 599 {
+		return "error"
+	}
+	return strconv.Itoa(res.Status/100) + "xx"
+}
+
+func (m *Metrics) durationBuckets() []float64 {
+	if len(m.DurationBuckets) == 0 {
+		return DefaultDurationBuckets
+	}
+	return m.DurationBuckets
+}
+
+// observeDuration accounts an invocation by topic, function and status class.
+func (m *Metrics) observeDuration(res InvokerResponse) {
+	if len(res.Function) == 0 {
+		return
+	}
+
+	name, namespace := splitFunctionRef(res.Function)
+	target := invocationTarget{topic: res.Topic, function: name, namespace: namespace}
+	buckets := m.durationBuckets()
+	seconds := res.Duration.Seconds()
+
+	m.invocations.lock.Lock()
+	defer m.invocations.lock.Unlock()
+
+	if m.invocations.invocations == nil {
+		m.invocations.invocations = map[invocationTarget]*invocationStats{}
+	}
+	stats, ok := m.invocations.invocations[target]
+	if !ok {
+		stats = &invocationStats{statusClasses: map[string]uint64{}, buckets: make([]uint64, len(buckets))}
+		m.invocations.invocations[target] = stats
+	}
+
+	stats.statusClasses[statusClass(res)]++
+	stats.count++
+	stats.sum += seconds
+	for n, bound := range buckets {
+		if seconds <= bound {
+			stats.buckets[n]++
+		}
+	}
+}
+
+// observeSync accounts a rebuild of the topic map, which mapped topics
+// topics if it succeeded.
+func (m *Metrics) observeSync(duration time.Duration, topics int, err error) {
+	atomic.StoreInt64(&m.invocations.syncDurationNs, int64(duration))
+	if err != nil {
+		atomic.AddUint64(&m.invocations.syncFailures, 1)
+		return
+	}
+	atomic.AddUint64(&m.invocations.syncs, 1)
+	atomic.StoreInt64(&m.invocations.topics, int64(topics))
+}
+
+// writeInvocations writes the invocations by topic, function and status
+// class, their durations, and the topic map syncs.
+func (m *Metrics) writeInvocations(w io.Writer) {
+	writeMetricHeader(w, "connector_topic_map_topics", "gauge", "Topics in the topic map.")
+	writeMetric(w, "connector_topic_map_topics", nil, float64(atomic.LoadInt64(&m.invocations.topics)))
+
+	writeMetricHeader(w, "connector_topic_map_syncs_total", "counter", "Rebuilds of the topic map by result.")
+	writeMetric(w, "connector_topic_map_syncs_total", []string{"result", "success"}, float64(atomic.LoadUint64(&m.invocations.syncs)))
+	writeMetric(w, "connector_topic_map_syncs_total", []string{"result", "error"}, float64(atomic.LoadUint64(&m.invocations.syncFailures)))
+
+	writeMetricHeader(w, "connector_topic_map_sync_duration_seconds", "gauge", "Duration of the last rebuild of the topic map.")
+	writeMetric(w, "connector_topic_map_sync_duration_seconds", nil, time.Duration(atomic.LoadInt64(&m.invocations.syncDurationNs)).Seconds())
+
+	m.invocations.lock.Lock()
+	targets := make([]invocationTarget, 0, len(m.invocations.invocations))
+	stats := make(map[invocationTarget]invocationStats, len(m.invocations.invocations))
+	for target, s := range m.invocations.invocations {
+		targets = append(targets, target)
+		classes := make(map[string]uint64, len(s.statusClasses))
+		for class, count := range s.statusClasses {
+			classes[class] = count
+		}
+		stats[target] = invocationStats{
+			statusClasses: classes,
+			buckets:       append([]uint64(nil), s.buckets...),
+			count:         s.count,
+			sum:           s.sum,
+		}
+	}
+	m.invocations.lock.Unlock()
+
+	if len(targets) == 0 {
+		return
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		a, b := targets[i], targets[j]
+		if a.topic != b.topic {
+			return a.topic < b.topic
+		}
+		if a.function != b.function {
+			return a.function < b.function
+		}
+		return a.namespace < b.namespace
+	})
+
+	writeMetricHeader(w, "connector_invocations_total", "counter", "Invocations by topic, function and status class.")
+	for _, target := range targets {
+		classes := make([]string, 0, len(stats[target].statusClasses))
+		for class := range stats[target].statusClasses {
+			classes = append(classes, class)
+		}
+		sort.Strings(classes)
+		for _, class := range classes {
+			writeMetric(w, "connector_invocations_total", []string{
+				"topic", target.topic,
+				"function", target.function,
+				"namespace", target.namespace,
+				"status_class", class,
+			}, float64(stats[target].statusClasses[class]))
+		}
+	}
+
+	buckets := m.durationBuckets()
+	writeMetricHeader(w, "connector_invocation_duration_seconds", "histogram", "Duration of the invocations by topic and function.")
+	for _, target := range targets {
+		s := stats[target]
+		labels := []string{"topic", target.topic, "function", target.function, "namespace", target.namespace}
+		for n, bound := range buckets {
+			if n < len(s.buckets) {
+				writeMetric(w, "connector_invocation_duration_seconds_bucket", append(labels, "le", formatBound(bound)), float64(s.buckets[n]))
+			}
+		}
+		writeMetric(w, "connector_invocation_duration_seconds_bucket", append(labels, "le", "+Inf"), float64(s.count))
+		writeMetric(w, "connector_invocation_duration_seconds_sum", labels, s.sum)
+		writeMetric(w, "connector_invocation_duration_seconds_count", labels, float64(s.count))
+	}
+}
+
+func formatBound(bound float64) string {
+	if math.IsInf(bound, 1) {
+		return "+Inf"
+	}
+	return fmt.Sprint(bound)
+}
@@ -0,0 +1,52 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"io"
+	"time"
+)
+
+// InvokeOption customises a single direct invocation.
+type InvokeOption func(*invokeOptions)
+
+type invokeOptions struct {
+	topic           string
+	discardResponse bool
+
+	// async overrides the invocation mode of the Invoker, if set.
+	async *bool
+
+	// timeout bounds the request to the gateway, if set.
+	timeout time.Duration
+
+	// stream is sent instead of the payload, when the body of the message
+	// can be streamed.
+	stream io.Reader
+}
+
+func newInvokeOptions(opts []InvokeOption) invokeOptions {
+	options := invokeOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// WithInvokeTopic sets the topic reported in the response of a direct
+// invocation, and sent to the function when SendTopic is enabled.
+func WithInvokeTopic(topic string) InvokeOption {
+	return func(options *invokeOptions) {
+		options.topic = topic
+	}
+}
+
+// WithInvokeDiscardResponse drains and closes the response of the function
+// without buffering its body, for fire-and-forget invocations. The response
+// is delivered with an empty body.
+func WithInvokeDiscardResponse() InvokeOption {
+	return func(options *invokeOptions) {
+		options.discardResponse = true
+	}
+}
@@ -4,17 +4,21 @@
 package types
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/pkg/errors"
 )
 
+const defaultTopicHeader = "X-Topic"
+
 // Invoker is used to send requests to functions. Responses are
 // returned via the Responses channel.
 type Invoker struct {
@@ -24,6 +28,177 @@ type Invoker struct {
 	CallbackURL   string
 	SendTopic     bool
 	Responses     chan InvokerResponse
+
+	// DuplicatePolicy defines how functions with the same name in several
+	// namespaces subscribed to the same topic are invoked.
+	DuplicatePolicy DuplicateFunctionPolicy
+
+	// NamespacePreference is the namespace priority used by the
+	// DuplicatePreferNamespace policy.
+	NamespacePreference []string
+
+	// DefaultNamespace is applied to matched functions without a namespace.
+	DefaultNamespace string
+
+	// Logger is used to log the invocations. Defaults to the standard log package.
+	Logger Logger
+
+	// AsyncTracker records the call IDs of asynchronous invocations, if set.
+	AsyncTracker *AsyncTracker
+
+	// RateLimiter limits the invocations per second, if set.
+	RateLimiter *RateLimiter
+
+	// CloudEventsMode defines whether the messages are wrapped as CloudEvents.
+	CloudEventsMode CloudEventsMode
+
+	// CloudEventsSource is the source of the CloudEvents. Defaults to "connector-sdk".
+	CloudEventsSource string
+
+	// AttributeHeaders maps the attributes of a Message to the headers used
+	// to send them.
+	AttributeHeaders map[string]string
+
+	// AttributeHeaderPrefix is prepended to the attributes of a Message
+	// without a mapped header. If empty, those attributes are not sent.
+	AttributeHeaderPrefix string
+
+	// TopicHeader is the header used to send the topic when SendTopic is
+	// enabled. Defaults to "X-Topic".
+	TopicHeader string
+
+	// AsyncGatewayURL is the asynchronous route of the gateway used when
+	// AdaptiveAsync switches a topic to async, or for the functions declaring
+	// topic-async: "true".
+	AsyncGatewayURL string
+
+	// SyncGatewayURL is the synchronous route of the gateway used for the
+	// functions declaring topic-async: "false" when GatewayURL is the
+	// asynchronous route.
+	SyncGatewayURL string
+
+	// AdaptiveAsync switches topics to asynchronous invocations under load, if set.
+	AdaptiveAsync *AdaptiveAsync
+
+	// Tracer creates a span per invocation, if set.
+	Tracer Tracer
+
+	// RetryAfterMaxWait is the maximum total time to wait when retrying the
+	// invocations, after the delay given by their Retry-After header. Zero
+	// disables the retries.
+	RetryAfterMaxWait time.Duration
+
+	// ShouldRetry decides which invocations are retried, given their response
+	// or transport error. Defaults to the invocations rejected with 429.
+	ShouldRetry func(res InvokerResponse) bool
+
+	// RetryBudget caps the retries to a ratio of the invocations, if set.
+	RetryBudget *RetryBudget
+
+	// Archiver archives the payloads sent to the functions, if set.
+	Archiver *Archiver
+
+	// DropOnOverflow drops the responses that cannot be sent to Responses
+	// right away instead of blocking the invocations until the consumers
+	// catch up. Use it with a buffered Responses channel.
+	DropOnOverflow bool
+
+	// OnOverflow is called with each dropped response, if set.
+	OnOverflow func(InvokerResponse)
+
+	// ResponseCache answers identical invocations from the cached responses,
+	// if set.
+	ResponseCache *ResponseCache
+
+	// TopicContentTypes maps topics to the Content-Type sent to the
+	// functions, e.g. "application/avro" for Avro topics. Topics missing
+	// from the map use DefaultContentType, if set. They are ignored in the
+	// structured CloudEvents mode.
+	TopicContentTypes  map[string]string
+	DefaultContentType string
+
+	// OrderedDelivery publishes the responses of each topic in the order the
+	// messages were invoked, holding back the responses of a message until
+	// those of the previous messages of its topic have been published.
+	OrderedDelivery bool
+
+	// OrderedByKey invokes the messages of a topic sharing a Key one at a
+	// time, in the order they were received, while the messages with
+	// different keys are invoked in parallel, e.g. to preserve the order of
+	// the events of an entity keyed by a Kafka partition key.
+	OrderedByKey bool
+
+	// IDGenerator generates the IDs of the events and invocations. Defaults
+	// to random IDs.
+	IDGenerator IDGenerator
+
+	// ResponseTransformer is applied to each response before it is
+	// published, if set.
+	ResponseTransformer ResponseTransformer
+
+	// ExpiringHeaders are forwarded to every function until they expire.
+	ExpiringHeaders *ExpiringHeaders
+
+	// Auth authenticates the invocations, e.g. with a TokenAuth when the
+	// gateway requires OpenFaaS IAM tokens to invoke the functions.
+	Auth ClientAuth
+
+	// GatewayPool selects the gateway of each invocation, if set. The
+	// GatewayURL must belong to one of its gateways.
+	GatewayPool *GatewayPool
+
+	// MissingFunctionTTL is how long a function answered with 404 is
+	// considered missing: its invocations fail with ErrFunctionNotFound
+	// without calling the gateway. Zero disables it. Do not enable it if
+	// the functions themselves respond with 404.
+	MissingFunctionTTL time.Duration
+
+	// OnMissingFunction is called when a function is found missing, e.g.
+	// to rebuild the topic map.
+	OnMissingFunction func(function string)
+
+	// PropagateHeaders lists the request headers, e.g. a tenant or
+	// correlation ID, copied into the Metadata of the responses.
+	PropagateHeaders []string
+
+	// DiscardResponseBodies drains the responses without buffering their
+	// bodies, like WithInvokeDiscardResponse, for every invocation. The
+	// responses are delivered with an empty body.
+	DiscardResponseBodies bool
+
+	// TenantResolver labels each invocation with its tenant, reported in
+	// the responses, traces and archived records.
+	TenantResolver TenantResolver
+
+	// TopicNormalization is applied to the topic of each message before it is
+	// matched, like to the topics of the topic map.
+	TopicNormalization TopicNormalization
+
+	// DeadLetterSink receives the invocations failed according to
+	// DeadLetterPolicy, once their retries are exhausted, with the original
+	// message. DeadLetterPolicy defaults to DefaultDeadLetterPolicy. The
+	// dead letters are delivered in the background, up to
+	// DeadLetterQueueSize waiting at once, 1000 by default; Close waits for
+	// them like for the invocations.
+	DeadLetterSink      DeadLetterSink
+	DeadLetterPolicy    func(res InvokerResponse) bool
+	DeadLetterQueueSize int
+
+	duplicatesWarned sync.Map
+	dropped          uint64
+	sequencer        topicSequencer
+	keys             topicSequencer
+	health           *healthTracker
+	base             atomic.Value
+	missing          missingFunctions
+	drains           functionDrains
+	deadLetters      deadLetterQueue
+
+	lifecycleLock sync.Mutex
+	closed        bool
+	inFlight      int
+	drained       chan struct{}
+	abandon       chan struct{}
 }
 
 // InvokerResponse is a wrapper to contain the response or error the Invoker
@@ -36,6 +211,30 @@ type InvokerResponse struct {
 	Error    error
 	Topic    string
 	Function string
+
+	// CallID is the ID given by the gateway to asynchronous invocations.
+	CallID string
+
+	// Duration is the time taken by the gateway to respond.
+	Duration time.Duration
+
+	// Cached is true when the response was served from the ResponseCache.
+	Cached bool
+
+	// MessageID is the ID of the message, sent to the function in the
+	// X-Message-Id header.
+	MessageID string
+
+	// Metadata holds the request headers listed in PropagateHeaders, by
+	// canonical header name, so subscribers can attribute the response.
+	Metadata map[string]string
+
+	// Tenant is the tenant of the invocation given by the TenantResolver.
+	Tenant string
+
+	// DeadLettered is true when the failed invocation was queued for the
+	// DeadLetterSink.
+	DeadLettered bool
 }
 
 // NewInvoker constructs an Invoker instance
@@ -47,7 +246,18 @@ func NewInvoker(gatewayURL, callbackURL string, client *http.Client, printRespon
 		CallbackURL:   callbackURL,
 		SendTopic:     sendTopic,
 		Responses:     make(chan InvokerResponse),
+		health:        newHealthTracker(),
+	}
+}
+
+// NewValidatedInvoker constructs an Invoker like NewInvoker, or returns the
+// ConfigErrors of its options.
+func NewValidatedInvoker(gatewayURL, callbackURL string, client *http.Client, printResponse, sendTopic bool) (*Invoker, error) {
+	invoker := NewInvoker(gatewayURL, callbackURL, client, printResponse, sendTopic)
+	if err := invoker.Validate(); err != nil {
+		return nil, err
 	}
+	return invoker, nil
 }
 
 // Invoke triggers a function by accessing the API Gateway
@@ -55,49 +265,477 @@ func (i *Invoker) Invoke(topicMap *TopicMap, topic string, message *[]byte) {
 	i.InvokeWithContext(context.Background(), topicMap, topic, message)
 }
 
-//InvokeWithContext triggers a function by accessing the API Gateway while propagating context
+// InvokeWithContext triggers a function by accessing the API Gateway while propagating context
 func (i *Invoker) InvokeWithContext(ctx context.Context, topicMap *TopicMap, topic string, message *[]byte) {
-	if len(*message) == 0 {
-		i.Responses <- InvokerResponse{
+	i.InvokeMessage(ctx, topicMap, topic, &Message{Body: *message})
+}
+
+// InvokeMessage triggers the functions subscribed to topic with a Message,
+// sending its metadata as headers.
+func (i *Invoker) InvokeMessage(ctx context.Context, topicMap *TopicMap, topic string, message *Message) {
+	i.InvokeMessageWithResults(ctx, topicMap, topic, message)
+}
+
+// InvokeMessageWithResults triggers the functions subscribed to topic like
+// InvokeMessage, and returns their responses once published.
+func (i *Invoker) InvokeMessageWithResults(ctx context.Context, topicMap *TopicMap, topic string, message *Message) []InvokerResponse {
+	turn := keyTurnFrom(ctx)
+	if turn == nil {
+		turn = i.takeKeyTurn(topic, message)
+	}
+	if turn != nil {
+		defer turn.done()
+		turn.wait()
+	}
+
+	if _, ok := i.begin(); !ok {
+		nack(ctx, ErrInvokerClosed)
+		return []InvokerResponse{{Context: ctx, Error: ErrInvokerClosed, Topic: topic}}
+	}
+	defer i.end()
+
+	responses := []InvokerResponse{}
+
+	if !i.OrderedDelivery {
+		i.invokeMessage(ctx, topicMap, topic, message, func(res InvokerResponse) {
+			responses = append(responses, res)
+			i.publish(res)
+		})
+		acknowledge(ctx, responses)
+		return responses
+	}
+
+	ticket := i.sequencer.take(topic)
+	defer ticket.done()
+
+	i.invokeMessage(ctx, topicMap, topic, message, func(res InvokerResponse) {
+		responses = append(responses, res)
+	})
+
+	ticket.wait()
+	for _, res := range responses {
+		i.publish(res)
+	}
+	acknowledge(ctx, responses)
+	return responses
+}
+
+// invokeMessage triggers the functions subscribed to topic with a Message,
+// passing each response to publish.
+func (i *Invoker) invokeMessage(ctx context.Context, topicMap *TopicMap, topic string, message *Message, publish func(InvokerResponse)) {
+	if i.ResponseTransformer != nil {
+		next := publish
+		publish = func(res InvokerResponse) {
+			next(i.transform(res))
+		}
+	}
+
+	if !message.hasBody() {
+		publish(InvokerResponse{
 			Context: ctx,
 			Error:   fmt.Errorf("no message to send"),
-		}
+			Topic:   topic,
+		})
+		return
+	}
+
+	message = i.withMessageID(message)
+
+	// the topic map holds the normalized topics
+	matchTopic := i.TopicNormalization.apply(topic)
+	matchedFunctions := skipCompleted(ctx, i.resolveDuplicates(topic, topicMap.Match(matchTopic)))
+
+	message, stream, err := i.prepareBody(message, len(matchedFunctions))
+	defer closeStream(stream)
+	if err != nil {
+		publish(InvokerResponse{
+			Context:   ctx,
+			Error:     err,
+			Topic:     topic,
+			MessageID: message.ID,
+		})
+		return
+	}
+
+	payload, header, err := i.request(ctx, topic, message)
+	if err != nil {
+		publish(InvokerResponse{
+			Context:   ctx,
+			Error:     err,
+			Topic:     topic,
+			MessageID: message.ID,
+		})
+		return
+	}
+
+	archived := i.Archiver != nil && len(matchedFunctions) > 0 && i.Archiver.sample()
+	archivePrefix := ""
+	if archived {
+		archivePrefix = i.Archiver.archiveRequest(topic, message.ID, payload)
 	}
 
-	matchedFunctions := topicMap.Match(topic)
 	for _, matchedFunction := range matchedFunctions {
-		log.Printf("Invoke function: %s", matchedFunction)
+		invokeHeader := i.contentTypeHeader(topicMap, matchTopic, matchedFunction, functionHeader(topicMap, matchedFunction, header))
+		res := i.invoke(ctx, topic, matchedFunction, message, payload, invokeHeader, invokeOptions{
+			stream:          stream,
+			discardResponse: i.DiscardResponseBodies,
+			async:           functionAsync(topicMap, matchTopic, matchedFunction),
+			timeout:         functionTimeout(topicMap, matchedFunction),
+		})
+		if archived {
+			i.Archiver.archiveResponse(archivePrefix, res)
+		}
+		publish(res)
+	}
+}
+
+// InvokeFunction invokes a single function directly, bypassing the topic
+// map. The response is published to Responses and returned, and the
+// Acknowledger of ctx is notified of it.
+func (i *Invoker) InvokeFunction(ctx context.Context, function string, message *Message, headers http.Header, opts ...InvokeOption) InvokerResponse {
+	res := i.invokeFunction(ctx, function, message, headers, opts...)
+	acknowledge(ctx, []InvokerResponse{res})
+	return res
+}
+
+func (i *Invoker) invokeFunction(ctx context.Context, function string, message *Message, headers http.Header, opts ...InvokeOption) InvokerResponse {
+	options := newInvokeOptions(opts)
+	options.discardResponse = options.discardResponse || i.DiscardResponseBodies
+
+	if _, ok := i.begin(); !ok {
+		return InvokerResponse{Context: ctx, Error: ErrInvokerClosed, Function: function, Topic: options.topic}
+	}
+	defer i.end()
+
+	if !message.hasBody() {
+		res := InvokerResponse{
+			Context:  ctx,
+			Error:    fmt.Errorf("no message to send"),
+			Function: function,
+			Topic:    options.topic,
+		}
+		i.publish(res)
+		return res
+	}
+
+	message = i.withMessageID(message)
+
+	message, stream, err := i.prepareBody(message, 1)
+	defer closeStream(stream)
+	if err != nil {
+		res := InvokerResponse{
+			Context:   ctx,
+			Error:     err,
+			Function:  function,
+			Topic:     options.topic,
+			MessageID: message.ID,
+		}
+		i.publish(res)
+		return res
+	}
+	options.stream = stream
 
-		gwURL := fmt.Sprintf("%s/%s", i.GatewayURL, matchedFunction)
-		reader := bytes.NewReader(*message)
+	payload, header, err := i.request(ctx, options.topic, message)
+	if err != nil {
+		res := InvokerResponse{
+			Context:   ctx,
+			Error:     err,
+			Function:  function,
+			Topic:     options.topic,
+			MessageID: message.ID,
+		}
+		i.publish(res)
+		return res
+	}
+
+	header = mergeHeader(header, headers)
 
-		sendTopic := ""
-		if i.SendTopic {
-			sendTopic = topic
+	res := i.transform(i.invoke(ctx, options.topic, function, message, payload, header, options))
+	i.publish(res)
+	return res
+}
+
+// request builds the payload and the header sent to the functions for a
+// message.
+func (i *Invoker) request(ctx context.Context, topic string, message *Message) ([]byte, http.Header, error) {
+	payload, header, err := i.cloudEvent(topic, message.Body)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "unable to create CloudEvent")
+	}
+
+	i.messageHeaders(message, header)
+
+	if contentType := i.contentType(topic); len(contentType) > 0 && i.CloudEventsMode != CloudEventsStructured {
+		header.Set("Content-Type", contentType)
+	}
+
+	if i.SendTopic && len(topic) > 0 {
+		header.Add(i.topicHeader(), topic)
+	}
+
+	for name, values := range i.baseHeader() {
+		// The base values are set with Set, so Add copies them instead of
+		// appending to the shared slice.
+		if _, ok := header[name]; !ok {
+			header[name] = values
 		}
+	}
+
+	if i.ExpiringHeaders != nil {
+		i.ExpiringHeaders.apply(ctx, header, i.logger())
+	}
+
+	return payload, header, nil
+}
 
-		body, statusCode, header, doErr := invokefunction(ctx, i.Client, gwURL, sendTopic, i.CallbackURL, reader)
+// invoke sends a payload to a single function and returns its response,
+// tracing the invocation if a Tracer is set.
+func (i *Invoker) invoke(ctx context.Context, topic, function string, message *Message, payload []byte, header http.Header, options invokeOptions) InvokerResponse {
+	if i.Tracer == nil {
+		res := i.send(ctx, topic, function, message, payload, header, options)
+		res.MessageID = message.ID
+		res.Metadata = i.propagatedMetadata(header)
+		res.Tenant = i.tenant(ctx, topic, function, message)
+		i.health.record(res)
+		res.DeadLettered = i.deadLetter(message, res)
+		return res
+	}
+
+	ctx, span := i.Tracer.Start(ctx, "invoke "+function)
+	res := i.send(ctx, topic, function, message, payload, header, options)
+	res.MessageID = message.ID
+	res.Metadata = i.propagatedMetadata(header)
+	res.Tenant = i.tenant(ctx, topic, function, message)
+	i.health.record(res)
+	res.DeadLettered = i.deadLetter(message, res)
+	traceInvocation(span, res)
+	return res
+}
 
-		if doErr != nil {
-			i.Responses <- InvokerResponse{
-				Context: ctx,
-				Error:   errors.Wrap(doErr, fmt.Sprintf("unable to invoke %s", matchedFunction)),
+// send sends a payload to a single function and returns its response.
+func (i *Invoker) send(ctx context.Context, topic, function string, message *Message, payload []byte, header http.Header, options invokeOptions) InvokerResponse {
+	i.logger().Debugf("Invoke function: %s", function)
+
+	functionRef, err := i.resolveFunctionRef(function)
+	if err != nil {
+		return InvokerResponse{
+			Context:  ctx,
+			Error:    err,
+			Function: function,
+			Topic:    topic,
+		}
+	}
+
+	if i.ResponseCache != nil {
+		if cached, ok := i.ResponseCache.get(functionRef, i.cloudEventData(payload)); ok {
+			return InvokerResponse{
+				Context:  ctx,
+				Body:     cached.body,
+				Status:   cached.status,
+				Header:   cached.header,
+				Function: functionRef,
+				Topic:    topic,
+				Cached:   true,
+			}
+		}
+	}
+
+	if err := i.drains.begin(ctx, functionRef); err != nil {
+		return InvokerResponse{
+			Context:  ctx,
+			Error:    err,
+			Function: functionRef,
+			Topic:    topic,
+		}
+	}
+	defer i.drains.end(functionRef)
+
+	if i.MissingFunctionTTL > 0 && i.missing.missing(functionRef, time.Now()) {
+		return InvokerResponse{
+			Context:  ctx,
+			Error:    ErrFunctionNotFound,
+			Status:   http.StatusNotFound,
+			Function: functionRef,
+			Topic:    topic,
+			Cached:   true,
+		}
+	}
+
+	if i.RateLimiter != nil {
+		if err := i.RateLimiter.Wait(ctx); err != nil {
+			return InvokerResponse{
+				Context:  ctx,
+				Error:    errors.Wrap(ErrRateLimited, fmt.Sprintf("unable to invoke %s: %s", functionRef, err)),
+				Function: functionRef,
+				Topic:    topic,
 			}
-			continue
 		}
+	}
+
+	// The circuit is checked last, as the half-open trial it takes is only
+	// released by the response of an invocation sent to the gateway.
+	if err := i.health.allow(functionRef); err != nil {
+		return InvokerResponse{
+			Context:  ctx,
+			Error:    err,
+			Function: functionRef,
+			Topic:    topic,
+		}
+	}
+
+	gatewayURL := i.GatewayURL
+	adaptive := i.AdaptiveAsync != nil && len(i.AsyncGatewayURL) > 0
+	async := false
+	if options.async != nil {
+		// the mode declared by the function is not adapted to the load
+		adaptive = false
+		if *options.async && len(i.AsyncGatewayURL) > 0 {
+			gatewayURL = i.AsyncGatewayURL
+			async = true
+		} else if !*options.async && len(i.SyncGatewayURL) > 0 {
+			gatewayURL = i.SyncGatewayURL
+		}
+	}
+	if adaptive {
+		async = i.AdaptiveAsync.acquire(topic)
+		if async {
+			gatewayURL = i.AsyncGatewayURL
+		}
+	}
+
+	gwURL := fmt.Sprintf("%s/%s", gatewayURL, url.PathEscape(functionRef))
 
-		i.Responses <- InvokerResponse{
+	requestCtx := ctx
+	if options.timeout > 0 {
+		var cancel context.CancelFunc
+		requestCtx, cancel = context.WithTimeout(ctx, options.timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	var (
+		body       *[]byte
+		statusCode int
+		resHeader  *http.Header
+		doErr      error
+	)
+	if options.stream != nil {
+		// A stream can't be replayed, so it is neither retried nor failed over.
+		body, statusCode, resHeader, doErr = invokefunction(requestCtx, i.Client, i.Auth, gwURL, header, options.stream, options.discardResponse)
+	} else {
+		body, statusCode, resHeader, doErr = i.postGateway(requestCtx, functionRef, gwURL, header, payload, options.discardResponse)
+	}
+	duration := time.Since(start)
+
+	if adaptive {
+		i.AdaptiveAsync.release(topic, async, duration)
+	}
+
+	if doErr != nil {
+		return InvokerResponse{
 			Context:  ctx,
-			Body:     body,
-			Status:   statusCode,
-			Header:   header,
-			Function: matchedFunction,
+			Error:    errors.Wrap(doErr, fmt.Sprintf("unable to invoke %s", functionRef)),
+			Function: functionRef,
 			Topic:    topic,
+			Duration: duration,
 		}
 	}
+
+	if statusCode == http.StatusNotFound && i.MissingFunctionTTL > 0 {
+		i.missing.add(functionRef, time.Now(), i.MissingFunctionTTL)
+		if i.OnMissingFunction != nil {
+			i.OnMissingFunction(functionRef)
+		}
+	}
+
+	callID := ""
+	if statusCode == http.StatusAccepted && resHeader != nil {
+		callID = resHeader.Get(callIDHeader)
+		if i.AsyncTracker != nil && len(callID) > 0 {
+			i.AsyncTracker.Track(AsyncCall{
+				CallID:    callID,
+				Topic:     topic,
+				Function:  functionRef,
+				Message:   &message.Body,
+				InvokedAt: time.Now(),
+			})
+		}
+	}
+
+	res := InvokerResponse{
+		Context:  ctx,
+		Body:     body,
+		Status:   statusCode,
+		Header:   resHeader,
+		Function: functionRef,
+		Topic:    topic,
+		CallID:   callID,
+		Duration: duration,
+	}
+	if i.ResponseCache != nil && !async && !options.discardResponse {
+		i.ResponseCache.put(functionRef, i.cloudEventData(payload), res)
+	}
+	return res
 }
 
-func invokefunction(ctx context.Context, c *http.Client, gwURL, topic, callbackURL string, reader io.Reader) (*[]byte, int, *http.Header, error) {
+// publish sends a response to the Responses channel, dropping it if the
+// channel is full and DropOnOverflow is enabled, or if the Invoker is closed.
+func (i *Invoker) publish(res InvokerResponse) {
+	abandon, ok := i.beginPublish()
+	if !ok {
+		return
+	}
+	defer i.end()
+
+	if !i.DropOnOverflow {
+		select {
+		case i.Responses <- res:
+		case <-abandon:
+		}
+		return
+	}
+
+	select {
+	case i.Responses <- res:
+	default:
+		atomic.AddUint64(&i.dropped, 1)
+		if i.OnOverflow != nil {
+			i.OnOverflow(res)
+		}
+	}
+}
+
+// DroppedResponses gets the number of responses dropped on overflow.
+func (i *Invoker) DroppedResponses() uint64 {
+	return atomic.LoadUint64(&i.dropped)
+}
+
+// contentType gets the Content-Type of the messages of a topic.
+func (i *Invoker) contentType(topic string) string {
+	if contentType, ok := i.TopicContentTypes[topic]; ok {
+		return contentType
+	}
+	return i.DefaultContentType
+}
+
+func (i *Invoker) topicHeader() string {
+	if len(i.TopicHeader) == 0 {
+		return defaultTopicHeader
+	}
+	return i.TopicHeader
+}
+
+func (i *Invoker) logger() Logger {
+	if i.Logger == nil {
+		return defaultLogger
+	}
+	return i.Logger
+}
+
+// invokefunction posts a request to a function, authenticated with auth if
+// set. When discard is true, the response body is drained without being
+// buffered and an empty body is returned.
+func invokefunction(ctx context.Context, c *http.Client, auth ClientAuth, gwURL string, header http.Header, reader io.Reader, discard bool) (*[]byte, int, *http.Header, error) {
 
 	httpReq, err := http.NewRequest(http.MethodPost, gwURL, reader)
 	if err != nil {
@@ -109,12 +747,19 @@ func invokefunction(ctx context.Context, c *http.Client, gwURL, topic, callbackU
 		defer httpReq.Body.Close()
 	}
 
-	if topic != "" {
-		httpReq.Header.Add("X-Topic", topic)
+	// The header is shared with the other invocations of the message, and
+	// neither the client nor the transport modify it.
+	if header != nil {
+		httpReq.Header = header
 	}
-
-	if callbackURL != "" {
-		httpReq.Header.Add("X-Callback-Url", callbackURL)
+	if auth != nil {
+		// Authenticate a copy of the shared header.
+		if header != nil {
+			httpReq.Header = header.Clone()
+		}
+		if err := auth.Set(httpReq); err != nil {
+			return nil, http.StatusServiceUnavailable, nil, err
+		}
 	}
 
 	var body *[]byte
@@ -124,14 +769,19 @@ func invokefunction(ctx context.Context, c *http.Client, gwURL, topic, callbackU
 		return nil, http.StatusServiceUnavailable, nil, doErr
 	}
 
-	if res.Body != nil {
+	if res.Body != nil && discard {
 		defer res.Body.Close()
 
-		bytesOut, readErr := ioutil.ReadAll(res.Body)
-		if readErr != nil {
-			log.Printf("Error reading body")
-			return nil, http.StatusServiceUnavailable, nil, doErr
+		if _, readErr := io.Copy(ioutil.Discard, res.Body); readErr != nil {
+			return nil, http.StatusServiceUnavailable, nil, errors.Wrap(readErr, "error reading body")
+		}
+		body = &[]byte{}
+	} else if res.Body != nil {
+		defer res.Body.Close()
 
+		bytesOut, readErr := readBody(res.Body, res.ContentLength)
+		if readErr != nil {
+			return nil, http.StatusServiceUnavailable, nil, errors.Wrap(readErr, "error reading body")
 		}
 		body = &bytesOut
 	}
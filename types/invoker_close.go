@@ -0,0 +1,99 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+)
+
+// begin registers an in-flight operation, unless the Invoker is closed. It
+// returns the channel closed when Close gives up waiting.
+func (i *Invoker) begin() (<-chan struct{}, bool) {
+	i.lifecycleLock.Lock()
+	defer i.lifecycleLock.Unlock()
+
+	if i.closed {
+		return nil, false
+	}
+	if i.abandon == nil {
+		i.abandon = make(chan struct{})
+	}
+	i.inFlight++
+	return i.abandon, true
+}
+
+// beginPublish registers a send to the Responses channel, unless it is
+// closed. Sends are still accepted after Close while invocations are in
+// flight, so their responses are delivered.
+func (i *Invoker) beginPublish() (<-chan struct{}, bool) {
+	i.lifecycleLock.Lock()
+	defer i.lifecycleLock.Unlock()
+
+	if i.closed && i.inFlight == 0 {
+		return nil, false
+	}
+	if i.abandon == nil {
+		i.abandon = make(chan struct{})
+	}
+	i.inFlight++
+	return i.abandon, true
+}
+
+// end unregisters an in-flight operation. The last one to end after Close
+// closes the Responses channel.
+func (i *Invoker) end() {
+	i.lifecycleLock.Lock()
+	defer i.lifecycleLock.Unlock()
+
+	i.inFlight--
+	if i.closed && i.inFlight == 0 {
+		close(i.Responses)
+		if i.drained != nil {
+			close(i.drained)
+			i.drained = nil
+		}
+	}
+}
+
+// Close stops accepting new invocations, which fail with ErrInvokerClosed,
+// and waits for the in-flight invocations until ctx is done. The Responses
+// channel is closed once they have returned. If ctx is done first, Close
+// returns the number of abandoned invocations with the error of ctx: their
+// responses are discarded and Responses is closed when they return.
+func (i *Invoker) Close(ctx context.Context) (int, error) {
+	i.lifecycleLock.Lock()
+	if i.closed {
+		i.lifecycleLock.Unlock()
+		return 0, ErrInvokerClosed
+	}
+	i.closed = true
+
+	if i.inFlight == 0 {
+		close(i.Responses)
+		i.lifecycleLock.Unlock()
+		return 0, nil
+	}
+
+	drained := make(chan struct{})
+	i.drained = drained
+	i.lifecycleLock.Unlock()
+
+	select {
+	case <-drained:
+		return 0, nil
+	case <-ctx.Done():
+	}
+
+	i.lifecycleLock.Lock()
+	defer i.lifecycleLock.Unlock()
+
+	abandoned := i.inFlight
+	if abandoned == 0 {
+		return 0, nil
+	}
+	if i.abandon != nil {
+		close(i.abandon)
+	}
+	return abandoned, ctx.Err()
+}
@@ -0,0 +1,74 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_Invoker_CloseWaitsForInFlight(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	invoker := NewInvoker(srv.URL+"/function", "", srv.Client(), false, false)
+	topicMap := newTestTopicMap(map[string][]string{"topic1": {"echo"}})
+
+	responses := make(chan []InvokerResponse)
+	go func() {
+		received := []InvokerResponse{}
+		for res := range invoker.Responses {
+			received = append(received, res)
+		}
+		responses <- received
+	}()
+
+	go invoker.InvokeMessage(context.Background(), topicMap, "topic1", &Message{Body: []byte("hello")})
+	time.Sleep(10 * time.Millisecond)
+
+	abandoned, err := invoker.Close(context.Background())
+	if err != nil || abandoned != 0 {
+		t.Fatalf("Close - want: 0 abandoned, got: %d (%v)", abandoned, err)
+	}
+
+	received := <-responses
+	if len(received) != 1 || received[0].Status != http.StatusOK {
+		t.Errorf("Responses - want the in-flight response delivered, got: %+v", received)
+	}
+
+	res := invoker.InvokeFunction(context.Background(), "echo", &Message{Body: []byte("hello")}, nil)
+	if res.Error != ErrInvokerClosed {
+		t.Errorf("Invoke - want: %v, got: %v", ErrInvokerClosed, res.Error)
+	}
+}
+
+func Test_Invoker_CloseReportsAbandoned(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	invoker := NewInvoker(srv.URL+"/function", "", srv.Client(), false, false)
+	topicMap := newTestTopicMap(map[string][]string{"topic1": {"echo"}})
+
+	go invoker.InvokeMessage(context.Background(), topicMap, "topic1", &Message{Body: []byte("hello")})
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	abandoned, err := invoker.Close(ctx)
+	if err != context.DeadlineExceeded || abandoned != 1 {
+		t.Errorf("Close - want: 1 abandoned, got: %d (%v)", abandoned, err)
+	}
+}
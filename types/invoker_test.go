@@ -0,0 +1,530 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// collectResponses runs invoke and returns the responses it publishes.
+func collectResponses(invoker *Invoker, invoke func()) []InvokerResponse {
+	done := make(chan struct{})
+	go func() {
+		invoke()
+		close(done)
+	}()
+
+	responses := []InvokerResponse{}
+	for {
+		select {
+		case res := <-invoker.Responses:
+			responses = append(responses, res)
+		case <-done:
+			return responses
+		}
+	}
+}
+
+func newTestTopicMap(lookup map[string][]string) *TopicMap {
+	topicMap := NewTopicMap(nil)
+	topicMap.Sync(&lookup)
+	return &topicMap
+}
+
+func Test_InvokeMessage_SendsMetadataHeaders(t *testing.T) {
+	headers := make(chan http.Header, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/function/echo.openfaas-fn" {
+			t.Errorf("Path - want: %s, got: %s", "/function/echo.openfaas-fn", r.URL.Path)
+		}
+		headers <- r.Header
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	invoker := NewInvoker(srv.URL+"/function", "", srv.Client(), false, true)
+	invoker.AttributeHeaders = map[string]string{"partition": "X-Kafka-Partition"}
+	invoker.AttributeHeaderPrefix = "X-Attr-"
+
+	topicMap := newTestTopicMap(map[string][]string{"topic1": {"echo.openfaas-fn"}})
+	message := &Message{
+		Body:       []byte("hello"),
+		Key:        "key1",
+		ID:         "id1",
+		Timestamp:  time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		Attributes: map[string]string{"partition": "3", "tenant": "acme"},
+	}
+
+	responses := collectResponses(invoker, func() {
+		invoker.InvokeMessage(context.Background(), topicMap, "topic1", message)
+	})
+	if len(responses) != 1 || responses[0].Error != nil {
+		t.Fatalf("Responses - want 1 successful response, got: %+v", responses)
+	}
+
+	header := <-headers
+	want := map[string]string{
+		"X-Topic":             "topic1",
+		"X-Message-Key":       "key1",
+		"X-Message-Id":        "id1",
+		"X-Message-Timestamp": "2020-01-01T00:00:00Z",
+		"X-Kafka-Partition":   "3",
+		"X-Attr-Tenant":       "acme",
+	}
+	for name, value := range want {
+		if got := header.Get(name); got != value {
+			t.Errorf("Header %s - want: %s, got: %s", name, value, got)
+		}
+	}
+}
+
+func Test_InvokeMessage_EmptyBody(t *testing.T) {
+	invoker := NewInvoker("http://127.0.0.1:8080/function", "", http.DefaultClient, false, false)
+	topicMap := newTestTopicMap(map[string][]string{"topic1": {"echo"}})
+
+	responses := collectResponses(invoker, func() {
+		invoker.InvokeMessage(context.Background(), topicMap, "topic1", &Message{})
+	})
+	if len(responses) != 1 || responses[0].Error == nil {
+		t.Errorf("Responses - want 1 error response, got: %+v", responses)
+	}
+}
+
+func Test_InvokeMessage_CustomTopicHeader(t *testing.T) {
+	headers := make(chan http.Header, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header
+	}))
+	defer srv.Close()
+
+	invoker := NewInvoker(srv.URL+"/function", "", srv.Client(), false, true)
+	invoker.TopicHeader = "Kafka-Topic"
+	topicMap := newTestTopicMap(map[string][]string{"topic1": {"echo"}})
+
+	collectResponses(invoker, func() {
+		invoker.InvokeMessage(context.Background(), topicMap, "topic1", &Message{Body: []byte("hello")})
+	})
+
+	header := <-headers
+	if got := header.Get("Kafka-Topic"); got != "topic1" {
+		t.Errorf("Header Kafka-Topic - want: %s, got: %s", "topic1", got)
+	}
+	if got := header.Get("X-Topic"); got != "" {
+		t.Errorf("Header X-Topic - want empty, got: %s", got)
+	}
+}
+
+func Test_InvokeMessage_AddsFunctionHeaders(t *testing.T) {
+	modes := make(chan string, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		modes <- r.URL.Path + " " + r.Header.Get("X-Mode")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	invoker := NewInvoker(srv.URL+"/function", "", srv.Client(), false, false)
+	topicMap := NewTopicMap(nil)
+	topicMap.SyncWithMetadata(&map[string][]string{"topic1": {"compat"}}, map[string]FunctionMetadata{
+		"compat": {Headers: http.Header{"X-Mode": []string{"compat"}}},
+	})
+
+	collectResponses(invoker, func() {
+		invoker.InvokeMessage(context.Background(), &topicMap, "topic1", &Message{Body: []byte("hello")})
+	})
+
+	if got := <-modes; got != "/function/compat compat" {
+		t.Errorf("Header - want: %q, got: %q", "/function/compat compat", got)
+	}
+}
+
+func Test_InvokeMessage_FunctionAsyncOverride(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer srv.Close()
+
+	async, sync := true, false
+	topicMap := NewTopicMap(nil)
+	topicMap.SyncWithMetadata(&map[string][]string{"topic1": {"batch", "lookup", "echo"}}, map[string]FunctionMetadata{
+		"batch":  {Async: &async},
+		"lookup": {Async: &sync},
+	})
+
+	invoker := NewInvoker(srv.URL+"/async-function", "", srv.Client(), false, false)
+	invoker.AsyncGatewayURL = srv.URL + "/async-function"
+	invoker.SyncGatewayURL = srv.URL + "/function"
+
+	responses := collectResponses(invoker, func() {
+		invoker.InvokeMessage(context.Background(), &topicMap, "topic1", &Message{Body: []byte("hello")})
+	})
+
+	want := map[string]string{
+		"batch":  "/async-function/batch",
+		"lookup": "/function/lookup",
+		"echo":   "/async-function/echo",
+	}
+	for _, res := range responses {
+		if got := string(*res.Body); got != want[res.Function] {
+			t.Errorf("Route of %s - want: %s, got: %s", res.Function, want[res.Function], got)
+		}
+	}
+}
+
+func Test_InvokeMessage_TopicBindings(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path + " " + r.Header.Get("Content-Type")))
+	}))
+	defer srv.Close()
+
+	async, sync := true, false
+	topicMap := NewTopicMap(nil)
+	topicMap.SyncWithMetadata(&map[string][]string{"orders": {"batch", "echo"}, "payments": {"batch"}}, map[string]FunctionMetadata{
+		"batch": {Async: &sync, Bindings: map[string]TopicBinding{
+			"orders": {Topic: "orders", ContentType: "application/json", Async: &async},
+		}},
+	})
+
+	invoker := NewInvoker(srv.URL+"/function", "", srv.Client(), false, false)
+	invoker.AsyncGatewayURL = srv.URL + "/async-function"
+	invoker.SyncGatewayURL = srv.URL + "/function"
+	invoker.DefaultContentType = "text/plain"
+
+	want := map[string]string{
+		"orders batch":   "/async-function/batch application/json",
+		"orders echo":    "/function/echo text/plain",
+		"payments batch": "/function/batch text/plain",
+	}
+	for _, topic := range []string{"orders", "payments"} {
+		responses := collectResponses(invoker, func() {
+			invoker.InvokeMessage(context.Background(), &topicMap, topic, &Message{Body: []byte("hello")})
+		})
+		for _, res := range responses {
+			key := topic + " " + res.Function
+			if got := string(*res.Body); got != want[key] {
+				t.Errorf("Invocation of %s - want: %q, got: %q", key, want[key], got)
+			}
+		}
+	}
+}
+
+func Test_InvokeMessage_FunctionContentTypeAndTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/function/slow" {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+			return
+		}
+		w.Write([]byte(r.Header.Get("Content-Type")))
+	}))
+	defer srv.Close()
+
+	topicMap := NewTopicMap(nil)
+	topicMap.SyncWithMetadata(&map[string][]string{"topic1": {"json", "slow"}}, map[string]FunctionMetadata{
+		"json": {ContentType: "application/json"},
+		"slow": {Timeout: 20 * time.Millisecond},
+	})
+
+	invoker := NewInvoker(srv.URL+"/function", "", srv.Client(), false, false)
+	invoker.DefaultContentType = "text/plain"
+
+	responses := collectResponses(invoker, func() {
+		invoker.InvokeMessage(context.Background(), &topicMap, "topic1", &Message{Body: []byte("hello")})
+	})
+	if len(responses) != 2 {
+		t.Fatalf("Responses - want: 2, got: %d", len(responses))
+	}
+	for _, res := range responses {
+		switch res.Function {
+		case "json":
+			if res.Error != nil || string(*res.Body) != "application/json" {
+				t.Errorf("Content-Type - want: application/json, got: %v %v", res.Error, res.Body)
+			}
+		case "slow":
+			if res.Error == nil || res.Duration >= time.Second {
+				t.Errorf("Timeout - want the invocation cut after 20ms, got: %v after %s", res.Error, res.Duration)
+			}
+		}
+	}
+}
+
+func Test_InvokeMessage_DropsResponsesOnOverflow(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	invoker := NewInvoker(srv.URL+"/function", "", srv.Client(), false, false)
+	invoker.Responses = make(chan InvokerResponse, 1)
+	invoker.DropOnOverflow = true
+	overflowed := []string{}
+	invoker.OnOverflow = func(res InvokerResponse) {
+		overflowed = append(overflowed, res.Function)
+	}
+	topicMap := newTestTopicMap(map[string][]string{"topic1": {"fn1", "fn2", "fn3"}})
+
+	invoker.InvokeMessage(context.Background(), topicMap, "topic1", &Message{Body: []byte("hello")})
+
+	if len(invoker.Responses) != 1 {
+		t.Errorf("Responses - want: %d buffered, got: %d", 1, len(invoker.Responses))
+	}
+	if invoker.DroppedResponses() != 2 || len(overflowed) != 2 {
+		t.Errorf("Dropped - want: %d, got: %d (callback: %v)", 2, invoker.DroppedResponses(), overflowed)
+	}
+}
+
+func Test_InvokeFunction_DiscardResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("a large response"))
+	}))
+	defer srv.Close()
+
+	invoker := NewInvoker(srv.URL+"/function", "", srv.Client(), false, false)
+
+	var res InvokerResponse
+	collectResponses(invoker, func() {
+		res = invoker.InvokeFunction(context.Background(), "echo", &Message{Body: []byte("hello")}, nil, WithInvokeDiscardResponse())
+	})
+
+	if res.Error != nil || res.Status != http.StatusOK {
+		t.Fatalf("Response - want: %d, got: %d (%v)", http.StatusOK, res.Status, res.Error)
+	}
+	if res.Body == nil || len(*res.Body) != 0 {
+		t.Errorf("Body - want: empty, got: %v", res.Body)
+	}
+}
+
+func Test_InvokeMessage_TopicContentTypes(t *testing.T) {
+	contentTypes := make(chan string, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentTypes <- r.Header.Get("Content-Type")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	invoker := NewInvoker(srv.URL+"/function", "", srv.Client(), false, false)
+	invoker.TopicContentTypes = map[string]string{"avro": "application/avro"}
+	invoker.DefaultContentType = "application/json"
+	topicMap := newTestTopicMap(map[string][]string{"avro": {"fn1"}, "json": {"fn2"}})
+
+	collectResponses(invoker, func() {
+		invoker.InvokeMessage(context.Background(), topicMap, "avro", &Message{Body: []byte("hello")})
+		invoker.InvokeMessage(context.Background(), topicMap, "json", &Message{Body: []byte("{}")})
+	})
+
+	for _, want := range []string{"application/avro", "application/json"} {
+		if got := <-contentTypes; got != want {
+			t.Errorf("Content-Type - want: %s, got: %s", want, got)
+		}
+	}
+}
+
+func Test_InvokeMessageWithResults(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer srv.Close()
+
+	invoker := NewInvoker(srv.URL+"/function", "", srv.Client(), false, false)
+	topicMap := newTestTopicMap(map[string][]string{"topic1": {"fn1", "fn2"}})
+
+	var results []InvokerResponse
+	published := collectResponses(invoker, func() {
+		results = invoker.InvokeMessageWithResults(context.Background(), topicMap, "topic1", &Message{Body: []byte("hello")})
+	})
+
+	if len(results) != 2 || len(published) != 2 {
+		t.Fatalf("Responses - want: %d returned and published, got: %d and %d", 2, len(results), len(published))
+	}
+	got := map[string]bool{string(*results[0].Body): true, string(*results[1].Body): true}
+	if !got["/function/fn1"] || !got["/function/fn2"] {
+		t.Errorf("Results - want both functions, got: %v", got)
+	}
+}
+
+func Test_InvokeMessage_ResponseTransformer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":"hello"}`))
+	}))
+	defer srv.Close()
+
+	invoker := NewInvoker(srv.URL+"/function", "", srv.Client(), false, false)
+	invoker.ResponseTransformer = ResponseTransformerFunc(func(res InvokerResponse) InvokerResponse {
+		envelope := struct {
+			Data string `json:"data"`
+		}{}
+		if err := json.Unmarshal(*res.Body, &envelope); err != nil {
+			res.Error = err
+			return res
+		}
+		body := []byte(envelope.Data)
+		res.Body = &body
+		return res
+	})
+	topicMap := newTestTopicMap(map[string][]string{"topic1": {"echo"}})
+
+	responses := collectResponses(invoker, func() {
+		invoker.InvokeMessage(context.Background(), topicMap, "topic1", &Message{Body: []byte("hello")})
+	})
+
+	if len(responses) != 1 || string(*responses[0].Body) != "hello" {
+		t.Errorf("Response - want the unwrapped body %q, got: %+v", "hello", responses)
+	}
+}
+
+func Test_InvokeMessage_GeneratesMessageID(t *testing.T) {
+	ids := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ids <- r.Header.Get("X-Message-Id")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	invoker := NewInvoker(srv.URL+"/function", "", srv.Client(), false, false)
+	topicMap := newTestTopicMap(map[string][]string{"topic1": {"echo"}})
+	message := &Message{Body: []byte("hello")}
+
+	responses := collectResponses(invoker, func() {
+		invoker.InvokeMessage(context.Background(), topicMap, "topic1", message)
+	})
+
+	sent := <-ids
+	if len(sent) != 36 || sent[14] != '7' {
+		t.Errorf("X-Message-Id - want a UUIDv7, got: %q", sent)
+	}
+	if len(responses) != 1 || responses[0].MessageID != sent {
+		t.Errorf("MessageID - want: %q, got: %+v", sent, responses)
+	}
+	if len(message.ID) != 0 {
+		t.Errorf("Message - want unchanged, got ID %q", message.ID)
+	}
+}
+
+func Test_InvokeMessage_CachesMissingFunctions(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	invoker := NewInvoker(srv.URL+"/function", "", srv.Client(), false, false)
+	invoker.MissingFunctionTTL = time.Minute
+	missing := []string{}
+	invoker.OnMissingFunction = func(function string) {
+		missing = append(missing, function)
+	}
+	topicMap := newTestTopicMap(map[string][]string{"topic1": {"deleted"}})
+
+	responses := collectResponses(invoker, func() {
+		for i := 0; i < 3; i++ {
+			invoker.InvokeMessage(context.Background(), topicMap, "topic1", &Message{Body: []byte("hello")})
+		}
+	})
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("Calls - want: %d, got: %d", 1, got)
+	}
+	if len(missing) != 1 || missing[0] != "deleted" {
+		t.Errorf("OnMissingFunction - want: [deleted], got: %v", missing)
+	}
+	if len(responses) != 3 || responses[2].Error != ErrFunctionNotFound || responses[2].Status != http.StatusNotFound {
+		t.Errorf("Responses - want cached 404s, got: %+v", responses)
+	}
+}
+
+func Test_InvokeMessage_PropagatesHeadersToMetadata(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	invoker := NewInvoker(srv.URL+"/function", "", srv.Client(), false, false)
+	invoker.AttributeHeaderPrefix = "X-Attr-"
+	invoker.PropagateHeaders = []string{"x-attr-tenant", "X-Message-Key", "X-Correlation-Id"}
+	topicMap := newTestTopicMap(map[string][]string{"topic1": {"echo"}})
+
+	responses := collectResponses(invoker, func() {
+		invoker.InvokeMessage(context.Background(), topicMap, "topic1", &Message{
+			Body:       []byte("hello"),
+			Key:        "key1",
+			Attributes: map[string]string{"tenant": "acme"},
+		})
+	})
+	if len(responses) != 1 {
+		t.Fatalf("Responses - want: %d, got: %d", 1, len(responses))
+	}
+
+	want := map[string]string{"X-Attr-Tenant": "acme", "X-Message-Key": "key1"}
+	if got := responses[0].Metadata; len(got) != len(want) || got["X-Attr-Tenant"] != "acme" || got["X-Message-Key"] != "key1" {
+		t.Errorf("Metadata - want: %v, got: %v", want, got)
+	}
+}
+
+func Test_InvokeMessage_StreamsBodyReader(t *testing.T) {
+	type request struct {
+		body          string
+		contentLength int64
+	}
+	requests := make(chan request, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests <- request{body: string(body), contentLength: r.ContentLength}
+	}))
+	defer srv.Close()
+
+	invoker := NewInvoker(srv.URL+"/function", "", srv.Client(), false, false)
+
+	// A single function gets the body streamed, without a known length.
+	topicMap := newTestTopicMap(map[string][]string{"topic1": {"echo"}})
+	collectResponses(invoker, func() {
+		invoker.InvokeMessage(context.Background(), topicMap, "topic1", &Message{BodyReader: io.MultiReader(strings.NewReader("streamed"))})
+	})
+	if got := <-requests; got.body != "streamed" || got.contentLength != -1 {
+		t.Errorf("Streamed request - want: %q with unknown length, got: %+v", "streamed", got)
+	}
+
+	// Several functions need the body buffered, each gets a copy.
+	topicMap = newTestTopicMap(map[string][]string{"topic1": {"echo", "echo2"}})
+	collectResponses(invoker, func() {
+		invoker.InvokeMessage(context.Background(), topicMap, "topic1", &Message{BodyReader: strings.NewReader("buffered")})
+	})
+	for n := 0; n < 2; n++ {
+		if got := <-requests; got.body != "buffered" || got.contentLength != int64(len("buffered")) {
+			t.Errorf("Buffered request %d - want: %q, got: %+v", n, "buffered", got)
+		}
+	}
+}
+
+func Test_InvokeMessage_DiscardResponseBodies(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(strings.Repeat("x", 1<<16)))
+	}))
+	defer srv.Close()
+
+	invoker := NewInvoker(srv.URL+"/function", "", srv.Client(), false, false)
+	invoker.DiscardResponseBodies = true
+	topicMap := newTestTopicMap(map[string][]string{"topic1": {"echo"}})
+
+	responses := collectResponses(invoker, func() {
+		invoker.InvokeMessage(context.Background(), topicMap, "topic1", &Message{Body: []byte("hello")})
+	})
+	if len(responses) != 1 || responses[0].Status != http.StatusCreated {
+		t.Fatalf("Responses - want 1 response with status 201, got: %+v", responses)
+	}
+	if body := responses[0].Body; body == nil || len(*body) != 0 {
+		t.Errorf("Body - want empty, got: %d bytes", len(*body))
+	}
+}
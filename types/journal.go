@@ -0,0 +1,352 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	journalFilePrefix = "responses-"
+	journalFileSuffix = ".jsonl"
+	journalDayLayout  = "2006-01-02"
+)
+
+// JournalEntry is an InvokerResponse as stored in the Journal.
+type JournalEntry struct {
+	Time      time.Time `json:"time"`
+	Topic     string    `json:"topic,omitempty"`
+	Function  string    `json:"function,omitempty"`
+	MessageID string    `json:"messageId,omitempty"`
+	Tenant    string    `json:"tenant,omitempty"`
+	Status    int       `json:"status,omitempty"`
+	Body      []byte    `json:"body,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// JournalQuery filters the entries returned by Journal.Query. Empty fields
+// match any entry.
+type JournalQuery struct {
+	Topic    string
+	Function string
+	Tenant   string
+	Since    time.Time
+	Until    time.Time
+
+	// Limit is the maximum number of entries returned. Zero means no limit.
+	Limit int
+}
+
+// Journal is a ResponseSubscriber that stores every InvokerResponse, successful
+// or not, in daily files on disk. Files older than the retention period are
+// removed, so the journal can be used to investigate what a function returned
+// without an external log pipeline.
+type Journal struct {
+	// Logger reports the entries that can't be written. Defaults to the
+	// Logger of the controller the journal subscribes to.
+	Logger Logger
+
+	dir       string
+	retention time.Duration
+
+	lock sync.Mutex
+	file *os.File
+	day  string
+
+	now func() time.Time
+}
+
+// NewJournal creates a Journal that writes to dir and keeps the entries of
+// the last retention period. A zero retention keeps the entries forever.
+func NewJournal(dir string, retention time.Duration) (*Journal, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("unable to create journal directory: %s", err)
+	}
+
+	j := &Journal{
+		dir:       dir,
+		retention: retention,
+		now:       time.Now,
+	}
+
+	if err := j.prune(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// Response is triggered by the controller when a message is
+// received from the function invocation
+func (j *Journal) Response(res InvokerResponse) {
+	entry := JournalEntry{
+		Time:      j.now().UTC(),
+		Topic:     res.Topic,
+		Function:  res.Function,
+		MessageID: res.MessageID,
+		Tenant:    res.Tenant,
+		Status:    res.Status,
+	}
+	if res.Body != nil {
+		entry.Body = *res.Body
+	}
+	if res.Error != nil {
+		entry.Error = res.Error.Error()
+	}
+
+	if err := j.write(entry); err != nil {
+		j.logger().Errorf("Unable to write journal entry: %s", err)
+	}
+}
+
+// setDefaultLogger sets the Logger of the journal, unless it has one.
+func (j *Journal) setDefaultLogger(logger Logger) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	if j.Logger == nil {
+		j.Logger = logger
+	}
+}
+
+func (j *Journal) logger() Logger {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	if j.Logger == nil {
+		return defaultLogger
+	}
+	return j.Logger
+}
+
+func (j *Journal) write(entry JournalEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	day := entry.Time.Format(journalDayLayout)
+	if j.file == nil || j.day != day {
+		if err := j.rotate(day); err != nil {
+			return err
+		}
+	}
+
+	_, err = j.file.Write(line)
+	return err
+}
+
+// rotate closes the current file, opens the file of the given day and removes
+// the expired files. The journal lock must be held.
+func (j *Journal) rotate(day string) error {
+	if j.file != nil {
+		j.file.Close()
+		j.file = nil
+	}
+
+	file, err := os.OpenFile(j.path(day), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	j.file = file
+	j.day = day
+
+	return j.prune()
+}
+
+// prune removes the journal files older than the retention period.
+func (j *Journal) prune() error {
+	if j.retention <= 0 {
+		return nil
+	}
+
+	days, err := j.days()
+	if err != nil {
+		return err
+	}
+
+	oldest := j.now().UTC().Add(-j.retention).Format(journalDayLayout)
+	for _, day := range days {
+		if day < oldest {
+			if err := os.Remove(j.path(day)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// days returns the days with a journal file, sorted in ascending order.
+func (j *Journal) days() ([]string, error) {
+	files, err := ioutil.ReadDir(j.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var days []string
+	for _, file := range files {
+		name := file.Name()
+		if strings.HasPrefix(name, journalFilePrefix) && strings.HasSuffix(name, journalFileSuffix) {
+			days = append(days, strings.TrimSuffix(strings.TrimPrefix(name, journalFilePrefix), journalFileSuffix))
+		}
+	}
+	sort.Strings(days)
+	return days, nil
+}
+
+func (j *Journal) path(day string) string {
+	return filepath.Join(j.dir, journalFilePrefix+day+journalFileSuffix)
+}
+
+// Query returns the journal entries matching the query in chronological order.
+func (j *Journal) Query(query JournalQuery) ([]JournalEntry, error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	days, err := j.days()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []JournalEntry{}
+	for _, day := range days {
+		if !query.Since.IsZero() && day < query.Since.UTC().Format(journalDayLayout) {
+			continue
+		}
+		if !query.Until.IsZero() && day > query.Until.UTC().Format(journalDayLayout) {
+			break
+		}
+
+		done, err := j.scan(day, query, &entries)
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			break
+		}
+	}
+
+	return entries, nil
+}
+
+// scan appends the entries of a day matching the query and returns true when
+// the query limit has been reached.
+func (j *Journal) scan(day string, query JournalQuery, entries *[]JournalEntry) (bool, error) {
+	file, err := os.Open(j.path(day))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var entry JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if !query.matches(entry) {
+			continue
+		}
+		*entries = append(*entries, entry)
+		if query.Limit > 0 && len(*entries) >= query.Limit {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+func (q JournalQuery) matches(entry JournalEntry) bool {
+	if len(q.Topic) > 0 && q.Topic != entry.Topic {
+		return false
+	}
+	if len(q.Function) > 0 && q.Function != entry.Function {
+		return false
+	}
+	if len(q.Tenant) > 0 && q.Tenant != entry.Tenant {
+		return false
+	}
+	if !q.Since.IsZero() && entry.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && entry.Time.After(q.Until) {
+		return false
+	}
+	return true
+}
+
+// ServeHTTP returns the entries matching the "topic", "function", "tenant",
+// "since", "until" (RFC3339) and "limit" query parameters as JSON.
+func (j *Journal) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	values := r.URL.Query()
+	query := JournalQuery{
+		Topic:    values.Get("topic"),
+		Function: values.Get("function"),
+		Tenant:   values.Get("tenant"),
+	}
+
+	var err error
+	if v := values.Get("since"); len(v) > 0 {
+		if query.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, fmt.Sprintf("invalid since: %s", err), http.StatusBadRequest)
+			return
+		}
+	}
+	if v := values.Get("until"); len(v) > 0 {
+		if query.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, fmt.Sprintf("invalid until: %s", err), http.StatusBadRequest)
+			return
+		}
+	}
+	if v := values.Get("limit"); len(v) > 0 {
+		if query.Limit, err = strconv.Atoi(v); err != nil {
+			http.Error(w, fmt.Sprintf("invalid limit: %s", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	entries, err := j.Query(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(entries)
+}
+
+// Close closes the current journal file.
+func (j *Journal) Close() error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
@@ -0,0 +1,104 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func Test_Journal_QueryAndRetention(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	journal, err := NewJournal(dir, 48*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+
+	now := time.Date(2020, 1, 10, 12, 0, 0, 0, time.UTC)
+	journal.now = func() time.Time { return now.Add(-72 * time.Hour) }
+	body := []byte("old")
+	journal.Response(InvokerResponse{Topic: "topic1", Function: "echo", Status: 200, Body: &body})
+
+	journal.now = func() time.Time { return now }
+	body = []byte("new")
+	journal.Response(InvokerResponse{Topic: "topic1", Function: "echo", Status: 200, Body: &body})
+	journal.Response(InvokerResponse{Topic: "topic1", Function: "figlet", Error: fmt.Errorf("timeout")})
+
+	entries, err := journal.Query(JournalQuery{Function: "echo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("Entries - want: %d, got: %d", 1, len(entries))
+	}
+	if string(entries[0].Body) != "new" {
+		t.Errorf("Body - want: %s, got: %s", "new", string(entries[0].Body))
+	}
+
+	entries, err = journal.Query(JournalQuery{Topic: "topic1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Entries - want: %d, got: %d", 2, len(entries))
+	}
+	if entries[1].Error != "timeout" {
+		t.Errorf("Error - want: %s, got: %s", "timeout", entries[1].Error)
+	}
+}
+
+func Test_Journal_ControlHandlerAndLogger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	journal, err := NewJournal(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+
+	logger := NewStdLogger(LevelError)
+	c := NewController(nil, &ControllerConfig{
+		GatewayURL:      "http://127.0.0.1:8080",
+		RebuildInterval: time.Hour,
+		Logger:          logger,
+	}).(*controller)
+	defer c.Close()
+	c.Subscribe(journal)
+	if journal.logger() != logger {
+		t.Errorf("Logger - want the logger of the controller")
+	}
+
+	body := []byte("ok")
+	journal.Response(InvokerResponse{Topic: "topic1", Function: "echo", Status: 200, Body: &body})
+
+	handler := NewControlHandler(c, ControlOptions{Token: "secret", Journal: journal})
+	req := httptest.NewRequest(http.MethodGet, "/journal?function=echo", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	var entries []JournalEntry
+	if err := json.Unmarshal(rr.Body.Bytes(), &entries); err != nil {
+		t.Fatalf("Body - want JSON entries, got: %d %s", rr.Code, rr.Body.String())
+	}
+	if len(entries) != 1 || string(entries[0].Body) != "ok" {
+		t.Errorf("Entries - want the response of echo, got: %+v", entries)
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import "context"
+
+type keyTurnKey struct{}
+
+// takeKeyTurn returns the place of message among the messages of topic
+// sharing its key, or nil if OrderedByKey is disabled or the message has no
+// key.
+func (i *Invoker) takeKeyTurn(topic string, message *Message) *sequenceTicket {
+	if !i.OrderedByKey || message == nil || len(message.Key) == 0 {
+		return nil
+	}
+	return i.keys.take(topic + "\x00" + message.Key)
+}
+
+// withKeyTurn returns a copy of ctx carrying turn, taken when the message was
+// received so that its place is kept while it is queued.
+func withKeyTurn(ctx context.Context, turn *sequenceTicket) context.Context {
+	if turn == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, keyTurnKey{}, turn)
+}
+
+func keyTurnFrom(ctx context.Context) *sequenceTicket {
+	turn, _ := ctx.Value(keyTurnKey{}).(*sequenceTicket)
+	return turn
+}
+
+// keyTurnReady returns true if the message of ctx has no key turn or has its
+// turn.
+func keyTurnReady(ctx context.Context) bool {
+	if ctx == nil {
+		return true
+	}
+	turn := keyTurnFrom(ctx)
+	return turn == nil || turn.ready()
+}
+
+// finishKeyTurn gives the turn of the message of ctx to the next message
+// sharing its key, once its own turn has come, when it won't be invoked.
+func finishKeyTurn(ctx context.Context) {
+	if turn := keyTurnFrom(ctx); turn != nil {
+		go turn.done()
+	}
+}
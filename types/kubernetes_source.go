@@ -0,0 +1,359 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/openfaas/faas-provider/types"
+)
+
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	functionsAPI      = "/apis/openfaas.com/v1"
+
+	// maxWatchBackoff bounds the delay before a failed watch is restarted.
+	maxWatchBackoff = 30 * time.Second
+
+	// defaultKubernetesRequestTimeout limits the list requests when no
+	// RequestTimeout is given.
+	defaultKubernetesRequestTimeout = 30 * time.Second
+)
+
+// errWatchExpired is returned when the resourceVersion of a watch is too old
+// (410 Gone), so the functions must be listed again.
+var errWatchExpired = fmt.Errorf("the resource version of the watch expired")
+
+// FunctionWatcher is a FunctionSource notifying the changes of its
+// functions, so that the topic map is rebuilt as soon as they change rather
+// than on the next RebuildInterval.
+type FunctionWatcher interface {
+	FunctionSource
+
+	// Watch calls changed after each change of the functions, until stop is
+	// closed.
+	Watch(stop <-chan struct{}, changed func())
+}
+
+// KubernetesFunctionSource lists the OpenFaaS Function custom resources
+// from the Kubernetes API server instead of the gateway, and watches them
+// to rebuild the topic map within seconds of a deploy. The service account
+// must be allowed to list and watch functions.openfaas.com.
+type KubernetesFunctionSource struct {
+	// APIServer is the URL of the Kubernetes API server.
+	APIServer string
+
+	// Token is the bearer token of the service account, if set.
+	Token string
+
+	// Auth authenticates the requests, taking precedence over Token, e.g.
+	// with a TokenAuth reading a projected token rotated on disk.
+	Auth ClientAuth
+
+	// Client requests the API server. The watches are restarted when its
+	// timeout ends them.
+	Client *http.Client
+
+	// RequestTimeout limits each list request. Defaults to 30s. The watches
+	// are not limited.
+	RequestTimeout time.Duration
+
+	// Logger reports the failed watches. Defaults to the standard log
+	// package.
+	Logger Logger
+}
+
+// NewInClusterFunctionSource creates a KubernetesFunctionSource from the
+// service account of the pod the connector runs in. The token is read again
+// when it is rotated on disk.
+func NewInClusterFunctionSource() (*KubernetesFunctionSource, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if len(host) == 0 || len(port) == 0 {
+		return nil, fmt.Errorf("not running in a Kubernetes cluster, KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set")
+	}
+
+	tokens := &FileTokenSource{Path: serviceAccountDir + "/token"}
+	if _, err := tokens.Token(); err != nil {
+		return nil, fmt.Errorf("unable to read the service account token: %s", err)
+	}
+	ca, err := ioutil.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the service account CA: %s", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("invalid service account CA")
+	}
+
+	return &KubernetesFunctionSource{
+		APIServer: "https://" + net.JoinHostPort(host, port),
+		Auth:      &TokenAuth{TokenSource: tokens},
+		Client: &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{RootCAs: roots},
+			},
+		},
+	}, nil
+}
+
+// functionResource is the part of a Function custom resource mapped to the
+// topic map.
+type functionResource struct {
+	Metadata struct {
+		Name            string `json:"name"`
+		Namespace       string `json:"namespace"`
+		ResourceVersion string `json:"resourceVersion,omitempty"`
+	} `json:"metadata"`
+	Spec struct {
+		Name        string            `json:"name"`
+		Annotations map[string]string `json:"annotations,omitempty"`
+		Labels      map[string]string `json:"labels,omitempty"`
+	} `json:"spec"`
+}
+
+func (f functionResource) status() types.FunctionStatus {
+	name := f.Spec.Name
+	if len(name) == 0 {
+		name = f.Metadata.Name
+	}
+	status := types.FunctionStatus{Name: name, Namespace: f.Metadata.Namespace}
+	if f.Spec.Annotations != nil {
+		status.Annotations = &f.Spec.Annotations
+	}
+	if f.Spec.Labels != nil {
+		status.Labels = &f.Spec.Labels
+	}
+	return status
+}
+
+// Namespaces lists the namespaces holding Function resources.
+func (s *KubernetesFunctionSource) Namespaces() ([]string, error) {
+	functions, _, err := s.list(functionsAPI + "/functions")
+	if err != nil {
+		return nil, err
+	}
+
+	namespaces := []string{}
+	for _, function := range functions {
+		if !contains(namespaces, function.Metadata.Namespace) {
+			namespaces = append(namespaces, function.Metadata.Namespace)
+		}
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
+
+// Functions lists the Function resources of namespace.
+func (s *KubernetesFunctionSource) Functions(namespace string) ([]types.FunctionStatus, error) {
+	functions, _, err := s.list(fmt.Sprintf("%s/namespaces/%s/functions", functionsAPI, url.PathEscape(namespace)))
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]types.FunctionStatus, 0, len(functions))
+	for _, function := range functions {
+		statuses = append(statuses, function.status())
+	}
+	return statuses, nil
+}
+
+// list lists the Function resources at path, with the resourceVersion of the
+// list to watch the changes from.
+func (s *KubernetesFunctionSource) list(path string) ([]functionResource, string, error) {
+	timeout := s.RequestTimeout
+	if timeout <= 0 {
+		timeout = defaultKubernetesRequestTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	res, err := s.get(ctx, path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+
+	var list struct {
+		Metadata struct {
+			ResourceVersion string `json:"resourceVersion"`
+		} `json:"metadata"`
+		Items []functionResource `json:"items"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&list); err != nil {
+		return nil, "", fmt.Errorf("unable to decode the functions: %s", err)
+	}
+	return list.Items, list.Metadata.ResourceVersion, nil
+}
+
+// Watch watches the Function resources of every namespace and calls
+// changed for each event. The functions are listed first, and watched from
+// the resourceVersion of the list; they are listed again when it expires. A
+// watch ended by the API server is resumed right away, and a failed one is
+// restarted with a backoff.
+func (s *KubernetesFunctionSource) Watch(stop <-chan struct{}, changed func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	backoff := time.Second
+	resourceVersion := ""
+	listed := false
+	for {
+		var err error
+		if len(resourceVersion) == 0 {
+			if _, resourceVersion, err = s.list(functionsAPI + "/functions"); err == nil {
+				if listed {
+					// the functions may have changed while they were not
+					// watched
+					changed()
+				}
+				listed = true
+			}
+		}
+		if err == nil {
+			resourceVersion, err = s.watch(ctx, resourceVersion, changed)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		switch {
+		case err == nil:
+			backoff = time.Second
+			continue
+		case err == errWatchExpired:
+			s.logger().Debugf("Watch of the functions expired, listing them again")
+			resourceVersion = ""
+			continue
+		}
+
+		s.logger().Warnf("Watch of the functions failed, restarting in %s: %s", backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff *= 2
+		if backoff > maxWatchBackoff {
+			backoff = maxWatchBackoff
+		}
+	}
+}
+
+// watch streams the events of one watch request from resourceVersion until
+// it ends, and returns the resourceVersion of the last event to resume from.
+func (s *KubernetesFunctionSource) watch(ctx context.Context, resourceVersion string, changed func()) (string, error) {
+	query := url.Values{}
+	query.Set("watch", "true")
+	query.Set("allowWatchBookmarks", "true")
+	query.Set("resourceVersion", resourceVersion)
+
+	res, err := s.get(ctx, functionsAPI+"/functions?"+query.Encode())
+	if err != nil {
+		if statusErr, ok := err.(*kubernetesStatusError); ok && statusErr.status == http.StatusGone {
+			return "", errWatchExpired
+		}
+		return resourceVersion, err
+	}
+	defer res.Body.Close()
+
+	decoder := json.NewDecoder(res.Body)
+	for {
+		var event struct {
+			Type   string `json:"type"`
+			Object struct {
+				Code     int `json:"code"`
+				Metadata struct {
+					ResourceVersion string `json:"resourceVersion"`
+				} `json:"metadata"`
+			} `json:"object"`
+		}
+		if err := decoder.Decode(&event); err != nil {
+			if err == io.EOF || ctx.Err() != nil {
+				return resourceVersion, nil
+			}
+			return resourceVersion, err
+		}
+
+		if event.Type == "ERROR" {
+			if event.Object.Code == http.StatusGone {
+				return "", errWatchExpired
+			}
+			return resourceVersion, fmt.Errorf("the API server ended the watch with status %d", event.Object.Code)
+		}
+		if len(event.Object.Metadata.ResourceVersion) > 0 {
+			resourceVersion = event.Object.Metadata.ResourceVersion
+		}
+		if event.Type != "BOOKMARK" {
+			changed()
+		}
+	}
+}
+
+// kubernetesStatusError is an unexpected status returned by the API server.
+type kubernetesStatusError struct {
+	status int
+	body   string
+}
+
+func (e *kubernetesStatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d from the API server: %s", e.status, e.body)
+}
+
+func (s *KubernetesFunctionSource) get(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(s.APIServer, "/")+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if s.Auth != nil {
+		if err := s.Auth.Set(req); err != nil {
+			return nil, err
+		}
+	} else if len(s.Token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		return nil, &kubernetesStatusError{status: res.StatusCode, body: strings.TrimSpace(string(body))}
+	}
+	return res, nil
+}
+
+func (s *KubernetesFunctionSource) logger() Logger {
+	if s.Logger == nil {
+		return defaultLogger
+	}
+	return s.Logger
+}
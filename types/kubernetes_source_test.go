@@ -0,0 +1,188 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_Controller_KubernetesFunctionSource(t *testing.T) {
+	var topic atomic.Value
+	topic.Store("orders")
+	events := make(chan string, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/apis/openfaas.com/v1/functions":
+			if r.URL.Query().Get("watch") != "true" {
+				w.Write([]byte(`{"items":[{"metadata":{"name":"echo","namespace":"openfaas-fn"}}]}`))
+				return
+			}
+			w.(http.Flusher).Flush()
+			for {
+				select {
+				case event := <-events:
+					fmt.Fprintf(w, `{"type":%q,"object":{}}`+"\n", event)
+					w.(http.Flusher).Flush()
+				case <-r.Context().Done():
+					return
+				}
+			}
+		case "/apis/openfaas.com/v1/namespaces/openfaas-fn/functions":
+			fmt.Fprintf(w, `{"items":[{"metadata":{"name":"echo","namespace":"openfaas-fn"},
+				"spec":{"name":"echo","annotations":{"topic":%q}}}]}`, topic.Load())
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewController(nil, &ControllerConfig{
+		GatewayURL:      srv.URL,
+		RebuildInterval: time.Hour,
+		FunctionSource:  &KubernetesFunctionSource{APIServer: srv.URL, Token: "token", Client: srv.Client()},
+		Logger:          NewStdLogger(LevelError),
+	}).(*controller)
+	defer c.Close()
+
+	builder := c.StartMapBuilder()
+	defer builder.Stop()
+	waitFor(t, func() bool {
+		return len(c.TopicMap.Match("orders")) == 1
+	})
+
+	topic.Store("payments")
+	events <- "MODIFIED"
+	waitFor(t, func() bool {
+		return len(c.TopicMap.Match("payments")) == 1 && len(c.TopicMap.Match("orders")) == 0
+	})
+}
+
+func Test_KubernetesFunctionSource_WatchesFromListVersion(t *testing.T) {
+	var lists int32
+	watches := make(chan string, 10)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("watch") != "true" {
+			n := atomic.AddInt32(&lists, 1)
+			fmt.Fprintf(w, `{"metadata":{"resourceVersion":"%d0"},"items":[]}`, n)
+			return
+		}
+
+		version := r.URL.Query().Get("resourceVersion")
+		watches <- version
+		switch version {
+		case "10":
+			w.Write([]byte(`{"type":"ERROR","object":{"kind":"Status","code":410}}` + "\n"))
+		case "20":
+			// the watch ends cleanly after an event
+			w.Write([]byte(`{"type":"MODIFIED","object":{"metadata":{"resourceVersion":"21"}}}` + "\n"))
+		default:
+			<-r.Context().Done()
+		}
+	}))
+	defer srv.Close()
+
+	source := &KubernetesFunctionSource{APIServer: srv.URL, Client: srv.Client(), Logger: NewStdLogger(LevelError)}
+	var changes int32
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		source.Watch(stop, func() { atomic.AddInt32(&changes, 1) })
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	// The expired watch lists the functions again, and the watch ended by
+	// the server resumes from its last event without waiting.
+	for _, want := range []string{"10", "20", "21"} {
+		select {
+		case got := <-watches:
+			if got != want {
+				t.Fatalf("Watch resourceVersion - want: %s, got: %s", want, got)
+			}
+		case <-time.After(500 * time.Millisecond):
+			t.Fatalf("want a watch from resourceVersion %s", want)
+		}
+	}
+	if got := atomic.LoadInt32(&lists); got != 2 {
+		t.Errorf("Lists - want: 2, got: %d", got)
+	}
+	// One change for the list after the expired watch, one for the event.
+	if got := atomic.LoadInt32(&changes); got != 2 {
+		t.Errorf("Changes - want: 2, got: %d", got)
+	}
+}
+
+func Test_KubernetesFunctionSource_ListTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	source := &KubernetesFunctionSource{APIServer: srv.URL, Client: srv.Client(), RequestTimeout: 20 * time.Millisecond}
+	if _, err := source.Functions("openfaas-fn"); err == nil {
+		t.Error("want an error once the RequestTimeout is over")
+	}
+}
+
+func Test_KubernetesFunctionSource_RotatedToken(t *testing.T) {
+	var token atomic.Value
+	token.Store("token1")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token.Load().(string) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"items":[{"metadata":{"name":"echo","namespace":"openfaas-fn"}}]}`))
+	}))
+	defer srv.Close()
+
+	file, err := ioutil.TempFile("", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+	if err := ioutil.WriteFile(file.Name(), []byte("token1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	source := &KubernetesFunctionSource{
+		APIServer: srv.URL,
+		Auth:      &TokenAuth{TokenSource: &FileTokenSource{Path: file.Name()}},
+		Client:    srv.Client(),
+	}
+	if _, err := source.Namespaces(); err != nil {
+		t.Fatal(err)
+	}
+
+	token.Store("token2")
+	if err := ioutil.WriteFile(file.Name(), []byte("token2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	rotated := time.Now().Add(time.Minute)
+	if err := os.Chtimes(file.Name(), rotated, rotated); err != nil {
+		t.Fatal(err)
+	}
+	if namespaces, err := source.Namespaces(); err != nil || len(namespaces) != 1 {
+		t.Errorf("Namespaces - want the rotated token used, got: %v (%v)", namespaces, err)
+	}
+}
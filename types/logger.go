@@ -0,0 +1,105 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+// LogLevel is the severity of a log message.
+type LogLevel int32
+
+const (
+	// LevelDebug is used for per-invocation messages.
+	LevelDebug LogLevel = iota
+	// LevelInfo is used for messages about the connector activity.
+	LevelInfo
+	// LevelWarn is used for recoverable problems.
+	LevelWarn
+	// LevelError is used for failures.
+	LevelError
+)
+
+var levelNames = map[LogLevel]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+}
+
+func (l LogLevel) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("LogLevel(%d)", int32(l))
+}
+
+// ParseLogLevel returns the LogLevel of a name ("debug", "info", "warn" or "error").
+func ParseLogLevel(name string) (LogLevel, error) {
+	for level, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, nil
+		}
+	}
+	return LevelDebug, fmt.Errorf("unknown log level: %q", name)
+}
+
+// Logger is used by the controller and the invoker to log their activity, so
+// connectors can integrate the SDK with their own structured logging.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// StdLogger is a Logger that writes the messages above its level using the
+// standard log package.
+type StdLogger struct {
+	level int32
+}
+
+// NewStdLogger creates a StdLogger that discards messages below level.
+func NewStdLogger(level LogLevel) *StdLogger {
+	return &StdLogger{level: int32(level)}
+}
+
+// SetLevel changes the minimum level of the messages written by the logger.
+func (l *StdLogger) SetLevel(level LogLevel) {
+	atomic.StoreInt32(&l.level, int32(level))
+}
+
+// Level returns the minimum level of the messages written by the logger.
+func (l *StdLogger) Level() LogLevel {
+	return LogLevel(atomic.LoadInt32(&l.level))
+}
+
+func (l *StdLogger) Debugf(format string, args ...interface{}) {
+	l.printf(LevelDebug, format, args...)
+}
+
+func (l *StdLogger) Infof(format string, args ...interface{}) {
+	l.printf(LevelInfo, format, args...)
+}
+
+func (l *StdLogger) Warnf(format string, args ...interface{}) {
+	l.printf(LevelWarn, format, args...)
+}
+
+func (l *StdLogger) Errorf(format string, args ...interface{}) {
+	l.printf(LevelError, format, args...)
+}
+
+func (l *StdLogger) printf(level LogLevel, format string, args ...interface{}) {
+	if level < l.Level() {
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// defaultLogger is used when no Logger is configured.
+var defaultLogger Logger = NewStdLogger(LevelDebug)
@@ -9,8 +9,71 @@ import (
 	"time"
 )
 
+const (
+	defaultMaxIdleConns        = 100
+	defaultMaxIdleConnsPerHost = 100
+	defaultIdleConnTimeout     = 120 * time.Millisecond
+)
+
+// ClientOptions tunes the transport of the HTTP client. Zero values use the
+// defaults of MakeClient.
+type ClientOptions struct {
+	// MaxIdleConns controls the maximum number of idle connections across all hosts.
+	MaxIdleConns int
+
+	// MaxIdleConnsPerHost controls the maximum idle connections to keep per host.
+	MaxIdleConnsPerHost int
+
+	// MaxConnsPerHost limits the total number of connections per host. Zero means no limit.
+	MaxConnsPerHost int
+
+	// IdleConnTimeout is the maximum amount of time an idle connection will remain idle before closing itself.
+	IdleConnTimeout time.Duration
+
+	// DialTimeout is the maximum amount of time a dial will wait for a connect to complete. Zero uses the timeout
+	// given to MakeClient.
+	DialTimeout time.Duration
+
+	// TLSHandshakeTimeout is the maximum amount of time to wait for a TLS handshake. Zero means no limit other
+	// than the timeout given to MakeClient.
+	TLSHandshakeTimeout time.Duration
+
+	// ResponseHeaderTimeout is the maximum amount of time to wait for the response headers once the request is
+	// written. Zero means no limit other than the timeout given to MakeClient.
+	ResponseHeaderTimeout time.Duration
+
+	// EnableHTTP2 makes the transport attempt HTTP/2 when the gateway supports it.
+	EnableHTTP2 bool
+}
+
 // MakeClient returns a http.Client with a timeout for connection establishing and request handling
 func MakeClient(timeout time.Duration) *http.Client {
+	return MakeClientWithOptions(timeout, ClientOptions{})
+}
+
+// MakeClientWithOptions returns a http.Client like MakeClient, with its
+// transport tuned by options.
+func MakeClientWithOptions(timeout time.Duration, options ClientOptions) *http.Client {
+	maxIdleConns := options.MaxIdleConns
+	if maxIdleConns <= 0 {
+		maxIdleConns = defaultMaxIdleConns
+	}
+
+	maxIdleConnsPerHost := options.MaxIdleConnsPerHost
+	if maxIdleConnsPerHost <= 0 {
+		maxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	}
+
+	idleConnTimeout := options.IdleConnTimeout
+	if idleConnTimeout <= 0 {
+		idleConnTimeout = defaultIdleConnTimeout
+	}
+
+	dialTimeout := options.DialTimeout
+	if dialTimeout <= 0 {
+		dialTimeout = timeout
+	}
+
 	return &http.Client{
 		Transport: &http.Transport{
 			Proxy: http.ProxyFromEnvironment,
@@ -18,12 +81,16 @@ func MakeClient(timeout time.Duration) *http.Client {
 				// Timeout is the maximum amount of time a dial will wait for
 				// a connect to complete. If Deadline is also set, it may fail
 				// earlier.
-				Timeout:   timeout,
+				Timeout:   dialTimeout,
 				KeepAlive: 10 * time.Second,
 			}).DialContext,
-			MaxIdleConns:        100,
-			MaxIdleConnsPerHost: 100,
-			IdleConnTimeout:     120 * time.Millisecond,
+			MaxIdleConns:          maxIdleConns,
+			MaxIdleConnsPerHost:   maxIdleConnsPerHost,
+			MaxConnsPerHost:       options.MaxConnsPerHost,
+			IdleConnTimeout:       idleConnTimeout,
+			TLSHandshakeTimeout:   options.TLSHandshakeTimeout,
+			ResponseHeaderTimeout: options.ResponseHeaderTimeout,
+			ForceAttemptHTTP2:     options.EnableHTTP2,
 		},
 		// Timeout specifies a time limit for requests made by this
 		// Client. The timeout includes connection time, any
@@ -0,0 +1,28 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func Test_MakeClientWithOptions_SplitsTimeouts(t *testing.T) {
+	client := MakeClientWithOptions(time.Minute, ClientOptions{
+		TLSHandshakeTimeout:   3 * time.Second,
+		ResponseHeaderTimeout: 10 * time.Second,
+	})
+
+	if client.Timeout != time.Minute {
+		t.Errorf("Timeout - want: %s, got: %s", time.Minute, client.Timeout)
+	}
+	transport := client.Transport.(*http.Transport)
+	if transport.TLSHandshakeTimeout != 3*time.Second {
+		t.Errorf("TLSHandshakeTimeout - want: %s, got: %s", 3*time.Second, transport.TLSHandshakeTimeout)
+	}
+	if transport.ResponseHeaderTimeout != 10*time.Second {
+		t.Errorf("ResponseHeaderTimeout - want: %s, got: %s", 10*time.Second, transport.ResponseHeaderTimeout)
+	}
+}
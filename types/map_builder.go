@@ -0,0 +1,114 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MapBuilder controls the loop rebuilding the topic map started by
+// StartMapBuilder.
+type MapBuilder interface {
+	// Stop stops rebuilding the topic map periodically. The topic map built
+	// last is kept, and can still be rebuilt with RefreshTopicMap.
+	Stop()
+
+	// LastSync returns the time of the last successful rebuild of the topic
+	// map, zero if none, and the error of the last rebuild, nil if it
+	// succeeded.
+	LastSync() (time.Time, error)
+
+	// Done is closed once the loop has returned, after Stop or when the
+	// controller is stopped.
+	Done() <-chan struct{}
+}
+
+// mapBuilder is the MapBuilder of a controller.
+type mapBuilder struct {
+	controller *controller
+	stop       chan struct{}
+	stopOnce   sync.Once
+	done       chan struct{}
+}
+
+func (b *mapBuilder) Stop() {
+	b.stopOnce.Do(func() {
+		close(b.stop)
+	})
+}
+
+func (b *mapBuilder) LastSync() (time.Time, error) {
+	var last time.Time
+	if nanos := atomic.LoadInt64(&b.controller.lastSync); nanos > 0 {
+		last = time.Unix(0, nanos)
+	}
+
+	err, _ := b.controller.syncErr.Load().(syncError)
+	return last, err.err
+}
+
+func (b *mapBuilder) Done() <-chan struct{} {
+	return b.done
+}
+
+// syncError holds the error of the last rebuild of the topic map, as an
+// atomic.Value can't hold nil.
+type syncError struct {
+	err error
+}
+
+// StartMapBuilder begins to build the map of function->topic like
+// BeginMapBuilder, and returns a handle to monitor and stop the loop.
+func (c *controller) StartMapBuilder() MapBuilder {
+	source := c.newTopicSource()
+
+	c.Lock.Lock()
+	c.topicSource = source
+	c.Lock.Unlock()
+
+	builder := &mapBuilder{
+		controller: c,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+
+	changes := c.watchFunctions(builder.stop)
+
+	ticker := newRebuildTicker(c.Config.RebuildInterval, c.Config.RebuildJitter)
+	go func() {
+		defer close(builder.done)
+		c.synchronizeLookups(ticker, source, c.TopicMap, changes, builder.stop)
+	}()
+	return builder
+}
+
+// watchFunctions watches the FunctionSource if it is a FunctionWatcher, and
+// returns a channel signalling its changes, coalesced while a rebuild is in
+// progress. It returns nil otherwise.
+func (c *controller) watchFunctions(stop <-chan struct{}) <-chan struct{} {
+	watcher, ok := c.Config.FunctionSource.(FunctionWatcher)
+	if !ok || c.Config.TopicSource != nil {
+		return nil
+	}
+
+	changes := make(chan struct{}, 1)
+	watchStop := make(chan struct{})
+	go func() {
+		select {
+		case <-stop:
+		case <-c.stop:
+		}
+		close(watchStop)
+	}()
+
+	go watcher.Watch(watchStop, func() {
+		select {
+		case changes <- struct{}{}:
+		default:
+		}
+	})
+	return changes
+}
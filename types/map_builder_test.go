@@ -0,0 +1,68 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_Controller_StartMapBuilder(t *testing.T) {
+	var failing int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`[{"name":"echo","annotations":{"topic":"orders"}}]`))
+	}))
+	defer srv.Close()
+
+	c := NewController(nil, &ControllerConfig{
+		GatewayURL:       srv.URL,
+		RebuildInterval:  20 * time.Millisecond,
+		SyncRetryBackoff: time.Hour,
+		Namespace:        "openfaas-fn",
+		OnSyncError:      func(err error, failures int) {},
+	}).(*controller)
+	defer c.Close()
+
+	builder := c.StartMapBuilder()
+	waitFor(t, func() bool {
+		last, err := builder.LastSync()
+		return !last.IsZero() && err == nil
+	})
+
+	atomic.StoreInt32(&failing, 1)
+	waitFor(t, func() bool {
+		_, err := builder.LastSync()
+		return err != nil
+	})
+
+	builder.Stop()
+	builder.Stop()
+	select {
+	case <-builder.Done():
+	case <-time.After(time.Second):
+		t.Fatal("want the loop stopped")
+	}
+	if len(c.Topics()) != 1 {
+		t.Errorf("Topics - want the last topic map kept, got: %v", c.Topics())
+	}
+}
+
+// waitFor polls condition until it is true, failing the test after a second.
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	messageKeyHeader       = "X-Message-Key"
+	messageIDHeader        = "X-Message-Id"
+	messageTimestampHeader = "X-Message-Timestamp"
+)
+
+// Message is a message received by a connector from its source, with the
+// metadata given by the source (e.g. a Kafka key or NATS headers).
+type Message struct {
+	// Body is the payload sent to the functions.
+	Body []byte
+
+	// BodyReader streams the payload to the function instead of Body, so
+	// large payloads don't need to be held in memory. It is buffered anyway
+	// when the topic matches several functions, or when the invocation may
+	// be retried, failed over, cached, archived, queued or wrapped in a
+	// structured CloudEvent. It is closed if it is an io.Closer.
+	BodyReader io.Reader
+
+	// Key is sent in the X-Message-Key header, if set.
+	Key string
+
+	// ID is sent in the X-Message-Id header. A UUIDv7 is generated if it
+	// is empty.
+	ID string
+
+	// Timestamp is sent in the X-Message-Timestamp header (RFC3339), if set.
+	Timestamp time.Time
+
+	// Attributes are sent as headers according to the AttributeHeaders and
+	// AttributeHeaderPrefix of the Invoker.
+	Attributes map[string]string
+}
+
+// messageHeaders adds the metadata of a message to header.
+func (i *Invoker) messageHeaders(message *Message, header http.Header) {
+	if len(message.Key) > 0 {
+		header.Set(messageKeyHeader, message.Key)
+	}
+
+	if len(message.ID) > 0 {
+		header.Set(messageIDHeader, message.ID)
+	}
+
+	if !message.Timestamp.IsZero() {
+		header.Set(messageTimestampHeader, message.Timestamp.UTC().Format(time.RFC3339Nano))
+	}
+
+	for name, value := range message.Attributes {
+		if headerName, ok := i.AttributeHeaders[name]; ok {
+			header.Set(headerName, value)
+		} else if len(i.AttributeHeaderPrefix) > 0 {
+			header.Set(i.AttributeHeaderPrefix+name, value)
+		}
+	}
+}
+
+// withMessageID returns the message, or a copy of it with a generated ID if
+// it has none. The ID comes from the IDGenerator of the Invoker, if set, or
+// is a UUIDv7.
+func (i *Invoker) withMessageID(message *Message) *Message {
+	if len(message.ID) > 0 {
+		return message
+	}
+
+	var generator IDGenerator = UUIDv7Generator{}
+	if i.IDGenerator != nil {
+		generator = i.IDGenerator
+	}
+
+	id, err := generator.NewID()
+	if err != nil {
+		i.logger().Warnf("Unable to generate message ID: %s", err)
+		return message
+	}
+
+	withID := *message
+	withID.ID = id
+	return &withID
+}
+
+// propagatedMetadata returns the values of the PropagateHeaders found in the
+// request header, or nil if there are none.
+func (i *Invoker) propagatedMetadata(header http.Header) map[string]string {
+	var metadata map[string]string
+	for _, name := range i.PropagateHeaders {
+		value := header.Get(name)
+		if len(value) == 0 {
+			continue
+		}
+		if metadata == nil {
+			metadata = make(map[string]string, len(i.PropagateHeaders))
+		}
+		metadata[http.CanonicalHeaderKey(name)] = value
+	}
+	return metadata
+}
+
+// hasBody returns true if the message has a payload to send.
+func (m *Message) hasBody() bool {
+	return len(m.Body) > 0 || m.BodyReader != nil
+}
+
+// streamable returns true if the body of a message sent to the given number
+// of functions can be streamed, i.e. is sent once and never needed again.
+func (i *Invoker) streamable(functions int) bool {
+	return functions == 1 &&
+		i.ResponseCache == nil &&
+		i.Archiver == nil &&
+		i.CloudEventsMode != CloudEventsStructured &&
+		i.RetryAfterMaxWait <= 0 &&
+		i.GatewayPool == nil
+}
+
+// bufferBody returns a copy of message with its BodyReader read into Body,
+// or message itself if it has no BodyReader.
+func bufferBody(message *Message) (*Message, error) {
+	if message.BodyReader == nil {
+		return message, nil
+	}
+	if closer, ok := message.BodyReader.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	body, err := ioutil.ReadAll(message.BodyReader)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read message body")
+	}
+
+	buffered := *message
+	buffered.Body = body
+	buffered.BodyReader = nil
+	return &buffered, nil
+}
+
+// prepareBody decides whether the body of message is streamed to the given
+// number of functions, returning the stream, or buffers it. The caller must
+// close the stream with closeStream.
+func (i *Invoker) prepareBody(message *Message, functions int) (*Message, io.Reader, error) {
+	if message.BodyReader != nil && i.streamable(functions) {
+		return message, message.BodyReader, nil
+	}
+	buffered, err := bufferBody(message)
+	if err != nil {
+		return message, nil, err
+	}
+	return buffered, nil, nil
+}
+
+// closeStream closes a stream returned by prepareBody, in case the
+// invocation returned before sending it.
+func closeStream(stream io.Reader) {
+	if closer, ok := stream.(io.Closer); ok {
+		closer.Close()
+	}
+}
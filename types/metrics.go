@@ -0,0 +1,275 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Metrics exposes the state of the connector in the Prometheus text format,
+// without depending on the Prometheus client. Serve it on /metrics:
+//
+//	http.Handle("/metrics", metrics)
+//
+// or append its samples to an existing exposition with WriteTo.
+type Metrics struct {
+	// DurationBuckets are the upper bounds, in seconds, of the buckets of the
+	// invocation duration histogram. Defaults to DefaultDurationBuckets.
+	DurationBuckets []float64
+
+	lock           sync.RWMutex
+	topicFunctions []topicFunction
+
+	droppedResponses uint64
+	spilledMessages  uint64
+	spilledBytes     uint64
+	crossZone        uint64
+	retries          uint64
+	retriesDenied    uint64
+
+	tenantLock  sync.Mutex
+	tenantUsage map[tenantResult]*tenantUsage
+
+	invocations invocationMetrics
+	discovery   discoveryMetrics
+}
+
+// tenantResult identifies the invocations of a tenant with the same result.
+type tenantResult struct {
+	tenant string
+	result string
+}
+
+// tenantUsage accounts the invocations of a tenant.
+type tenantUsage struct {
+	invocations uint64
+	seconds     float64
+}
+
+// topicFunction is a topic to function mapping of the topic map.
+type topicFunction struct {
+	topic     string
+	function  string
+	namespace string
+}
+
+// NewMetrics creates an empty set of metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{}
+}
+
+// syncTopicMap replaces the topic to function mappings exported by
+// connector_topic_function_info.
+func (m *Metrics) syncTopicMap(lookups map[string][]string) {
+	mappings := []topicFunction{}
+	for topic, functions := range lookups {
+		for _, function := range functions {
+			name, namespace := splitFunctionRef(function)
+			mappings = append(mappings, topicFunction{topic: topic, function: name, namespace: namespace})
+		}
+	}
+
+	sort.Slice(mappings, func(i, j int) bool {
+		a, b := mappings[i], mappings[j]
+		if a.topic != b.topic {
+			return a.topic < b.topic
+		}
+		if a.function != b.function {
+			return a.function < b.function
+		}
+		return a.namespace < b.namespace
+	})
+
+	m.lock.Lock()
+	m.topicFunctions = mappings
+	m.lock.Unlock()
+}
+
+// responseDropped counts a response dropped on overflow.
+func (m *Metrics) responseDropped() {
+	atomic.AddUint64(&m.droppedResponses, 1)
+}
+
+// messageSpilled counts a queued message spilled to disk.
+func (m *Metrics) messageSpilled(bytes int) {
+	atomic.AddUint64(&m.spilledMessages, 1)
+	atomic.AddUint64(&m.spilledBytes, uint64(bytes))
+}
+
+// crossZoneRequest counts an invocation sent to a gateway of another zone.
+func (m *Metrics) crossZoneRequest() {
+	atomic.AddUint64(&m.crossZone, 1)
+}
+
+// retry counts a retry, or a retry denied by the retry budget.
+func (m *Metrics) retry(allowed bool) {
+	if allowed {
+		atomic.AddUint64(&m.retries, 1)
+	} else {
+		atomic.AddUint64(&m.retriesDenied, 1)
+	}
+}
+
+// observeInvocation accounts an invocation by topic, function and status
+// class, and by tenant if it is labelled with one.
+func (m *Metrics) observeInvocation(res InvokerResponse) {
+	m.observeDuration(res)
+	if len(res.Tenant) == 0 {
+		return
+	}
+
+	result := "success"
+	if res.Error != nil || res.Status >= http.StatusBadRequest {
+		result = "error"
+	}
+	key := tenantResult{tenant: res.Tenant, result: result}
+
+	m.tenantLock.Lock()
+	defer m.tenantLock.Unlock()
+
+	if m.tenantUsage == nil {
+		m.tenantUsage = map[tenantResult]*tenantUsage{}
+	}
+	usage, ok := m.tenantUsage[key]
+	if !ok {
+		usage = &tenantUsage{}
+		m.tenantUsage[key] = usage
+	}
+	usage.invocations++
+	usage.seconds += res.Duration.Seconds()
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", metricsContentType)
+	m.write(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text format to w, e.g. to
+// serve them along with the metrics of another registry.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	counter := &countingWriter{w: w}
+	m.write(counter)
+	return counter.n, counter.err
+}
+
+// countingWriter counts the bytes written to w and keeps the first error.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
+
+func (m *Metrics) write(out io.Writer) {
+	w := bufio.NewWriter(out)
+	defer w.Flush()
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	writeMetricHeader(w, "connector_topic_function_info", "gauge", "Functions subscribed to each topic in the topic map.")
+	for _, mapping := range m.topicFunctions {
+		writeMetric(w, "connector_topic_function_info", []string{
+			"topic", mapping.topic,
+			"function", mapping.function,
+			"namespace", mapping.namespace,
+		}, 1)
+	}
+
+	writeMetricHeader(w, "connector_dropped_responses_total", "counter", "Responses dropped because the subscribers lagged behind.")
+	writeMetric(w, "connector_dropped_responses_total", nil, float64(atomic.LoadUint64(&m.droppedResponses)))
+
+	writeMetricHeader(w, "connector_queue_spilled_messages_total", "counter", "Queued messages spilled to disk because the memory budget was exceeded.")
+	writeMetric(w, "connector_queue_spilled_messages_total", nil, float64(atomic.LoadUint64(&m.spilledMessages)))
+
+	writeMetricHeader(w, "connector_queue_spilled_bytes_total", "counter", "Bytes of queued messages spilled to disk.")
+	writeMetric(w, "connector_queue_spilled_bytes_total", nil, float64(atomic.LoadUint64(&m.spilledBytes)))
+
+	writeMetricHeader(w, "connector_gateway_cross_zone_requests_total", "counter", "Invocations sent to a gateway of another zone.")
+	writeMetric(w, "connector_gateway_cross_zone_requests_total", nil, float64(atomic.LoadUint64(&m.crossZone)))
+
+	writeMetricHeader(w, "connector_retries_total", "counter", "Invocations retried, within the retry budget.")
+	writeMetric(w, "connector_retries_total", nil, float64(atomic.LoadUint64(&m.retries)))
+
+	writeMetricHeader(w, "connector_retry_budget_exhausted_total", "counter", "Retries denied because the retry budget was exhausted.")
+	writeMetric(w, "connector_retry_budget_exhausted_total", nil, float64(atomic.LoadUint64(&m.retriesDenied)))
+
+	m.writeInvocations(w)
+	m.writeDiscovery(w)
+	m.writeTenantUsage(w)
+}
+
+func writeMetricHeader(w io.Writer, name, metricType, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+// writeMetric writes a sample, with labels given as name, value pairs.
+func writeMetric(w io.Writer, name string, labels []string, value float64) {
+	fmt.Fprint(w, name)
+	if len(labels) > 0 {
+		pairs := make([]string, 0, len(labels)/2)
+		for i := 0; i+1 < len(labels); i += 2 {
+			pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], escapeLabelValue(labels[i+1])))
+		}
+		fmt.Fprintf(w, "{%s}", strings.Join(pairs, ","))
+	}
+	fmt.Fprintf(w, " %v\n", value)
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeLabelValue(value string) string {
+	return labelValueReplacer.Replace(value)
+}
+
+// writeTenantUsage writes the invocations and their duration per tenant.
+func (m *Metrics) writeTenantUsage(w io.Writer) {
+	m.tenantLock.Lock()
+	keys := make([]tenantResult, 0, len(m.tenantUsage))
+	usages := make(map[tenantResult]tenantUsage, len(m.tenantUsage))
+	for key, usage := range m.tenantUsage {
+		keys = append(keys, key)
+		usages[key] = *usage
+	}
+	m.tenantLock.Unlock()
+
+	if len(keys) == 0 {
+		return
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].tenant != keys[j].tenant {
+			return keys[i].tenant < keys[j].tenant
+		}
+		return keys[i].result < keys[j].result
+	})
+
+	writeMetricHeader(w, "connector_tenant_invocations_total", "counter", "Invocations per tenant and result.")
+	for _, key := range keys {
+		writeMetric(w, "connector_tenant_invocations_total", []string{"tenant", key.tenant, "result", key.result}, float64(usages[key].invocations))
+	}
+
+	writeMetricHeader(w, "connector_tenant_invocation_seconds_total", "counter", "Time spent invoking functions per tenant and result.")
+	for _, key := range keys {
+		writeMetric(w, "connector_tenant_invocation_seconds_total", []string{"tenant", key.tenant, "result", key.result}, usages[key].seconds)
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Metrics_TopicFunctionInfo(t *testing.T) {
+	metrics := NewMetrics()
+	metrics.syncTopicMap(map[string][]string{
+		"topic1": {"echo.openfaas-fn", "plain"},
+		`quo"te`: {"echo.dev"},
+	})
+
+	rr := httptest.NewRecorder()
+	metrics.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	want := []string{
+		"# TYPE connector_topic_function_info gauge",
+		`connector_topic_function_info{topic="quo\"te",function="echo",namespace="dev"} 1`,
+		`connector_topic_function_info{topic="topic1",function="echo",namespace="openfaas-fn"} 1`,
+		`connector_topic_function_info{topic="topic1",function="plain",namespace=""} 1`,
+	}
+	body := rr.Body.String()
+	for _, line := range want {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Metrics - want line %q, got:\n%s", line, body)
+		}
+	}
+
+	metrics.syncTopicMap(map[string][]string{})
+	rr = httptest.NewRecorder()
+	metrics.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if strings.Contains(rr.Body.String(), "connector_topic_function_info{") {
+		t.Errorf("Metrics - want mappings removed after sync, got:\n%s", rr.Body.String())
+	}
+}
+
+func Test_Metrics_TenantUsage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".team-b") {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	invoker := NewInvoker(srv.URL+"/function", "", srv.Client(), false, false)
+	invoker.TenantResolver = func(topic, function string, message *Message) string {
+		_, namespace := splitFunctionRef(function)
+		return namespace
+	}
+	topicMap := newTestTopicMap(map[string][]string{"topic1": {"echo.team-a", "echo.team-b"}})
+
+	metrics := NewMetrics()
+	responses := collectResponses(invoker, func() {
+		invoker.InvokeMessage(context.Background(), topicMap, "topic1", &Message{Body: []byte("hello")})
+	})
+	for _, res := range responses {
+		metrics.observeInvocation(res)
+	}
+
+	if len(responses) != 2 || responses[0].Tenant != "team-a" || responses[1].Tenant != "team-b" {
+		t.Fatalf("Responses - want tenants team-a and team-b, got: %+v", responses)
+	}
+
+	rr := httptest.NewRecorder()
+	metrics.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, want := range []string{
+		`connector_tenant_invocations_total{tenant="team-a",result="success"} 1`,
+		`connector_tenant_invocations_total{tenant="team-b",result="error"} 1`,
+	} {
+		if !strings.Contains(rr.Body.String(), want) {
+			t.Errorf("Metrics - want: %s, got:\n%s", want, rr.Body.String())
+		}
+	}
+}
+
+func Test_Metrics_Invocations(t *testing.T) {
+	metrics := NewMetrics()
+	metrics.DurationBuckets = []float64{0.1, 1}
+
+	metrics.observeInvocation(InvokerResponse{Topic: "orders", Function: "echo.openfaas-fn", Status: http.StatusOK, Duration: 50 * time.Millisecond})
+	metrics.observeInvocation(InvokerResponse{Topic: "orders", Function: "echo.openfaas-fn", Status: http.StatusBadGateway, Duration: 500 * time.Millisecond})
+	metrics.observeInvocation(InvokerResponse{Topic: "orders", Function: "echo.openfaas-fn", Error: ErrCircuitOpen})
+	metrics.observeSync(250*time.Millisecond, 3, nil)
+	metrics.observeSync(time.Second, 0, ErrPaused)
+
+	out := &strings.Builder{}
+	if _, err := metrics.WriteTo(out); err != nil {
+		t.Fatal(err)
+	}
+
+	labels := `topic="orders",function="echo",namespace="openfaas-fn"`
+	for _, want := range []string{
+		`connector_invocations_total{` + labels + `,status_class="2xx"} 1`,
+		`connector_invocations_total{` + labels + `,status_class="5xx"} 1`,
+		`connector_invocations_total{` + labels + `,status_class="error"} 1`,
+		"# TYPE connector_invocation_duration_seconds histogram",
+		`connector_invocation_duration_seconds_bucket{` + labels + `,le="0.1"} 2`,
+		`connector_invocation_duration_seconds_bucket{` + labels + `,le="1"} 3`,
+		`connector_invocation_duration_seconds_bucket{` + labels + `,le="+Inf"} 3`,
+		`connector_invocation_duration_seconds_sum{` + labels + `} 0.55`,
+		`connector_invocation_duration_seconds_count{` + labels + `} 3`,
+		"connector_topic_map_topics 3",
+		`connector_topic_map_syncs_total{result="success"} 1`,
+		`connector_topic_map_syncs_total{result="error"} 1`,
+		"connector_topic_map_sync_duration_seconds 1",
+	} {
+		if !strings.Contains(out.String(), want+"\n") {
+			t.Errorf("Metrics - want line %q, got:\n%s", want, out.String())
+		}
+	}
+}
+
+func Test_Metrics_Discovery(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/system/namespaces":
+			w.Write([]byte(`["openfaas-fn","broken"]`))
+		case r.URL.Query().Get("namespace") == "broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.Write([]byte(`[{"name":"echo","annotations":{"topic":"a,b"}},{"name":"plain"}]`))
+		}
+	}))
+	defer srv.Close()
+
+	metrics := NewMetrics()
+	var reported []DiscoveryStats
+	builder := FunctionLookupBuilder{
+		GatewayURL:     srv.URL,
+		Client:         srv.Client(),
+		TopicDelimiter: ",",
+		PartialResults: true,
+		OnDiscovery: func(stats DiscoveryStats) {
+			reported = append(reported, stats)
+			metrics.observeDiscovery(stats)
+		},
+	}
+	if _, _, err := builder.BuildWithMetadata(); err == nil {
+		t.Fatal("want a partial build error")
+	}
+
+	if len(reported) != 1 {
+		t.Fatalf("want 1 discovery reported, got %d", len(reported))
+	}
+	stats := reported[0]
+	if stats.Namespaces != 1 || stats.Functions != 2 || stats.Topics != 2 || stats.NamespaceErrors["broken"] == nil {
+		t.Errorf("want 1 namespace, 2 functions, 2 topics and an error for broken, got %+v", stats)
+	}
+
+	rr := httptest.NewRecorder()
+	metrics.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	want := []string{
+		"# TYPE connector_discovery_duration_seconds gauge",
+		"connector_discovery_namespaces 1",
+		"connector_discovery_functions 2",
+		"connector_discovery_topics 2",
+		`connector_discovery_namespace_errors_total{namespace="broken"} 1`,
+	}
+	body := rr.Body.String()
+	for _, line := range want {
+		if !strings.Contains(body, line) {
+			t.Errorf("Metrics - want line %q, got:\n%s", line, body)
+		}
+	}
+}
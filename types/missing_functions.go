@@ -0,0 +1,43 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"sync"
+	"time"
+)
+
+// missingFunctions remembers the functions the gateway answered with 404,
+// so the messages for a deleted function fail fast until the TTL expires.
+type missingFunctions struct {
+	lock  sync.Mutex
+	until map[string]time.Time
+}
+
+// missing returns true if function was recently not found.
+func (m *missingFunctions) missing(function string, now time.Time) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	until, ok := m.until[function]
+	if !ok {
+		return false
+	}
+	if !now.Before(until) {
+		delete(m.until, function)
+		return false
+	}
+	return true
+}
+
+// add remembers function as missing for ttl.
+func (m *missingFunctions) add(function string, now time.Time, ttl time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.until == nil {
+		m.until = make(map[string]time.Time)
+	}
+	m.until[function] = now.Add(ttl)
+}
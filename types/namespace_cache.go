@@ -0,0 +1,129 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"sync"
+	"time"
+)
+
+// NamespaceCache keeps the namespaces listed from each gateway for TTL, so
+// that the builds of the topic map, which list the functions on every
+// rebuild, list the namespaces far less often. The metadata of the
+// namespaces, fetched for the NamespaceSelector, is kept the same way.
+// Failed listings are not cached.
+type NamespaceCache struct {
+	TTL time.Duration
+
+	lock     sync.Mutex
+	entries  map[string]namespaceEntry
+	metadata map[namespaceKey]namespaceMetadataEntry
+	now      func() time.Time
+}
+
+// namespaceEntry is a namespace listing and the time it expires.
+type namespaceEntry struct {
+	namespaces []string
+	expires    time.Time
+}
+
+// namespaceKey identifies a namespace of a gateway.
+type namespaceKey struct {
+	gatewayURL string
+	namespace  string
+}
+
+// namespaceMetadataEntry is the metadata of a namespace, found is false if
+// the gateway doesn't serve it, and the time it expires.
+type namespaceMetadataEntry struct {
+	metadata namespaceMetadata
+	found    bool
+	expires  time.Time
+}
+
+// NewNamespaceCache creates a cache keeping the namespaces for ttl.
+func NewNamespaceCache(ttl time.Duration) *NamespaceCache {
+	return &NamespaceCache{TTL: ttl}
+}
+
+// Refresh forgets the cached namespaces, so that the next build lists them
+// again.
+func (c *NamespaceCache) Refresh() {
+	if c == nil {
+		return
+	}
+
+	c.lock.Lock()
+	c.entries = nil
+	c.metadata = nil
+	c.lock.Unlock()
+}
+
+// namespaces returns the cached namespaces of gatewayURL, or lists and
+// caches them with list.
+func (c *NamespaceCache) namespaces(gatewayURL string, list func() ([]string, error)) ([]string, error) {
+	if c == nil || c.TTL <= 0 {
+		return list()
+	}
+
+	now := c.clock()
+	c.lock.Lock()
+	entry, ok := c.entries[gatewayURL]
+	c.lock.Unlock()
+	if ok && now.Before(entry.expires) {
+		return append([]string(nil), entry.namespaces...), nil
+	}
+
+	namespaces, err := list()
+	if err != nil {
+		return namespaces, err
+	}
+
+	c.lock.Lock()
+	if c.entries == nil {
+		c.entries = map[string]namespaceEntry{}
+	}
+	c.entries[gatewayURL] = namespaceEntry{namespaces: append([]string(nil), namespaces...), expires: now.Add(c.TTL)}
+	c.lock.Unlock()
+	return namespaces, nil
+}
+
+// namespaceMetadata returns the cached metadata of namespace on gatewayURL,
+// or gets and caches it with get.
+func (c *NamespaceCache) namespaceMetadata(gatewayURL, namespace string,
+	get func() (namespaceMetadata, bool, error)) (namespaceMetadata, bool, error) {
+
+	if c == nil || c.TTL <= 0 {
+		return get()
+	}
+
+	key := namespaceKey{gatewayURL: gatewayURL, namespace: namespace}
+	now := c.clock()
+	c.lock.Lock()
+	entry, ok := c.metadata[key]
+	c.lock.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.metadata, entry.found, nil
+	}
+
+	metadata, found, err := get()
+	if err != nil {
+		return metadata, found, err
+	}
+
+	c.lock.Lock()
+	if c.metadata == nil {
+		c.metadata = map[namespaceKey]namespaceMetadataEntry{}
+	}
+	c.metadata[key] = namespaceMetadataEntry{metadata: metadata, found: found, expires: now.Add(c.TTL)}
+	c.lock.Unlock()
+	return metadata, found, nil
+}
+
+func (c *NamespaceCache) clock() time.Time {
+	if c.now == nil {
+		return time.Now()
+	}
+	return c.now()
+}
@@ -0,0 +1,121 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_NamespaceCache_ListsNamespacesOncePerTTL(t *testing.T) {
+	var namespaceCalls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/system/namespaces" {
+			atomic.AddInt32(&namespaceCalls, 1)
+			w.Write([]byte(`["openfaas-fn"]`))
+			return
+		}
+		w.Write([]byte(`[{"name":"echo","annotations":{"topic":"topic1"}}]`))
+	}))
+	defer srv.Close()
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewNamespaceCache(time.Minute)
+	cache.now = func() time.Time { return now }
+
+	builder := FunctionLookupBuilder{
+		GatewayURL:     srv.URL,
+		Client:         srv.Client(),
+		NamespaceCache: cache,
+	}
+
+	build := func() {
+		lookups, err := builder.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(lookups["topic1"]) != 1 {
+			t.Fatalf("want echo on topic1, got %v", lookups)
+		}
+	}
+
+	build()
+	build()
+	if got := atomic.LoadInt32(&namespaceCalls); got != 1 {
+		t.Errorf("want the namespaces listed once within the TTL, got %d calls", got)
+	}
+
+	now = now.Add(2 * time.Minute)
+	build()
+	if got := atomic.LoadInt32(&namespaceCalls); got != 2 {
+		t.Errorf("want the namespaces listed again once expired, got %d calls", got)
+	}
+
+	cache.Refresh()
+	build()
+	if got := atomic.LoadInt32(&namespaceCalls); got != 3 {
+		t.Errorf("want the namespaces listed again after Refresh, got %d calls", got)
+	}
+}
+
+func Test_NamespaceCache_KeepsNamespaceMetadata(t *testing.T) {
+	var metadataCalls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/system/namespaces":
+			w.Write([]byte(`["team-a", "team-b"]`))
+		case "/system/namespace/team-a":
+			atomic.AddInt32(&metadataCalls, 1)
+			w.Write([]byte(`{"name":"team-a","labels":{"openfaas":"1"}}`))
+		case "/system/namespace/team-b":
+			atomic.AddInt32(&metadataCalls, 1)
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.Write([]byte(`[{"name":"echo","annotations":{"topic":"topic1"}}]`))
+		}
+	}))
+	defer srv.Close()
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewNamespaceCache(time.Minute)
+	cache.now = func() time.Time { return now }
+
+	builder := FunctionLookupBuilder{
+		GatewayURL:        srv.URL,
+		Client:            srv.Client(),
+		NamespaceCache:    cache,
+		NamespaceSelector: map[string]string{"openfaas": "1"},
+	}
+
+	build := func() {
+		lookups, err := builder.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := lookups["topic1"]; len(got) != 1 || got[0] != "echo.team-a" {
+			t.Fatalf("want echo.team-a on topic1, got %v", lookups)
+		}
+	}
+
+	build()
+	build()
+	if got := atomic.LoadInt32(&metadataCalls); got != 2 {
+		t.Errorf("want the metadata of each namespace read once within the TTL, got %d calls", got)
+	}
+
+	now = now.Add(2 * time.Minute)
+	build()
+	if got := atomic.LoadInt32(&metadataCalls); got != 4 {
+		t.Errorf("want the metadata read again once expired, got %d calls", got)
+	}
+
+	cache.Refresh()
+	build()
+	if got := atomic.LoadInt32(&metadataCalls); got != 6 {
+		t.Errorf("want the metadata read again after Refresh, got %d calls", got)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+)
+
+// namespaceMetadata is the metadata of a namespace served by the gateway
+// with GET /system/namespace/{name}.
+type namespaceMetadata struct {
+	Name        string            `json:"name"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// selects returns true if the labels or annotations of the namespace match
+// every pair of selector. An empty value matches any value of the key.
+func (n namespaceMetadata) selects(selector map[string]string) bool {
+	for key, want := range selector {
+		value, ok := n.Labels[key]
+		if !ok {
+			value, ok = n.Annotations[key]
+		}
+		if !ok || (len(want) > 0 && value != want) {
+			return false
+		}
+	}
+	return true
+}
+
+// selectNamespaces keeps the namespaces matching the NamespaceSelector.
+func (s *FunctionLookupBuilder) selectNamespaces(ctx context.Context, gatewayURL string, namespaces []string) ([]string, error) {
+	selected := make([]string, 0, len(namespaces))
+	for _, namespace := range namespaces {
+		metadata, found, err := s.NamespaceCache.namespaceMetadata(gatewayURL, namespace, func() (namespaceMetadata, bool, error) {
+			return s.getNamespaceMetadata(ctx, gatewayURL, namespace)
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			if atomic.CompareAndSwapInt32(&s.selectorWarned, 0, 1) {
+				s.logger().Warnf("The gateway serves no metadata for namespace %q, it can't be selected by label", namespace)
+			}
+			continue
+		}
+		if metadata.selects(s.NamespaceSelector) {
+			selected = append(selected, namespace)
+		}
+	}
+	return selected, nil
+}
+
+// getNamespaceMetadata gets the labels and annotations of a namespace.
+// found is false when the gateway doesn't serve them.
+func (s *FunctionLookupBuilder) getNamespaceMetadata(ctx context.Context, gatewayURL, namespace string) (metadata namespaceMetadata, found bool, err error) {
+	if err := s.waitDiscovery(ctx); err != nil {
+		return metadata, false, err
+	}
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/system/namespace/%s", gatewayURL, url.PathEscape(namespace)), nil)
+	if err != nil {
+		return metadata, false, err
+	}
+	req = req.WithContext(ctx)
+	if err := setAuth(req, s.Auth, s.Credentials); err != nil {
+		return metadata, false, err
+	}
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return metadata, false, err
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return metadata, false, nil
+	case res.StatusCode != http.StatusOK:
+		return metadata, false, fmt.Errorf("unable to get namespace %s: unexpected status %d", namespace, res.StatusCode)
+	}
+
+	bytesOut, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return metadata, false, err
+	}
+	if err := json.Unmarshal(bytesOut, &metadata); err != nil {
+		return metadata, false, fmt.Errorf("unable to unmarshal namespace %s: %s", namespace, err)
+	}
+	return metadata, true, nil
+}
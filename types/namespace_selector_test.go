@@ -0,0 +1,61 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func Test_Build_SelectsNamespacesByLabel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/system/namespaces":
+			w.Write([]byte(`["openfaas-fn","team-a","team-b","legacy"]`))
+		case r.URL.Path == "/system/namespace/team-a":
+			w.Write([]byte(`{"name":"team-a","labels":{"openfaas":"1"},"annotations":{"team":"a"}}`))
+		case r.URL.Path == "/system/namespace/team-b":
+			w.Write([]byte(`{"name":"team-b","labels":{"openfaas":"1"}}`))
+		case r.URL.Path == "/system/namespace/openfaas-fn":
+			w.Write([]byte(`{"name":"openfaas-fn","labels":{"openfaas":"1","team":"core"}}`))
+		case strings.HasPrefix(r.URL.Path, "/system/namespace/"):
+			http.NotFound(w, r)
+		default:
+			fmt.Fprintf(w, `[{"name":"echo","annotations":{"topic":"topic1"}}]`)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		selector map[string]string
+		want     string
+	}{
+		{selector: map[string]string{"openfaas": "1"}, want: "[echo.openfaas-fn echo.team-a echo.team-b]"},
+		{selector: map[string]string{"openfaas": "1", "team": ""}, want: "[echo.openfaas-fn echo.team-a]"},
+		{selector: map[string]string{"team": "a"}, want: "[echo.team-a]"},
+		{selector: map[string]string{"team": "b"}, want: "[]"},
+	}
+
+	for _, test := range tests {
+		builder := FunctionLookupBuilder{
+			Client:            srv.Client(),
+			GatewayURL:        srv.URL,
+			NamespaceSelector: test.selector,
+			Logger:            NewStdLogger(LevelError),
+		}
+		lookups, err := builder.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := lookups["topic1"]
+		sort.Strings(got)
+		if fmt.Sprint(got) != test.want {
+			t.Errorf("Functions selected by %v - want: %s, got: %v", test.selector, test.want, got)
+		}
+	}
+}
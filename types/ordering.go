@@ -0,0 +1,100 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"sync"
+)
+
+// topicSequencer hands out per-topic tickets in invocation order, so the
+// responses of each topic can be published in that order.
+type topicSequencer struct {
+	lock   sync.Mutex
+	topics map[string]*topicSequence
+
+	// notify is called when a ticket gets its turn, if set.
+	notify func()
+}
+
+// topicSequence holds the tickets of a topic not done yet, in order. The
+// first one has the turn.
+type topicSequence struct {
+	tickets []*sequenceTicket
+}
+
+// sequenceTicket is the place of a message in the sequence of its topic.
+type sequenceTicket struct {
+	sequencer *topicSequencer
+	topic     string
+	finished  bool
+
+	// turn is closed when the tickets taken before this one are done.
+	turn chan struct{}
+}
+
+// take returns the next ticket of a topic.
+func (s *topicSequencer) take(topic string) *sequenceTicket {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.topics == nil {
+		s.topics = make(map[string]*topicSequence)
+	}
+
+	sequence, ok := s.topics[topic]
+	if !ok {
+		sequence = &topicSequence{}
+		s.topics[topic] = sequence
+	}
+
+	ticket := &sequenceTicket{sequencer: s, topic: topic, turn: make(chan struct{})}
+	sequence.tickets = append(sequence.tickets, ticket)
+	if len(sequence.tickets) == 1 {
+		close(ticket.turn)
+	}
+	return ticket
+}
+
+// wait blocks until the tickets taken before t are done.
+func (t *sequenceTicket) wait() {
+	<-t.turn
+}
+
+// ready returns true if the tickets taken before t are done.
+func (t *sequenceTicket) ready() bool {
+	select {
+	case <-t.turn:
+		return true
+	default:
+		return false
+	}
+}
+
+// done gives the turn to the next ticket of the topic. It waits for the
+// turn of t first, so that the order is kept if wait wasn't called.
+func (t *sequenceTicket) done() {
+	if t.finished {
+		return
+	}
+	t.finished = true
+	t.wait()
+
+	s := t.sequencer
+	s.lock.Lock()
+	sequence := s.topics[t.topic]
+	sequence.tickets[0] = nil
+	sequence.tickets = sequence.tickets[1:]
+	if len(sequence.tickets) == 0 {
+		delete(s.topics, t.topic)
+		s.lock.Unlock()
+		return
+	}
+	close(sequence.tickets[0].turn)
+	notify := s.notify
+	s.lock.Unlock()
+
+	if notify != nil {
+		notify()
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_InvokeMessage_OrderedDelivery(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) == "first" {
+			time.Sleep(100 * time.Millisecond)
+		}
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	invoker := NewInvoker(srv.URL+"/function", "", srv.Client(), false, false)
+	invoker.OrderedDelivery = true
+	topicMap := newTestTopicMap(map[string][]string{"topic1": {"echo"}})
+
+	responses := collectResponses(invoker, func() {
+		wg := sync.WaitGroup{}
+		for _, body := range []string{"first", "second", "third"} {
+			wg.Add(1)
+			go func(body string) {
+				defer wg.Done()
+				invoker.InvokeMessage(context.Background(), topicMap, "topic1", &Message{Body: []byte(body)})
+			}(body)
+			// Let the invocation take its ticket before starting the next one.
+			time.Sleep(10 * time.Millisecond)
+		}
+		wg.Wait()
+	})
+
+	if len(responses) != 3 {
+		t.Fatalf("Responses - want: %d, got: %d", 3, len(responses))
+	}
+	for i, want := range []string{"first", "second", "third"} {
+		if got := string(*responses[i].Body); got != want {
+			t.Errorf("Response %d - want: %s, got: %s", i, want, got)
+		}
+	}
+}
+
+func Test_Controller_OrderedByKey(t *testing.T) {
+	lock := sync.Mutex{}
+	inFlight := map[string]int{}
+	received := map[string][]string{}
+	overlapped := false
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(messageKeyHeader)
+		body, _ := ioutil.ReadAll(r.Body)
+
+		lock.Lock()
+		inFlight[key]++
+		overlapped = overlapped || inFlight[key] > 1
+		received[key] = append(received[key], string(body))
+		lock.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		lock.Lock()
+		inFlight[key]--
+		lock.Unlock()
+	}))
+	defer srv.Close()
+
+	c := NewController(nil, &ControllerConfig{
+		GatewayURL:      srv.URL,
+		RebuildInterval: time.Hour,
+		OrderedByKey:    true,
+		Queue:           &QueueConfig{Workers: 4},
+	}).(*controller)
+	c.TopicMap.Sync(&map[string][]string{"orders": {"billing"}})
+
+	start := time.Now()
+	for _, message := range []Message{
+		{Key: "a", Body: []byte("a1")},
+		{Key: "b", Body: []byte("b1")},
+		{Key: "a", Body: []byte("a2")},
+		{Key: "b", Body: []byte("b2")},
+		{Key: "a", Body: []byte("a3")},
+	} {
+		message := message
+		c.InvokeMessage(context.Background(), "orders", &message)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if overlapped {
+		t.Error("want the messages sharing a key invoked one at a time")
+	}
+	for key, want := range map[string][]string{"a": {"a1", "a2", "a3"}, "b": {"b1", "b2"}} {
+		if got := received[key]; strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("Messages of %s - want: %v, got: %v", key, want, got)
+		}
+	}
+	if elapsed := time.Since(start); elapsed >= 100*time.Millisecond {
+		t.Errorf("want the keys invoked in parallel, took: %s", elapsed)
+	}
+}
+
+func Test_Controller_OrderedByKey_BurstDoesNotHoldWorkers(t *testing.T) {
+	release := make(chan struct{})
+	received := make(chan string, 10)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received <- string(body)
+		if string(body) == "a1" {
+			<-release
+		}
+	}))
+	defer srv.Close()
+
+	c := NewController(nil, &ControllerConfig{
+		GatewayURL:      srv.URL,
+		RebuildInterval: time.Hour,
+		OrderedByKey:    true,
+		Queue:           &QueueConfig{Workers: 2},
+		Logger:          NewStdLogger(LevelError),
+	}).(*controller)
+	c.TopicMap.Sync(&map[string][]string{"orders": {"billing"}})
+
+	// The burst of a waits for a1, and the other worker invokes b1.
+	for _, message := range []Message{
+		{Key: "a", Body: []byte("a1")},
+		{Key: "a", Body: []byte("a2")},
+		{Key: "a", Body: []byte("a3")},
+		{Key: "b", Body: []byte("b1")},
+	} {
+		message := message
+		c.InvokeMessage(context.Background(), "orders", &message)
+	}
+
+	invoked := map[string]bool{}
+	for len(invoked) < 2 {
+		select {
+		case got := <-received:
+			invoked[got] = true
+		case <-time.After(time.Second):
+			t.Fatalf("want a1 and b1 invoked while a1 is in flight, got: %v", invoked)
+		}
+	}
+	if !invoked["a1"] || !invoked["b1"] {
+		t.Errorf("Invoked - want a1 and b1, got: %v", invoked)
+	}
+
+	close(release)
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"a2", "a3"} {
+		if got := <-received; got != want {
+			t.Errorf("Invoked - want: %s, got: %s", want, got)
+		}
+	}
+}
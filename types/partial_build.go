@@ -0,0 +1,107 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/openfaas/faas-provider/types"
+)
+
+// defaultNamespaceRetryBackoff is the delay before the first retry of a
+// namespace listing when NamespaceRetryBackoff is not set.
+const defaultNamespaceRetryBackoff = 100 * time.Millisecond
+
+// PartialBuildError is returned by a build with PartialResults, along with
+// the functions of the namespaces listed successfully, when the functions
+// of some namespaces could not be listed.
+type PartialBuildError struct {
+	// Failed maps the namespaces that could not be listed to their error.
+	Failed map[string]error
+}
+
+func (e *PartialBuildError) Error() string {
+	namespaces := make([]string, 0, len(e.Failed))
+	for namespace := range e.Failed {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	messages := make([]string, 0, len(namespaces))
+	for _, namespace := range namespaces {
+		messages = append(messages, fmt.Sprintf("%s: %s", namespace, e.Failed[namespace]))
+	}
+	return fmt.Sprintf("unable to list the functions of %d namespaces: %s", len(namespaces), strings.Join(messages, "; "))
+}
+
+// listFunctions lists the functions of a namespace from source, retrying up
+// to NamespaceRetries times with an exponential backoff, until ctx is done.
+func (s *FunctionLookupBuilder) listFunctions(ctx context.Context, source FunctionSource, namespace string) ([]types.FunctionStatus, error) {
+	backoff := s.NamespaceRetryBackoff
+	if backoff <= 0 {
+		backoff = defaultNamespaceRetryBackoff
+	}
+
+	for attempt := 0; ; attempt++ {
+		functions, err := source.Functions(namespace)
+		if err == nil || attempt >= s.NamespaceRetries || ctx.Err() != nil {
+			return functions, err
+		}
+
+		s.logger().Debugf("Unable to list the functions of namespace %q, retrying in %s: %s", namespace, backoff, err)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return functions, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// failsBuild returns true if err fails the whole build even with
+// PartialResults: the gateway is unreachable, so the namespaces listed are
+// dropped and the GatewayPool fails over, or the build was abandoned.
+func failsBuild(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return true
+	}
+	_, unreachable := err.(*url.Error)
+	return unreachable
+}
+
+// keepFailedNamespaces adds to lookups and metadata the functions of the
+// namespaces that failed to be listed, as they were in the previous topic
+// map, so that a partial build doesn't unsubscribe them.
+func keepFailedNamespaces(lookups map[string][]string, metadata map[string]FunctionMetadata,
+	previous map[string][]string, previousMetadata map[string]FunctionMetadata, failed map[string]error) {
+
+	inFailedNamespace := func(function string) bool {
+		for namespace := range failed {
+			if strings.HasSuffix(function, "."+namespace) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for topic, functions := range previous {
+		for _, function := range functions {
+			if inFailedNamespace(function) && !contains(lookups[topic], function) {
+				lookups[topic] = append(lookups[topic], function)
+			}
+		}
+	}
+	for function, functionMetadata := range previousMetadata {
+		if _, ok := metadata[function]; !ok && inFailedNamespace(function) {
+			metadata[function] = functionMetadata
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newFlakyGateway serves the functions of namespaces team-a and team-b,
+// failing the listings of team-b while failures is positive.
+func newFlakyGateway(failures *int32, topic string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/system/namespaces" {
+			w.Write([]byte(`["team-a","team-b"]`))
+			return
+		}
+		namespace := r.URL.Query().Get("namespace")
+		if namespace == "team-b" && atomic.AddInt32(failures, -1) >= 0 {
+			w.Write([]byte(`not json`))
+			return
+		}
+		fmt.Fprintf(w, `[{"name":"%s","annotations":{"topic":"%s","topic-headers":"X-Team=%s"}}]`, namespace, topic, namespace)
+	}))
+}
+
+func Test_Build_RetriesFailedNamespace(t *testing.T) {
+	failures := int32(2)
+	srv := newFlakyGateway(&failures, "topic1")
+	defer srv.Close()
+
+	builder := FunctionLookupBuilder{
+		Client:                srv.Client(),
+		GatewayURL:            srv.URL,
+		NamespaceRetries:      2,
+		NamespaceRetryBackoff: time.Millisecond,
+		Logger:                NewStdLogger(LevelError),
+	}
+	lookups, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lookups["topic1"]) != 2 {
+		t.Errorf("Functions - want both namespaces after the retries, got: %v", lookups)
+	}
+}
+
+func Test_Build_PartialResults(t *testing.T) {
+	failures := int32(1 << 30)
+	srv := newFlakyGateway(&failures, "topic1")
+	defer srv.Close()
+
+	builder := FunctionLookupBuilder{
+		Client:         srv.Client(),
+		GatewayURL:     srv.URL,
+		PartialResults: true,
+	}
+	lookups, err := builder.Build()
+	partial, ok := err.(*PartialBuildError)
+	if !ok || len(partial.Failed) != 1 || partial.Failed["team-b"] == nil {
+		t.Fatalf("Error - want a PartialBuildError for team-b, got: %v", err)
+	}
+	if fmt.Sprint(lookups["topic1"]) != "[team-a.team-a]" {
+		t.Errorf("Functions - want team-a only, got: %v", lookups)
+	}
+}
+
+func Test_Build_PartialResultsFailsOverUnreachableGateway(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	down.Close()
+	failures := int32(0)
+	up := newFlakyGateway(&failures, "topic1")
+	defer up.Close()
+
+	pool := NewGatewayPool("", Gateway{URL: down.URL}, Gateway{URL: up.URL})
+	pool.Ordered = true
+	builder := FunctionLookupBuilder{
+		Client:         http.DefaultClient,
+		GatewayURL:     down.URL,
+		Namespaces:     []string{"team-a", "team-b"},
+		PartialResults: true,
+		Logger:         NewStdLogger(LevelError),
+		GatewayPool:    pool,
+	}
+	lookups, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lookups["topic1"]) != 2 {
+		t.Errorf("Functions - want both namespaces from %s, got: %v", up.URL, lookups)
+	}
+}
+
+func Test_Build_RetryBackoffStopsWithContext(t *testing.T) {
+	failures := int32(1 << 30)
+	srv := newFlakyGateway(&failures, "topic1")
+	defer srv.Close()
+
+	source := NewAnnotationTopicSource(&FunctionLookupBuilder{
+		Client:                srv.Client(),
+		GatewayURL:            srv.URL,
+		Namespaces:            []string{"team-b"},
+		NamespaceRetries:      3,
+		NamespaceRetryBackoff: time.Hour,
+		PartialResults:        true,
+		Logger:                NewStdLogger(LevelError),
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := source.Build(ctx)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Fatalf("want %s, got %v", context.Canceled, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("want the retries abandoned when the context is done")
+	}
+}
+
+func Test_Controller_PartialSyncKeepsFailedNamespaces(t *testing.T) {
+	failures := int32(0)
+	srv := newFlakyGateway(&failures, "topic1")
+	defer srv.Close()
+
+	c := NewController(nil, &ControllerConfig{
+		GatewayURL:  srv.URL,
+		PartialSync: true,
+		Logger:      NewStdLogger(LevelError),
+	}).(*controller)
+	defer c.Close()
+
+	source := c.newTopicSource()
+	if err := c.syncTopicMap(context.Background(), source, c.TopicMap); err != nil {
+		t.Fatal(err)
+	}
+
+	atomic.StoreInt32(&failures, 1<<30)
+	err := c.syncTopicMap(context.Background(), source, c.TopicMap)
+	if _, ok := err.(*PartialBuildError); !ok {
+		t.Fatalf("Error - want a PartialBuildError, got: %v", err)
+	}
+
+	functions := c.TopicMap.Match("topic1")
+	sort.Strings(functions)
+	if fmt.Sprint(functions) != "[team-a.team-a team-b.team-b]" {
+		t.Errorf("Functions - want team-b kept, got: %v", functions)
+	}
+	if metadata, _ := c.TopicMap.Metadata("team-b.team-b"); metadata.Headers.Get("X-Team") != "team-b" {
+		t.Errorf("Metadata - want the metadata of team-b kept, got: %+v", metadata)
+	}
+}
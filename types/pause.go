@@ -0,0 +1,96 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"sync"
+)
+
+// PausePolicy decides what happens to the messages received while the
+// controller is paused.
+type PausePolicy string
+
+const (
+	// PauseReject rejects the messages with ErrPaused. It is the default.
+	PauseReject PausePolicy = ""
+
+	// PauseHold holds the messages, and the queued ones, until Resume is
+	// called, their context is done or the controller is stopped, so that
+	// the broker is slowed down rather than the messages lost.
+	PauseHold PausePolicy = "hold"
+)
+
+// pauseGate holds the invocations while the controller is paused.
+type pauseGate struct {
+	lock sync.Mutex
+
+	// resumed is closed by Resume, and nil while not paused.
+	resumed chan struct{}
+}
+
+func (g *pauseGate) pause() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if g.resumed == nil {
+		g.resumed = make(chan struct{})
+	}
+}
+
+func (g *pauseGate) resume() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if g.resumed != nil {
+		close(g.resumed)
+		g.resumed = nil
+	}
+}
+
+// wait returns a channel closed on resume, or nil if not paused.
+func (g *pauseGate) wait() <-chan struct{} {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	return g.resumed
+}
+
+// Pause makes the controller reject the received messages, or hold them with
+// PauseHold, until Resume is called. The topic map keeps being synchronized.
+func (c *controller) Pause() {
+	c.pause.pause()
+}
+
+// Resume resumes the invocations after Pause, releasing the held messages.
+func (c *controller) Resume() {
+	c.pause.resume()
+}
+
+// Paused returns true if the controller is paused.
+func (c *controller) Paused() bool {
+	return c.pause.wait() != nil
+}
+
+// admit returns nil if a message can be invoked: right away when the
+// controller is not paused, or once resumed with PauseHold. Otherwise it
+// returns ErrPaused, ErrControllerStopped or the error of ctx.
+func (c *controller) admit(ctx context.Context) error {
+	resumed := c.pause.wait()
+	if resumed == nil {
+		return nil
+	}
+	if c.Config.PausePolicy != PauseHold {
+		return ErrPaused
+	}
+
+	select {
+	case <-resumed:
+		return nil
+	case <-c.stop:
+		return ErrControllerStopped
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_Controller_PauseHold(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	c := NewController(nil, &ControllerConfig{
+		GatewayURL:      srv.URL,
+		RebuildInterval: time.Hour,
+		PausePolicy:     PauseHold,
+	}).(*controller)
+	defer c.Close()
+	c.TopicMap.Sync(&map[string][]string{"orders": {"echo"}})
+	c.Pause()
+
+	done := make(chan []InvokerResponse, 1)
+	go func() {
+		done <- c.InvokeWithResults(context.Background(), "orders", &Message{Body: []byte("hello")})
+	}()
+
+	select {
+	case responses := <-done:
+		t.Fatalf("want the message held while paused, got: %+v", responses)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	c.Resume()
+	select {
+	case responses := <-done:
+		if len(responses) != 1 || responses[0].Error != nil || responses[0].Status != http.StatusOK {
+			t.Errorf("Responses - want a single %d, got: %+v", http.StatusOK, responses)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("want the message invoked once resumed")
+	}
+
+	c.Pause()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	responses := c.InvokeWithResults(ctx, "orders", &Message{Body: []byte("hello")})
+	if len(responses) != 1 || responses[0].Error != context.DeadlineExceeded {
+		t.Errorf("Responses - want: %v, got: %+v", context.DeadlineExceeded, responses)
+	}
+}
+
+func Test_Controller_PauseReject(t *testing.T) {
+	c := NewController(nil, &ControllerConfig{GatewayURL: "http://gateway:8080", RebuildInterval: time.Hour}).(*controller)
+	defer c.Close()
+	c.Pause()
+
+	responses := c.InvokeWithResults(context.Background(), "orders", &Message{Body: []byte("hello")})
+	if len(responses) != 1 || responses[0].Error != ErrPaused {
+		t.Errorf("Responses - want: %v, got: %+v", ErrPaused, responses)
+	}
+
+	c.Resume()
+	if c.Paused() {
+		t.Error("Controller - want resumed")
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+)
+
+// ProbeStatus is the state of the controller reported by the probe handler.
+type ProbeStatus struct {
+	Healthy bool `json:"healthy"`
+	Ready   bool `json:"ready"`
+}
+
+// recordSync records the outcome of a topic map sync for Ready and LastSync.
+func (c *controller) recordSync(err error) {
+	c.syncErr.Store(syncError{err: err})
+	if err != nil {
+		atomic.AddInt32(&c.syncFailures, 1)
+		return
+	}
+	atomic.StoreInt32(&c.syncFailures, 0)
+	atomic.StoreInt64(&c.lastSync, c.now().UnixNano())
+}
+
+// Healthy returns true while the responses are dispatched to the
+// subscribers.
+func (c *controller) Healthy() bool {
+	select {
+	case <-c.fanOutDone:
+		return false
+	default:
+		return !c.Stopped()
+	}
+}
+
+// Ready returns true if the controller is healthy, the topic map has been
+// synchronized at least once and the last sync reached the gateway.
+func (c *controller) Ready() bool {
+	return c.Healthy() &&
+		atomic.LoadInt64(&c.lastSync) > 0 &&
+		atomic.LoadInt32(&c.syncFailures) == 0
+}
+
+// NewProbeHandler returns an http.Handler to wire the liveness and readiness
+// probes of Kubernetes to a controller. It is not authenticated:
+//
+//	GET /healthz  200 if the controller is healthy, 503 otherwise
+//	GET /readyz   200 if the controller is ready, 503 otherwise
+//
+// Both return a ProbeStatus. They answer 501 unless the controller
+// implements HealthController.
+func NewProbeHandler(controller Controller) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", probe(controller, false))
+	mux.HandleFunc("/readyz", probe(controller, true))
+	return mux
+}
+
+func probe(controller Controller, readiness bool) http.HandlerFunc {
+	health, ok := controller.(HealthController)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if !ok {
+			http.Error(w, "not supported by the controller", http.StatusNotImplemented)
+			return
+		}
+
+		status := ProbeStatus{Healthy: health.Healthy(), Ready: health.Ready()}
+		w.Header().Set("Content-Type", "application/json")
+		if (readiness && !status.Ready) || !status.Healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(status)
+	}
+}
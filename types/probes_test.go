@@ -0,0 +1,75 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_ProbeHandler(t *testing.T) {
+	var failing int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("[]"))
+	}))
+	defer srv.Close()
+
+	c := NewController(nil, &ControllerConfig{
+		GatewayURL:      srv.URL,
+		RebuildInterval: time.Hour,
+		Namespace:       "openfaas-fn",
+		OnSyncError:     func(error, int) {},
+	}).(*controller)
+	handler := NewProbeHandler(c)
+
+	probe := func(path string) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	steps := []struct {
+		name        string
+		step        func()
+		wantHealthy int
+		wantReady   int
+	}{
+		{name: "before the first sync", step: func() {}, wantHealthy: http.StatusOK, wantReady: http.StatusServiceUnavailable},
+		{name: "after a sync", step: func() {
+			c.BeginMapBuilder()
+			if err := c.RefreshTopicMap(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		}, wantHealthy: http.StatusOK, wantReady: http.StatusOK},
+		{name: "gateway unreachable", step: func() {
+			atomic.StoreInt32(&failing, 1)
+			c.RefreshTopicMap(context.Background())
+		}, wantHealthy: http.StatusOK, wantReady: http.StatusServiceUnavailable},
+		{name: "gateway back", step: func() {
+			atomic.StoreInt32(&failing, 0)
+			c.RefreshTopicMap(context.Background())
+		}, wantHealthy: http.StatusOK, wantReady: http.StatusOK},
+		{name: "stopped", step: func() {
+			c.Close()
+		}, wantHealthy: http.StatusServiceUnavailable, wantReady: http.StatusServiceUnavailable},
+	}
+
+	for _, s := range steps {
+		s.step()
+		if got := probe("/healthz"); got != s.wantHealthy {
+			t.Errorf("%s: /healthz - want: %d, got: %d", s.name, s.wantHealthy, got)
+		}
+		if got := probe("/readyz"); got != s.wantReady {
+			t.Errorf("%s: /readyz - want: %d, got: %d", s.name, s.wantReady, got)
+		}
+	}
+}
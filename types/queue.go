@@ -0,0 +1,366 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// defaultQueueMemoryBudget is the memory budget of the queue when none is
+// given.
+const defaultQueueMemoryBudget = 64 << 20
+
+// QueueOverflowPolicy decides what happens when the memory budget of the
+// queue is exceeded.
+type QueueOverflowPolicy string
+
+const (
+	// QueueOverflowBlock blocks the callers until the workers free enough
+	// memory, applying back-pressure to the source.
+	QueueOverflowBlock QueueOverflowPolicy = ""
+	// QueueOverflowSpill moves the oldest messages to files in SpillDir.
+	QueueOverflowSpill QueueOverflowPolicy = "spill"
+)
+
+// QueueConfig configures the queue placed between the controller and the
+// invoker. When enabled, the messages given to the controller are queued and
+// invoked by a pool of workers, so InvokeMessage returns without waiting for
+// the functions.
+type QueueConfig struct {
+	// Workers is the number of messages invoked concurrently. Defaults to 1.
+	Workers int
+
+	// MemoryBudget is the maximum size in bytes of the message bodies held
+	// in memory. Defaults to 64MiB.
+	MemoryBudget int64
+
+	// OverflowPolicy decides what happens when the budget is exceeded.
+	OverflowPolicy QueueOverflowPolicy
+
+	// SpillDir is the directory holding the spilled messages. Required by
+	// QueueOverflowSpill. The spilled messages don't survive a restart: the
+	// spill files left by a previous run are removed on start. Use
+	// PersistDir to recover the messages.
+	SpillDir string
+
+	// PersistDir makes the queue durable: each message is written to this
+	// directory when it is queued, and removed once invoked. The messages
+	// left by a previous run, because it stopped before invoking them or
+	// the gateway was unreachable, are invoked again on start. Their
+	// context, and so their Acknowledger, is not restored.
+	PersistDir string
+}
+
+// queuedMessage is a message waiting to be invoked.
+type queuedMessage struct {
+	ctx     context.Context
+	topic   string
+	message *Message
+
+	// sequence is the sequence of the persisted copy of the message, or 0.
+	sequence uint64
+
+	// completed lists the functions invoked with a recovered message before
+	// the restart.
+	completed []string
+}
+
+// spilledMessage is the content of a spill file or of a persisted message.
+// The context of a spilled message is kept in memory.
+type spilledMessage struct {
+	Topic     string
+	Message   *Message
+	Sequence  uint64   `json:",omitempty"`
+	Completed []string `json:",omitempty"`
+}
+
+// invocationQueue is a FIFO queue of messages with a memory budget. The
+// spilled messages are always older than the messages in memory, so they are
+// dequeued first.
+type invocationQueue struct {
+	config  QueueConfig
+	metrics *Metrics
+	logger  Logger
+
+	lock        sync.Mutex
+	cond        *sync.Cond
+	memory      []queuedMessage
+	memoryBytes int64
+	spillHead   uint64
+	spillTail   uint64
+	spillCtx    map[uint64]context.Context
+	persistNext uint64
+	closed      bool
+	workers     sync.WaitGroup
+}
+
+func newInvocationQueue(config QueueConfig, metrics *Metrics, logger Logger) (*invocationQueue, error) {
+	if config.Workers <= 0 {
+		config.Workers = 1
+	}
+	if config.MemoryBudget <= 0 {
+		config.MemoryBudget = defaultQueueMemoryBudget
+	}
+	if config.OverflowPolicy == QueueOverflowSpill {
+		if len(config.SpillDir) == 0 {
+			return nil, &ConfigError{Field: "Queue.SpillDir", Reason: "required to spill messages"}
+		}
+		if err := os.MkdirAll(config.SpillDir, 0700); err != nil {
+			return nil, err
+		}
+		if err := clearSpilled(config.SpillDir); err != nil {
+			return nil, err
+		}
+	}
+
+	q := &invocationQueue{
+		config:  config,
+		metrics: metrics,
+		logger:  logger,
+	}
+	q.cond = sync.NewCond(&q.lock)
+
+	if len(config.PersistDir) > 0 {
+		if err := os.MkdirAll(config.PersistDir, 0700); err != nil {
+			return nil, err
+		}
+		if err := q.recoverPersisted(); err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+// start runs the workers invoking the queued messages. invoke returns keep as
+// true to keep the persisted copy of a message, to invoke it again on the
+// next start without the completed functions.
+func (q *invocationQueue) start(invoke func(ctx context.Context, topic string, message *Message) (keep bool, completed []string)) {
+	q.workers.Add(q.config.Workers)
+	for i := 0; i < q.config.Workers; i++ {
+		go func() {
+			defer q.workers.Done()
+			for {
+				item, ok := q.pop()
+				if !ok {
+					return
+				}
+				keep, completed := invoke(item.ctx, item.topic, item.message)
+				q.settle(item, keep, completed)
+			}
+		}()
+	}
+}
+
+// close rejects the new messages and waits until the workers have invoked
+// the queued ones or ctx is done.
+func (q *invocationQueue) close(ctx context.Context) error {
+	q.lock.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.lock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// push queues a message, blocking while the memory budget is exceeded unless
+// the messages are spilled to disk.
+func (q *invocationQueue) push(ctx context.Context, topic string, message *Message) error {
+	message, err := bufferBody(message)
+	if err != nil {
+		return err
+	}
+	size := int64(len(message.Body))
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.closed {
+		return ErrControllerStopped
+	}
+
+	for q.memoryBytes > 0 && q.memoryBytes+size > q.config.MemoryBudget {
+		if q.config.OverflowPolicy == QueueOverflowSpill {
+			if err := q.spillOldest(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		done := make(chan struct{})
+		go func() {
+			select {
+			case <-ctx.Done():
+				q.lock.Lock()
+				q.cond.Broadcast()
+				q.lock.Unlock()
+			case <-done:
+			}
+		}()
+		q.cond.Wait()
+		close(done)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if q.closed {
+			return ErrControllerStopped
+		}
+	}
+
+	var sequence uint64
+	if len(q.config.PersistDir) > 0 {
+		if sequence, err = q.persist(topic, message); err != nil {
+			return err
+		}
+	}
+
+	q.memory = append(q.memory, queuedMessage{ctx: ctx, topic: topic, message: message, sequence: sequence})
+	q.memoryBytes += size
+	q.cond.Broadcast()
+	return nil
+}
+
+// pop dequeues the oldest message whose key has its turn, blocking until
+// there is one, so that the messages waiting for the previous messages of
+// their key don't hold the workers. It returns false once the queue is
+// closed and empty.
+func (q *invocationQueue) pop() (queuedMessage, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for {
+		if q.spillHead < q.spillTail && keyTurnReady(q.spillCtx[q.spillHead]) {
+			item, err := q.unspillOldest()
+			if err == nil {
+				return item, true
+			}
+			q.logger.Errorf("Unable to read spilled message: %s", err)
+			nack(item.ctx, err)
+			finishKeyTurn(item.ctx)
+			continue
+		}
+
+		// the messages in memory are newer than the spilled ones, so the
+		// ones with another key than the oldest spilled message can go
+		// first
+		for n, item := range q.memory {
+			if !keyTurnReady(item.ctx) {
+				continue
+			}
+			if n == 0 {
+				q.memory[0] = queuedMessage{}
+				q.memory = q.memory[1:]
+			} else {
+				copy(q.memory[n:], q.memory[n+1:])
+				q.memory[len(q.memory)-1] = queuedMessage{}
+				q.memory = q.memory[:len(q.memory)-1]
+			}
+			q.memoryBytes -= int64(len(item.message.Body))
+			q.cond.Broadcast()
+			return item, true
+		}
+
+		if q.closed && len(q.memory) == 0 && q.spillHead == q.spillTail {
+			return queuedMessage{}, false
+		}
+		q.cond.Wait()
+	}
+}
+
+// wake wakes up the workers waiting for the turn of a key.
+func (q *invocationQueue) wake() {
+	q.lock.Lock()
+	q.cond.Broadcast()
+	q.lock.Unlock()
+}
+
+// spillOldest moves the oldest message in memory to disk.
+func (q *invocationQueue) spillOldest() error {
+	item := q.memory[0]
+
+	data, err := json.Marshal(spilledMessage{Topic: item.topic, Message: item.message, Sequence: item.sequence, Completed: item.completed})
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(q.spillPath(q.spillTail), data, 0600); err != nil {
+		return err
+	}
+
+	if q.spillCtx == nil {
+		q.spillCtx = map[uint64]context.Context{}
+	}
+	q.spillCtx[q.spillTail] = item.ctx
+	q.spillTail++
+	q.memory[0] = queuedMessage{}
+	q.memory = q.memory[1:]
+	q.memoryBytes -= int64(len(item.message.Body))
+
+	if q.metrics != nil {
+		q.metrics.messageSpilled(len(data))
+	}
+	return nil
+}
+
+// unspillOldest reads and removes the oldest spilled message. The returned
+// message holds the context of the spilled message even on error.
+func (q *invocationQueue) unspillOldest() (queuedMessage, error) {
+	path := q.spillPath(q.spillHead)
+	ctx, ok := q.spillCtx[q.spillHead]
+	if !ok {
+		ctx = context.Background()
+	}
+	delete(q.spillCtx, q.spillHead)
+	q.spillHead++
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return queuedMessage{ctx: ctx}, err
+	}
+	_ = os.Remove(path)
+
+	spilled := spilledMessage{}
+	if err := json.Unmarshal(data, &spilled); err != nil {
+		return queuedMessage{ctx: ctx}, err
+	}
+	if spilled.Message == nil {
+		return queuedMessage{ctx: ctx}, fmt.Errorf("empty spilled message in %s", path)
+	}
+
+	return queuedMessage{ctx: ctx, topic: spilled.Topic, message: spilled.Message, sequence: spilled.Sequence, completed: spilled.Completed}, nil
+}
+
+// clearSpilled removes the spill files left in dir by a previous run, which
+// would otherwise be overwritten by the new spilled messages.
+func clearSpilled(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "message-*.json"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (q *invocationQueue) spillPath(sequence uint64) string {
+	return filepath.Join(q.config.SpillDir, fmt.Sprintf("message-%020d.json", sequence))
+}
@@ -0,0 +1,213 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	persistPrefix = "pending-"
+	persistSuffix = ".json"
+)
+
+// persist writes message to PersistDir until it is settled, and returns its
+// sequence. The lock must be held.
+func (q *invocationQueue) persist(topic string, message *Message) (uint64, error) {
+	data, err := json.Marshal(spilledMessage{Topic: topic, Message: message})
+	if err != nil {
+		return 0, err
+	}
+
+	q.persistNext++
+	sequence := q.persistNext
+	if err := writeFileSync(q.persistPath(sequence), data); err != nil {
+		return 0, err
+	}
+	return sequence, nil
+}
+
+// settle removes the persisted copy of a message once it has been invoked,
+// unless keep is true, in which case it is recovered on the next start
+// without the completed functions, which were already invoked.
+func (q *invocationQueue) settle(item queuedMessage, keep bool, completed []string) {
+	if item.sequence == 0 {
+		return
+	}
+	if !keep {
+		if err := os.Remove(q.persistPath(item.sequence)); err != nil && !os.IsNotExist(err) {
+			q.logger.Errorf("Unable to remove the persisted message %d: %s", item.sequence, err)
+		}
+		return
+	}
+	if len(completed) == 0 {
+		return
+	}
+
+	data, err := json.Marshal(spilledMessage{
+		Topic:     item.topic,
+		Message:   item.message,
+		Completed: append(append([]string{}, item.completed...), completed...),
+	})
+	if err == nil {
+		err = writeFileSync(q.persistPath(item.sequence), data)
+	}
+	if err != nil {
+		q.logger.Errorf("Unable to record the functions invoked for the persisted message %d: %s", item.sequence, err)
+	}
+}
+
+// recoverPersisted queues the messages persisted by a previous run which were not
+// invoked, in the order they were received. They are queued over the memory
+// budget, without their context.
+func (q *invocationQueue) recoverPersisted() error {
+	files, err := ioutil.ReadDir(q.config.PersistDir)
+	if err != nil {
+		return err
+	}
+
+	sequences := []uint64{}
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasPrefix(name, persistPrefix) || !strings.HasSuffix(name, persistSuffix) {
+			continue
+		}
+		var sequence uint64
+		if _, err := fmt.Sscanf(strings.TrimSuffix(strings.TrimPrefix(name, persistPrefix), persistSuffix), "%d", &sequence); err != nil {
+			continue
+		}
+		sequences = append(sequences, sequence)
+	}
+	sort.Slice(sequences, func(i, j int) bool { return sequences[i] < sequences[j] })
+
+	for _, sequence := range sequences {
+		if sequence > q.persistNext {
+			q.persistNext = sequence
+		}
+
+		data, err := ioutil.ReadFile(q.persistPath(sequence))
+		if err != nil {
+			return err
+		}
+		persisted := spilledMessage{}
+		if err := json.Unmarshal(data, &persisted); err != nil || persisted.Message == nil {
+			q.logger.Errorf("Skipping the invalid persisted message %s", q.persistPath(sequence))
+			continue
+		}
+
+		q.memory = append(q.memory, queuedMessage{
+			ctx:       withCompletedFunctions(context.Background(), persisted.Completed),
+			topic:     persisted.Topic,
+			message:   persisted.Message,
+			sequence:  sequence,
+			completed: persisted.Completed,
+		})
+		q.memoryBytes += int64(len(persisted.Message.Body))
+	}
+
+	if len(q.memory) > 0 {
+		q.logger.Infof("Recovered %d persisted messages", len(q.memory))
+	}
+	return nil
+}
+
+func (q *invocationQueue) persistPath(sequence uint64) string {
+	return filepath.Join(q.config.PersistDir, fmt.Sprintf("%s%020d%s", persistPrefix, sequence, persistSuffix))
+}
+
+// writeFileSync writes data to a temporary file renamed to path, and syncs
+// both the file and its directory so that it survives a crash.
+func writeFileSync(path string, data []byte) error {
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+// settlement returns keep as true if one of the responses failed because
+// the gateway could not be reached or the invocation was rejected before
+// being sent, e.g. by an open circuit or the rate limiter, so that a
+// persisted message is kept to be retried on the next start, and the
+// functions which were invoked, so that they are skipped on the retry.
+func settlement(responses []InvokerResponse) (keep bool, completed []string) {
+	for _, res := range responses {
+		if res.Error != nil && !res.DeadLettered {
+			if _, unreachable := errors.Cause(res.Error).(*url.Error); unreachable {
+				keep = true
+				continue
+			}
+			if localRejection(res.Error) {
+				keep = true
+				continue
+			}
+		}
+		if len(res.Function) > 0 {
+			completed = append(completed, res.Function)
+		}
+	}
+	return keep, completed
+}
+
+type completedFunctionsKey struct{}
+
+// withCompletedFunctions returns a context skipping the functions already
+// invoked with a recovered message.
+func withCompletedFunctions(ctx context.Context, functions []string) context.Context {
+	if len(functions) == 0 {
+		return ctx
+	}
+	completed := make(map[string]bool, len(functions))
+	for _, function := range functions {
+		completed[function] = true
+	}
+	return context.WithValue(ctx, completedFunctionsKey{}, completed)
+}
+
+// skipCompleted removes from functions the ones already invoked with the
+// message of ctx.
+func skipCompleted(ctx context.Context, functions []string) []string {
+	completed, _ := ctx.Value(completedFunctionsKey{}).(map[string]bool)
+	if len(completed) == 0 {
+		return functions
+	}
+	pending := make([]string, 0, len(functions))
+	for _, function := range functions {
+		if !completed[function] {
+			pending = append(pending, function)
+		}
+	}
+	return pending
+}
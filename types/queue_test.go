@@ -0,0 +1,274 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func Test_invocationQueue_SpillsOldestMessages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	metrics := NewMetrics()
+	q, err := newInvocationQueue(QueueConfig{MemoryBudget: 10, OverflowPolicy: QueueOverflowSpill, SpillDir: dir}, metrics, defaultLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, body := range []string{"first", "second", "third"} {
+		if err := q.push(context.Background(), "topic1", &Message{Body: []byte(body)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if files, _ := ioutil.ReadDir(dir); len(files) != 2 {
+		t.Errorf("Spilled - want: %d files, got: %d", 2, len(files))
+	}
+	if metrics.spilledMessages != 2 {
+		t.Errorf("Metrics - want: %d spilled, got: %d", 2, metrics.spilledMessages)
+	}
+
+	for _, want := range []string{"first", "second", "third"} {
+		item, _ := q.pop()
+		if got := string(item.message.Body); got != want || item.topic != "topic1" {
+			t.Errorf("Pop - want: %s, got: %s (%s)", want, got, item.topic)
+		}
+	}
+
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("Spilled - want the files removed, got: %d", len(files))
+	}
+}
+
+func Test_invocationQueue_ClearsStaleSpillFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	stale := filepath.Join(dir, "message-00000000000000000000.json")
+	if err := ioutil.WriteFile(stale, []byte(`{"Topic":"stale","Message":{"Body":"c3RhbGU="}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(dir, "other.txt")
+	if err := ioutil.WriteFile(other, []byte("kept"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	q, err := newInvocationQueue(QueueConfig{MemoryBudget: 1, OverflowPolicy: QueueOverflowSpill, SpillDir: dir}, NewMetrics(), defaultLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("Stale spill file - want removed, got: %v", err)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("Other file - want kept, got: %v", err)
+	}
+
+	for _, body := range []string{"first", "second"} {
+		if err := q.push(context.Background(), "topic1", &Message{Body: []byte(body)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range []string{"first", "second"} {
+		item, _ := q.pop()
+		if got := string(item.message.Body); got != want {
+			t.Errorf("Pop - want: %s, got: %s", want, got)
+		}
+	}
+}
+
+func Test_invocationQueue_BlocksOverBudget(t *testing.T) {
+	q, err := newInvocationQueue(QueueConfig{MemoryBudget: 10}, nil, defaultLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := q.push(context.Background(), "topic1", &Message{Body: []byte("first")}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := q.push(ctx, "topic1", &Message{Body: []byte("second")}); err != context.DeadlineExceeded {
+		t.Errorf("Push - want: %v, got: %v", context.DeadlineExceeded, err)
+	}
+
+	pushed := make(chan error)
+	go func() {
+		pushed <- q.push(context.Background(), "topic1", &Message{Body: []byte("third")})
+	}()
+
+	q.pop()
+	select {
+	case err := <-pushed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Push - want unblocked once memory is freed")
+	}
+}
+
+func Test_invocationQueue_RecoversPersistedMessages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := newInvocationQueue(QueueConfig{PersistDir: dir}, nil, defaultLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, body := range []string{"first", "second", "third"} {
+		if err := q.push(context.Background(), "topic1", &Message{Body: []byte(body)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The first message is invoked, the second can't reach the gateway and
+	// the third is never invoked before the restart.
+	item, _ := q.pop()
+	q.settle(item, false, nil)
+	item, _ = q.pop()
+	q.settle(item, true, nil)
+
+	restarted, err := newInvocationQueue(QueueConfig{PersistDir: dir}, nil, defaultLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := restarted.push(context.Background(), "topic1", &Message{Body: []byte("fourth")}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"second", "third", "fourth"} {
+		item, _ := restarted.pop()
+		if got := string(item.message.Body); got != want || item.topic != "topic1" {
+			t.Errorf("Pop - want: %s, got: %s (%s)", want, got, item.topic)
+		}
+		restarted.settle(item, false, nil)
+	}
+
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("Persisted - want the files removed, got: %d", len(files))
+	}
+}
+
+func Test_invocationQueue_RecoversCompletedFunctions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := newInvocationQueue(QueueConfig{PersistDir: dir}, nil, defaultLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.push(context.Background(), "topic1", &Message{Body: []byte("first")}); err != nil {
+		t.Fatal(err)
+	}
+	item, _ := q.pop()
+	q.settle(item, true, []string{"fn1"})
+
+	restarted, err := newInvocationQueue(QueueConfig{PersistDir: dir}, nil, defaultLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item, _ = restarted.pop()
+	got := skipCompleted(item.ctx, []string{"fn1", "fn2"})
+	if !reflect.DeepEqual(got, []string{"fn2"}) {
+		t.Errorf("Pending functions - want: [fn2], got: %v", got)
+	}
+
+	// The functions completed before each restart add up.
+	restarted.settle(item, true, []string{"fn2"})
+	again, err := newInvocationQueue(QueueConfig{PersistDir: dir}, nil, defaultLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item, _ = again.pop()
+	if got := skipCompleted(item.ctx, []string{"fn1", "fn2", "fn3"}); !reflect.DeepEqual(got, []string{"fn3"}) {
+		t.Errorf("Pending functions - want: [fn3], got: %v", got)
+	}
+}
+
+func Test_newController_FailsWithoutPersistDir(t *testing.T) {
+	file, err := ioutil.TempFile("", "queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+
+	config := &ControllerConfig{
+		GatewayURL:      "http://gateway:8080",
+		RebuildInterval: time.Second,
+		Logger:          NewStdLogger(LevelError),
+		Queue:           &QueueConfig{PersistDir: file.Name()},
+	}
+	if _, err := NewValidatedController(nil, config); err == nil {
+		t.Fatal("want an error when the PersistDir is a file")
+	}
+
+	c := NewController(nil, config).(*controller)
+	defer c.Close()
+	if c.queue != nil {
+		t.Errorf("want the controller created without the queue")
+	}
+}
+
+func Test_settlement(t *testing.T) {
+	unreachable := &url.Error{Op: "Post", URL: "http://gateway:8080", Err: fmt.Errorf("connection refused")}
+
+	cases := []struct {
+		name      string
+		responses []InvokerResponse
+		keep      bool
+		completed []string
+	}{
+		{name: "no function"},
+		{name: "invoked", responses: []InvokerResponse{{Function: "fn1", Status: 500}}, completed: []string{"fn1"}},
+		{name: "unreachable", responses: []InvokerResponse{{Function: "fn1", Status: 200}, {Function: "fn2", Error: errors.Wrap(unreachable, "unable to invoke")}}, keep: true, completed: []string{"fn1"}},
+		{name: "dead-lettered", responses: []InvokerResponse{{Function: "fn1", Error: unreachable, DeadLettered: true}}, completed: []string{"fn1"}},
+		{name: "stopped", responses: []InvokerResponse{{Error: ErrInvokerClosed}}, keep: true},
+	}
+	for _, rejection := range []error{ErrPaused, ErrCircuitOpen, ErrFunctionDraining, ErrInvokerClosed, ErrControllerStopped, ErrBusy, ErrRateLimited} {
+		cases = append(cases, struct {
+			name      string
+			responses []InvokerResponse
+			keep      bool
+			completed []string
+		}{
+			name:      rejection.Error(),
+			responses: []InvokerResponse{{Function: "fn1", Status: 200}, {Function: "fn2", Error: errors.Wrap(rejection, "fn2")}},
+			keep:      true,
+			completed: []string{"fn1"},
+		})
+	}
+
+	for _, tc := range cases {
+		keep, completed := settlement(tc.responses)
+		if keep != tc.keep || !reflect.DeepEqual(completed, tc.completed) {
+			t.Errorf("%s: settlement - want: %v %v, got: %v %v", tc.name, tc.keep, tc.completed, keep, completed)
+		}
+	}
+}
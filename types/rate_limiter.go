@@ -0,0 +1,172 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+const rateLimitWindow = time.Second
+
+// RateLimiter is a token bucket limiting the invocations per second. Its
+// limit can be changed at runtime.
+//
+// When a SharedState is set, the limit is enforced across all the replicas
+// sharing the state using a counter per window of one second, or longer for
+// rates below one per second so that a window allows at least one
+// invocation, and the burst is ignored. The local token bucket is used if
+// the state can't be reached.
+type RateLimiter struct {
+	// SharedState enforces the limit across replicas, if set.
+	SharedState SharedState
+
+	// Key identifies the limit in the SharedState. Defaults to "connector".
+	Key string
+
+	lock   sync.Mutex
+	rate   float64
+	burst  int
+	tokens float64
+	last   time.Time
+
+	// now and after replace the clock of the limiter in the tests.
+	now   func() time.Time
+	after func(time.Duration) <-chan time.Time
+}
+
+// NewRateLimiter creates a RateLimiter allowing rate invocations per second
+// with bursts of up to burst invocations. A rate of zero disables the limit.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	l := &RateLimiter{}
+	l.SetLimit(rate, burst)
+	return l
+}
+
+// SetLimit changes the rate and burst of the limiter.
+func (l *RateLimiter) SetLimit(rate float64, burst int) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if burst < 1 {
+		burst = 1
+	}
+	l.rate = rate
+	l.burst = burst
+	l.tokens = float64(burst)
+	l.last = l.clock()
+}
+
+// Limit returns the rate and burst of the limiter.
+func (l *RateLimiter) Limit() (float64, int) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.rate, l.burst
+}
+
+// Wait blocks until an invocation is allowed or ctx is done.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	for {
+		delay, err := l.reserveShared(ctx)
+		if err != nil {
+			delay = l.reserve()
+		}
+		if delay == 0 {
+			return nil
+		}
+		if err := l.sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// sleep waits for delay or for ctx to be done.
+func (l *RateLimiter) sleep(ctx context.Context, delay time.Duration) error {
+	if l.after != nil {
+		select {
+		case <-l.after(delay):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *RateLimiter) clock() time.Time {
+	if l.now == nil {
+		return time.Now()
+	}
+	return l.now()
+}
+
+// reserveShared counts an invocation in the current window of the shared
+// state. If the window is full, it returns how long to wait for the next one.
+func (l *RateLimiter) reserveShared(ctx context.Context) (time.Duration, error) {
+	if l.SharedState == nil {
+		return 0, fmt.Errorf("no shared state")
+	}
+
+	rate, _ := l.Limit()
+	if rate <= 0 {
+		return 0, nil
+	}
+
+	key := l.Key
+	if len(key) == 0 {
+		key = "connector"
+	}
+
+	length := rateLimitWindow
+	if rate < 1 {
+		length = time.Duration(math.Ceil(1/rate)) * rateLimitWindow
+	}
+
+	now := l.clock()
+	window := now.Truncate(length)
+	count, err := l.SharedState.Increment(ctx, fmt.Sprintf("ratelimit:%s:%d:%d", key, length/time.Second, window.Unix()), 1, 2*length)
+	if err != nil {
+		return 0, err
+	}
+
+	if count <= int64(rate*length.Seconds()) {
+		return 0, nil
+	}
+	return window.Add(length).Sub(now), nil
+}
+
+// reserve takes a token if available, otherwise it returns how long to wait
+// for the next one.
+func (l *RateLimiter) reserve() time.Duration {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.rate <= 0 {
+		return 0
+	}
+
+	now := l.clock()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > float64(l.burst) {
+		l.tokens = float64(l.burst)
+	}
+	l.last = now
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
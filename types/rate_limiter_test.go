@@ -0,0 +1,64 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func Test_RateLimiter_SharedState(t *testing.T) {
+	state := NewMemoryState()
+
+	replica1 := NewRateLimiter(2, 10)
+	replica1.SharedState = state
+	replica2 := NewRateLimiter(2, 10)
+	replica2.SharedState = state
+
+	// Wait for the beginning of a window so both invocations fall in it
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+
+	if delay, err := replica1.reserveShared(context.Background()); err != nil || delay != 0 {
+		t.Fatalf("First invocation - want no delay, got: %s (%v)", delay, err)
+	}
+	if delay, err := replica2.reserveShared(context.Background()); err != nil || delay != 0 {
+		t.Fatalf("Second invocation - want no delay, got: %s (%v)", delay, err)
+	}
+	if delay, _ := replica1.reserveShared(context.Background()); delay == 0 {
+		t.Errorf("Third invocation - want delay as the limit is shared")
+	}
+}
+
+func Test_RateLimiter_Unlimited(t *testing.T) {
+	limiter := NewRateLimiter(0, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	for i := 0; i < 100; i++ {
+		if err := limiter.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func Test_RateLimiter_SharedStateBelowOnePerSecond(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter(0.25, 1)
+	limiter.SharedState = NewMemoryState()
+	limiter.now = func() time.Time { return now }
+
+	if delay, err := limiter.reserveShared(context.Background()); err != nil || delay != 0 {
+		t.Fatalf("First invocation - want no delay, got: %s (%v)", delay, err)
+	}
+	now = now.Add(time.Second)
+	if delay, _ := limiter.reserveShared(context.Background()); delay != 3*time.Second {
+		t.Errorf("Second invocation - want: %s, got: %s", 3*time.Second, delay)
+	}
+	now = now.Add(3 * time.Second)
+	if delay, err := limiter.reserveShared(context.Background()); err != nil || delay != 0 {
+		t.Errorf("Next window - want no delay, got: %s (%v)", delay, err)
+	}
+}
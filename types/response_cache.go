@@ -0,0 +1,122 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// defaultResponseCacheSize is the maximum number of responses cached when
+// none is given.
+const defaultResponseCacheSize = 10000
+
+// ResponseCache caches the successful responses of the functions, keyed by
+// function and payload hash, so identical invocations within the TTL are
+// answered without invoking the function again. Use it only with idempotent
+// functions.
+type ResponseCache struct {
+	ttl        time.Duration
+	maxEntries int
+
+	lock    sync.Mutex
+	entries map[string]cachedResponse
+}
+
+type cachedResponse struct {
+	body      *[]byte
+	header    *http.Header
+	status    int
+	expiresAt time.Time
+}
+
+// clone returns a copy of the response, so the body and the header of the
+// cached responses can't be modified by the callers.
+func (r cachedResponse) clone() cachedResponse {
+	clone := cachedResponse{status: r.status, expiresAt: r.expiresAt}
+	if r.body != nil {
+		body := append([]byte(nil), *r.body...)
+		clone.body = &body
+	}
+	if r.header != nil {
+		header := r.header.Clone()
+		clone.header = &header
+	}
+	return clone
+}
+
+// NewResponseCache creates a ResponseCache keeping the responses for ttl, up
+// to maxEntries responses. maxEntries defaults to 10000.
+func NewResponseCache(ttl time.Duration, maxEntries int) *ResponseCache {
+	if maxEntries <= 0 {
+		maxEntries = defaultResponseCacheSize
+	}
+	return &ResponseCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]cachedResponse),
+	}
+}
+
+func responseCacheKey(function string, payload []byte) string {
+	sum := sha256.Sum256(payload)
+	return function + "/" + hex.EncodeToString(sum[:])
+}
+
+// get returns the cached response of a function for a payload.
+func (c *ResponseCache) get(function string, payload []byte) (cachedResponse, bool) {
+	key := responseCacheKey(function, payload)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return cachedResponse{}, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(c.entries, key)
+		return cachedResponse{}, false
+	}
+	return entry.clone(), true
+}
+
+// put caches a response if it is a successful synchronous response.
+func (c *ResponseCache) put(function string, payload []byte, res InvokerResponse) {
+	if res.Error != nil || res.Status < 200 || res.Status > 299 || res.Status == http.StatusAccepted {
+		return
+	}
+
+	now := time.Now()
+	key := responseCacheKey(function, payload)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, exists := c.entries[key]; !exists && len(c.entries) >= c.maxEntries {
+		c.prune(now)
+		if len(c.entries) >= c.maxEntries {
+			return
+		}
+	}
+
+	c.entries[key] = cachedResponse{
+		body:      res.Body,
+		header:    res.Header,
+		status:    res.Status,
+		expiresAt: now.Add(c.ttl),
+	}.clone()
+}
+
+// prune removes the expired responses.
+func (c *ResponseCache) prune(now time.Time) {
+	for key, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, key)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_InvokeMessage_ResponseCache(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Write([]byte("enriched"))
+	}))
+	defer srv.Close()
+
+	invoker := NewInvoker(srv.URL+"/function", "", srv.Client(), false, false)
+	invoker.ResponseCache = NewResponseCache(time.Minute, 0)
+	topicMap := newTestTopicMap(map[string][]string{"topic1": {"enrich"}})
+
+	responses := collectResponses(invoker, func() {
+		invoker.InvokeMessage(context.Background(), topicMap, "topic1", &Message{Body: []byte("hello")})
+		invoker.InvokeMessage(context.Background(), topicMap, "topic1", &Message{Body: []byte("hello")})
+		invoker.InvokeMessage(context.Background(), topicMap, "topic1", &Message{Body: []byte("other")})
+	})
+
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("Calls - want: %d, got: %d", 2, got)
+	}
+	if len(responses) != 3 {
+		t.Fatalf("Responses - want: %d, got: %d", 3, len(responses))
+	}
+	if responses[0].Cached || !responses[1].Cached || responses[2].Cached {
+		t.Errorf("Cached - want: [false true false], got: [%v %v %v]", responses[0].Cached, responses[1].Cached, responses[2].Cached)
+	}
+	if string(*responses[1].Body) != "enriched" {
+		t.Errorf("Body - want: %q, got: %q", "enriched", string(*responses[1].Body))
+	}
+}
+
+func Test_ResponseCache_SkipsFailuresAndExpires(t *testing.T) {
+	cache := NewResponseCache(10*time.Millisecond, 0)
+	body := []byte("ok")
+
+	cache.put("fn", []byte("a"), InvokerResponse{Status: http.StatusInternalServerError, Body: &body})
+	if _, ok := cache.get("fn", []byte("a")); ok {
+		t.Errorf("want failed responses not cached")
+	}
+
+	cache.put("fn", []byte("a"), InvokerResponse{Status: http.StatusOK, Body: &body})
+	if _, ok := cache.get("fn", []byte("a")); !ok {
+		t.Errorf("want successful response cached")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := cache.get("fn", []byte("a")); ok {
+		t.Errorf("want response expired")
+	}
+}
+
+func Test_ResponseCache_CopiesResponses(t *testing.T) {
+	cache := NewResponseCache(time.Minute, 0)
+	body := []byte("ok")
+	header := http.Header{"X-Test": {"a"}}
+
+	cache.put("fn", []byte("a"), InvokerResponse{Status: http.StatusOK, Body: &body, Header: &header})
+	body[0] = 'X'
+	header.Set("X-Test", "b")
+
+	cached, ok := cache.get("fn", []byte("a"))
+	if !ok {
+		t.Fatalf("want response cached")
+	}
+	(*cached.body)[0] = 'Y'
+	cached.header.Set("X-Test", "c")
+
+	cached, _ = cache.get("fn", []byte("a"))
+	if got := string(*cached.body); got != "ok" {
+		t.Errorf("Body - want: %q, got: %q", "ok", got)
+	}
+	if got := cached.header.Get("X-Test"); got != "a" {
+		t.Errorf("Header - want: %q, got: %q", "a", got)
+	}
+}
+
+func Test_InvokeMessage_ResponseCacheStructuredCloudEvents(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Write([]byte("enriched"))
+	}))
+	defer srv.Close()
+
+	invoker := NewInvoker(srv.URL+"/function", "", srv.Client(), false, false)
+	invoker.CloudEventsMode = CloudEventsStructured
+	invoker.ResponseCache = NewResponseCache(time.Minute, 0)
+	topicMap := newTestTopicMap(map[string][]string{"topic1": {"enrich"}})
+
+	responses := collectResponses(invoker, func() {
+		invoker.InvokeMessage(context.Background(), topicMap, "topic1", &Message{Body: []byte(`{"id":1}`)})
+		invoker.InvokeMessage(context.Background(), topicMap, "topic1", &Message{Body: []byte(`{"id":1}`)})
+		invoker.InvokeMessage(context.Background(), topicMap, "topic1", &Message{Body: []byte("other")})
+		invoker.InvokeMessage(context.Background(), topicMap, "topic1", &Message{Body: []byte("other")})
+	})
+
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("Calls - want: %d, got: %d", 2, got)
+	}
+	if len(responses) != 4 {
+		t.Fatalf("Responses - want: %d, got: %d", 4, len(responses))
+	}
+	if !responses[1].Cached || !responses[3].Cached {
+		t.Errorf("Cached - want: [true true], got: [%v %v]", responses[1].Cached, responses[3].Cached)
+	}
+}
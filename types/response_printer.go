@@ -5,23 +5,63 @@ package types
 
 import (
 	"fmt"
-	"log"
+	"math/rand"
 )
 
 // ResponsePrinter prints function results
 type ResponsePrinter struct {
 	PrintResponseBody bool
+
+	// SampleRate is the fraction of the successful responses printed, e.g.
+	// 0.01 for 1%, so that printing can stay enabled at high volume. Errors
+	// are always printed. Zero or one prints every response.
+	SampleRate float64
+
+	// MaxBodyLength truncates the printed bodies to this number of bytes.
+	// Zero prints the whole body.
+	MaxBodyLength int
+
+	// Logger is used to log the results. Defaults to the standard log package.
+	Logger Logger
 }
 
 // Response is triggered by the controller when a message is
 // received from the function invocation
 func (rp *ResponsePrinter) Response(res InvokerResponse) {
+	tenant := ""
+	if len(res.Tenant) > 0 {
+		tenant = fmt.Sprintf(" (tenant %s)", res.Tenant)
+	}
+
 	if res.Error != nil {
-		log.Printf("connector-sdk got error: %s", res.Error.Error())
-	} else {
-		log.Printf("connector-sdk got result: [%d] %s => %s (%d) bytes", res.Status, res.Topic, res.Function, len(*res.Body))
+		rp.logger().Errorf("connector-sdk got error%s: %s", tenant, res.Error.Error())
+	} else if rp.sampled() {
+		rp.logger().Infof("connector-sdk got result%s: [%d] %s => %s (%d) bytes", tenant, res.Status, res.Topic, res.Function, len(*res.Body))
 		if rp.PrintResponseBody {
-			fmt.Printf("[%d] %s => %s\n%s\n", res.Status, res.Topic, res.Function, string(*res.Body))
+			fmt.Printf("[%d] %s => %s\n%s\n", res.Status, res.Topic, res.Function, rp.truncate(*res.Body))
 		}
 	}
 }
+
+// sampled returns true if a response is to be printed.
+func (rp *ResponsePrinter) sampled() bool {
+	if rp.SampleRate <= 0 || rp.SampleRate >= 1 {
+		return true
+	}
+	return rand.Float64() < rp.SampleRate
+}
+
+// truncate cuts body to MaxBodyLength.
+func (rp *ResponsePrinter) truncate(body []byte) string {
+	if rp.MaxBodyLength <= 0 || len(body) <= rp.MaxBodyLength {
+		return string(body)
+	}
+	return fmt.Sprintf("%s... (%d bytes truncated)", body[:rp.MaxBodyLength], len(body)-rp.MaxBodyLength)
+}
+
+func (rp *ResponsePrinter) logger() Logger {
+	if rp.Logger == nil {
+		return defaultLogger
+	}
+	return rp.Logger
+}
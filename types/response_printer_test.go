@@ -0,0 +1,49 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+// countingLogger counts the messages logged at each level.
+type countingLogger struct {
+	infos, errors int32
+}
+
+func (l *countingLogger) Debugf(format string, args ...interface{}) {}
+func (l *countingLogger) Infof(format string, args ...interface{})  { atomic.AddInt32(&l.infos, 1) }
+func (l *countingLogger) Warnf(format string, args ...interface{})  {}
+func (l *countingLogger) Errorf(format string, args ...interface{}) { atomic.AddInt32(&l.errors, 1) }
+
+func Test_ResponsePrinter_SampleRate(t *testing.T) {
+	logger := &countingLogger{}
+	printer := &ResponsePrinter{SampleRate: 0.1, Logger: logger}
+
+	body := []byte("ok")
+	for i := 0; i < 1000; i++ {
+		printer.Response(InvokerResponse{Status: 200, Body: &body})
+		printer.Response(InvokerResponse{Error: fmt.Errorf("unreachable")})
+	}
+
+	if logger.infos < 50 || logger.infos > 200 {
+		t.Errorf("Printed results - want about %d, got: %d", 100, logger.infos)
+	}
+	if logger.errors != 1000 {
+		t.Errorf("Printed errors - want: %d, got: %d", 1000, logger.errors)
+	}
+}
+
+func Test_ResponsePrinter_truncate(t *testing.T) {
+	printer := &ResponsePrinter{MaxBodyLength: 5}
+
+	if got, want := printer.truncate([]byte("hello world")), "hello... (6 bytes truncated)"; got != want {
+		t.Errorf("Body - want: %q, got: %q", want, got)
+	}
+	if got, want := printer.truncate([]byte("hello")), "hello"; got != want {
+		t.Errorf("Body - want: %q, got: %q", want, got)
+	}
+}
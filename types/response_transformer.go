@@ -0,0 +1,27 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+// ResponseTransformer normalizes or validates the responses of the functions
+// before they are published to the subscribers, e.g. to unwrap an envelope,
+// decode a base64 body or turn an invalid response into an error.
+type ResponseTransformer interface {
+	Transform(res InvokerResponse) InvokerResponse
+}
+
+// ResponseTransformerFunc adapts a function to a ResponseTransformer.
+type ResponseTransformerFunc func(res InvokerResponse) InvokerResponse
+
+// Transform calls f.
+func (f ResponseTransformerFunc) Transform(res InvokerResponse) InvokerResponse {
+	return f(res)
+}
+
+// transform applies the ResponseTransformer of the Invoker, if set.
+func (i *Invoker) transform(res InvokerResponse) InvokerResponse {
+	if i.ResponseTransformer == nil {
+		return res
+	}
+	return i.ResponseTransformer.Transform(res)
+}
@@ -0,0 +1,98 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultRetryAfter is the delay used when a 429 response doesn't include a
+// valid Retry-After header.
+const defaultRetryAfter = time.Second
+
+// post sends the payload to a function. When RetryAfterMaxWait is set and
+// the response is retryable (429 unless ShouldRetry decides otherwise), the
+// request is sent again after the delay given by the Retry-After header, as
+// long as the total wait doesn't exceed RetryAfterMaxWait.
+func (i *Invoker) post(ctx context.Context, function, gwURL string, header http.Header, payload []byte, discard bool) (*[]byte, int, *http.Header, error) {
+	var waited time.Duration
+	for {
+		body, statusCode, resHeader, err := invokefunction(ctx, i.Client, i.Auth, gwURL, header, bytes.NewReader(payload), discard)
+		if i.RetryAfterMaxWait <= 0 || !i.shouldRetry(InvokerResponse{
+			Context:  ctx,
+			Body:     body,
+			Header:   resHeader,
+			Status:   statusCode,
+			Error:    err,
+			Function: function,
+		}) {
+			return body, statusCode, resHeader, err
+		}
+
+		delay, ok := time.Duration(0), false
+		if resHeader != nil {
+			delay, ok = parseRetryAfter(resHeader.Get("Retry-After"), time.Now())
+		}
+		if !ok {
+			delay = defaultRetryAfter
+		}
+		if waited+delay > i.RetryAfterMaxWait {
+			return body, statusCode, resHeader, err
+		}
+		if !i.RetryBudget.withdraw() {
+			i.logger().Debugf("Function at %s not retried, retry budget exhausted", gwURL)
+			return body, statusCode, resHeader, err
+		}
+
+		i.logger().Debugf("Function at %s returned %d, retrying in %s", gwURL, statusCode, delay)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return body, statusCode, resHeader, err
+		}
+		waited += delay
+	}
+}
+
+// shouldRetry reports whether an invocation is retried: by default, only
+// when it was rejected with 429.
+func (i *Invoker) shouldRetry(res InvokerResponse) bool {
+	if i.ShouldRetry != nil {
+		return i.ShouldRetry(res)
+	}
+	return res.Error == nil && res.Status == http.StatusTooManyRequests
+}
+
+// parseRetryAfter parses the value of a Retry-After header, given either as
+// a number of seconds or as an HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	if delay := date.Sub(now); delay > 0 {
+		return delay, true
+	}
+	return 0, true
+}
@@ -0,0 +1,97 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_parseRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{value: "3", want: 3 * time.Second, ok: true},
+		{value: "0", want: 0, ok: true},
+		{value: now.Add(10 * time.Second).Format(http.TimeFormat), want: 10 * time.Second, ok: true},
+		{value: now.Add(-10 * time.Second).Format(http.TimeFormat), want: 0, ok: true},
+		{value: "", ok: false},
+		{value: "-1", ok: false},
+		{value: "soon", ok: false},
+	}
+
+	for _, test := range tests {
+		got, ok := parseRetryAfter(test.value, now)
+		if ok != test.ok || got != test.want {
+			t.Errorf("Retry-After %q - want: %s (%v), got: %s (%v)", test.value, test.want, test.ok, got, ok)
+		}
+	}
+}
+
+func Test_Invoke_RetriesAfter429(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	invoker := NewInvoker(srv.URL+"/function", "", srv.Client(), false, false)
+	invoker.RetryAfterMaxWait = time.Second
+	topicMap := newTestTopicMap(map[string][]string{"topic1": {"echo"}})
+
+	responses := collectResponses(invoker, func() {
+		invoker.InvokeMessage(context.Background(), topicMap, "topic1", &Message{Body: []byte("hello")})
+	})
+
+	if len(responses) != 1 || responses[0].Status != http.StatusOK {
+		t.Errorf("Responses - want 1 response with status 200, got: %+v", responses)
+	}
+	if calls != 2 {
+		t.Errorf("Calls - want: %d, got: %d", 2, calls)
+	}
+}
+
+func Test_Invoke_ShouldRetry(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&calls, 1) {
+		case 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusConflict)
+		}
+	}))
+	defer srv.Close()
+
+	invoker := NewInvoker(srv.URL+"/function", "", srv.Client(), false, false)
+	invoker.RetryAfterMaxWait = time.Second
+	invoker.ShouldRetry = func(res InvokerResponse) bool {
+		if res.Function != "echo" {
+			t.Errorf("Function - want: %s, got: %s", "echo", res.Function)
+		}
+		return res.Status == http.StatusServiceUnavailable
+	}
+
+	res := invoker.invoke(context.Background(), "topic1", "echo", &Message{Body: []byte("hello")}, []byte("hello"), http.Header{}, invokeOptions{})
+	if res.Status != http.StatusConflict {
+		t.Errorf("Status - want: %d, got: %d", http.StatusConflict, res.Status)
+	}
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("Calls - want: %d, got: %d", 2, got)
+	}
+}
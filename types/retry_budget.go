@@ -0,0 +1,128 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultRetryBudgetRatio  = 0.2
+	defaultRetryBudgetWindow = 10 * time.Second
+	retryBudgetBuckets       = 10
+)
+
+// RetryBudget caps the retries of the invoker, the 429 retries and the
+// failovers to another gateway, to a ratio of the invocations sent over a
+// sliding window, so that retries don't amplify the load on a gateway
+// that is already failing.
+type RetryBudget struct {
+	// Ratio is the maximum number of retries per invocation. Defaults to 0.2.
+	Ratio float64
+
+	// Window is the sliding window over which the retries and invocations
+	// are counted. Defaults to 10 seconds.
+	Window time.Duration
+
+	// MinRetries are allowed in every window regardless of the ratio, so that
+	// a low traffic connector can still retry.
+	MinRetries int
+
+	// Metrics counts the retries and the retries denied by the budget, if set.
+	Metrics *Metrics
+
+	lock    sync.Mutex
+	buckets [retryBudgetBuckets]retryBucket
+}
+
+// retryBucket counts the invocations and retries of a slice of the window.
+type retryBucket struct {
+	slot     int64
+	requests int
+	retries  int
+}
+
+// NewRetryBudget creates a retry budget allowing ratio retries per
+// invocation over window.
+func NewRetryBudget(ratio float64, window time.Duration) *RetryBudget {
+	return &RetryBudget{Ratio: ratio, Window: window}
+}
+
+// deposit records an invocation, which adds Ratio to the budget.
+func (b *RetryBudget) deposit() {
+	if b == nil {
+		return
+	}
+
+	b.lock.Lock()
+	b.bucket(time.Now()).requests++
+	b.lock.Unlock()
+}
+
+// withdraw records a retry and reports whether the budget allows it.
+func (b *RetryBudget) withdraw() bool {
+	if b == nil {
+		return true
+	}
+
+	b.lock.Lock()
+	now := time.Now()
+	requests, retries := b.sum(now)
+	allowed := retries < b.MinRetries || float64(retries+1) <= b.ratio()*float64(requests)
+	if allowed {
+		b.bucket(now).retries++
+	}
+	b.lock.Unlock()
+
+	if b.Metrics != nil {
+		b.Metrics.retry(allowed)
+	}
+	return allowed
+}
+
+func (b *RetryBudget) ratio() float64 {
+	if b.Ratio <= 0 {
+		return defaultRetryBudgetRatio
+	}
+	return b.Ratio
+}
+
+// slotWidth is the duration covered by each bucket.
+func (b *RetryBudget) slotWidth() int64 {
+	window := b.Window
+	if window <= 0 {
+		window = defaultRetryBudgetWindow
+	}
+	width := int64(window) / retryBudgetBuckets
+	if width <= 0 {
+		width = 1
+	}
+	return width
+}
+
+// bucket returns the bucket of now, resetting it if it belongs to a past
+// window. The lock must be held.
+func (b *RetryBudget) bucket(now time.Time) *retryBucket {
+	slot := now.UnixNano() / b.slotWidth()
+	bucket := &b.buckets[slot%retryBudgetBuckets]
+	if bucket.slot != slot {
+		*bucket = retryBucket{slot: slot}
+	}
+	return bucket
+}
+
+// sum returns the invocations and retries within the window ending at now.
+// The lock must be held.
+func (b *RetryBudget) sum(now time.Time) (int, int) {
+	slot := now.UnixNano() / b.slotWidth()
+	requests, retries := 0, 0
+	for _, bucket := range b.buckets {
+		if bucket.slot > slot-retryBudgetBuckets && bucket.slot <= slot {
+			requests += bucket.requests
+			retries += bucket.retries
+		}
+	}
+	return requests, retries
+}
@@ -0,0 +1,66 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_RetryBudget_LimitsRetriesToRatio(t *testing.T) {
+	budget := NewRetryBudget(0.2, time.Minute)
+	for i := 0; i < 10; i++ {
+		budget.deposit()
+	}
+
+	if !budget.withdraw() || !budget.withdraw() {
+		t.Fatal("want the first 2 retries allowed")
+	}
+	if budget.withdraw() {
+		t.Error("want the third retry denied")
+	}
+}
+
+func Test_RetryBudget_MinRetries(t *testing.T) {
+	budget := NewRetryBudget(0.2, time.Minute)
+	budget.MinRetries = 1
+
+	if !budget.withdraw() {
+		t.Error("want a retry allowed by MinRetries")
+	}
+	if budget.withdraw() {
+		t.Error("want the second retry denied")
+	}
+}
+
+func Test_RetryBudget_StopsRetryAfterLoop(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	metrics := NewMetrics()
+	invoker := NewInvoker(srv.URL+"/function", "", srv.Client(), false, false)
+	invoker.RetryAfterMaxWait = time.Second
+	invoker.RetryBudget = NewRetryBudget(0.5, time.Minute)
+	invoker.RetryBudget.Metrics = metrics
+
+	res := invoker.invoke(context.Background(), "topic1", "echo", &Message{Body: []byte("hello")}, []byte("hello"), http.Header{}, invokeOptions{})
+	if res.Status != http.StatusTooManyRequests {
+		t.Errorf("Status - want: %d, got: %d", http.StatusTooManyRequests, res.Status)
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("Calls - want: %d, got: %d", 1, got)
+	}
+	if got := atomic.LoadUint64(&metrics.retriesDenied); got != 1 {
+		t.Errorf("Denied retries - want: %d, got: %d", 1, got)
+	}
+}
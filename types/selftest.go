@@ -0,0 +1,100 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// defaultSelftestPayload is sent to the health-check function when no
+// SelftestPayload is configured.
+var defaultSelftestPayload = []byte(`{"selftest":true}`)
+
+// SelftestReport is the result of a self-test of the controller.
+type SelftestReport struct {
+	OK     bool            `json:"ok"`
+	Checks []SelftestCheck `json:"checks"`
+}
+
+// SelftestCheck is the result of a single self-test step.
+type SelftestCheck struct {
+	Name       string `json:"name"`
+	OK         bool   `json:"ok"`
+	Skipped    bool   `json:"skipped,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+	Detail     string `json:"detail,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Selftest checks that the functions can be discovered through the gateway
+// and, when SelftestFunction is set, that the health-check function can be
+// invoked successfully with a synthetic payload. The response of the
+// health-check function is not delivered to the subscribers.
+func (c *controller) Selftest(ctx context.Context) SelftestReport {
+	report := SelftestReport{OK: true}
+	add := func(check SelftestCheck) {
+		report.Checks = append(report.Checks, check)
+		if !check.OK && !check.Skipped {
+			report.OK = false
+		}
+	}
+
+	add(c.selftestDiscovery(ctx))
+	add(c.selftestInvoke(ctx))
+
+	return report
+}
+
+func (c *controller) selftestDiscovery(ctx context.Context) SelftestCheck {
+	check := SelftestCheck{Name: "discovery"}
+	start := time.Now()
+
+	lookups, err := c.newTopicSource().Build(ctx)
+	check.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+
+	check.OK = true
+	check.Detail = fmt.Sprintf("%d topics", len(lookups))
+	return check
+}
+
+func (c *controller) selftestInvoke(ctx context.Context) SelftestCheck {
+	check := SelftestCheck{Name: "invoke"}
+	if len(c.Config.SelftestFunction) == 0 {
+		check.Skipped = true
+		check.Detail = "no SelftestFunction configured"
+		return check
+	}
+
+	payload := c.Config.SelftestPayload
+	if len(payload) == 0 {
+		payload = defaultSelftestPayload
+	}
+	message := &Message{Body: payload}
+
+	body, header, err := c.Invoker.request(ctx, "", message)
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+
+	res := c.Invoker.invoke(ctx, "", c.Config.SelftestFunction, message, body, header, invokeOptions{})
+	check.DurationMs = res.Duration.Milliseconds()
+	check.Detail = res.Function
+
+	switch {
+	case res.Error != nil:
+		check.Error = res.Error.Error()
+	case res.Status < 200 || res.Status > 299:
+		check.Error = fmt.Sprintf("unexpected status code: %d", res.Status)
+	default:
+		check.OK = true
+	}
+	return check
+}
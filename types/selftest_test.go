@@ -0,0 +1,57 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas-provider/types"
+)
+
+func Test_Controller_Selftest(t *testing.T) {
+	var unhealthy int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/system/namespaces":
+			_ = json.NewEncoder(w).Encode([]string{})
+		case "/system/functions":
+			_ = json.NewEncoder(w).Encode([]types.FunctionStatus{
+				{Name: "echo", Annotations: &map[string]string{"topic": "topic1"}},
+			})
+		case "/function/health":
+			if atomic.LoadInt32(&unhealthy) == 1 {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	controller := NewController(nil, &ControllerConfig{
+		GatewayURL:       srv.URL,
+		RebuildInterval:  time.Second,
+		SelftestFunction: "health",
+	}).(*controller)
+
+	report := controller.Selftest(context.Background())
+	if !report.OK || len(report.Checks) != 2 {
+		t.Fatalf("Report - want: ok with 2 checks, got: %+v", report)
+	}
+	if report.Checks[0].Detail != "1 topics" {
+		t.Errorf("Discovery - want: %q, got: %q", "1 topics", report.Checks[0].Detail)
+	}
+
+	atomic.StoreInt32(&unhealthy, 1)
+	report = controller.Selftest(context.Background())
+	if report.OK || report.Checks[1].OK {
+		t.Errorf("Report - want failed invoke check, got: %+v", report)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SharedState is a counter store shared by all the replicas of a connector,
+// so the rate limits of the invocations and of the discovery calls are
+// enforced collectively instead of per replica. The other state, such as the
+// circuit breakers and the duplicate windows, is kept per replica.
+// Implementations backed by Redis or etcd can be plugged in by the
+// connectors; MemoryState is provided for single replicas and tests.
+type SharedState interface {
+	// Increment adds delta to the counter stored at key and returns the new
+	// value. A counter that doesn't exist is created with the given ttl.
+	Increment(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error)
+}
+
+// memoryStateSweepInterval is how often MemoryState removes all its expired
+// entries, rather than only the ones it looks up.
+const memoryStateSweepInterval = time.Minute
+
+type memoryEntry struct {
+	value   int64
+	expires time.Time
+}
+
+// MemoryState is a SharedState kept in memory, which is only shared by the
+// controllers of the same process.
+type MemoryState struct {
+	lock    sync.Mutex
+	entries map[string]*memoryEntry
+	sweep   time.Time
+	now     func() time.Time
+}
+
+// NewMemoryState creates an empty MemoryState.
+func NewMemoryState() *MemoryState {
+	return &MemoryState{
+		entries: make(map[string]*memoryEntry),
+		now:     time.Now,
+	}
+}
+
+// Increment adds delta to the counter stored at key.
+func (s *MemoryState) Increment(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	entry := s.get(key)
+	if entry == nil {
+		entry = &memoryEntry{expires: s.now().Add(ttl)}
+		s.entries[key] = entry
+	}
+	entry.value += delta
+	return entry.value, nil
+}
+
+// get returns the entry of a key if it hasn't expired, removing it
+// otherwise. Every memoryStateSweepInterval, all the expired entries are
+// removed. The state lock must be held.
+func (s *MemoryState) get(key string) *memoryEntry {
+	now := s.now()
+	if now.After(s.sweep) {
+		for k, entry := range s.entries {
+			if now.After(entry.expires) {
+				delete(s.entries, k)
+			}
+		}
+		s.sweep = now.Add(memoryStateSweepInterval)
+	}
+
+	entry, ok := s.entries[key]
+	if ok && now.After(entry.expires) {
+		delete(s.entries, key)
+		return nil
+	}
+	return entry
+}
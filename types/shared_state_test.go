@@ -0,0 +1,35 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func Test_MemoryState_ExpiresEntries(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	state := NewMemoryState()
+	state.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	state.Increment(ctx, "short", 1, time.Second)
+	state.Increment(ctx, "long", 1, time.Hour)
+
+	now = now.Add(2 * time.Second)
+	if value, _ := state.Increment(ctx, "short", 1, time.Second); value != 1 {
+		t.Errorf("short - want a new counter once expired, got: %d", value)
+	}
+	if value, _ := state.Increment(ctx, "long", 1, time.Hour); value != 2 {
+		t.Errorf("long - want: %d, got: %d", 2, value)
+	}
+
+	state.Increment(ctx, "other", 1, time.Second)
+	now = now.Add(2 * memoryStateSweepInterval)
+	state.Increment(ctx, "long", 1, time.Hour)
+	if _, ok := state.entries["other"]; ok {
+		t.Errorf("other - want the expired entry swept")
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"sync"
+)
+
+// flightGroup coalesces concurrent calls: while a call is in flight, the
+// callers wait for it and share its result instead of starting a new one.
+type flightGroup struct {
+	lock    sync.Mutex
+	call    *flightCall
+	started uint64
+}
+
+type flightCall struct {
+	done chan struct{}
+	err  error
+
+	// seq orders the calls by the time they started.
+	seq uint64
+}
+
+// do runs fn, unless a call is already in flight, in which case it waits for
+// that call and returns its error.
+func (g *flightGroup) do(fn func() error) error {
+	g.lock.Lock()
+	if call := g.call; call != nil {
+		g.lock.Unlock()
+		<-call.done
+		return call.err
+	}
+	return g.run(fn)
+}
+
+// doFresh runs fn like do, but only shares a call started after doFresh was
+// called: a call already in flight may have missed the changes the caller
+// wants to see, so it is waited for and fn runs again.
+func (g *flightGroup) doFresh(fn func() error) error {
+	g.lock.Lock()
+	after := g.started
+	for {
+		call := g.call
+		if call == nil {
+			return g.run(fn)
+		}
+		g.lock.Unlock()
+		<-call.done
+		if call.seq > after {
+			return call.err
+		}
+		g.lock.Lock()
+	}
+}
+
+// run starts a call of fn. The lock must be held, and is released.
+func (g *flightGroup) run(fn func() error) error {
+	g.started++
+	call := &flightCall{done: make(chan struct{}), seq: g.started}
+	g.call = call
+	g.lock.Unlock()
+
+	defer func() {
+		g.lock.Lock()
+		g.call = nil
+		g.lock.Unlock()
+		close(call.done)
+	}()
+
+	call.err = fn()
+	return call.err
+}
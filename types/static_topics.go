@@ -0,0 +1,113 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// LoadTopicMapFile reads a static topic map from a JSON file mapping each
+// topic to its functions:
+//
+//	{"payment.received": ["billing", "audit.openfaas-fn"]}
+func LoadTopicMapFile(path string) (map[string][]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	lookups := map[string][]string{}
+	if err := json.Unmarshal(data, &lookups); err != nil {
+		return nil, fmt.Errorf("invalid topic map file %s: %s", path, err)
+	}
+	return lookups, nil
+}
+
+// buildLookups builds the lookups of the topic map: the topics of the
+// TopicSource, unless SkipTopicDiscovery is set, merged with the StaticTopics
+// and the topics of StaticTopicsFile, read on each build.
+func (c *controller) buildLookups(ctx context.Context, source TopicSource) (map[string][]string, map[string]FunctionMetadata, error) {
+	lookups, metadata := map[string][]string{}, map[string]FunctionMetadata{}
+	var partial *PartialBuildError
+	if !c.Config.SkipTopicDiscovery {
+		var err error
+		lookups, metadata, err = buildTopicSource(ctx, source)
+		if partial, _ = err.(*PartialBuildError); err != nil && partial == nil {
+			return lookups, metadata, err
+		}
+		if c.Config.TopicSource != nil {
+			// the lookup builder normalizes the topics of the annotations
+			// itself
+			lookups = c.Config.TopicNormalization.lookups(lookups)
+			c.Config.TopicNormalization.metadata(metadata)
+		}
+	}
+
+	mergeLookups(lookups, c.Config.TopicNormalization.lookups(c.Config.StaticTopics), c.Config.DefaultNamespace)
+	if len(c.Config.StaticTopicsFile) > 0 {
+		static, err := LoadTopicMapFile(c.Config.StaticTopicsFile)
+		if err != nil {
+			return map[string][]string{}, map[string]FunctionMetadata{}, err
+		}
+		mergeLookups(lookups, c.Config.TopicNormalization.lookups(static), c.Config.DefaultNamespace)
+	}
+	if partial != nil {
+		return lookups, metadata, partial
+	}
+	return lookups, metadata, nil
+}
+
+// mergeLookups adds the functions of static to lookups, skipping the
+// functions already subscribed to a topic. The functions without a namespace
+// are compared as functions of defaultNamespace, so that "billing" and
+// "billing.openfaas-fn" are not both subscribed.
+func mergeLookups(lookups, static map[string][]string, defaultNamespace string) {
+	for topic, functions := range static {
+		topic = strings.TrimSpace(topic)
+		if len(topic) == 0 {
+			continue
+		}
+
+		for _, function := range functions {
+			function = strings.TrimSpace(function)
+			if len(function) > 0 && !containsFunction(lookups[topic], function, defaultNamespace) {
+				lookups[topic] = append(lookups[topic], function)
+			}
+		}
+	}
+}
+
+// containsFunction reports whether functions contains function, applying
+// defaultNamespace to the functions without a namespace.
+func containsFunction(functions []string, function, defaultNamespace string) bool {
+	function = qualifyFunction(function, defaultNamespace)
+	for _, f := range functions {
+		if qualifyFunction(f, defaultNamespace) == function {
+			return true
+		}
+	}
+	return false
+}
+
+// qualifyFunction applies defaultNamespace to a function reference without
+// a namespace.
+func qualifyFunction(ref, defaultNamespace string) string {
+	if len(defaultNamespace) > 0 && !strings.Contains(ref, ".") {
+		return ref + "." + defaultNamespace
+	}
+	return ref
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,145 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_mergeLookups(t *testing.T) {
+	lookups := map[string][]string{"orders": {"billing"}}
+	mergeLookups(lookups, map[string][]string{
+		"orders":   {"billing", " audit "},
+		"payments": {"billing.finance"},
+		" ":        {"ignored"},
+	}, "")
+
+	want := map[string][]string{
+		"orders":   {"billing", "audit"},
+		"payments": {"billing.finance"},
+	}
+	if !reflect.DeepEqual(lookups, want) {
+		t.Errorf("Lookups - want: %v, got: %v", want, lookups)
+	}
+}
+
+func Test_mergeLookups_DefaultNamespace(t *testing.T) {
+	lookups := map[string][]string{"orders": {"billing.openfaas-fn"}, "payments": {"audit"}}
+	mergeLookups(lookups, map[string][]string{
+		"orders":   {"billing", "billing.finance"},
+		"payments": {"audit.openfaas-fn"},
+	}, "openfaas-fn")
+
+	want := map[string][]string{
+		"orders":   {"billing.openfaas-fn", "billing.finance"},
+		"payments": {"audit"},
+	}
+	if !reflect.DeepEqual(lookups, want) {
+		t.Errorf("Lookups - want: %v, got: %v", want, lookups)
+	}
+}
+
+func Test_Controller_StaticTopics(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"name":"echo","annotations":{"topic":"orders"}}]`))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "static-topics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "topics.json")
+	if err := ioutil.WriteFile(file, []byte(`{"payments": ["billing"]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewController(nil, &ControllerConfig{
+		GatewayURL:       srv.URL,
+		RebuildInterval:  time.Hour,
+		Namespace:        "openfaas-fn",
+		StaticTopics:     map[string][]string{"orders": {"audit"}},
+		StaticTopicsFile: file,
+	}).(*controller)
+	defer c.Close()
+	c.BeginMapBuilder()
+
+	if err := c.RefreshTopicMap(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := c.TopicMap.Match("orders"), []string{"echo.openfaas-fn", "audit"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Functions of orders - want: %v, got: %v", want, got)
+	}
+	if got, want := c.TopicMap.Match("payments"), []string{"billing"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Functions of payments - want: %v, got: %v", want, got)
+	}
+}
+
+func Test_Controller_SkipTopicDiscovery(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Unexpected request to the gateway: %s", r.URL.Path)
+	}))
+	defer srv.Close()
+
+	c := NewController(nil, &ControllerConfig{
+		GatewayURL:         srv.URL,
+		RebuildInterval:    time.Hour,
+		StaticTopics:       map[string][]string{"orders": {"billing"}},
+		SkipTopicDiscovery: true,
+	}).(*controller)
+	defer c.Close()
+	c.BeginMapBuilder()
+
+	if err := c.RefreshTopicMap(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := c.TopicMap.Match("orders"), []string{"billing"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Functions of orders - want: %v, got: %v", want, got)
+	}
+}
+
+func Test_Controller_StaticTopicsNormalization(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer srv.Close()
+
+	c := NewController(nil, &ControllerConfig{
+		GatewayURL:         srv.URL,
+		RebuildInterval:    time.Hour,
+		StaticTopics:       map[string][]string{"Team.Orders": {"billing"}, "orders": {"audit"}},
+		SkipTopicDiscovery: true,
+		TopicNormalization: TopicNormalization{Lowercase: true, StripPrefix: "Team."},
+		Logger:             NewStdLogger(LevelError),
+	}).(*controller)
+	defer c.Close()
+	c.BeginMapBuilder()
+
+	if err := c.RefreshTopicMap(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.TopicMap.Match("orders"); len(got) != 2 {
+		t.Errorf("Functions of orders - want billing and audit, got: %v", got)
+	}
+
+	// The topic of the message is normalized before it is matched.
+	responses := c.InvokeWithResults(context.Background(), "TEAM.ORDERS", &Message{Body: []byte("order")})
+	if len(responses) != 2 {
+		t.Fatalf("Responses - want: 2, got: %v", responses)
+	}
+	for _, res := range responses {
+		if res.Error != nil || res.Topic != "TEAM.ORDERS" {
+			t.Errorf("Response - want the topic of the message, got: %s %q", res.Error, res.Topic)
+		}
+	}
+}
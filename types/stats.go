@@ -0,0 +1,229 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const defaultStatsSamples = 1000
+
+// InvocationStats summarizes the most recent invocations of a function or a
+// topic.
+type InvocationStats struct {
+	Invocations int64
+	Failures    int64
+	P50         time.Duration
+	P95         time.Duration
+	P99         time.Duration
+}
+
+// Stats summarizes the most recent invocations by topic and by function.
+type Stats struct {
+	Topics    map[string]InvocationStats
+	Functions map[string]InvocationStats
+}
+
+// Successes returns the number of successful invocations.
+func (s InvocationStats) Successes() int64 {
+	return s.Invocations - s.Failures
+}
+
+// ErrorRate returns the ratio of failed invocations.
+func (s InvocationStats) ErrorRate() float64 {
+	if s.Invocations == 0 {
+		return 0
+	}
+	return float64(s.Failures) / float64(s.Invocations)
+}
+
+type statsSample struct {
+	time     time.Time
+	duration time.Duration
+	failed   bool
+}
+
+// statsWindow is a ring buffer with the most recent samples.
+type statsWindow struct {
+	samples []statsSample
+	next    int
+	full    bool
+}
+
+func (w *statsWindow) add(sample statsSample) {
+	w.samples[w.next] = sample
+	w.next = (w.next + 1) % len(w.samples)
+	if w.next == 0 {
+		w.full = true
+	}
+}
+
+// stats summarizes the samples taken after since, or all of them if since
+// is zero.
+func (w *statsWindow) stats(since time.Time) InvocationStats {
+	samples := w.samples[:w.next]
+	if w.full {
+		samples = w.samples
+	}
+
+	stats := InvocationStats{}
+	durations := make([]time.Duration, 0, len(samples))
+	for _, sample := range samples {
+		if sample.time.Before(since) {
+			continue
+		}
+		stats.Invocations++
+		if sample.failed {
+			stats.Failures++
+		}
+		durations = append(durations, sample.duration)
+	}
+
+	stats.P50 = percentile(durations, 0.50)
+	stats.P95 = percentile(durations, 0.95)
+	stats.P99 = percentile(durations, 0.99)
+	return stats
+}
+
+func percentile(durations []time.Duration, p float64) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	return durations[int(p*float64(len(durations)-1))]
+}
+
+// StatsCollector is a ResponseSubscriber that keeps the outcome and latency
+// of the most recent invocations of each function and topic.
+type StatsCollector struct {
+	samples int
+
+	// MaxAge excludes the samples older than this duration from the stats,
+	// so that they reflect the recent invocations of the functions invoked
+	// rarely. Zero keeps the samples until they are replaced.
+	MaxAge time.Duration
+
+	lock      sync.Mutex
+	all       *statsWindow
+	functions map[string]*statsWindow
+	topics    map[string]*statsWindow
+	pairs     map[string]*statsWindow
+}
+
+// NewStatsCollector creates a StatsCollector keeping the given number of
+// samples per function and per topic. Defaults to 1000 samples.
+func NewStatsCollector(samples int) *StatsCollector {
+	if samples <= 0 {
+		samples = defaultStatsSamples
+	}
+	return &StatsCollector{
+		samples:   samples,
+		all:       &statsWindow{samples: make([]statsSample, samples)},
+		functions: make(map[string]*statsWindow),
+		topics:    make(map[string]*statsWindow),
+		pairs:     make(map[string]*statsWindow),
+	}
+}
+
+// Response is triggered by the controller when a message is
+// received from the function invocation. The responses served from a cache
+// and the invocations rejected before being sent, e.g. by an open circuit or
+// the rate limiter, are ignored, as they say nothing about the function.
+func (c *StatsCollector) Response(res InvokerResponse) {
+	if len(res.Function) == 0 || res.Cached || localRejection(res.Error) {
+		return
+	}
+
+	sample := statsSample{
+		time:     time.Now(),
+		duration: res.Duration,
+		failed:   res.Error != nil || res.Status >= 400,
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.all.add(sample)
+	c.window(c.functions, res.Function).add(sample)
+	if len(res.Topic) > 0 {
+		c.window(c.topics, res.Topic).add(sample)
+		c.window(c.pairs, pairKey(res.Topic, res.Function)).add(sample)
+	}
+}
+
+func pairKey(topic, function string) string {
+	return topic + "\x00" + function
+}
+
+// window returns the window of key in windows, creating it if needed. The
+// lock must be held.
+func (c *StatsCollector) window(windows map[string]*statsWindow, key string) *statsWindow {
+	window, ok := windows[key]
+	if !ok {
+		window = &statsWindow{samples: make([]statsSample, c.samples)}
+		windows[key] = window
+	}
+	return window
+}
+
+// Functions returns the stats of every function invoked.
+func (c *StatsCollector) Functions() map[string]InvocationStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.summarize(c.functions)
+}
+
+// Topics returns the stats of every topic invoked.
+func (c *StatsCollector) Topics() map[string]InvocationStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.summarize(c.topics)
+}
+
+// Invocations returns the stats of the invocations of function for topic.
+// If topic is empty, the invocations of function for every topic are
+// summarized, and if function is empty, those of every function of topic.
+// If both are empty, the most recent invocations of all the functions are
+// summarized.
+func (c *StatsCollector) Invocations(topic, function string) InvocationStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var window *statsWindow
+	switch {
+	case len(topic) == 0 && len(function) == 0:
+		window = c.all
+	case len(topic) == 0:
+		window = c.functions[function]
+	case len(function) == 0:
+		window = c.topics[topic]
+	default:
+		window = c.pairs[pairKey(topic, function)]
+	}
+	if window == nil {
+		return InvocationStats{}
+	}
+	return window.stats(c.since())
+}
+
+// since returns the time of the oldest sample summarized.
+func (c *StatsCollector) since() time.Time {
+	if c.MaxAge <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(-c.MaxAge)
+}
+
+func (c *StatsCollector) summarize(windows map[string]*statsWindow) map[string]InvocationStats {
+	since := c.since()
+	stats := make(map[string]InvocationStats, len(windows))
+	for key, window := range windows {
+		stats[key] = window.stats(since)
+	}
+	return stats
+}
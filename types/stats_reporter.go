@@ -0,0 +1,245 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/openfaas/faas-provider/auth"
+)
+
+// DefaultStatsAnnotationPrefix is prepended to the annotations written by the StatsReporter.
+const DefaultStatsAnnotationPrefix = "com.openfaas.connector."
+
+// StatsReporter periodically writes the stats observed by the connector for
+// each function back to the gateway as annotations ("error-rate", "p95-ms"
+// and "invocations"), so other tools can see the health of the functions as
+// observed by the connector.
+//
+// The annotations of a function are only written when one of their values
+// changed since the last report: the function is read from the gateway, the
+// stats annotations are merged into its annotations and the deployment is
+// updated with the rest of it unchanged. Set Update to write them another
+// way. The same stats are available without writing to the functions
+// through Stats, the /stats endpoint of the control API and the Metrics.
+type StatsReporter struct {
+	GatewayURL  string
+	Client      *http.Client
+	Credentials *auth.BasicAuthCredentials
+	Stats       *StatsCollector
+
+	// Auth authenticates the requests, taking precedence over Credentials.
+	Auth ClientAuth
+
+	// Prefix is prepended to the annotation names. Defaults to
+	// DefaultStatsAnnotationPrefix.
+	Prefix string
+
+	// Update writes the annotations of a function, if set, in place of the
+	// update of the deployment through the gateway.
+	Update func(function string, annotations map[string]string) error
+
+	Logger Logger
+
+	lock     sync.Mutex
+	stop     chan struct{}
+	reported map[string]map[string]string
+}
+
+// Start reports the stats at every interval, until Stop is called.
+func (r *StatsReporter) Start(interval time.Duration) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.stop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	r.stop = stop
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.Report()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the reports started by Start.
+func (r *StatsReporter) Stop() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.stop != nil {
+		close(r.stop)
+		r.stop = nil
+	}
+}
+
+// Report writes the current stats of every function to the gateway.
+func (r *StatsReporter) Report() {
+	for function, stats := range r.Stats.Functions() {
+		if err := r.report(function, stats); err != nil {
+			r.logger().Warnf("Unable to report stats of %s: %s", function, err)
+		}
+	}
+}
+
+func (r *StatsReporter) report(function string, stats InvocationStats) error {
+	prefix := r.Prefix
+	if len(prefix) == 0 {
+		prefix = DefaultStatsAnnotationPrefix
+	}
+	annotations := map[string]string{
+		prefix + "error-rate":  strconv.FormatFloat(stats.ErrorRate(), 'f', 4, 64),
+		prefix + "p95-ms":      strconv.FormatInt(int64(stats.P95/time.Millisecond), 10),
+		prefix + "invocations": strconv.FormatInt(stats.Invocations, 10),
+	}
+
+	r.lock.Lock()
+	unchanged := reflect.DeepEqual(r.reported[function], annotations)
+	r.lock.Unlock()
+	if unchanged {
+		return nil
+	}
+
+	var err error
+	if r.Update != nil {
+		err = r.Update(function, annotations)
+	} else {
+		err = r.updateAnnotations(function, annotations)
+	}
+	if err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	if r.reported == nil {
+		r.reported = map[string]map[string]string{}
+	}
+	r.reported[function] = annotations
+	r.lock.Unlock()
+	return nil
+}
+
+// updateAnnotations merges the annotations into those of function and
+// updates its deployment, unless they already hold these values. The
+// function is read as a generic map, so the fields not known by this package
+// are preserved.
+func (r *StatsReporter) updateAnnotations(function string, annotations map[string]string) error {
+	name, namespace := splitFunctionRef(function)
+	deployment, err := r.getFunction(name, namespace)
+	if err != nil {
+		return err
+	}
+
+	existing, _ := deployment["annotations"].(map[string]interface{})
+	if existing == nil {
+		existing = make(map[string]interface{})
+	}
+	changed := false
+	for key, value := range annotations {
+		if existing[key] != value {
+			existing[key] = value
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	deployment["annotations"] = existing
+
+	// The status endpoint returns "name", the deployment endpoint expects "service"
+	deployment["service"] = name
+	delete(deployment, "name")
+
+	return r.updateFunction(deployment)
+}
+
+// getFunction returns the function as a generic map.
+func (r *StatsReporter) getFunction(name, namespace string) (map[string]interface{}, error) {
+	functionURL, err := url.Parse(fmt.Sprintf("%s/system/function/%s", r.GatewayURL, url.PathEscape(name)))
+	if err != nil {
+		return nil, err
+	}
+	if len(namespace) > 0 {
+		query := functionURL.Query()
+		query.Set("namespace", namespace)
+		functionURL.RawQuery = query.Encode()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, functionURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	bytesOut, err := r.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	deployment := make(map[string]interface{})
+	if err := json.Unmarshal(bytesOut, &deployment); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal function: %s", err)
+	}
+	return deployment, nil
+}
+
+func (r *StatsReporter) updateFunction(deployment map[string]interface{}) error {
+	bytesIn, err := json.Marshal(deployment)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPut, fmt.Sprintf("%s/system/functions", r.GatewayURL), bytes.NewReader(bytesIn))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	_, err = r.do(req)
+	return err
+}
+
+func (r *StatsReporter) do(req *http.Request) ([]byte, error) {
+	if err := setAuth(req, r.Auth, r.Credentials); err != nil {
+		return nil, err
+	}
+
+	res, err := r.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	bytesOut, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, fmt.Errorf("unexpected status code %d from %s: %s", res.StatusCode, req.URL.Path, string(bytesOut))
+	}
+	return bytesOut, nil
+}
+
+func (r *StatsReporter) logger() Logger {
+	if r.Logger == nil {
+		return defaultLogger
+	}
+	return r.Logger
+}
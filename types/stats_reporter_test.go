@@ -0,0 +1,109 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_StatsReporter_UpdatesChangedAnnotations(t *testing.T) {
+	var lock sync.Mutex
+	deployment := map[string]interface{}{
+		"name":        "echo",
+		"namespace":   "openfaas-fn",
+		"image":       "ghcr.io/openfaas/echo:latest",
+		"labels":      map[string]interface{}{"topic": "payments"},
+		"annotations": map[string]interface{}{"owner": "team-a"},
+		"envVars":     map[string]interface{}{"mode": "fast"},
+	}
+	gets, puts := 0, make(chan map[string]interface{}, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/system/function/echo":
+			if r.URL.Query().Get("namespace") != "openfaas-fn" {
+				t.Errorf("Namespace - want: %s, got: %s", "openfaas-fn", r.URL.Query().Get("namespace"))
+			}
+			gets++
+			json.NewEncoder(w).Encode(deployment)
+		case r.Method == http.MethodPut && r.URL.Path == "/system/functions":
+			update := make(map[string]interface{})
+			_ = json.NewDecoder(r.Body).Decode(&update)
+			deployment = update
+			puts <- update
+		default:
+			t.Errorf("want GET /system/function/echo or PUT /system/functions, got %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	stats := NewStatsCollector(10)
+	stats.Response(InvokerResponse{Function: "echo.openfaas-fn", Status: 200, Duration: 10 * time.Millisecond})
+	stats.Response(InvokerResponse{Function: "echo.openfaas-fn", Error: fmt.Errorf("timeout"), Duration: 30 * time.Millisecond})
+
+	reporter := StatsReporter{
+		GatewayURL: srv.URL,
+		Client:     srv.Client(),
+		Stats:      stats,
+	}
+	reporter.Report()
+
+	update := <-puts
+	if update["service"] != "echo" || update["name"] != nil {
+		t.Errorf("Service - want: echo without name, got: %v / %v", update["service"], update["name"])
+	}
+	if update["image"] != "ghcr.io/openfaas/echo:latest" || update["namespace"] != "openfaas-fn" {
+		t.Errorf("Deployment - want image and namespace preserved, got: %v", update)
+	}
+	if labels := update["labels"].(map[string]interface{}); labels["topic"] != "payments" {
+		t.Errorf("Labels - want preserved, got: %v", labels)
+	}
+	if env := update["envVars"].(map[string]interface{}); env["mode"] != "fast" {
+		t.Errorf("Env vars - want preserved, got: %v", env)
+	}
+	annotations := update["annotations"].(map[string]interface{})
+	want := map[string]string{
+		"owner":                              "team-a",
+		"com.openfaas.connector.error-rate":  "0.5000",
+		"com.openfaas.connector.invocations": "2",
+		"com.openfaas.connector.p95-ms":      "10",
+	}
+	if len(annotations) != len(want) {
+		t.Errorf("Annotations - want: %v, got: %v", want, annotations)
+	}
+	for name, value := range want {
+		if annotations[name] != value {
+			t.Errorf("Annotation %s - want: %s, got: %v", name, value, annotations[name])
+		}
+	}
+
+	reporter.Report()
+	lock.Lock()
+	if gets != 1 || len(puts) != 0 {
+		t.Errorf("Requests - want none while the stats are unchanged, got: %d GET, %d PUT", gets-1, len(puts))
+	}
+	lock.Unlock()
+
+	// A new reporter finds the values already on the function.
+	restarted := StatsReporter{GatewayURL: srv.URL, Client: srv.Client(), Stats: stats}
+	restarted.Report()
+	if len(puts) != 0 {
+		t.Errorf("Updates - want none when the function holds the values, got: %d", len(puts))
+	}
+
+	stats.Response(InvokerResponse{Function: "echo.openfaas-fn", Status: 200, Duration: 10 * time.Millisecond})
+	reporter.Report()
+	if len(puts) != 1 {
+		t.Errorf("Updates - want one once the stats changed, got: %d", len(puts))
+	}
+}
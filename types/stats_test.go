@@ -0,0 +1,66 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func Test_StatsCollector_Invocations(t *testing.T) {
+	collector := NewStatsCollector(100)
+	for i := 1; i <= 10; i++ {
+		collector.Response(InvokerResponse{Topic: "orders", Function: "billing", Status: 200, Duration: time.Duration(i) * time.Millisecond})
+	}
+	collector.Response(InvokerResponse{Topic: "payments", Function: "billing", Error: fmt.Errorf("unreachable")})
+
+	cases := []struct {
+		topic, function string
+		want            InvocationStats
+	}{
+		{"orders", "billing", InvocationStats{Invocations: 10, P50: 5 * time.Millisecond, P95: 9 * time.Millisecond, P99: 9 * time.Millisecond}},
+		{"payments", "billing", InvocationStats{Invocations: 1, Failures: 1}},
+		{"", "billing", InvocationStats{Invocations: 11, Failures: 1, P50: 5 * time.Millisecond, P95: 9 * time.Millisecond, P99: 9 * time.Millisecond}},
+		{"orders", "", InvocationStats{Invocations: 10, P50: 5 * time.Millisecond, P95: 9 * time.Millisecond, P99: 9 * time.Millisecond}},
+		{"orders", "audit", InvocationStats{}},
+		{"", "", InvocationStats{Invocations: 11, Failures: 1, P50: 5 * time.Millisecond, P95: 9 * time.Millisecond, P99: 9 * time.Millisecond}},
+		{"", "audit", InvocationStats{}},
+	}
+	for _, tc := range cases {
+		if got := collector.Invocations(tc.topic, tc.function); got != tc.want {
+			t.Errorf("Stats of %q/%q - want: %+v, got: %+v", tc.topic, tc.function, tc.want, got)
+		}
+	}
+}
+
+func Test_StatsCollector_MaxAge(t *testing.T) {
+	collector := NewStatsCollector(100)
+	collector.MaxAge = 20 * time.Millisecond
+	collector.Response(InvokerResponse{Topic: "orders", Function: "billing", Status: 200})
+
+	if got := collector.Invocations("orders", "billing"); got.Invocations != 1 {
+		t.Errorf("Invocations - want: %d, got: %d", 1, got.Invocations)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if got := collector.Invocations("orders", "billing"); got.Invocations != 0 {
+		t.Errorf("Invocations - want the old samples excluded, got: %d", got.Invocations)
+	}
+}
+
+func Test_StatsCollector_SkipsCachedAndLocalRejections(t *testing.T) {
+	collector := NewStatsCollector(100)
+	collector.Response(InvokerResponse{Topic: "orders", Function: "billing", Status: 200, Duration: 10 * time.Millisecond})
+	collector.Response(InvokerResponse{Topic: "orders", Function: "billing", Status: 200, Cached: true})
+	for _, rejection := range []error{ErrPaused, ErrCircuitOpen, ErrFunctionDraining, ErrBusy, errors.Wrap(ErrRateLimited, "unable to invoke billing")} {
+		collector.Response(InvokerResponse{Topic: "orders", Function: "billing", Error: rejection})
+	}
+
+	want := InvocationStats{Invocations: 1, P50: 10 * time.Millisecond, P95: 10 * time.Millisecond, P99: 10 * time.Millisecond}
+	if got := collector.Invocations("orders", "billing"); got != want {
+		t.Errorf("Stats - want: %+v, got: %+v", want, got)
+	}
+}
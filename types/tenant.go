@@ -0,0 +1,34 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import "context"
+
+// TenantResolver returns the tenant of an invocation, from its topic, the
+// function reference ("name" or "name.namespace") and the message metadata,
+// or an empty string if it has none. It is called for every invocation and
+// must be fast and safe for concurrent use.
+type TenantResolver func(topic, function string, message *Message) string
+
+// tenantKey is the context key of the tenant of an invocation made with
+// InvokeForTenant.
+type tenantKey struct{}
+
+// withTenant returns a context labelling its invocations with tenant.
+func withTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// tenant resolves the tenant of an invocation: the tenant given to
+// InvokeForTenant, or else the one of the TenantResolver of the Invoker, if
+// set.
+func (i *Invoker) tenant(ctx context.Context, topic, function string, message *Message) string {
+	if tenant, ok := ctx.Value(tenantKey{}).(string); ok {
+		return tenant
+	}
+	if i.TenantResolver == nil {
+		return ""
+	}
+	return i.TenantResolver(topic, function, message)
+}
@@ -0,0 +1,189 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// tenantTopics is the topic map of a tenant, with the source discovering the
+// functions of its namespaces and the error of its last build.
+type tenantTopics struct {
+	namespaces []string
+	source     TopicSource
+	topicMap   *TopicMap
+
+	lock sync.Mutex
+	err  error
+}
+
+// newTenantTopics creates an empty topic map for each of the Tenants, built
+// like the main topic map: from the TopicSource of the config, or else from
+// the lookup builder restricted to the namespaces of the tenant.
+func (c *controller) newTenantTopics() map[string]*tenantTopics {
+	if len(c.Config.Tenants) == 0 {
+		return nil
+	}
+
+	tenants := make(map[string]*tenantTopics, len(c.Config.Tenants))
+	for tenant, namespaces := range c.Config.Tenants {
+		source := c.Config.TopicSource
+		if source == nil {
+			source = NewAnnotationTopicSource(c.newLookupBuilder().forNamespaces(namespaces))
+		}
+
+		topicMap := NewTopicMap(c.Config.TopicMatcher)
+		tenants[tenant] = &tenantTopics{
+			namespaces: append([]string(nil), namespaces...),
+			source:     source,
+			topicMap:   &topicMap,
+		}
+	}
+	return tenants
+}
+
+// forNamespaces returns a copy of the builder discovering the functions of
+// namespaces only, without reporting the discovery stats, which describe the
+// main topic map.
+func (s *FunctionLookupBuilder) forNamespaces(namespaces []string) *FunctionLookupBuilder {
+	return &FunctionLookupBuilder{
+		GatewayURL:             s.GatewayURL,
+		Client:                 s.Client,
+		Auth:                   s.Auth,
+		Credentials:            s.Credentials,
+		TopicDelimiter:         s.TopicDelimiter,
+		Namespace:              s.Namespace,
+		TopicDelimiterPattern:  s.TopicDelimiterPattern,
+		Namespaces:             append([]string(nil), namespaces...),
+		ExcludeNamespaces:      s.ExcludeNamespaces,
+		NamespaceSelector:      s.NamespaceSelector,
+		TopicNormalization:     s.TopicNormalization,
+		DefaultNamespace:       s.DefaultNamespace,
+		SkipNamespaceDiscovery: s.SkipNamespaceDiscovery,
+		Logger:                 s.Logger,
+		GatewayPool:            s.GatewayPool,
+		DisableListCache:       s.DisableListCache,
+		SkipNotReady:           s.SkipNotReady,
+		FunctionSource:         s.FunctionSource,
+		PageSize:               s.PageSize,
+		MaxPages:               s.MaxPages,
+		NamespaceCache:         s.NamespaceCache,
+		DiscoveryLimiter:       s.DiscoveryLimiter,
+		NamespaceRetries:       s.NamespaceRetries,
+		NamespaceRetryBackoff:  s.NamespaceRetryBackoff,
+		PartialResults:         s.PartialResults,
+	}
+}
+
+// buildTenantTopicMaps rebuilds the topic map of every tenant. A tenant that
+// fails keeps its previous map, or the previous functions of the namespaces
+// that failed on a partial build, and its error is logged and kept for
+// TenantErrors without failing the sync of the main topic map.
+func (c *controller) buildTenantTopicMaps(ctx context.Context) {
+	names := make([]string, 0, len(c.tenants))
+	for tenant := range c.tenants {
+		names = append(names, tenant)
+	}
+	sort.Strings(names)
+
+	for _, tenant := range names {
+		topics := c.tenants[tenant]
+		lookups, metadata, err := c.buildLookups(ctx, topics.source)
+		partial, _ := err.(*PartialBuildError)
+		if err != nil && partial == nil {
+			c.Logger.Errorf("Unable to build the topic map of tenant %s: %s", tenant, err)
+			topics.setErr(err)
+			continue
+		}
+
+		c.restrictToNamespaces(lookups, metadata, topics.namespaces)
+		if partial != nil {
+			c.Logger.Errorf("Partially built the topic map of tenant %s: %s", tenant, partial)
+			keepFailedNamespaces(lookups, metadata, topics.topicMap.lookups(), topics.topicMap.functionMetadata(), partial.Failed)
+			topics.setErr(partial)
+		} else {
+			topics.setErr(nil)
+		}
+		syncChange(topics.topicMap, lookups, metadata)
+	}
+}
+
+// restrictToNamespaces removes from lookups and metadata the functions
+// outside of namespaces, e.g. the StaticTopics or the functions of a custom
+// TopicSource of another tenant. The functions without a namespace are in
+// the DefaultNamespace.
+func (c *controller) restrictToNamespaces(lookups map[string][]string, metadata map[string]FunctionMetadata, namespaces []string) {
+	inNamespaces := func(function string) bool {
+		_, namespace := splitFunctionRef(function)
+		if len(namespace) == 0 {
+			namespace = c.Config.DefaultNamespace
+		}
+		return contains(namespaces, namespace)
+	}
+
+	for topic, functions := range lookups {
+		kept := functions[:0]
+		for _, function := range functions {
+			if inNamespaces(function) {
+				kept = append(kept, function)
+			}
+		}
+		if len(kept) == 0 {
+			delete(lookups, topic)
+			continue
+		}
+		lookups[topic] = kept
+	}
+	for function := range metadata {
+		if !inNamespaces(function) {
+			delete(metadata, function)
+		}
+	}
+}
+
+func (t *tenantTopics) setErr(err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.err = err
+}
+
+// TenantErrors returns the error of the last build of each tenant whose
+// topic map failed to build, or was built partially.
+func (c *controller) TenantErrors() map[string]error {
+	errs := map[string]error{}
+	for tenant, topics := range c.tenants {
+		topics.lock.Lock()
+		if topics.err != nil {
+			errs[tenant] = topics.err
+		}
+		topics.lock.Unlock()
+	}
+	return errs
+}
+
+// InvokeForTenant invokes the functions of tenant matching topic and returns
+// their responses, labelled with the tenant.
+func (c *controller) InvokeForTenant(ctx context.Context, tenant, topic string, message *Message) []InvokerResponse {
+	ctx = withTenant(ctx, tenant)
+
+	topics, ok := c.tenants[tenant]
+	if !ok {
+		err := errors.Wrapf(ErrUnknownTenant, "tenant %s", tenant)
+		nack(ctx, err)
+		res := InvokerResponse{
+			Context: ctx,
+			Error:   err,
+			Topic:   topic,
+			Tenant:  tenant,
+		}
+		c.Invoker.publish(res)
+		return []InvokerResponse{res}
+	}
+
+	return c.invokeWithResults(ctx, topics.topicMap, topic, message)
+}
@@ -0,0 +1,114 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func Test_Controller_InvokeForTenant(t *testing.T) {
+	var failing atomic.Value
+	failing.Store("initech")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/system/namespaces":
+			w.Write([]byte(`["acme","globex","initech"]`))
+		case "/system/functions":
+			namespace := r.URL.Query().Get("namespace")
+			if namespace == failing.Load().(string) {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			fmt.Fprintf(w, `[{"name":"%s-orders","annotations":{"topic":"orders"}}]`, namespace)
+		default:
+			w.Write([]byte(r.URL.Path))
+		}
+	}))
+	defer srv.Close()
+
+	c := NewController(nil, &ControllerConfig{
+		GatewayURL:      srv.URL,
+		RebuildInterval: time.Hour,
+		Namespaces:      []string{"acme"},
+		Tenants: map[string][]string{
+			"acme":    {"acme"},
+			"globex":  {"globex"},
+			"initech": {"initech"},
+		},
+		Logger: NewStdLogger(LevelError),
+	}).(*controller)
+	defer c.Close()
+	c.BeginMapBuilder()
+
+	// A failing tenant doesn't fail the sync of the main topic map.
+	if err := c.RefreshTopicMap(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if topics := c.Topics(); len(topics) != 1 || topics[0] != "orders" {
+		t.Errorf("Topics - want the main topic map built, got: %v", topics)
+	}
+	if errs := c.TenantErrors(); len(errs) != 1 || errs["initech"] == nil {
+		t.Errorf("TenantErrors - want initech, got: %v", errs)
+	}
+
+	responses := c.InvokeForTenant(context.Background(), "globex", "orders", &Message{Body: []byte("order")})
+	if len(responses) != 1 {
+		t.Fatalf("Responses - want: 1, got: %d", len(responses))
+	}
+	if res := responses[0]; res.Error != nil || string(*res.Body) != "/function/globex-orders.globex" || res.Tenant != "globex" {
+		t.Errorf("Response - want globex-orders.globex invoked for globex, got: %s %q %q", res.Error, *res.Body, res.Tenant)
+	}
+
+	// A tenant that fails keeps its last topic map.
+	failing.Store("globex")
+	if err := c.RefreshTopicMap(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if errs := c.TenantErrors(); len(errs) != 1 || errs["globex"] == nil {
+		t.Errorf("TenantErrors - want globex, got: %v", errs)
+	}
+	responses = c.InvokeForTenant(context.Background(), "globex", "orders", &Message{Body: []byte("order")})
+	if len(responses) != 1 || responses[0].Error != nil {
+		t.Errorf("Responses - want globex-orders.globex still invoked, got: %v", responses)
+	}
+
+	responses = c.InvokeForTenant(context.Background(), "umbrella", "orders", &Message{Body: []byte("order")})
+	if len(responses) != 1 || errors.Cause(responses[0].Error) != ErrUnknownTenant {
+		t.Errorf("Responses - want an ErrUnknownTenant response, got: %v", responses)
+	}
+}
+
+func Test_Controller_TenantStaticTopics(t *testing.T) {
+	c := NewController(nil, &ControllerConfig{
+		GatewayURL:         "http://gateway:8080",
+		RebuildInterval:    time.Hour,
+		SkipTopicDiscovery: true,
+		DefaultNamespace:   "acme",
+		StaticTopics: map[string][]string{
+			"orders":   {"billing", "shipping.globex"},
+			"invoices": {"ledger.globex"},
+		},
+		Tenants: map[string][]string{"acme": {"acme"}},
+		Logger:  NewStdLogger(LevelError),
+	}).(*controller)
+	defer c.Close()
+	c.BeginMapBuilder()
+
+	if err := c.RefreshTopicMap(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	got := c.tenants["acme"].topicMap.lookups()
+	if want := map[string][]string{"orders": {"billing"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Tenant topic map - want: %v, got: %v", want, got)
+	}
+}
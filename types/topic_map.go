@@ -29,6 +29,7 @@ func NewTopicMap(matchFunc MatchTopicFunc) TopicMap {
 
 type TopicMap struct {
 	lookup    *map[string][]string
+	metadata  map[string]FunctionMetadata
 	lock      sync.RWMutex
 	matchFunc MatchTopicFunc
 }
@@ -56,6 +57,42 @@ func (t *TopicMap) Sync(updated *map[string][]string) {
 	t.lookup = updated
 }
 
+// SyncWithMetadata replaces the lookups and the metadata of the functions.
+func (t *TopicMap) SyncWithMetadata(updated *map[string][]string, metadata map[string]FunctionMetadata) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.lookup = updated
+	t.metadata = metadata
+}
+
+// Metadata gets the metadata of a function, as referenced in the lookups.
+func (t *TopicMap) Metadata(function string) (FunctionMetadata, bool) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	metadata, ok := t.metadata[function]
+	return metadata, ok
+}
+
+// Binding gets the TopicBinding of a function matching topic, declared in
+// its topic-config annotation.
+func (t *TopicMap) Binding(topic, function string) (TopicBinding, bool) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	bindings := t.metadata[function].Bindings
+	if binding, ok := bindings[topic]; ok {
+		return binding, true
+	}
+	for key, binding := range bindings {
+		if t.matchFunc(topic, key) {
+			return binding, true
+		}
+	}
+	return TopicBinding{}, false
+}
+
 func (t *TopicMap) Topics() []string {
 	t.lock.RLock()
 	defer t.lock.RUnlock()
@@ -67,3 +104,16 @@ func (t *TopicMap) Topics() []string {
 
 	return topics
 }
+
+// Snapshot returns a copy of the functions subscribed to each topic, which
+// can be modified freely.
+func (t *TopicMap) Snapshot() map[string][]string {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	snapshot := make(map[string][]string, len(*t.lookup))
+	for topic, functions := range *t.lookup {
+		snapshot[topic] = append([]string(nil), functions...)
+	}
+	return snapshot
+}
@@ -0,0 +1,146 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import "sort"
+
+// TopicMapChange is the difference between the topic map before and after a
+// rebuild.
+type TopicMapChange struct {
+	// AddedTopics and RemovedTopics are the topics that gained their first
+	// function or lost their last one.
+	AddedTopics   []string
+	RemovedTopics []string
+
+	// AddedFunctions and RemovedFunctions are the functions subscribed to or
+	// unsubscribed from each topic, including the added and removed topics,
+	// in the order of the new and the previous map.
+	AddedFunctions   map[string][]string
+	RemovedFunctions map[string][]string
+}
+
+// Empty returns true if the topic map did not change.
+func (c TopicMapChange) Empty() bool {
+	return len(c.AddedFunctions) == 0 && len(c.RemovedFunctions) == 0
+}
+
+// diffTopicMaps returns the change from previous to current.
+func diffTopicMaps(previous, current map[string][]string) TopicMapChange {
+	change := TopicMapChange{
+		AddedFunctions:   map[string][]string{},
+		RemovedFunctions: map[string][]string{},
+	}
+
+	for topic, functions := range current {
+		if added := missingFrom(functions, previous[topic]); len(added) > 0 {
+			change.AddedFunctions[topic] = added
+		}
+		if len(previous[topic]) == 0 && len(functions) > 0 {
+			change.AddedTopics = append(change.AddedTopics, topic)
+		}
+	}
+	for topic, functions := range previous {
+		if removed := missingFrom(functions, current[topic]); len(removed) > 0 {
+			change.RemovedFunctions[topic] = removed
+		}
+		if len(current[topic]) == 0 && len(functions) > 0 {
+			change.RemovedTopics = append(change.RemovedTopics, topic)
+		}
+	}
+
+	sort.Strings(change.AddedTopics)
+	sort.Strings(change.RemovedTopics)
+	return change
+}
+
+// missingFrom returns the values of a that are not in b, in the order of a.
+func missingFrom(a, b []string) []string {
+	in := make(map[string]bool, len(b))
+	for _, value := range b {
+		in[value] = true
+	}
+
+	missing := []string{}
+	for _, value := range a {
+		if !in[value] {
+			missing = append(missing, value)
+			in[value] = true
+		}
+	}
+	return missing
+}
+
+// ApplyChange updates the lookups with the additions and removals of change
+// rather than replacing them: the functions that didn't change keep their
+// order, followed by the added ones, and the topics without a change keep
+// their functions. The metadata of the functions is replaced.
+func (t *TopicMap) ApplyChange(change TopicMapChange, metadata map[string]FunctionMetadata) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.applyChange(change, metadata)
+}
+
+// applyChange applies change like ApplyChange, with the lock held.
+func (t *TopicMap) applyChange(change TopicMapChange, metadata map[string]FunctionMetadata) {
+	// the lookups are copied on write, as they are read without the lock
+	updated := make(map[string][]string, len(*t.lookup)+len(change.AddedTopics))
+	for topic, functions := range *t.lookup {
+		updated[topic] = functions
+	}
+
+	for topic, removed := range change.RemovedFunctions {
+		kept := make([]string, 0, len(updated[topic]))
+		for _, function := range updated[topic] {
+			if !contains(removed, function) {
+				kept = append(kept, function)
+			}
+		}
+		if len(kept) == 0 {
+			delete(updated, topic)
+			continue
+		}
+		updated[topic] = kept
+	}
+
+	for topic, added := range change.AddedFunctions {
+		functions := make([]string, 0, len(updated[topic])+len(added))
+		functions = append(functions, updated[topic]...)
+		updated[topic] = append(functions, added...)
+	}
+
+	t.lookup = &updated
+	t.metadata = metadata
+}
+
+// syncChange applies the difference between the lookups of topicMap and
+// lookups, and returns it. The difference is computed and applied under the
+// same lock, so that concurrent syncs don't apply a change computed against
+// a map that was replaced in between.
+func syncChange(topicMap *TopicMap, lookups map[string][]string, metadata map[string]FunctionMetadata) TopicMapChange {
+	topicMap.lock.Lock()
+	defer topicMap.lock.Unlock()
+
+	change := diffTopicMaps(*topicMap.lookup, lookups)
+	topicMap.applyChange(change, metadata)
+	return change
+}
+
+// lookups returns the current lookups. They are replaced, never modified, by
+// the syncs, so they can be read without the lock.
+func (t *TopicMap) lookups() map[string][]string {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return *t.lookup
+}
+
+// functionMetadata returns the metadata of the functions, which must not be
+// modified.
+func (t *TopicMap) functionMetadata() map[string]FunctionMetadata {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return t.metadata
+}
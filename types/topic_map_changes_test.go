@@ -0,0 +1,151 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_diffTopicMaps(t *testing.T) {
+	previous := map[string][]string{
+		"orders":   {"billing", "audit"},
+		"invoices": {"billing"},
+	}
+	current := map[string][]string{
+		"orders":   {"audit", "shipping"},
+		"payments": {"billing"},
+	}
+
+	change := diffTopicMaps(previous, current)
+	want := TopicMapChange{
+		AddedTopics:   []string{"payments"},
+		RemovedTopics: []string{"invoices"},
+		AddedFunctions: map[string][]string{
+			"orders":   {"shipping"},
+			"payments": {"billing"},
+		},
+		RemovedFunctions: map[string][]string{
+			"orders":   {"billing"},
+			"invoices": {"billing"},
+		},
+	}
+	if !reflect.DeepEqual(change, want) {
+		t.Errorf("Change - want: %+v, got: %+v", want, change)
+	}
+
+	if change := diffTopicMaps(current, current); !change.Empty() {
+		t.Errorf("Change - want empty, got: %+v", change)
+	}
+}
+
+func Test_Controller_OnTopicMapChange(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"name":"echo","annotations":{"topic":"orders"}}]`))
+	}))
+	defer srv.Close()
+
+	changes := make(chan TopicMapChange, 2)
+	c := NewController(nil, &ControllerConfig{
+		GatewayURL:       srv.URL,
+		RebuildInterval:  time.Hour,
+		Namespace:        "openfaas-fn",
+		OnTopicMapChange: func(change TopicMapChange) { changes <- change },
+	}).(*controller)
+	defer c.Close()
+	c.BeginMapBuilder()
+
+	for i := 0; i < 2; i++ {
+		if err := c.RefreshTopicMap(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(changes) != 1 {
+		t.Fatalf("Changes - want: %d, got: %d", 1, len(changes))
+	}
+	if change := <-changes; !reflect.DeepEqual(change.AddedTopics, []string{"orders"}) {
+		t.Errorf("Added topics - want: %v, got: %v", []string{"orders"}, change.AddedTopics)
+	}
+}
+
+func Test_TopicMap_ApplyChange(t *testing.T) {
+	topicMap := newTestTopicMap(map[string][]string{
+		"orders":   {"a", "b", "c"},
+		"payments": {"p"},
+		"legacy":   {"old"},
+	})
+	payments := topicMap.lookups()["payments"]
+
+	change := syncChange(topicMap, map[string][]string{
+		"orders":   {"d", "c", "a", "e"},
+		"payments": {"p"},
+		"refunds":  {"r"},
+	}, nil)
+
+	want := map[string][]string{
+		"orders":   {"a", "c", "d", "e"},
+		"payments": {"p"},
+		"refunds":  {"r"},
+	}
+	if got := topicMap.Snapshot(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Lookups - want: %v, got: %v", want, got)
+	}
+	if &topicMap.lookups()["payments"][0] != &payments[0] {
+		t.Errorf("Lookups - want the functions of an unchanged topic kept as they were")
+	}
+	if !reflect.DeepEqual(change.AddedTopics, []string{"refunds"}) || !reflect.DeepEqual(change.RemovedTopics, []string{"legacy"}) {
+		t.Errorf("Change - want refunds added and legacy removed, got: %+v", change)
+	}
+	if want := []string{"d", "e"}; !reflect.DeepEqual(change.AddedFunctions["orders"], want) {
+		t.Errorf("Added functions - want: %v, got: %v", want, change.AddedFunctions["orders"])
+	}
+}
+
+func Test_syncChange_Concurrent(t *testing.T) {
+	topicMap := newTestTopicMap(map[string][]string{})
+	maps := []map[string][]string{
+		{"orders": {"a", "b"}},
+		{"orders": {"b", "c"}, "payments": {"p"}},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(lookups map[string][]string) {
+			defer wg.Done()
+			syncChange(topicMap, lookups, nil)
+		}(maps[i%len(maps)])
+	}
+	wg.Wait()
+
+	got := topicMap.Snapshot()
+	for _, lookups := range maps {
+		if len(got) != len(lookups) {
+			continue
+		}
+		same := true
+		for topic, functions := range lookups {
+			if !reflect.DeepEqual(sorted(got[topic]), sorted(functions)) {
+				same = false
+			}
+		}
+		if same {
+			return
+		}
+	}
+	t.Errorf("Lookups - want one of %v, got: %v", maps, got)
+}
+
+func sorted(values []string) []string {
+	values = append([]string(nil), values...)
+	sort.Strings(values)
+	return values
+}
@@ -0,0 +1,29 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_TopicMap_Snapshot(t *testing.T) {
+	topicMap := NewTopicMap(nil)
+	topicMap.Sync(&map[string][]string{"orders": {"billing", "audit"}})
+
+	snapshot := topicMap.Snapshot()
+	want := map[string][]string{"orders": {"billing", "audit"}}
+	if !reflect.DeepEqual(snapshot, want) {
+		t.Errorf("Snapshot - want: %v, got: %v", want, snapshot)
+	}
+
+	snapshot["orders"][0] = "shipping"
+	snapshot["payments"] = []string{"billing"}
+	if got := topicMap.Match("orders"); !reflect.DeepEqual(got, want["orders"]) {
+		t.Errorf("Functions of orders - want: %v, got: %v", want["orders"], got)
+	}
+	if got := topicMap.Topics(); len(got) != 1 {
+		t.Errorf("Topics - want: %d, got: %v", 1, got)
+	}
+}
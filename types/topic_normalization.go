@@ -0,0 +1,83 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import "strings"
+
+// TopicNormalization rewrites the topics declared by the functions before
+// they are added to the topic map, so that typos and case differences in the
+// annotations don't silently break the routing. The surrounding whitespace is
+// always trimmed, then the steps are applied in the order of the fields.
+type TopicNormalization struct {
+	// Lowercase lowercases the topics.
+	Lowercase bool
+
+	// StripPrefix is removed from the topics starting with it, after they
+	// are lowercased. It is lowercased too with Lowercase.
+	StripPrefix string
+
+	// Normalize rewrites each topic last, if set. A topic normalized to an
+	// empty string is skipped.
+	Normalize func(topic string) string
+}
+
+// apply returns the normalized topic.
+func (n TopicNormalization) apply(topic string) string {
+	topic = strings.TrimSpace(topic)
+	if n.Lowercase {
+		topic = strings.ToLower(topic)
+	}
+	if prefix := n.StripPrefix; len(prefix) > 0 {
+		if n.Lowercase {
+			prefix = strings.ToLower(prefix)
+		}
+		topic = strings.TrimPrefix(topic, prefix)
+	}
+	if n.Normalize != nil {
+		topic = n.Normalize(topic)
+	}
+	return topic
+}
+
+// lookups returns lookups keyed by the normalized topics, merging the
+// functions of the topics normalized to the same one.
+func (n TopicNormalization) lookups(lookups map[string][]string) map[string][]string {
+	normalized := make(map[string][]string, len(lookups))
+	for topic, functions := range lookups {
+		topic = n.apply(topic)
+		if len(topic) == 0 {
+			continue
+		}
+		for _, function := range functions {
+			if !contains(normalized[topic], function) {
+				normalized[topic] = append(normalized[topic], function)
+			}
+		}
+	}
+	return normalized
+}
+
+// metadata normalizes the topics of the bindings of each function.
+func (n TopicNormalization) metadata(metadata map[string]FunctionMetadata) {
+	for function, functionMetadata := range metadata {
+		functionMetadata.Bindings = n.bindings(functionMetadata.Bindings)
+		metadata[function] = functionMetadata
+	}
+}
+
+// bindings returns the bindings of metadata keyed by their normalized topic.
+func (n TopicNormalization) bindings(bindings map[string]TopicBinding) map[string]TopicBinding {
+	if len(bindings) == 0 {
+		return bindings
+	}
+
+	normalized := make(map[string]TopicBinding, len(bindings))
+	for _, binding := range bindings {
+		binding.Topic = n.apply(binding.Topic)
+		if len(binding.Topic) > 0 {
+			normalized[binding.Topic] = binding
+		}
+	}
+	return normalized
+}
@@ -0,0 +1,65 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import "context"
+
+// TopicSource builds the map of the topics to the functions subscribed to
+// them, from which the controller rebuilds its topic map. The default source
+// discovers the functions from their "topic" annotation, other sources can
+// read e.g. Kubernetes resources, Consul or a database.
+type TopicSource interface {
+	Build(ctx context.Context) (map[string][]string, error)
+}
+
+// MetadataTopicSource is a TopicSource also returning the metadata of the
+// functions, such as the headers added to their invocations.
+type MetadataTopicSource interface {
+	TopicSource
+	BuildWithMetadata(ctx context.Context) (map[string][]string, map[string]FunctionMetadata, error)
+}
+
+// AnnotationTopicSource is the TopicSource discovering the functions of the
+// gateway from their "topic" annotation.
+type AnnotationTopicSource struct {
+	Builder *FunctionLookupBuilder
+}
+
+// NewAnnotationTopicSource creates a TopicSource discovering the functions
+// with builder.
+func NewAnnotationTopicSource(builder *FunctionLookupBuilder) *AnnotationTopicSource {
+	return &AnnotationTopicSource{Builder: builder}
+}
+
+// Build lists the functions of the gateway and maps their topics. The
+// requests to the gateway, and the waits for the DiscoveryLimiter of the
+// builder, are abandoned when ctx is done.
+func (s *AnnotationTopicSource) Build(ctx context.Context) (map[string][]string, error) {
+	lookups, _, err := s.BuildWithMetadata(ctx)
+	return lookups, err
+}
+
+// BuildWithMetadata maps the topics of the functions like Build, along with
+// the metadata declared in their annotations.
+func (s *AnnotationTopicSource) BuildWithMetadata(ctx context.Context) (map[string][]string, map[string]FunctionMetadata, error) {
+	if err := ctx.Err(); err != nil {
+		return map[string][]string{}, map[string]FunctionMetadata{}, err
+	}
+	return s.Builder.buildWithMetadata(ctx)
+}
+
+// buildTopicSource builds the topics of source, with the metadata of the
+// functions if it is a MetadataTopicSource.
+func buildTopicSource(ctx context.Context, source TopicSource) (map[string][]string, map[string]FunctionMetadata, error) {
+	if source, ok := source.(MetadataTopicSource); ok {
+		lookups, metadata, err := source.BuildWithMetadata(ctx)
+		if metadata == nil {
+			metadata = map[string]FunctionMetadata{}
+		}
+		return lookups, metadata, err
+	}
+
+	lookups, err := source.Build(ctx)
+	return lookups, map[string]FunctionMetadata{}, err
+}
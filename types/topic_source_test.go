@@ -0,0 +1,76 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testTopicSource map[string][]string
+
+func (s testTopicSource) Build(ctx context.Context) (map[string][]string, error) {
+	lookups := map[string][]string{}
+	for topic, functions := range s {
+		lookups[topic] = append([]string(nil), functions...)
+	}
+	return lookups, nil
+}
+
+func Test_Controller_TopicSource(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Unexpected request to the gateway: %s", r.URL.Path)
+	}))
+	defer srv.Close()
+
+	c := NewController(nil, &ControllerConfig{
+		GatewayURL:      srv.URL,
+		RebuildInterval: time.Hour,
+		TopicSource:     testTopicSource{"orders": {"billing"}},
+		StaticTopics:    map[string][]string{"orders": {"audit"}},
+	}).(*controller)
+	defer c.Close()
+	c.BeginMapBuilder()
+
+	if err := c.RefreshTopicMap(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := c.TopicMap.Match("orders"), []string{"billing", "audit"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Functions of orders - want: %v, got: %v", want, got)
+	}
+}
+
+func Test_AnnotationTopicSource(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"name":"echo","annotations":{"topic":"orders","topic-headers":"X-Tenant=acme"}}]`))
+	}))
+	defer srv.Close()
+
+	source := NewAnnotationTopicSource(&FunctionLookupBuilder{
+		GatewayURL: srv.URL,
+		Client:     srv.Client(),
+		Namespace:  "openfaas-fn",
+	})
+
+	lookups, metadata, err := buildTopicSource(context.Background(), source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string][]string{"orders": {"echo.openfaas-fn"}}; !reflect.DeepEqual(lookups, want) {
+		t.Errorf("Lookups - want: %v, got: %v", want, lookups)
+	}
+	if len(metadata) != 1 {
+		t.Errorf("Metadata - want: %d function, got: %v", 1, metadata)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := source.Build(ctx); err != context.Canceled {
+		t.Errorf("Error - want: %v, got: %v", context.Canceled, err)
+	}
+}
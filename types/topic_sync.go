@@ -0,0 +1,38 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import "time"
+
+// defaultSyncRetryBackoff is the delay before the first retry of a failed
+// topic map rebuild when SyncRetryBackoff is not set.
+const defaultSyncRetryBackoff = time.Second
+
+// syncRetryDelay returns the delay before retrying a topic map rebuild after
+// failures consecutive failures: SyncRetryBackoff doubled after each failure,
+// up to RebuildInterval.
+func (c *controller) syncRetryDelay(failures int) time.Duration {
+	delay := c.Config.SyncRetryBackoff
+	if delay <= 0 {
+		delay = defaultSyncRetryBackoff
+	}
+
+	for n := 1; n < failures && delay < c.Config.RebuildInterval; n++ {
+		delay *= 2
+	}
+	if delay > c.Config.RebuildInterval {
+		delay = c.Config.RebuildInterval
+	}
+	return delay
+}
+
+// syncFailed reports a failed rebuild of the topic map to OnSyncError, or
+// logs it. The topic map built last is kept.
+func (c *controller) syncFailed(err error, failures int) {
+	if c.Config.OnSyncError != nil {
+		c.Config.OnSyncError(err, failures)
+		return
+	}
+	c.Logger.Errorf("Unable to sync the topic map (%d consecutive failures), keeping the last one: %s", failures, err)
+}
@@ -0,0 +1,81 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_Controller_SyncRetriesWithBackoff(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		if n <= 2 || n > 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`[{"name":"echo","annotations":{"topic":"orders"}}]`))
+	}))
+	defer srv.Close()
+
+	failures := make(chan int, 10)
+	c := NewController(nil, &ControllerConfig{
+		GatewayURL:       srv.URL,
+		RebuildInterval:  time.Minute,
+		Namespace:        "openfaas-fn",
+		SyncRetryBackoff: 10 * time.Millisecond,
+		OnSyncError: func(err error, n int) {
+			failures <- n
+		},
+	}).(*controller)
+	c.BeginMapBuilder()
+	defer c.Close()
+
+	for want := 1; want <= 2; want++ {
+		select {
+		case got := <-failures:
+			if got != want {
+				t.Errorf("Failures - want: %d, got: %d", want, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("want failure %d reported", want)
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for len(c.Topics()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if topics := c.Topics(); len(topics) != 1 || topics[0] != "orders" {
+		t.Fatalf("Topics - want: %v, got: %v", []string{"orders"}, topics)
+	}
+
+	if err := c.resync(); err == nil {
+		t.Fatal("want the failed sync reported")
+	}
+	if topics := c.Topics(); len(topics) != 1 {
+		t.Errorf("Topics - want the last topic map kept, got: %v", topics)
+	}
+}
+
+func Test_Controller_SyncRetryDelay(t *testing.T) {
+	c := &controller{Config: &ControllerConfig{RebuildInterval: 10 * time.Second}}
+
+	cases := map[int]time.Duration{
+		1: time.Second,
+		2: 2 * time.Second,
+		4: 8 * time.Second,
+		5: 10 * time.Second,
+		9: 10 * time.Second,
+	}
+	for failures, want := range cases {
+		if got := c.syncRetryDelay(failures); got != want {
+			t.Errorf("Delay after %d failures - want: %s, got: %s", failures, want, got)
+		}
+	}
+}
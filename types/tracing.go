@@ -0,0 +1,51 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+)
+
+// tracerName is the instrumentation name given to the TracerProvider.
+const tracerName = "github.com/flusflas/connector-sdk"
+
+// TracerProvider provides the Tracer used to instrument the invocations and
+// the topic map syncs. It mirrors the OpenTelemetry trace API, so an
+// OpenTelemetry TracerProvider can be plugged in with a thin adapter without
+// making the SDK depend on it.
+type TracerProvider interface {
+	Tracer(name string) Tracer
+}
+
+// Tracer starts spans.
+type Tracer interface {
+	// Start creates a span and returns a context containing it.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a single operation traced by a Tracer.
+type Span interface {
+	SetAttributes(attributes map[string]interface{})
+	RecordError(err error)
+	End()
+}
+
+// traceInvocation records the outcome of an invocation in a span.
+func traceInvocation(span Span, res InvokerResponse) {
+	span.SetAttributes(map[string]interface{}{
+		"faas.function":        res.Function,
+		"messaging.topic":      res.Topic,
+		"http.status_code":     res.Status,
+		"faas.duration_ms":     res.Duration.Milliseconds(),
+		"faas.async_callid":    res.CallID,
+		"messaging.message_id": res.MessageID,
+	})
+	if len(res.Tenant) > 0 {
+		span.SetAttributes(map[string]interface{}{"connector.tenant": res.Tenant})
+	}
+	if res.Error != nil {
+		span.RecordError(res.Error)
+	}
+	span.End()
+}
@@ -0,0 +1,117 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultDebugSignalTimeout is how long the verbosity raised by SIGUSR1
+// lasts when DebugSignalTimeout is not set.
+const defaultDebugSignalTimeout = 15 * time.Minute
+
+// verbosity is the log level and body printing changed at runtime, with the
+// settings to restore when a temporary change times out.
+type verbosity struct {
+	lock        sync.Mutex
+	printBodies int32
+	revert      *time.Timer
+
+	// saved is true while a temporary change is pending, with the level to
+	// restore.
+	saved bool
+	level LogLevel
+}
+
+// printingBodies returns true if the response bodies are printed.
+func (v *verbosity) printingBodies() bool {
+	return atomic.LoadInt32(&v.printBodies) == 1
+}
+
+// SetVerbosity changes the log level and enables printing the response bodies.
+// If revertAfter is positive, the previous level is restored and the bodies are
+// no longer printed once it has elapsed, so a live connector can be debugged
+// without being left verbose.
+func (c *controller) SetVerbosity(level LogLevel, printBodies bool, revertAfter time.Duration) error {
+	logger, ok := c.Logger.(interface {
+		SetLevel(LogLevel)
+		Level() LogLevel
+	})
+	if !ok {
+		return fmt.Errorf("the logger does not support changing the level")
+	}
+
+	v := &c.verbosity
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if v.revert != nil {
+		v.revert.Stop()
+		v.revert = nil
+	}
+
+	if revertAfter > 0 {
+		if !v.saved {
+			v.saved = true
+			v.level = logger.Level()
+		}
+		v.revert = time.AfterFunc(revertAfter, c.revertVerbosity)
+	} else {
+		v.saved = false
+	}
+
+	logger.SetLevel(level)
+	if printBodies {
+		atomic.StoreInt32(&v.printBodies, 1)
+	} else {
+		atomic.StoreInt32(&v.printBodies, 0)
+	}
+	return nil
+}
+
+// stop cancels the pending revert of a temporary change.
+func (v *verbosity) stop() {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if v.revert != nil {
+		v.revert.Stop()
+		v.revert = nil
+	}
+}
+
+// revertVerbosity restores the verbosity saved by a temporary change.
+func (c *controller) revertVerbosity() {
+	v := &c.verbosity
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if v.revert != nil {
+		v.revert.Stop()
+		v.revert = nil
+	}
+	if !v.saved {
+		return
+	}
+	v.saved = false
+
+	if logger, ok := c.Logger.(interface{ SetLevel(LogLevel) }); ok {
+		logger.SetLevel(v.level)
+	}
+	atomic.StoreInt32(&v.printBodies, 0)
+	c.Logger.Infof("Verbosity reverted to %s", v.level)
+}
+
+// printBody prints the body of a response while body printing is enabled at
+// runtime, unless the configured ResponsePrinter already prints it.
+func (c *controller) printBody(res InvokerResponse) {
+	if !c.verbosity.printingBodies() || (c.Config.PrintResponse && c.Config.PrintResponseBody) {
+		return
+	}
+	printer := ResponsePrinter{PrintResponseBody: true, MaxBodyLength: c.Config.PrintMaxBodyLength, Logger: c.Logger}
+	printer.Response(res)
+}
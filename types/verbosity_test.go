@@ -0,0 +1,37 @@
+// Copyright (c) OpenFaaS Author(s) 2019. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_SetVerbosity_RevertsAfterTimeout(t *testing.T) {
+	logger := NewStdLogger(LevelWarn)
+	c := NewController(nil, &ControllerConfig{
+		GatewayURL: "http://127.0.0.1:8080",
+		Logger:     logger,
+	}).(*controller)
+
+	if err := c.SetVerbosity(LevelDebug, true, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if logger.Level() != LevelDebug || !c.verbosity.printingBodies() {
+		t.Fatalf("Verbosity - want debug with bodies, got: %s (bodies: %v)", logger.Level(), c.verbosity.printingBodies())
+	}
+
+	// Raising again keeps the level saved by the first change.
+	if err := c.SetVerbosity(LevelInfo, true, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for c.verbosity.printingBodies() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if logger.Level() != LevelWarn || c.verbosity.printingBodies() {
+		t.Errorf("Verbosity - want reverted to warn without bodies, got: %s (bodies: %v)", logger.Level(), c.verbosity.printingBodies())
+	}
+}